@@ -0,0 +1,210 @@
+// Package auth verifies the bearer tokens of API requests: JWTs signed with a key of the issuer's JWKS.
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+)
+
+// DefaultLeeway - clock skew tolerated on the expiry and not-before times of tokens.
+const DefaultLeeway = time.Minute
+
+var (
+	ErrMalformedToken       = errors.New("malformed token")
+	ErrUnsupportedAlgorithm = errors.New("unsupported signing algorithm")
+	ErrUnknownKey           = errors.New("unknown signing key")
+	ErrInvalidSignature     = errors.New("invalid token signature")
+	ErrExpired              = errors.New("token expired")
+	ErrNotYetValid          = errors.New("token not valid yet")
+	ErrInvalidIssuer        = errors.New("invalid token issuer")
+	ErrInvalidAudience      = errors.New("invalid token audience")
+	ErrMissingSubject       = errors.New("token has no subject")
+)
+
+// KeySource - Public keys tokens are signed with, by key ID.
+type KeySource interface {
+	Key(kid string) (crypto.PublicKey, error)
+}
+
+// Audience - "aud" claim, either a single string or an array of strings.
+type Audience []string
+
+// UnmarshalJSON - implements json.Unmarshaler
+func (a *Audience) UnmarshalJSON(b []byte) error {
+	var single string
+	if err := json.Unmarshal(b, &single); err == nil {
+		*a = Audience{single}
+		return nil
+	}
+	var many []string
+	if err := json.Unmarshal(b, &many); err != nil {
+		return err
+	}
+	*a = many
+	return nil
+}
+
+// Contains - Whether aud is one of the audiences.
+func (a Audience) Contains(aud string) bool {
+	for _, v := range a {
+		if v == aud {
+			return true
+		}
+	}
+	return false
+}
+
+// Claims - Registered claims of a verified token.
+type Claims struct {
+	Subject   string   `json:"sub"`
+	Issuer    string   `json:"iss"`
+	Audience  Audience `json:"aud"`
+	ExpiresAt *float64 `json:"exp"`
+	NotBefore *float64 `json:"nbf"`
+}
+
+// header - JOSE header of a token.
+type header struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+}
+
+// Verifier - Checks the signature and registered claims of tokens. An empty Issuer or Audience is not checked.
+type Verifier struct {
+	Issuer   string
+	Audience string
+	Keys     KeySource
+	Leeway   time.Duration
+
+	now func() time.Time
+}
+
+// NewVerifier - Verifier of the tokens of issuer for audience, signed with keys.
+func NewVerifier(issuer string, audience string, keys KeySource) *Verifier {
+	return &Verifier{Issuer: issuer, Audience: audience, Keys: keys, Leeway: DefaultLeeway, now: time.Now}
+}
+
+// Verify - Claims of token once its signature, issuer, audience and validity period are checked.
+func (v *Verifier) Verify(token string) (Claims, error) {
+
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return Claims{}, ErrMalformedToken
+	}
+
+	var h header
+	if err := decodeSegment(parts[0], &h); err != nil {
+		return Claims{}, ErrMalformedToken
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return Claims{}, ErrMalformedToken
+	}
+
+	key, err := v.Keys.Key(h.Kid)
+	if err != nil {
+		return Claims{}, err
+	}
+	if err := verifySignature(h.Alg, key, parts[0]+"."+parts[1], signature); err != nil {
+		return Claims{}, err
+	}
+
+	var claims Claims
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return Claims{}, ErrMalformedToken
+	}
+	return claims, v.checkClaims(claims)
+}
+
+// checkClaims - Check the registered claims of a token whose signature is valid.
+func (v *Verifier) checkClaims(claims Claims) error {
+	now := v.now()
+
+	if claims.ExpiresAt == nil || now.After(numericDate(*claims.ExpiresAt).Add(v.Leeway)) {
+		return ErrExpired
+	}
+	if claims.NotBefore != nil && now.Before(numericDate(*claims.NotBefore).Add(-v.Leeway)) {
+		return ErrNotYetValid
+	}
+	if v.Issuer != "" && claims.Issuer != v.Issuer {
+		return ErrInvalidIssuer
+	}
+	if v.Audience != "" && !claims.Audience.Contains(v.Audience) {
+		return ErrInvalidAudience
+	}
+	if claims.Subject == "" {
+		return ErrMissingSubject
+	}
+	return nil
+}
+
+// curveBits - Size of the curve each ECDSA algorithm signs with.
+var curveBits = map[string]int{"ES256": 256, "ES384": 384, "ES512": 521}
+
+// verifySignature - Check signature of signed with key, using alg. The algorithm must match the key type, so that
+// a token cannot pick a weaker check than the key was issued for.
+func verifySignature(alg string, key crypto.PublicKey, signed string, signature []byte) error {
+
+	var hash crypto.Hash
+	switch alg {
+	case "RS256", "ES256":
+		hash = crypto.SHA256
+	case "RS384", "ES384":
+		hash = crypto.SHA384
+	case "RS512", "ES512":
+		hash = crypto.SHA512
+	default:
+		return fmt.Errorf("%w: %q", ErrUnsupportedAlgorithm, alg)
+	}
+	h := hash.New()
+	h.Write([]byte(signed))
+	digest := h.Sum(nil)
+
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		if !strings.HasPrefix(alg, "RS") {
+			return fmt.Errorf("%w: %q with an RSA key", ErrUnsupportedAlgorithm, alg)
+		}
+		if rsa.VerifyPKCS1v15(k, hash, digest, signature) != nil {
+			return ErrInvalidSignature
+		}
+	case *ecdsa.PublicKey:
+		if curveBits[alg] != k.Curve.Params().BitSize {
+			return fmt.Errorf("%w: %q with a %s key", ErrUnsupportedAlgorithm, alg, k.Curve.Params().Name)
+		}
+		size := (k.Curve.Params().BitSize + 7) / 8
+		if len(signature) != 2*size {
+			return ErrInvalidSignature
+		}
+		r := new(big.Int).SetBytes(signature[:size])
+		s := new(big.Int).SetBytes(signature[size:])
+		if !ecdsa.Verify(k, digest, r, s) {
+			return ErrInvalidSignature
+		}
+	default:
+		return ErrUnknownKey
+	}
+	return nil
+}
+
+// decodeSegment - Decode a base64url JSON segment of a token into v.
+func decodeSegment(segment string, v interface{}) error {
+	raw, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(raw, v)
+}
+
+// numericDate - Time of a JWT NumericDate, in seconds since the epoch.
+func numericDate(seconds float64) time.Time {
+	return time.Unix(0, int64(seconds*float64(time.Second)))
+}
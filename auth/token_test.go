@@ -0,0 +1,236 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+var testNow = time.Date(2021, 10, 18, 12, 0, 0, 0, time.UTC)
+
+func encodeSegment(t *testing.T, v interface{}) string {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+// signRS256 - Token of claims signed by key with RS256.
+func signRS256(t *testing.T, key *rsa.PrivateKey, kid string, claims map[string]interface{}) string {
+	signed := encodeSegment(t, map[string]string{"alg": "RS256", "kid": kid}) + "." + encodeSegment(t, claims)
+	digest := sha256.Sum256([]byte(signed))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+// signES256 - Token of claims signed by key with ES256.
+func signES256(t *testing.T, key *ecdsa.PrivateKey, kid string, claims map[string]interface{}) string {
+	signed := encodeSegment(t, map[string]string{"alg": "ES256", "kid": kid}) + "." + encodeSegment(t, claims)
+	digest := sha256.Sum256([]byte(signed))
+	r, s, err := ecdsa.Sign(rand.Reader, key, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	signature := make([]byte, 64)
+	r.FillBytes(signature[:32])
+	s.FillBytes(signature[32:])
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func encodeBigInt(i *big.Int) string {
+	return base64.RawURLEncoding.EncodeToString(i.Bytes())
+}
+
+type TestCaseVerify struct {
+	name             string
+	token            string
+	expectedSubject  string
+	expectedErr      error
+	expectedFetchErr bool
+}
+
+func TestVerify(t *testing.T) {
+
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	otherKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+
+	var fetches int32
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&fetches, 1)
+		json.NewEncoder(rw).Encode(map[string]interface{}{"keys": []map[string]string{
+			{"kty": "RSA", "kid": "rsa-1", "use": "sig", "n": encodeBigInt(rsaKey.N), "e": encodeBigInt(big.NewInt(int64(rsaKey.E)))},
+			{"kty": "EC", "kid": "ec-1", "crv": "P-256", "x": encodeBigInt(ecKey.X), "y": encodeBigInt(ecKey.Y)},
+			{"kty": "oct", "kid": "hmac-1", "k": "c2VjcmV0"},
+		}})
+	}))
+	defer server.Close()
+
+	verifier := NewVerifier("https://issuer.example", "connections", NewJWKS(server.URL, server.Client()))
+	verifier.now = func() time.Time { return testNow }
+
+	claims := func(overrides map[string]interface{}) map[string]interface{} {
+		c := map[string]interface{}{
+			"sub": "dc9dbe3e-60d5-4a07-8c9c-42027b555b93",
+			"iss": "https://issuer.example",
+			"aud": []string{"other", "connections"},
+			"exp": testNow.Add(time.Hour).Unix(),
+			"nbf": testNow.Add(-time.Hour).Unix(),
+		}
+		for k, v := range overrides {
+			if v == nil {
+				delete(c, k)
+			} else {
+				c[k] = v
+			}
+		}
+		return c
+	}
+	valid := signRS256(t, rsaKey, "rsa-1", claims(nil))
+
+	testCases := []TestCaseVerify{
+		{
+			name:            "RS256",
+			token:           valid,
+			expectedSubject: "dc9dbe3e-60d5-4a07-8c9c-42027b555b93",
+		},
+		{
+			name:            "ES256",
+			token:           signES256(t, ecKey, "ec-1", claims(map[string]interface{}{"aud": "connections"})),
+			expectedSubject: "dc9dbe3e-60d5-4a07-8c9c-42027b555b93",
+		},
+		{
+			name:            "WithinLeeway",
+			token:           signRS256(t, rsaKey, "rsa-1", claims(map[string]interface{}{"exp": testNow.Add(-30 * time.Second).Unix()})),
+			expectedSubject: "dc9dbe3e-60d5-4a07-8c9c-42027b555b93",
+		},
+		{
+			name:        "Expired",
+			token:       signRS256(t, rsaKey, "rsa-1", claims(map[string]interface{}{"exp": testNow.Add(-time.Hour).Unix()})),
+			expectedErr: ErrExpired,
+		},
+		{
+			name:        "NoExpiry",
+			token:       signRS256(t, rsaKey, "rsa-1", claims(map[string]interface{}{"exp": nil})),
+			expectedErr: ErrExpired,
+		},
+		{
+			name:        "NotYetValid",
+			token:       signRS256(t, rsaKey, "rsa-1", claims(map[string]interface{}{"nbf": testNow.Add(time.Hour).Unix()})),
+			expectedErr: ErrNotYetValid,
+		},
+		{
+			name:        "OtherIssuer",
+			token:       signRS256(t, rsaKey, "rsa-1", claims(map[string]interface{}{"iss": "https://attacker.example"})),
+			expectedErr: ErrInvalidIssuer,
+		},
+		{
+			name:        "OtherAudience",
+			token:       signRS256(t, rsaKey, "rsa-1", claims(map[string]interface{}{"aud": "other"})),
+			expectedErr: ErrInvalidAudience,
+		},
+		{
+			name:        "NoSubject",
+			token:       signRS256(t, rsaKey, "rsa-1", claims(map[string]interface{}{"sub": nil})),
+			expectedErr: ErrMissingSubject,
+		},
+		{
+			name:        "SignedByOtherKey",
+			token:       signRS256(t, otherKey, "rsa-1", claims(nil)),
+			expectedErr: ErrInvalidSignature,
+		},
+		{
+			name:        "UnknownKey",
+			token:       signRS256(t, otherKey, "rsa-2", claims(nil)),
+			expectedErr: ErrUnknownKey,
+		},
+		{
+			name:        "AlgorithmNone",
+			token:       encodeSegment(t, map[string]string{"alg": "none", "kid": "rsa-1"}) + "." + encodeSegment(t, claims(nil)) + ".",
+			expectedErr: ErrUnsupportedAlgorithm,
+		},
+		{
+			name:        "AlgorithmOfOtherKeyType",
+			token:       signES256(t, ecKey, "rsa-1", claims(nil)),
+			expectedErr: ErrUnsupportedAlgorithm,
+		},
+		{
+			name:        "Malformed",
+			token:       "not-a-token",
+			expectedErr: ErrMalformedToken,
+		},
+	}
+
+	for _, test := range testCases {
+
+		t.Run(test.name, func(t *testing.T) {
+			claims, err := verifier.Verify(test.token)
+			if !errors.Is(err, test.expectedErr) {
+				t.Fatalf("error %v != %v", err, test.expectedErr)
+			}
+			if err == nil && claims.Subject != test.expectedSubject {
+				t.Fatalf("subject %s != %s", claims.Subject, test.expectedSubject)
+			}
+		})
+	}
+
+	// Unknown keys are looked up at most once per refresh interval.
+	if n := atomic.LoadInt32(&fetches); n != 1 {
+		t.Fatalf("JWKS fetched %d times", n)
+	}
+}
+
+func TestJWKSRefreshesOnUnknownKey(t *testing.T) {
+
+	oldKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	newKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+
+	published := map[string]*rsa.PrivateKey{"old": oldKey}
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		keys := []map[string]string{}
+		for kid, key := range published {
+			keys = append(keys, map[string]string{"kty": "RSA", "kid": kid, "n": encodeBigInt(key.N), "e": encodeBigInt(big.NewInt(int64(key.E)))})
+		}
+		json.NewEncoder(rw).Encode(map[string]interface{}{"keys": keys})
+	}))
+	defer server.Close()
+
+	now := testNow
+	jwks := NewJWKS(server.URL, server.Client())
+	jwks.now = func() time.Time { return now }
+	verifier := NewVerifier("", "", jwks)
+	verifier.now = func() time.Time { return testNow }
+
+	claims := map[string]interface{}{"sub": "user_1", "exp": testNow.Add(time.Hour).Unix()}
+	if _, err := verifier.Verify(signRS256(t, oldKey, "old", claims)); err != nil {
+		t.Fatal(err)
+	}
+
+	// The issuer rotates its key.
+	published["new"] = newKey
+	token := signRS256(t, newKey, "new", claims)
+	if _, err := verifier.Verify(token); !errors.Is(err, ErrUnknownKey) {
+		t.Fatalf("key fetched again within the refresh interval: %v", err)
+	}
+
+	now = now.Add(DefaultRefreshInterval)
+	if _, err := verifier.Verify(token); err != nil {
+		t.Fatal(err)
+	}
+}
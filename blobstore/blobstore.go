@@ -0,0 +1,53 @@
+package blobstore
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"regexp"
+)
+
+// ErrNotFound - returned when no blob is stored under a key.
+var ErrNotFound = errors.New("blob not found")
+
+// ErrInvalidKey - returned for keys that could escape the store namespace.
+var ErrInvalidKey = errors.New("invalid blob key")
+
+// Info - Metadata of a stored blob.
+type Info struct {
+	Key         string
+	Size        int64
+	ContentType string
+	// ETag - opaque validator of the blob content.
+	ETag string
+}
+
+// BlobStore - Storage of binary objects such as group pictures.
+type BlobStore interface {
+	// Put - Store size bytes read from r under key, replacing any existing blob. size may be -1 when unknown.
+	Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error
+	// Get - Open the blob stored under key. The caller closes the reader.
+	Get(ctx context.Context, key string) (io.ReadCloser, Info, error)
+	// Stat - Metadata of the blob stored under key.
+	Stat(ctx context.Context, key string) (Info, error)
+	// Delete - Remove the blob stored under key. Deleting a missing blob is not an error.
+	Delete(ctx context.Context, key string) error
+}
+
+// ContentKey - Key derived from the content hash, so identical content maps to the same blob.
+func ContentKey(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+var validKey = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]{1,254}$`)
+
+// ValidateKey - Reject keys containing path separators or other unexpected characters.
+func ValidateKey(key string) error {
+	if !validKey.MatchString(key) {
+		return ErrInvalidKey
+	}
+	return nil
+}
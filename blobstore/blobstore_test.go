@@ -0,0 +1,149 @@
+package blobstore
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/minio/minio-go/v7"
+)
+
+// testBlobStore - Behaviour every BlobStore implementation must share.
+func testBlobStore(t *testing.T, store BlobStore) {
+	ctx := context.Background()
+	data := []byte("\x89PNG\r\n\x1a\nnot really a picture")
+	key := ContentKey(data)
+
+	if _, err := store.Stat(ctx, key); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Stat of missing blob: %v != %v", err, ErrNotFound)
+	}
+	if _, _, err := store.Get(ctx, key); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Get of missing blob: %v != %v", err, ErrNotFound)
+	}
+
+	if err := store.Put(ctx, key, bytes.NewReader(data), int64(len(data)), "image/png"); err != nil {
+		t.Fatalf("Put: %s", err.Error())
+	}
+
+	r, info, err := store.Get(ctx, key)
+	if err != nil {
+		t.Fatalf("Get: %s", err.Error())
+	}
+	got, err := io.ReadAll(r)
+	r.Close()
+	if err != nil {
+		t.Fatalf("read: %s", err.Error())
+	}
+	if !bytes.Equal(got, data) {
+		t.Fatalf("content %q != %q", got, data)
+	}
+	if info.Size != int64(len(data)) || info.ContentType != "image/png" || info.ETag == "" {
+		t.Fatalf("unexpected info: %+v", info)
+	}
+
+	if err := store.Put(ctx, "../escape", bytes.NewReader(data), int64(len(data)), "image/png"); !errors.Is(err, ErrInvalidKey) {
+		t.Fatalf("Put with traversal key: %v != %v", err, ErrInvalidKey)
+	}
+
+	if err := store.Delete(ctx, key); err != nil {
+		t.Fatalf("Delete: %s", err.Error())
+	}
+	if err := store.Delete(ctx, key); err != nil {
+		t.Fatalf("Delete of missing blob: %s", err.Error())
+	}
+	if _, err := store.Stat(ctx, key); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Stat after delete: %v != %v", err, ErrNotFound)
+	}
+}
+
+func TestMemory(t *testing.T) {
+	testBlobStore(t, NewMemory())
+}
+
+func TestFilesystem(t *testing.T) {
+	store, err := NewFilesystem(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	testBlobStore(t, store)
+
+	// An interrupted upload leaves neither the blob nor temporary files behind.
+	ctx := context.Background()
+	data := []byte("GIF89a interrupted upload")
+	key := ContentKey(data)
+	failing := io.MultiReader(bytes.NewReader(data), iotestErrReader{})
+	if err := store.Put(ctx, key, failing, int64(len(data)), "image/gif"); err == nil {
+		t.Fatal("Put of a failing reader succeeded")
+	}
+	if _, err := store.Stat(ctx, key); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Stat after failed Put: %v != %v", err, ErrNotFound)
+	}
+
+	if err := store.Put(ctx, key, bytes.NewReader(data), int64(len(data)), "image/gif"); err != nil {
+		t.Fatalf("Put: %s", err.Error())
+	}
+	entries, err := os.ReadDir(filepath.Dir(store.path(key)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := []string{}
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	if len(names) != 2 || names[0] != key || names[1] != key+".meta" {
+		t.Fatalf("unexpected files %v", names)
+	}
+}
+
+// iotestErrReader - Reader failing like a dropped connection.
+type iotestErrReader struct{}
+
+func (iotestErrReader) Read(p []byte) (int, error) {
+	return 0, io.ErrUnexpectedEOF
+}
+
+// TestS3 - Runs against a local S3 stand-in such as MinIO:
+//
+//	docker run -p 9000:9000 minio/minio server /data
+//	BLOBSTORE_S3_ENDPOINT=localhost:9000 BLOBSTORE_S3_BUCKET=test go test ./blobstore
+func TestS3(t *testing.T) {
+	endpoint := os.Getenv("BLOBSTORE_S3_ENDPOINT")
+	if endpoint == "" {
+		t.Skip("BLOBSTORE_S3_ENDPOINT not set")
+	}
+
+	opts := S3Options{
+		Endpoint:  endpoint,
+		Bucket:    os.Getenv("BLOBSTORE_S3_BUCKET"),
+		AccessKey: envOr("BLOBSTORE_S3_ACCESS_KEY", "minioadmin"),
+		SecretKey: envOr("BLOBSTORE_S3_SECRET_KEY", "minioadmin"),
+		Prefix:    "test/",
+	}
+
+	store, err := NewS3(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	if exists, err := store.client.BucketExists(ctx, opts.Bucket); err != nil {
+		t.Fatal(err)
+	} else if !exists {
+		if err := store.client.MakeBucket(ctx, opts.Bucket, minio.MakeBucketOptions{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	testBlobStore(t, store)
+}
+
+func envOr(name, fallback string) string {
+	if value := os.Getenv(name); value != "" {
+		return value
+	}
+	return fallback
+}
@@ -0,0 +1,149 @@
+package blobstore
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// Filesystem - BlobStore keeping each blob as a file under Root, with its metadata in a sidecar file.
+type Filesystem struct {
+	Root string
+}
+
+// NewFilesystem - Initialize Filesystem blob store, creating root if needed
+func NewFilesystem(root string) (*Filesystem, error) {
+	if err := os.MkdirAll(root, 0o750); err != nil {
+		return nil, err
+	}
+	return &Filesystem{Root: root}, nil
+}
+
+// path - Location of the blob, sharded by the first two key characters to keep directories small.
+func (f *Filesystem) path(key string) string {
+	return filepath.Join(f.Root, key[:2], key)
+}
+
+// Put - function
+func (f *Filesystem) Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error {
+	if err := ValidateKey(key); err != nil {
+		return err
+	}
+
+	dir := filepath.Dir(f.path(key))
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(dir, ".upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	hash := sha256.New()
+	written, err := io.Copy(io.MultiWriter(tmp, hash), r)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	info := Info{Key: key, Size: written, ContentType: contentType, ETag: hex.EncodeToString(hash.Sum(nil))}
+	meta, err := json.Marshal(info)
+	if err != nil {
+		return err
+	}
+
+	// Blobs exist once their metadata does, so the data goes in place first and the metadata last.
+	if err := os.Rename(tmp.Name(), f.path(key)); err != nil {
+		return err
+	}
+	return writeFileAtomically(dir, f.path(key)+".meta", meta)
+}
+
+// writeFileAtomically - Write data to a temporary file of dir, then rename it to name, so that readers never see
+// a partial file.
+func writeFileAtomically(dir string, name string, data []byte) error {
+	tmp, err := os.CreateTemp(dir, ".meta-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = tmp.Write(data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0o640); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), name)
+}
+
+// Get - function
+func (f *Filesystem) Get(ctx context.Context, key string) (io.ReadCloser, Info, error) {
+	info, err := f.Stat(ctx, key)
+	if err != nil {
+		return nil, info, err
+	}
+
+	file, err := os.Open(f.path(key))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, Info{}, ErrNotFound
+	}
+	if err != nil {
+		return nil, Info{}, err
+	}
+
+	return file, info, nil
+}
+
+// Stat - function
+func (f *Filesystem) Stat(ctx context.Context, key string) (Info, error) {
+	var info Info
+
+	if err := ValidateKey(key); err != nil {
+		return info, ErrNotFound
+	}
+
+	meta, err := os.ReadFile(f.path(key) + ".meta")
+	if errors.Is(err, fs.ErrNotExist) {
+		return info, ErrNotFound
+	}
+	if err != nil {
+		return info, err
+	}
+
+	if err := json.Unmarshal(meta, &info); err != nil {
+		return info, err
+	}
+
+	return info, nil
+}
+
+// Delete - function
+func (f *Filesystem) Delete(ctx context.Context, key string) error {
+	if err := ValidateKey(key); err != nil {
+		return nil
+	}
+
+	for _, p := range []string{f.path(key), f.path(key) + ".meta"} {
+		if err := os.Remove(p); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+	}
+
+	return nil
+}
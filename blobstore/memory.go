@@ -0,0 +1,80 @@
+package blobstore
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"sync"
+)
+
+type memoryBlob struct {
+	data []byte
+	info Info
+}
+
+// Memory - BlobStore keeping blobs in process memory.
+type Memory struct {
+	mx    sync.RWMutex
+	blobs map[string]memoryBlob
+}
+
+// NewMemory - Initialize Memory blob store
+func NewMemory() *Memory {
+	return &Memory{blobs: make(map[string]memoryBlob)}
+}
+
+// Put - function
+func (m *Memory) Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error {
+	if err := ValidateKey(key); err != nil {
+		return err
+	}
+
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+
+	m.mx.Lock()
+	m.blobs[key] = memoryBlob{
+		data: data,
+		info: Info{Key: key, Size: int64(len(data)), ContentType: contentType, ETag: ContentKey(data)},
+	}
+	m.mx.Unlock()
+
+	return nil
+}
+
+// Get - function
+func (m *Memory) Get(ctx context.Context, key string) (io.ReadCloser, Info, error) {
+	m.mx.RLock()
+	blob, ok := m.blobs[key]
+	m.mx.RUnlock()
+
+	if !ok {
+		return nil, Info{}, ErrNotFound
+	}
+
+	return io.NopCloser(bytes.NewReader(blob.data)), blob.info, nil
+}
+
+// Stat - function
+func (m *Memory) Stat(ctx context.Context, key string) (Info, error) {
+	m.mx.RLock()
+	blob, ok := m.blobs[key]
+	m.mx.RUnlock()
+
+	if !ok {
+		return Info{}, ErrNotFound
+	}
+
+	return blob.info, nil
+}
+
+// Delete - function
+func (m *Memory) Delete(ctx context.Context, key string) error {
+	m.mx.Lock()
+	delete(m.blobs, key)
+	m.mx.Unlock()
+
+	return nil
+}
@@ -0,0 +1,113 @@
+package blobstore
+
+import (
+	"context"
+	"io"
+	"strings"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+// S3Options - Connection settings of an S3-compatible object store.
+type S3Options struct {
+	Endpoint  string
+	Region    string
+	Bucket    string
+	AccessKey string
+	SecretKey string
+	UseSSL    bool
+	// Prefix prepended to every key, e.g. "group-pictures/".
+	Prefix string
+}
+
+// S3 - BlobStore backed by an S3-compatible object store (AWS S3, GCS interoperability, MinIO).
+type S3 struct {
+	client *minio.Client
+	bucket string
+	prefix string
+}
+
+// NewS3 - Initialize S3 blob store
+func NewS3(opts S3Options) (*S3, error) {
+	client, err := minio.New(opts.Endpoint, &minio.Options{
+		Creds:  credentials.NewStaticV4(opts.AccessKey, opts.SecretKey, ""),
+		Secure: opts.UseSSL,
+		Region: opts.Region,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &S3{client: client, bucket: opts.Bucket, prefix: opts.Prefix}, nil
+}
+
+// isNotFound - Whether err reports a missing object or bucket.
+func isNotFound(err error) bool {
+	code := minio.ToErrorResponse(err).Code
+	return code == "NoSuchKey" || code == "NoSuchBucket" || code == "NotFound"
+}
+
+// Put - function
+func (s *S3) Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error {
+	if err := ValidateKey(key); err != nil {
+		return err
+	}
+
+	_, err := s.client.PutObject(ctx, s.bucket, s.prefix+key, r, size, minio.PutObjectOptions{ContentType: contentType})
+	return err
+}
+
+// Get - function
+func (s *S3) Get(ctx context.Context, key string) (io.ReadCloser, Info, error) {
+	info, err := s.Stat(ctx, key)
+	if err != nil {
+		return nil, info, err
+	}
+
+	object, err := s.client.GetObject(ctx, s.bucket, s.prefix+key, minio.GetObjectOptions{})
+	if err != nil {
+		if isNotFound(err) {
+			return nil, Info{}, ErrNotFound
+		}
+		return nil, Info{}, err
+	}
+
+	return object, info, nil
+}
+
+// Stat - function
+func (s *S3) Stat(ctx context.Context, key string) (Info, error) {
+	if err := ValidateKey(key); err != nil {
+		return Info{}, ErrNotFound
+	}
+
+	object, err := s.client.StatObject(ctx, s.bucket, s.prefix+key, minio.StatObjectOptions{})
+	if err != nil {
+		if isNotFound(err) {
+			return Info{}, ErrNotFound
+		}
+		return Info{}, err
+	}
+
+	return Info{
+		Key:         key,
+		Size:        object.Size,
+		ContentType: object.ContentType,
+		ETag:        strings.Trim(object.ETag, `"`),
+	}, nil
+}
+
+// Delete - function
+func (s *S3) Delete(ctx context.Context, key string) error {
+	if err := ValidateKey(key); err != nil {
+		return nil
+	}
+
+	err := s.client.RemoveObject(ctx, s.bucket, s.prefix+key, minio.RemoveObjectOptions{})
+	if err != nil && !isNotFound(err) {
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,46 @@
+// connections-config prints the effective service configuration.
+//
+// Usage:
+//
+//	connections-config dump [--config file] [server configuration flags]
+//
+// It resolves the configuration exactly like the server does (defaults, file,
+// CONNECTIONS_* environment variables, flags), validates it and prints it as
+// JSON with credentials redacted. It exits non-zero when the configuration is invalid.
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"learning/unit-testing/config"
+
+	flags "github.com/jessevdk/go-flags"
+)
+
+func main() {
+	if len(os.Args) < 2 || os.Args[1] != "dump" {
+		fmt.Fprintln(os.Stderr, "usage: connections-config dump [--config file] [flags]")
+		os.Exit(2)
+	}
+
+	var opts config.Flags
+	if _, err := flags.ParseArgs(&opts, os.Args[2:]); err != nil {
+		os.Exit(2)
+	}
+
+	cfg, err := config.Load(opts, nil)
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	if encodeErr := encoder.Encode(cfg.Redacted()); encodeErr != nil {
+		fmt.Fprintln(os.Stderr, encodeErr)
+		os.Exit(1)
+	}
+
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,527 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Storage backends.
+const (
+	BackendFirestore = "firestore"
+	BackendMemory    = "memory"
+)
+
+// Blob store backends.
+const (
+	BlobBackendMemory     = "memory"
+	BlobBackendFilesystem = "filesystem"
+	BlobBackendS3         = "s3"
+)
+
+// Event sinks.
+const (
+	EventSinkChannel = "channel"
+	EventSinkFile    = "file"
+	EventSinkWebhook = "webhook"
+	EventSinkNATS    = "nats"
+	// EventSinkSubscriptions - queue the webhook deliveries of the subscriptions of the users.
+	EventSinkSubscriptions = "subscriptions"
+)
+
+// Config - Effective service configuration.
+type Config struct {
+	Storage     StorageConfig     `json:"storage"`
+	Blobs       BlobConfig        `json:"blobs"`
+	Images      ImageConfig       `json:"images"`
+	Pictures    PictureQueue      `json:"pictures"`
+	Idempotency IdempotencyConfig `json:"idempotency"`
+	GroupNames  GroupNameConfig   `json:"group_names"`
+	Trash       TrashConfig       `json:"trash"`
+	Events      EventsConfig      `json:"events"`
+	Webhooks    WebhooksConfig    `json:"webhooks"`
+	Stream      StreamConfig      `json:"stream"`
+	Sync        SyncConfig        `json:"sync"`
+	Pagination  PaginationConfig  `json:"pagination"`
+	Auth        AuthConfig        `json:"auth"`
+	Tracing     TracingConfig     `json:"tracing"`
+}
+
+// StorageConfig - Storage backend selection.
+type StorageConfig struct {
+	// Backend is either "firestore" or "memory".
+	Backend string `json:"backend"`
+	// DSN of the backend, e.g. firestore://my-project?credentials=/etc/sa.json.
+	// Empty lets the Firebase SDK discover the project from the environment.
+	DSN string `json:"dsn"`
+}
+
+// BlobConfig - Where group pictures are stored.
+type BlobConfig struct {
+	// Backend is "memory", "filesystem" or "s3".
+	Backend string `json:"backend"`
+	// Dir of the filesystem backend.
+	Dir string   `json:"dir"`
+	S3  S3Config `json:"s3"`
+}
+
+// S3Config - S3-compatible object store settings.
+type S3Config struct {
+	Endpoint  string `json:"endpoint"`
+	Region    string `json:"region"`
+	Bucket    string `json:"bucket"`
+	AccessKey string `json:"access_key"`
+	SecretKey string `json:"secret_key"`
+	UseSSL    bool   `json:"use_ssl"`
+	Prefix    string `json:"prefix"`
+}
+
+// ImageConfig - Limits applied to group pictures.
+type ImageConfig struct {
+	// MaxUploadBytes - largest picture accepted by the picture upload endpoint, before reduction.
+	MaxUploadBytes int64 `json:"max_upload_bytes"`
+	// MaxDimension - largest accepted width or height in pixels.
+	MaxDimension int `json:"max_dimension"`
+	// MaxPixels - largest accepted width x height, guarding against decompression bombs.
+	MaxPixels    int `json:"max_pixels"`
+	MaxSizeBytes int `json:"max_size_bytes"`
+	// MinSizeRatio of MaxSizeBytes the reduced picture should not go below.
+	MinSizeRatio float64 `json:"min_size_ratio"`
+	// Renditions generated next to the original picture.
+	Renditions []RenditionConfig `json:"renditions"`
+}
+
+// RenditionConfig - A scaled version of group pictures.
+type RenditionConfig struct {
+	Name string `json:"name"`
+	// Size - bounding box in pixels.
+	Size int `json:"size"`
+	// Square - crop to the centered square before scaling.
+	Square bool `json:"square"`
+}
+
+// OriginalRendition - name under which the reduced picture itself is exposed.
+const OriginalRendition = "original"
+
+var renditionName = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{0,31}$`)
+
+// MinSizeBytes - Lower size bound of reduced pictures.
+func (i ImageConfig) MinSizeBytes() int {
+	return int(float64(i.MaxSizeBytes) * i.MinSizeRatio)
+}
+
+// PictureQueue - Background reduction of uploaded group pictures.
+type PictureQueue struct {
+	// Workers - number of concurrent picture workers, 0 disables processing in this instance.
+	Workers int `json:"workers"`
+	// BatchSize - jobs claimed per poll.
+	BatchSize    int      `json:"batch_size"`
+	PollInterval Duration `json:"poll_interval"`
+	// Lease - how long a claimed job is hidden from other workers before it is retried.
+	Lease       Duration `json:"lease"`
+	MaxAttempts int      `json:"max_attempts"`
+	// BaseBackoff doubles after every failed attempt, up to MaxBackoff.
+	BaseBackoff Duration `json:"base_backoff"`
+	MaxBackoff  Duration `json:"max_backoff"`
+}
+
+// IdempotencyConfig - Replay of requests retried with the same Idempotency-Key.
+type IdempotencyConfig struct {
+	// TTL - how long a key and its response are kept.
+	TTL Duration `json:"ttl"`
+}
+
+// GroupNameConfig - Rules group names follow on create and rename.
+type GroupNameConfig struct {
+	// MaxGraphemes - longest name in user-perceived characters.
+	MaxGraphemes int `json:"max_graphemes"`
+	// Blocked - reserved or offensive words, rejected as the whole name or as one of its words, ignoring case.
+	Blocked []string `json:"blocked"`
+}
+
+// TrashConfig - Deleted groups, kept for restoration until purged.
+type TrashConfig struct {
+	// Retention - how long a deleted group can be restored.
+	Retention Duration `json:"retention"`
+	// PurgeInterval - how often expired groups are purged, 0 disables purging in this instance.
+	PurgeInterval Duration `json:"purge_interval"`
+}
+
+// EventsConfig - Dispatch of the domain events written to the outbox with every group change.
+type EventsConfig struct {
+	// Sinks - where this instance publishes events: "channel", "file", "webhook", "nats" or "subscriptions", the
+	// latter queueing the webhook deliveries. Without sinks the instance dispatches nothing and events wait in the
+	// outbox.
+	Sinks []string `json:"sinks"`
+	// File - JSON lines file of the file sink.
+	File string `json:"file"`
+	// WebhookURL - endpoint the webhook sink posts events to.
+	WebhookURL string `json:"webhook_url"`
+	// NATSURL - broker of the nats sink, nats://[user:password@]host[:port].
+	NATSURL string `json:"nats_url"`
+	// NATSSubject - prefix of the subjects events are published on, followed by the event type.
+	NATSSubject string `json:"nats_subject"`
+	// BatchSize - events claimed per poll.
+	BatchSize    int      `json:"batch_size"`
+	PollInterval Duration `json:"poll_interval"`
+	// Lease - how long a claimed event is hidden from other dispatchers before it is retried.
+	Lease       Duration `json:"lease"`
+	MaxAttempts int      `json:"max_attempts"`
+	// BaseBackoff doubles after every failed attempt, up to MaxBackoff.
+	BaseBackoff Duration `json:"base_backoff"`
+	MaxBackoff  Duration `json:"max_backoff"`
+}
+
+// WebhooksConfig - Delivery of group events to the webhook subscriptions of users.
+type WebhooksConfig struct {
+	// Workers - number of concurrent delivery workers, 0 disables delivery in this instance.
+	Workers int `json:"workers"`
+	// BatchSize - deliveries claimed per poll.
+	BatchSize    int      `json:"batch_size"`
+	PollInterval Duration `json:"poll_interval"`
+	// Lease - how long a claimed delivery is hidden from other workers, longer than Timeout.
+	Lease Duration `json:"lease"`
+	// Timeout - how long an endpoint has to answer a delivery.
+	Timeout     Duration `json:"timeout"`
+	MaxAttempts int      `json:"max_attempts"`
+	// BaseBackoff doubles after every failed attempt, up to MaxBackoff.
+	BaseBackoff Duration `json:"base_backoff"`
+	MaxBackoff  Duration `json:"max_backoff"`
+	// MaxSubscriptions - subscriptions a user may have.
+	MaxSubscriptions int `json:"max_subscriptions"`
+	// AllowHTTP - accept plain http endpoints, only https ones otherwise.
+	AllowHTTP bool `json:"allow_http"`
+	// AllowPrivateNetworks - accept endpoints on loopback, private and link-local addresses, for development only.
+	AllowPrivateNetworks bool `json:"allow_private_networks"`
+}
+
+// StreamConfig - Server-Sent Events stream of group changes.
+type StreamConfig struct {
+	// Heartbeat - interval of the comments keeping idle streams open through proxies.
+	Heartbeat Duration `json:"heartbeat"`
+	// Retry - reconnection delay advised to clients.
+	Retry Duration `json:"retry"`
+}
+
+// SyncConfig - Delta sync of groups.
+type SyncConfig struct {
+	// SettleWindow - how long changes are left to commit before delta sync returns them, covering slow
+	// transactions and clock skew between instances.
+	SettleWindow Duration `json:"settle_window"`
+}
+
+// PaginationConfig - Page sizes of listing endpoints.
+type PaginationConfig struct {
+	DefaultLimit int32 `json:"default_limit"`
+	MaxLimit     int32 `json:"max_limit"`
+}
+
+// AuthConfig - Bearer token verification settings, all of them or none. Without them no token can be verified.
+type AuthConfig struct {
+	Issuer   string `json:"issuer"`
+	Audience string `json:"audience"`
+	JWKSURL  string `json:"jwks_url"`
+}
+
+// TracingConfig - OpenTelemetry exporter settings.
+type TracingConfig struct {
+	Exporter     string `json:"exporter"`
+	OTLPEndpoint string `json:"otlp_endpoint"`
+	OTLPInsecure bool   `json:"otlp_insecure"`
+}
+
+// Defaults - Configuration used when nothing overrides it.
+func Defaults() Config {
+	return Config{
+		Storage: StorageConfig{
+			Backend: BackendFirestore,
+		},
+		Blobs: BlobConfig{
+			Backend: BlobBackendFilesystem,
+			Dir:     "data/blobs",
+		},
+		Images: ImageConfig{
+			MaxUploadBytes: 10 << 20,
+			MaxDimension:   8192,
+			MaxPixels:      24000000,
+			MaxSizeBytes:   256 * 1024,
+			MinSizeRatio:   0.5,
+			Renditions: []RenditionConfig{
+				{Name: "thumbnail", Size: 64, Square: true},
+				{Name: "medium", Size: 256, Square: true},
+				{Name: "large", Size: 1024},
+			},
+		},
+		Pictures: PictureQueue{
+			Workers:      2,
+			BatchSize:    10,
+			PollInterval: Duration(time.Second),
+			Lease:        Duration(2 * time.Minute),
+			MaxAttempts:  5,
+			BaseBackoff:  Duration(5 * time.Second),
+			MaxBackoff:   Duration(10 * time.Minute),
+		},
+		Idempotency: IdempotencyConfig{
+			TTL: Duration(24 * time.Hour),
+		},
+		GroupNames: GroupNameConfig{
+			MaxGraphemes: 64,
+		},
+		Trash: TrashConfig{
+			Retention:     Duration(30 * 24 * time.Hour),
+			PurgeInterval: Duration(time.Hour),
+		},
+		Events: EventsConfig{
+			Sinks:        []string{EventSinkSubscriptions},
+			NATSSubject:  "connections.groups",
+			BatchSize:    50,
+			PollInterval: Duration(time.Second),
+			Lease:        Duration(time.Minute),
+			MaxAttempts:  10,
+			BaseBackoff:  Duration(5 * time.Second),
+			MaxBackoff:   Duration(15 * time.Minute),
+		},
+		Webhooks: WebhooksConfig{
+			Workers:          2,
+			BatchSize:        20,
+			PollInterval:     Duration(time.Second),
+			Lease:            Duration(2 * time.Minute),
+			Timeout:          Duration(10 * time.Second),
+			MaxAttempts:      8,
+			BaseBackoff:      Duration(30 * time.Second),
+			MaxBackoff:       Duration(time.Hour),
+			MaxSubscriptions: 10,
+		},
+		Stream: StreamConfig{
+			Heartbeat: Duration(15 * time.Second),
+			Retry:     Duration(3 * time.Second),
+		},
+		Sync: SyncConfig{
+			SettleWindow: Duration(5 * time.Second),
+		},
+		Pagination: PaginationConfig{
+			DefaultLimit: 25,
+			MaxLimit:     100,
+		},
+		Tracing: TracingConfig{
+			Exporter: "none",
+		},
+	}
+}
+
+// Validate - Check the configuration is usable, reporting every problem found.
+func (c Config) Validate() error {
+	var problems []string
+
+	switch c.Storage.Backend {
+	case BackendFirestore:
+		if c.Storage.DSN != "" {
+			if _, _, err := c.Storage.FirestoreDSN(); err != nil {
+				problems = append(problems, err.Error())
+			}
+		}
+	case BackendMemory:
+	default:
+		problems = append(problems, fmt.Sprintf("storage.backend must be %q or %q, got %q", BackendFirestore, BackendMemory, c.Storage.Backend))
+	}
+
+	switch c.Blobs.Backend {
+	case BlobBackendMemory:
+	case BlobBackendFilesystem:
+		if c.Blobs.Dir == "" {
+			problems = append(problems, "blobs.dir is required by the filesystem backend")
+		}
+	case BlobBackendS3:
+		if c.Blobs.S3.Endpoint == "" || c.Blobs.S3.Bucket == "" {
+			problems = append(problems, "blobs.s3.endpoint and blobs.s3.bucket are required by the s3 backend")
+		}
+	default:
+		problems = append(problems, fmt.Sprintf("blobs.backend must be memory, filesystem or s3, got %q", c.Blobs.Backend))
+	}
+
+	if c.Images.MaxUploadBytes <= 0 {
+		problems = append(problems, "images.max_upload_bytes must be positive")
+	}
+	if c.Images.MaxDimension <= 0 || c.Images.MaxPixels <= 0 {
+		problems = append(problems, "images.max_dimension and images.max_pixels must be positive")
+	}
+	if c.Images.MaxSizeBytes <= 0 {
+		problems = append(problems, "images.max_size_bytes must be positive")
+	}
+	if c.Images.MinSizeRatio < 0 || c.Images.MinSizeRatio >= 1 {
+		problems = append(problems, "images.min_size_ratio must be in [0, 1)")
+	}
+
+	renditionNames := map[string]bool{OriginalRendition: true}
+	for _, rendition := range c.Images.Renditions {
+		if !renditionName.MatchString(rendition.Name) || renditionNames[rendition.Name] {
+			problems = append(problems, fmt.Sprintf("images.renditions name %q must be unique, lowercase and not %q", rendition.Name, OriginalRendition))
+		}
+		renditionNames[rendition.Name] = true
+		if rendition.Size <= 0 {
+			problems = append(problems, fmt.Sprintf("images.renditions %q size must be positive", rendition.Name))
+		}
+	}
+
+	if c.Pictures.Workers < 0 {
+		problems = append(problems, "pictures.workers must not be negative")
+	}
+	if c.Pictures.BatchSize <= 0 || c.Pictures.MaxAttempts <= 0 {
+		problems = append(problems, "pictures.batch_size and pictures.max_attempts must be positive")
+	}
+	if c.Pictures.PollInterval <= 0 || c.Pictures.Lease <= 0 {
+		problems = append(problems, "pictures.poll_interval and pictures.lease must be positive")
+	}
+	if c.Pictures.BaseBackoff <= 0 || c.Pictures.MaxBackoff < c.Pictures.BaseBackoff {
+		problems = append(problems, "pictures.base_backoff must be positive and not exceed pictures.max_backoff")
+	}
+
+	if c.Idempotency.TTL <= 0 {
+		problems = append(problems, "idempotency.ttl must be positive")
+	}
+
+	if c.GroupNames.MaxGraphemes <= 0 {
+		problems = append(problems, "group_names.max_graphemes must be positive")
+	}
+
+	if c.Trash.Retention <= 0 {
+		problems = append(problems, "trash.retention must be positive")
+	}
+	if c.Trash.PurgeInterval < 0 {
+		problems = append(problems, "trash.purge_interval cannot be negative")
+	}
+
+	eventSinks := map[string]bool{}
+	for _, sink := range c.Events.Sinks {
+		switch sink {
+		case EventSinkChannel, EventSinkSubscriptions:
+		case EventSinkFile:
+			if c.Events.File == "" {
+				problems = append(problems, "events.file is required by the file sink")
+			}
+		case EventSinkWebhook:
+			if u, err := url.Parse(c.Events.WebhookURL); err != nil || u.Scheme != "https" && u.Scheme != "http" || u.Host == "" {
+				problems = append(problems, "events.webhook_url must be an http(s) URL")
+			}
+		case EventSinkNATS:
+			if u, err := url.Parse(c.Events.NATSURL); err != nil || u.Scheme != "nats" || u.Hostname() == "" {
+				problems = append(problems, "events.nats_url must look like nats://host[:port]")
+			}
+			if c.Events.NATSSubject == "" || strings.ContainsAny(c.Events.NATSSubject, " \t\r\n*>") {
+				problems = append(problems, "events.nats_subject must be a subject without spaces or wildcards")
+			}
+		default:
+			problems = append(problems, fmt.Sprintf("events.sinks must be channel, file, webhook, nats or subscriptions, got %q", sink))
+		}
+		if eventSinks[sink] {
+			problems = append(problems, fmt.Sprintf("events.sinks lists %q twice", sink))
+		}
+		eventSinks[sink] = true
+	}
+	if c.Events.BatchSize <= 0 || c.Events.MaxAttempts <= 0 {
+		problems = append(problems, "events.batch_size and events.max_attempts must be positive")
+	}
+	if c.Events.PollInterval <= 0 || c.Events.Lease <= 0 {
+		problems = append(problems, "events.poll_interval and events.lease must be positive")
+	}
+	if c.Events.BaseBackoff <= 0 || c.Events.MaxBackoff < c.Events.BaseBackoff {
+		problems = append(problems, "events.base_backoff must be positive and not exceed events.max_backoff")
+	}
+
+	if c.Webhooks.Workers < 0 {
+		problems = append(problems, "webhooks.workers must not be negative")
+	}
+	if c.Webhooks.BatchSize <= 0 || c.Webhooks.MaxAttempts <= 0 || c.Webhooks.MaxSubscriptions <= 0 {
+		problems = append(problems, "webhooks.batch_size, webhooks.max_attempts and webhooks.max_subscriptions must be positive")
+	}
+	if c.Webhooks.PollInterval <= 0 || c.Webhooks.Timeout <= 0 || c.Webhooks.Lease <= c.Webhooks.Timeout {
+		problems = append(problems, "webhooks.poll_interval and webhooks.timeout must be positive and webhooks.lease longer than webhooks.timeout")
+	}
+	if c.Webhooks.BaseBackoff <= 0 || c.Webhooks.MaxBackoff < c.Webhooks.BaseBackoff {
+		problems = append(problems, "webhooks.base_backoff must be positive and not exceed webhooks.max_backoff")
+	}
+
+	if c.Stream.Heartbeat <= 0 || c.Stream.Retry <= 0 {
+		problems = append(problems, "stream.heartbeat and stream.retry must be positive")
+	}
+
+	if c.Sync.SettleWindow < 0 {
+		problems = append(problems, "sync.settle_window must not be negative")
+	}
+
+	if c.Pagination.MaxLimit <= 0 {
+		problems = append(problems, "pagination.max_limit must be positive")
+	}
+	if c.Pagination.DefaultLimit <= 0 || c.Pagination.DefaultLimit > c.Pagination.MaxLimit {
+		problems = append(problems, "pagination.default_limit must be positive and not exceed pagination.max_limit")
+	}
+
+	// A token verified without its issuer or audience would be accepted from any other service of the issuer.
+	if c.Auth != (AuthConfig{}) {
+		if c.Auth.Issuer == "" || c.Auth.Audience == "" || c.Auth.JWKSURL == "" {
+			problems = append(problems, "auth.issuer, auth.audience and auth.jwks_url are required together")
+		}
+		if u, err := url.Parse(c.Auth.JWKSURL); c.Auth.JWKSURL != "" && (err != nil || u.Scheme != "https" && u.Scheme != "http") {
+			problems = append(problems, "auth.jwks_url must be an http(s) URL")
+		}
+	}
+
+	switch c.Tracing.Exporter {
+	case "none", "stdout", "otlp":
+	default:
+		problems = append(problems, fmt.Sprintf("tracing.exporter must be none, stdout or otlp, got %q", c.Tracing.Exporter))
+	}
+
+	if len(problems) > 0 {
+		return errors.New("invalid configuration: " + strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// FirestoreDSN - Project ID and optional credentials file of a firestore:// DSN.
+func (s StorageConfig) FirestoreDSN() (projectID string, credentialsFile string, err error) {
+	if s.DSN == "" {
+		return "", "", nil
+	}
+
+	u, err := url.Parse(s.DSN)
+	if err != nil || u.Scheme != BackendFirestore || u.Host == "" {
+		return "", "", fmt.Errorf("storage.dsn must look like firestore://<project>[?credentials=<file>], got %q", s.DSN)
+	}
+
+	return u.Host, u.Query().Get("credentials"), nil
+}
+
+// Redacted - Copy safe to print, with credentials removed from the DSN, the S3 keys and the event sink URLs.
+func (c Config) Redacted() Config {
+	if u, err := url.Parse(c.Storage.DSN); err == nil && u.RawQuery != "" {
+		q := u.Query()
+		for key := range q {
+			q.Set(key, "REDACTED")
+		}
+		u.RawQuery = q.Encode()
+		c.Storage.DSN = u.String()
+	}
+	if c.Blobs.S3.AccessKey != "" {
+		c.Blobs.S3.AccessKey = "REDACTED"
+	}
+	if c.Blobs.S3.SecretKey != "" {
+		c.Blobs.S3.SecretKey = "REDACTED"
+	}
+	// Webhook endpoints often carry their token in the path or query, only the host is kept.
+	if c.Events.WebhookURL != "" {
+		if u, err := url.Parse(c.Events.WebhookURL); err == nil && u.Host != "" {
+			c.Events.WebhookURL = (&url.URL{Scheme: u.Scheme, Host: u.Host, Path: "/REDACTED"}).String()
+		} else {
+			c.Events.WebhookURL = "REDACTED"
+		}
+	}
+	if u, err := url.Parse(c.Events.NATSURL); err == nil && u.User != nil {
+		u.User = url.UserPassword("REDACTED", "REDACTED")
+		c.Events.NATSURL = u.String()
+	}
+	return c
+}
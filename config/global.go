@@ -0,0 +1,22 @@
+package config
+
+import "sync"
+
+var (
+	mx      sync.RWMutex
+	current = Defaults()
+)
+
+// Get - Configuration installed at startup, or the defaults when none was.
+func Get() Config {
+	mx.RLock()
+	defer mx.RUnlock()
+	return current
+}
+
+// Set - Install the configuration returned by Get.
+func Set(cfg Config) {
+	mx.Lock()
+	current = cfg
+	mx.Unlock()
+}
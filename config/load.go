@@ -0,0 +1,201 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// EnvConfigFile - environment variable naming the configuration file when --config is not given.
+const EnvConfigFile = "CONNECTIONS_CONFIG"
+
+// Flags - Command line overrides, registered with the go-swagger server as an options group.
+// Zero values leave the file and environment settings untouched.
+type Flags struct {
+	ConfigFile        string `long:"config" description:"path of the JSON configuration file"`
+	StorageBackend    string `long:"storage-backend" description:"storage backend (firestore or memory)"`
+	StorageDSN        string `long:"storage-dsn" description:"storage DSN, e.g. firestore://my-project"`
+	BlobBackend       string `long:"blob-backend" description:"group picture store (memory, filesystem or s3)"`
+	BlobDir           string `long:"blob-dir" description:"directory of the filesystem picture store"`
+	ImageMaxSizeBytes int    `long:"image-max-size-bytes" description:"maximum size of a reduced group picture"`
+	PictureWorkers    int    `long:"picture-workers" description:"number of background picture workers"`
+	PageDefaultLimit  int32  `long:"page-default-limit" description:"page size used when a listing request has no limit"`
+	PageMaxLimit      int32  `long:"page-max-limit" description:"largest page size a listing request may ask for"`
+	TracingExporter   string `long:"tracing-exporter" description:"trace exporter (none, stdout or otlp)"`
+}
+
+// envVar - Environment override of a single setting.
+type envVar struct {
+	name  string
+	apply func(c *Config, value string) error
+}
+
+var envVars = []envVar{
+	{"CONNECTIONS_STORAGE_BACKEND", func(c *Config, v string) error { c.Storage.Backend = v; return nil }},
+	{"CONNECTIONS_STORAGE_DSN", func(c *Config, v string) error { c.Storage.DSN = v; return nil }},
+	{"CONNECTIONS_BLOBS_BACKEND", func(c *Config, v string) error { c.Blobs.Backend = v; return nil }},
+	{"CONNECTIONS_BLOBS_DIR", func(c *Config, v string) error { c.Blobs.Dir = v; return nil }},
+	{"CONNECTIONS_BLOBS_S3_ENDPOINT", func(c *Config, v string) error { c.Blobs.S3.Endpoint = v; return nil }},
+	{"CONNECTIONS_BLOBS_S3_REGION", func(c *Config, v string) error { c.Blobs.S3.Region = v; return nil }},
+	{"CONNECTIONS_BLOBS_S3_BUCKET", func(c *Config, v string) error { c.Blobs.S3.Bucket = v; return nil }},
+	{"CONNECTIONS_BLOBS_S3_ACCESS_KEY", func(c *Config, v string) error { c.Blobs.S3.AccessKey = v; return nil }},
+	{"CONNECTIONS_BLOBS_S3_SECRET_KEY", func(c *Config, v string) error { c.Blobs.S3.SecretKey = v; return nil }},
+	{"CONNECTIONS_BLOBS_S3_USE_SSL", func(c *Config, v string) (err error) { c.Blobs.S3.UseSSL, err = strconv.ParseBool(v); return }},
+	{"CONNECTIONS_IMAGES_MAX_UPLOAD_BYTES", func(c *Config, v string) (err error) {
+		c.Images.MaxUploadBytes, err = strconv.ParseInt(v, 10, 64)
+		return
+	}},
+	{"CONNECTIONS_IMAGES_MAX_DIMENSION", func(c *Config, v string) (err error) { c.Images.MaxDimension, err = strconv.Atoi(v); return }},
+	{"CONNECTIONS_IMAGES_MAX_PIXELS", func(c *Config, v string) (err error) { c.Images.MaxPixels, err = strconv.Atoi(v); return }},
+	{"CONNECTIONS_IMAGES_MAX_SIZE_BYTES", func(c *Config, v string) (err error) { c.Images.MaxSizeBytes, err = strconv.Atoi(v); return }},
+	{"CONNECTIONS_IMAGES_MIN_SIZE_RATIO", func(c *Config, v string) (err error) { c.Images.MinSizeRatio, err = strconv.ParseFloat(v, 64); return }},
+	{"CONNECTIONS_PICTURES_WORKERS", func(c *Config, v string) (err error) { c.Pictures.Workers, err = strconv.Atoi(v); return }},
+	{"CONNECTIONS_PICTURES_MAX_ATTEMPTS", func(c *Config, v string) (err error) { c.Pictures.MaxAttempts, err = strconv.Atoi(v); return }},
+	{"CONNECTIONS_PICTURES_POLL_INTERVAL", func(c *Config, v string) error { return parseDuration(v, &c.Pictures.PollInterval) }},
+	{"CONNECTIONS_PICTURES_BASE_BACKOFF", func(c *Config, v string) error { return parseDuration(v, &c.Pictures.BaseBackoff) }},
+	{"CONNECTIONS_PICTURES_MAX_BACKOFF", func(c *Config, v string) error { return parseDuration(v, &c.Pictures.MaxBackoff) }},
+	{"CONNECTIONS_IDEMPOTENCY_TTL", func(c *Config, v string) error { return parseDuration(v, &c.Idempotency.TTL) }},
+	{"CONNECTIONS_GROUP_NAMES_MAX_GRAPHEMES", func(c *Config, v string) (err error) { c.GroupNames.MaxGraphemes, err = strconv.Atoi(v); return }},
+	{"CONNECTIONS_GROUP_NAMES_BLOCKED", func(c *Config, v string) error { c.GroupNames.Blocked = splitList(v); return nil }},
+	{"CONNECTIONS_TRASH_RETENTION", func(c *Config, v string) error { return parseDuration(v, &c.Trash.Retention) }},
+	{"CONNECTIONS_TRASH_PURGE_INTERVAL", func(c *Config, v string) error { return parseDuration(v, &c.Trash.PurgeInterval) }},
+	{"CONNECTIONS_EVENTS_SINKS", func(c *Config, v string) error { c.Events.Sinks = splitList(v); return nil }},
+	{"CONNECTIONS_EVENTS_FILE", func(c *Config, v string) error { c.Events.File = v; return nil }},
+	{"CONNECTIONS_EVENTS_WEBHOOK_URL", func(c *Config, v string) error { c.Events.WebhookURL = v; return nil }},
+	{"CONNECTIONS_EVENTS_NATS_URL", func(c *Config, v string) error { c.Events.NATSURL = v; return nil }},
+	{"CONNECTIONS_EVENTS_NATS_SUBJECT", func(c *Config, v string) error { c.Events.NATSSubject = v; return nil }},
+	{"CONNECTIONS_EVENTS_MAX_ATTEMPTS", func(c *Config, v string) (err error) { c.Events.MaxAttempts, err = strconv.Atoi(v); return }},
+	{"CONNECTIONS_EVENTS_POLL_INTERVAL", func(c *Config, v string) error { return parseDuration(v, &c.Events.PollInterval) }},
+	{"CONNECTIONS_WEBHOOKS_WORKERS", func(c *Config, v string) (err error) { c.Webhooks.Workers, err = strconv.Atoi(v); return }},
+	{"CONNECTIONS_WEBHOOKS_MAX_ATTEMPTS", func(c *Config, v string) (err error) { c.Webhooks.MaxAttempts, err = strconv.Atoi(v); return }},
+	{"CONNECTIONS_WEBHOOKS_TIMEOUT", func(c *Config, v string) error { return parseDuration(v, &c.Webhooks.Timeout) }},
+	{"CONNECTIONS_WEBHOOKS_ALLOW_HTTP", func(c *Config, v string) (err error) { c.Webhooks.AllowHTTP, err = strconv.ParseBool(v); return }},
+	{"CONNECTIONS_WEBHOOKS_ALLOW_PRIVATE_NETWORKS", func(c *Config, v string) (err error) {
+		c.Webhooks.AllowPrivateNetworks, err = strconv.ParseBool(v)
+		return
+	}},
+	{"CONNECTIONS_STREAM_HEARTBEAT", func(c *Config, v string) error { return parseDuration(v, &c.Stream.Heartbeat) }},
+	{"CONNECTIONS_SYNC_SETTLE_WINDOW", func(c *Config, v string) error { return parseDuration(v, &c.Sync.SettleWindow) }},
+	{"CONNECTIONS_PAGINATION_DEFAULT_LIMIT", func(c *Config, v string) error { return parseInt32(v, &c.Pagination.DefaultLimit) }},
+	{"CONNECTIONS_PAGINATION_MAX_LIMIT", func(c *Config, v string) error { return parseInt32(v, &c.Pagination.MaxLimit) }},
+	{"CONNECTIONS_AUTH_ISSUER", func(c *Config, v string) error { c.Auth.Issuer = v; return nil }},
+	{"CONNECTIONS_AUTH_AUDIENCE", func(c *Config, v string) error { c.Auth.Audience = v; return nil }},
+	{"CONNECTIONS_AUTH_JWKS_URL", func(c *Config, v string) error { c.Auth.JWKSURL = v; return nil }},
+	{"CONNECTIONS_TRACING_EXPORTER", func(c *Config, v string) error { c.Tracing.Exporter = v; return nil }},
+	{"CONNECTIONS_TRACING_OTLP_ENDPOINT", func(c *Config, v string) error { c.Tracing.OTLPEndpoint = v; return nil }},
+	{"CONNECTIONS_TRACING_OTLP_INSECURE", func(c *Config, v string) (err error) { c.Tracing.OTLPInsecure, err = strconv.ParseBool(v); return }},
+}
+
+func parseInt32(value string, target *int32) error {
+	n, err := strconv.ParseInt(value, 10, 32)
+	if err != nil {
+		return err
+	}
+	*target = int32(n)
+	return nil
+}
+
+// splitList - Non-empty items of a comma separated list.
+func splitList(value string) []string {
+	items := []string{}
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+func parseDuration(value string, target *Duration) error {
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return err
+	}
+	*target = Duration(d)
+	return nil
+}
+
+// Load - Build the effective configuration from defaults, the configuration file,
+// environment variables and flags, in increasing order of precedence, and validate it.
+func Load(flags Flags, lookupEnv func(string) (string, bool)) (Config, error) {
+
+	if lookupEnv == nil {
+		lookupEnv = os.LookupEnv
+	}
+
+	cfg := Defaults()
+
+	path := flags.ConfigFile
+	if path == "" {
+		path, _ = lookupEnv(EnvConfigFile)
+	}
+	if path != "" {
+		if err := loadFile(path, &cfg); err != nil {
+			return cfg, err
+		}
+	}
+
+	for _, env := range envVars {
+		value, ok := lookupEnv(env.name)
+		if !ok || value == "" {
+			continue
+		}
+		if err := env.apply(&cfg, value); err != nil {
+			return cfg, fmt.Errorf("invalid %s (%s)", env.name, err.Error())
+		}
+	}
+
+	applyFlags(flags, &cfg)
+
+	return cfg, cfg.Validate()
+}
+
+// loadFile - Overlay the JSON configuration file onto cfg, rejecting unknown keys.
+func loadFile(path string, cfg *Config) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read configuration file (%s)", err.Error())
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(cfg); err != nil {
+		return fmt.Errorf("failed to parse configuration file %s (%s)", path, err.Error())
+	}
+
+	return nil
+}
+
+func applyFlags(flags Flags, cfg *Config) {
+	if flags.StorageBackend != "" {
+		cfg.Storage.Backend = flags.StorageBackend
+	}
+	if flags.StorageDSN != "" {
+		cfg.Storage.DSN = flags.StorageDSN
+	}
+	if flags.BlobBackend != "" {
+		cfg.Blobs.Backend = flags.BlobBackend
+	}
+	if flags.BlobDir != "" {
+		cfg.Blobs.Dir = flags.BlobDir
+	}
+	if flags.ImageMaxSizeBytes != 0 {
+		cfg.Images.MaxSizeBytes = flags.ImageMaxSizeBytes
+	}
+	if flags.PictureWorkers != 0 {
+		cfg.Pictures.Workers = flags.PictureWorkers
+	}
+	if flags.PageDefaultLimit != 0 {
+		cfg.Pagination.DefaultLimit = flags.PageDefaultLimit
+	}
+	if flags.PageMaxLimit != 0 {
+		cfg.Pagination.MaxLimit = flags.PageMaxLimit
+	}
+	if flags.TracingExporter != "" {
+		cfg.Tracing.Exporter = flags.TracingExporter
+	}
+}
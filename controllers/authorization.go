@@ -0,0 +1,17 @@
+package controllers
+
+import (
+	"errors"
+
+	"learning/unit-testing/models"
+)
+
+var errForbidden = errors.New("the bearer token does not grant access to this user's resources")
+
+// AuthorizeUser - Check the authenticated principal may access the resources of userID, which are only its own.
+func AuthorizeUser(principal *models.Principal, userID string) error {
+	if principal == nil || principal.UserID == "" || principal.UserID != userID {
+		return errForbidden
+	}
+	return nil
+}
@@ -1,15 +1,24 @@
 package controllers
 
 import (
-	"log"
-	"strings"
-	"time"
+	"encoding/json"
+	"errors"
+
+	"learning/unit-testing/database"
+	"learning/unit-testing/mergepatch"
+	"learning/unit-testing/tracing"
+)
+
+var (
+	errGroupNameRequired = errors.New("group_name is required")
+	errInvalidPatch      = errors.New("request body must be a JSON Merge Patch document")
 )
 
 // CreateConnectionsGroupsByUserIDResponse - Holding reponse for CreateConnectionsGroupsByUserID()
 type CreateConnectionsGroupsByUserIDResponse struct {
 	existsPayload  models.UsersConnectionsGroupsExistsPostResponse
 	createdPayload models.UsersConnectionsGroupsPostResponse
+	replay         *database.IdempotencyRecord
 	resType        string
 	errMsg         string
 	err            error
@@ -49,19 +58,25 @@ type DeleteUsersConnectionsGroupsByUserIDAndGroupIDResponse struct {
 // CreateConnectionsGroupsByUserIDController -
 func CreateConnectionsGroupsByUserIDController(params connections.UsersConnectionsGroupsByUserIDPostParams, principal *models.Principal) middleware.Responder {
 
-	ctlr, err := GetControllerDB()
+	ctlr, err := GetController()
 	if err != nil {
 		return connections.NewUsersConnectionsGroupsByUserIDPostInternalServerError()
 	}
 
-	response := ctlr.CreateConnectionsGroupsByUserID(params, principal)
+	response := ctlr.CreateConnectionsGroupsIdempotently(params, principal)
 	if response.err != nil {
 		switch response.resType {
+		case "errReturn400", "errReturn409", "errReturn413", "errReturn415", "errReturn422":
+			return newProblemResponder(params.HTTPRequest, problemStatus(response.resType), response.errMsg)
 		case "errReturn500":
 			return connections.NewUsersConnectionsGroupsByUserIDPostInternalServerError()
 		}
 	}
 
+	if response.resType == "Replayed" {
+		return &replayResponder{record: *response.replay}
+	}
+
 	if response.resType == "OK" {
 		return connections.NewUsersConnectionsGroupsByUserIDPostOK().WithPayload(&response.existsPayload)
 	}
@@ -72,7 +87,7 @@ func CreateConnectionsGroupsByUserIDController(params connections.UsersConnectio
 // UsersConnectionsGroupsByUserIDAndGroupIDGetController - Get an individual Connections Group.
 func UsersConnectionsGroupsByUserIDAndGroupIDGetController(params connections.UsersConnectionsGroupsByUserIDAndGroupIDGetParams, principal *models.Principal) middleware.Responder {
 
-	ctlr, err := GetControllerDB()
+	ctlr, err := GetController()
 	if err != nil {
 		return connections.NewUsersConnectionsGroupsByUserIDAndGroupIDGetInternalServerError()
 	}
@@ -93,7 +108,7 @@ func UsersConnectionsGroupsByUserIDAndGroupIDGetController(params connections.Us
 // UsersConnectionsGroupsByUserIDGetController - Get a batch of Users Connections Groups.
 func UsersConnectionsGroupsByUserIDGetController(params connections.UsersConnectionsGroupsByUserIDGetParams, principal *models.Principal) middleware.Responder {
 
-	ctlr, err := GetControllerDB()
+	ctlr, err := GetController()
 	if err != nil {
 		return connections.NewUsersConnectionsGroupsByUserIDGetInternalServerError()
 	}
@@ -101,6 +116,8 @@ func UsersConnectionsGroupsByUserIDGetController(params connections.UsersConnect
 	response := ctlr.GetUsersConnectionsGroupsByUserID(params, principal)
 	if response.err != nil {
 		switch response.resType {
+		case "errReturn400":
+			return newProblemResponder(params.HTTPRequest, problemStatus(response.resType), response.errMsg)
 		case "errReturn404":
 			return connections.NewUsersConnectionsGroupsByUserIDGetNotFound()
 		case "errReturn500":
@@ -108,13 +125,18 @@ func UsersConnectionsGroupsByUserIDGetController(params connections.UsersConnect
 		}
 	}
 
-	return connections.NewUsersConnectionsGroupsByUserIDGetOK().WithPayload(&response.payload)
+	offset := 0
+	if params.Offset != nil {
+		offset = int(*params.Offset)
+	}
+	ok := connections.NewUsersConnectionsGroupsByUserIDGetOK().WithPayload(&response.payload)
+	return &linkResponder{Responder: ok, r: params.HTTPRequest, offset: offset, meta: response.payload.PaginationMetadata}
 }
 
 // UsersConnectionsGroupsByUserIDAndGroupIDPatchController - Updates a specific user's group.
 func UsersConnectionsGroupsByUserIDAndGroupIDPatchController(params connections.UsersConnectionsGroupsByUserIDAndGroupIDPatchParams, principal *models.Principal) middleware.Responder {
 
-	ctlr, err := GetControllerDB()
+	ctlr, err := GetController()
 	if err != nil {
 		return connections.NewUsersConnectionsGroupsByUserIDAndGroupIDPatchInternalServerError()
 	}
@@ -122,6 +144,8 @@ func UsersConnectionsGroupsByUserIDAndGroupIDPatchController(params connections.
 	response := ctlr.UpdateUsersConnectionsGroupsByUserIDAndGroupID(params, principal)
 	if response.err != nil {
 		switch response.resType {
+		case "errReturn400", "errReturn413", "errReturn415":
+			return newProblemResponder(params.HTTPRequest, problemStatus(response.resType), response.errMsg)
 		case "errReturn500":
 			return connections.NewUsersConnectionsGroupsByUserIDAndGroupIDPatchInternalServerError()
 		}
@@ -137,7 +161,7 @@ func UsersConnectionsGroupsByUserIDAndGroupIDPatchController(params connections.
 // UsersConnectionsGroupsByUserIDAndGroupIDDeleteController - Delete an individual Connections Group.
 func UsersConnectionsGroupsByUserIDAndGroupIDDeleteController(params connections.UsersConnectionsGroupsByUserIDAndGroupIDDeleteParams, principal *models.Principal) middleware.Responder {
 
-	ctlr, err := GetControllerDB()
+	ctlr, err := GetController()
 	if err != nil {
 		return connections.NewUsersConnectionsGroupsByUserIDAndGroupIDDeleteInternalServerError()
 	}
@@ -158,7 +182,21 @@ func UsersConnectionsGroupsByUserIDAndGroupIDDeleteController(params connections
 // CreateConnectionsGroupsByUserID -
 func (c Ctlr) CreateConnectionsGroupsByUserID(params connections.UsersConnectionsGroupsByUserIDPostParams, principal *models.Principal) CreateConnectionsGroupsByUserIDResponse {
 
-	groupinfoObj, err := c.DB.GetUserConnectionGroupByName(params.UserID, *params.Body.GroupName)
+	ctx, span := tracing.Start(params.HTTPRequest, "Ctlr.CreateConnectionsGroupsByUserID")
+	defer span.End()
+
+	db := database.NewTracingStorage(ctx, c.DB)
+
+	if params.Body == nil || params.Body.GroupName == nil {
+		return CreateConnectionsGroupsByUserIDResponse{resType: "errReturn400", errMsg: "group_name is required", err: errGroupNameRequired}
+	}
+
+	groupName, err := applyGroupNamePolicy(*params.Body.GroupName)
+	if err != nil {
+		return CreateConnectionsGroupsByUserIDResponse{resType: "errReturn400", errMsg: err.Error(), err: err}
+	}
+
+	groupinfoObj, err := db.GetUserConnectionGroupByName(params.UserID, groupName)
 	if err != nil && status.Code(err) != codes.NotFound {
 		return CreateConnectionsGroupsByUserIDResponse{resType: "errReturn500", errMsg: "failed to parse group from database", err: err}
 	}
@@ -174,35 +212,16 @@ func (c Ctlr) CreateConnectionsGroupsByUserID(params connections.UsersConnection
 		return CreateConnectionsGroupsByUserIDResponse{resType: "OK", errMsg: msg, existsPayload: responseExistsPayload}
 	}
 
-	var reducedGroupPic *string
+	// The picture is validated now and reduced in the background.
+	uploadKey := ""
 	if !IsZeroOfUnderlyingType(params.Body.GroupPic) {
-
-		start := time.Now()
-
-		if strings.Contains(params.Body.GroupPic, "base64,") {
-			params.Body.GroupPic = params.Body.GroupPic[strings.IndexByte(params.Body.GroupPic, ',')+1:]
-		}
-		max := GetGroupPicMaxSizeBytes()
-		min := int(float64(max) * ProfileGraphicRatioMinThresholdDefault)
-		sizeSpecs := ImageOptions{
-			MaxImageSizeBytes: &max,
-			MinImageSizeBytes: &min,
-		}
-		reducedBgImageData, err := ReduceBase64EncodedImage(params.Body.GroupPic, &sizeSpecs)
+		uploadKey, err = c.stageEncodedGroupPic(ctx, params.Body.GroupPic)
 		if err != nil {
-			log.Printf("failed to save group picture for user (%s) (%s)", params.UserID, err.Error())
-			msg := err.Error()
-			responseExistsPayload := models.UsersConnectionsGroupsExistsPostResponse{
-				ErrorMessage: &msg,
+			if resType, rejected := rejectionResType(err); rejected {
+				return CreateConnectionsGroupsByUserIDResponse{resType: resType, errMsg: err.Error(), err: err}
 			}
-			return CreateConnectionsGroupsByUserIDResponse{resType: "OK", errMsg: "Failed to reduce image size", existsPayload: responseExistsPayload}
+			return CreateConnectionsGroupsByUserIDResponse{resType: "errReturn500", errMsg: "failed to store group picture", err: err}
 		}
-
-		reducedGroupPic = reducedBgImageData
-
-		elapsed := time.Since(start)
-
-		log.Printf("Image Processing took %s", elapsed)
 	}
 
 	ids := []GroupConnectionUserID{}
@@ -212,24 +231,42 @@ func (c Ctlr) CreateConnectionsGroupsByUserID(params connections.UsersConnection
 		ids = append(ids, id)
 	}
 
-	groupPicStr := ""
-	if reducedGroupPic != nil {
-		groupPicStr = *reducedGroupPic
-	}
+	// The storage sets the creation, update and interaction times.
 	group := UserConnectionGroupInfo{
-		GroupName:             *params.Body.GroupName,
-		ConnectionUserIds:     ids,
-		GroupPic:              groupPicStr,
-		LatestInteractionTime: time.Now(),
+		GroupName:         groupName,
+		ConnectionUserIds: ids,
 	}
 
 	// Set the group into the database.
-	groupID, err := c.DB.CreateUserConnectionGroup(params.UserID, group)
+	groupID, err := db.CreateUserConnectionGroup(params.UserID, group, principalClaims(principal))
+
+	if err != nil && uploadKey != "" {
+		c.discardStagedGroupPic(ctx, uploadKey)
+	}
+
+	// A concurrent request created a group with the same name since the check above.
+	var conflict *database.GroupNameConflictError
+	if errors.As(err, &conflict) {
+		var msg string = "Group Already Exists"
+		responseExistsPayload := models.UsersConnectionsGroupsExistsPostResponse{
+			ErrorMessage: &msg,
+			GroupID:      &conflict.GroupID,
+			GroupName:    &conflict.GroupName,
+		}
+
+		return CreateConnectionsGroupsByUserIDResponse{resType: "OK", errMsg: msg, existsPayload: responseExistsPayload}
+	}
 
 	if err != nil {
 		return CreateConnectionsGroupsByUserIDResponse{resType: "errReturn500", errMsg: "failed to create new Group entry in database", err: err}
 	}
 
+	if uploadKey != "" {
+		if err := enqueueGroupPic(db, params.UserID, groupID, uploadKey, principal); err != nil {
+			return CreateConnectionsGroupsByUserIDResponse{resType: "errReturn500", errMsg: "failed to queue group picture", err: err}
+		}
+	}
+
 	responsePayload := models.UsersConnectionsGroupsPostResponse{
 		GroupID: &groupID,
 	}
@@ -240,7 +277,12 @@ func (c Ctlr) CreateConnectionsGroupsByUserID(params connections.UsersConnection
 // GetUsersConnectionsGroupsByUserIDAndGroupID -
 func (c Ctlr) GetUsersConnectionsGroupsByUserIDAndGroupID(params connections.UsersConnectionsGroupsByUserIDAndGroupIDGetParams, principal *models.Principal) GetUsersConnectionsGroupsByUserIDAndGroupIDResponse {
 
-	groupInfo, err := c.DB.GetUserConnectionGroupByGroupID(params.UserID, params.GroupID)
+	ctx, span := tracing.Start(params.HTTPRequest, "Ctlr.GetUsersConnectionsGroupsByUserIDAndGroupID")
+	defer span.End()
+
+	db := database.NewTracingStorage(ctx, c.DB)
+
+	groupInfo, err := db.GetUserConnectionGroupByGroupID(params.UserID, params.GroupID)
 	if err != nil {
 		if status.Code(err) == codes.NotFound {
 			return GetUsersConnectionsGroupsByUserIDAndGroupIDResponse{resType: "errReturn404", errMsg: "record not found", err: err}
@@ -248,7 +290,8 @@ func (c Ctlr) GetUsersConnectionsGroupsByUserIDAndGroupID(params connections.Use
 		return GetUsersConnectionsGroupsByUserIDAndGroupIDResponse{resType: "errReturn500", errMsg: "failed to parse group from database", err: err}
 	}
 
-	groupData := groupInfo.TransformToResponseGroup()
+	groupData := database.ToResponseGroup(groupInfo)
+	attachGroupPicRenditions(params.UserID, groupData)
 
 	payload := models.UsersConnectionsGroupsResponse{
 		Group: groupData,
@@ -260,14 +303,26 @@ func (c Ctlr) GetUsersConnectionsGroupsByUserIDAndGroupID(params connections.Use
 // GetUsersConnectionsGroupsByUserID - Get a batch of Users Connections Groups.
 func (c Ctlr) GetUsersConnectionsGroupsByUserID(params connections.UsersConnectionsGroupsByUserIDGetParams, principal *models.Principal) GetUsersConnectionsGroupsByUserIDResponse {
 
-	groupsList, paginationMeta, err := c.DB.GetPaginatedUserConnectionGroup(params)
+	ctx, span := tracing.Start(params.HTTPRequest, "Ctlr.GetUsersConnectionsGroupsByUserID")
+	defer span.End()
+
+	db := database.NewTracingStorage(ctx, c.DB)
+
+	groupsList, paginationMeta, err := db.GetPaginatedUserConnectionGroup(params)
 	if err != nil {
 		if status.Code(err) == codes.NotFound {
 			return GetUsersConnectionsGroupsByUserIDResponse{resType: "errReturn404", errMsg: "records not found", err: err}
 		}
+		if status.Code(err) == codes.InvalidArgument {
+			return GetUsersConnectionsGroupsByUserIDResponse{resType: "errReturn400", errMsg: status.Convert(err).Message(), err: err}
+		}
 		return GetUsersConnectionsGroupsByUserIDResponse{resType: "errReturn500", errMsg: "failed to parse groups from database", err: err}
 	}
 
+	for _, groupData := range groupsList {
+		attachGroupPicRenditions(params.UserID, groupData)
+	}
+
 	payload := models.UsersConnectionsGroupsGetResponse{
 		Groups:             groupsList,
 		PaginationMetadata: paginationMeta,
@@ -279,71 +334,115 @@ func (c Ctlr) GetUsersConnectionsGroupsByUserID(params connections.UsersConnecti
 // UpdateUsersConnectionsGroupsByUserIDAndGroupID -
 func (c Ctlr) UpdateUsersConnectionsGroupsByUserIDAndGroupID(params connections.UsersConnectionsGroupsByUserIDAndGroupIDPatchParams, principal *models.Principal) UpdateUsersConnectionsGroupsByUserIDAndGroupIDResponse {
 
-	groupinfoObj, err := c.DB.GetUserConnectionGroupByName(params.UserID, params.Body.GroupName)
-	if err != nil && status.Code(err) != codes.NotFound {
-		return UpdateUsersConnectionsGroupsByUserIDAndGroupIDResponse{resType: "errReturn500", errMsg: "failed to parse group from database", err: err}
-	}
+	ctx, span := tracing.Start(params.HTTPRequest, "Ctlr.UpdateUsersConnectionsGroupsByUserIDAndGroupID")
+	defer span.End()
 
-	if !IsZeroOfUnderlyingType(groupinfoObj.GroupID) {
-		var msg string = "Group name is already in use, choose another group name."
-		responseExistsPayload := models.UsersConnectionsGroupsExistsPostResponse{
-			ErrorMessage: &msg,
-			GroupID:      &groupinfoObj.GroupID,
-			GroupName:    &groupinfoObj.GroupName,
-		}
+	db := database.NewTracingStorage(ctx, c.DB)
 
-		return UpdateUsersConnectionsGroupsByUserIDAndGroupIDResponse{resType: "OK", errMsg: msg, existsPayload: responseExistsPayload}
+	patch, err := groupPatchFromRequest(params)
+	if err != nil {
+		return UpdateUsersConnectionsGroupsByUserIDAndGroupIDResponse{resType: "errReturn400", errMsg: err.Error(), err: err}
+	}
+	if patch.GroupName.Null || patch.GroupName.Present && patch.GroupName.Value == "" {
+		return UpdateUsersConnectionsGroupsByUserIDAndGroupIDResponse{resType: "errReturn400", errMsg: "group_name cannot be removed", err: errGroupNameRequired}
 	}
 
-	var reducedGroupPic *string
-	if !IsZeroOfUnderlyingType(params.Body.GroupPic) {
-
-		start := time.Now()
-
-		if strings.Contains(params.Body.GroupPic, "base64,") {
-			params.Body.GroupPic = params.Body.GroupPic[strings.IndexByte(params.Body.GroupPic, ',')+1:]
+	if patch.GroupName.IsSet() {
+		patch.GroupName.Value, err = applyGroupNamePolicy(patch.GroupName.Value)
+		if err != nil {
+			return UpdateUsersConnectionsGroupsByUserIDAndGroupIDResponse{resType: "errReturn400", errMsg: err.Error(), err: err}
 		}
-		max := GetGroupPicMaxSizeBytes()
-		min := int(float64(max) * ProfileGraphicRatioMinThresholdDefault)
-		sizeSpecs := ImageOptions{
-			MaxImageSizeBytes: &max,
-			MinImageSizeBytes: &min,
+
+		groupinfoObj, err := db.GetUserConnectionGroupByName(params.UserID, patch.GroupName.Value)
+		if err != nil && status.Code(err) != codes.NotFound {
+			return UpdateUsersConnectionsGroupsByUserIDAndGroupIDResponse{resType: "errReturn500", errMsg: "failed to parse group from database", err: err}
 		}
-		reducedBgImageData, err := ReduceBase64EncodedImage(params.Body.GroupPic, &sizeSpecs)
-		if err != nil {
-			log.Printf("failed to save group picture for user (%s) (%s)", params.UserID, err.Error())
-			msg := err.Error()
+
+		// A group may change the case or spacing of its own name.
+		if !IsZeroOfUnderlyingType(groupinfoObj.GroupID) && groupinfoObj.GroupID != params.GroupID {
+			var msg string = "Group name is already in use, choose another group name."
 			responseExistsPayload := models.UsersConnectionsGroupsExistsPostResponse{
 				ErrorMessage: &msg,
+				GroupID:      &groupinfoObj.GroupID,
+				GroupName:    &groupinfoObj.GroupName,
 			}
 
-			return UpdateUsersConnectionsGroupsByUserIDAndGroupIDResponse{resType: "OK", errMsg: "Failed to reduce image size", existsPayload: responseExistsPayload}
+			return UpdateUsersConnectionsGroupsByUserIDAndGroupIDResponse{resType: "OK", errMsg: msg, existsPayload: responseExistsPayload}
 		}
+	}
 
-		reducedGroupPic = reducedBgImageData
+	uploadKey := ""
+	if patch.GroupPic.IsSet() {
+		uploadKey, err = c.stageEncodedGroupPic(ctx, patch.GroupPic.Value)
+		if err != nil {
+			if resType, rejected := rejectionResType(err); rejected {
+				return UpdateUsersConnectionsGroupsByUserIDAndGroupIDResponse{resType: resType, errMsg: err.Error(), err: err}
+			}
+			return UpdateUsersConnectionsGroupsByUserIDAndGroupIDResponse{resType: "errReturn500", errMsg: "failed to store group picture", err: err}
+		}
 
-		elapsed := time.Since(start)
+		// The current picture stays until the picture worker replaces it.
+		patch.GroupPic = mergepatch.Field[string]{}
+	}
 
-		log.Printf("Image Processing took %s", elapsed)
+	_, err := db.UpdateUserConnectionGroup(params.UserID, params.GroupID, patch, principalClaims(principal))
+	if err != nil && uploadKey != "" {
+		c.discardStagedGroupPic(ctx, uploadKey)
 	}
 
-	params.Body.GroupPic = ""
-	if !IsZeroOfUnderlyingType(reducedGroupPic) {
-		params.Body.GroupPic = *reducedGroupPic
+	var conflict *database.GroupNameConflictError
+	if errors.As(err, &conflict) {
+		var msg string = "Group name is already in use, choose another group name."
+		responseExistsPayload := models.UsersConnectionsGroupsExistsPostResponse{
+			ErrorMessage: &msg,
+			GroupID:      &conflict.GroupID,
+			GroupName:    &conflict.GroupName,
+		}
+
+		return UpdateUsersConnectionsGroupsByUserIDAndGroupIDResponse{resType: "OK", errMsg: msg, existsPayload: responseExistsPayload}
 	}
 
-	err = c.DB.UpdateUserConnectionGroup(params)
 	if err != nil {
 		return UpdateUsersConnectionsGroupsByUserIDAndGroupIDResponse{resType: "errReturn500", errMsg: "failed to parse group from database", err: err}
 	}
 
+	if uploadKey != "" {
+		if err := enqueueGroupPic(db, params.UserID, params.GroupID, uploadKey, principal); err != nil {
+			return UpdateUsersConnectionsGroupsByUserIDAndGroupIDResponse{resType: "errReturn500", errMsg: "failed to queue group picture", err: err}
+		}
+	}
+
 	return UpdateUsersConnectionsGroupsByUserIDAndGroupIDResponse{resType: "Updated"}
 }
 
-// DeleteUsersConnectionsGroupsByUserIDAndGroupID -
+// groupPatchFromRequest - Changes asked by a group PATCH. The raw JSON Merge Patch document tells absent members
+// from null ones, the bound body is only used when the document was not kept.
+func groupPatchFromRequest(params connections.UsersConnectionsGroupsByUserIDAndGroupIDPatchParams) (database.GroupPatch, error) {
+	if params.HTTPRequest != nil {
+		if raw, ok := mergepatch.FromContext(params.HTTPRequest.Context()); ok {
+			var patch database.GroupPatch
+			if err := json.Unmarshal(raw, &patch); err != nil {
+				return patch, errInvalidPatch
+			}
+			return patch, nil
+		}
+	}
+
+	if params.Body == nil {
+		return database.GroupPatch{}, errInvalidPatch
+	}
+	return database.GroupPatchFromBody(params.Body), nil
+}
+
+// DeleteUsersConnectionsGroupsByUserIDAndGroupID - Move a group to the trash, its picture stays with it until it is purged.
 func (c Ctlr) DeleteUsersConnectionsGroupsByUserIDAndGroupID(params connections.UsersConnectionsGroupsByUserIDAndGroupIDDeleteParams, principal *models.Principal) DeleteUsersConnectionsGroupsByUserIDAndGroupIDResponse {
 
-	err := c.DB.DeleteUserConnectionGroup(params)
+	ctx, span := tracing.Start(params.HTTPRequest, "Ctlr.DeleteUsersConnectionsGroupsByUserIDAndGroupID")
+	defer span.End()
+
+	db := database.NewTracingStorage(ctx, c.DB)
+
+	err := db.DeleteUserConnectionGroup(params, principalClaims(principal))
 	if err != nil {
 
 		if status.Code(err) == codes.NotFound {
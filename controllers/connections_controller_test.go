@@ -1,13 +1,24 @@
 package controllers
 
 import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"reflect"
+	"sync"
 	"testing"
+	"time"
 
+	"learning/unit-testing/config"
+	"learning/unit-testing/database"
+	"learning/unit-testing/imaging"
 	"learning/unit-testing/internal"
+	"learning/unit-testing/mergepatch"
 	"learning/unit-testing/models"
 	"learning/unit-testing/restapi/operations/connections"
 
+	"github.com/go-openapi/strfmt"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 )
@@ -22,6 +33,9 @@ type TestCaseCreateGroup struct {
 }
 
 var connectionUserIds []*models.UsersConnectionsGroupsPostRequestConnectionUserIdsItems0
+
+var errInvalidBase64Pic = &imaging.RejectionError{Reason: imaging.ReasonCorrupt, Detail: "picture is not valid base64"}
+var errUnsupportedPic = &imaging.RejectionError{Reason: imaging.ReasonUnsupportedFormat, Detail: "only JPEG, PNG, GIF and WebP pictures are accepted"}
 var ctlr Ctlr
 
 // init -
@@ -55,7 +69,7 @@ func CreateConnectionGroup() {
 		ConnectionUserIds: ids,
 		GroupPic:          "",
 	}
-	ctlr.DB.CreateUserConnectionGroup(userID, group)
+	ctlr.DB.CreateUserConnectionGroup(userID, group, nil)
 }
 func TestCreateConnectionsGroupsByUserID(t *testing.T) {
 
@@ -103,9 +117,37 @@ func TestCreateConnectionsGroupsByUserID(t *testing.T) {
 				},
 			},
 			inputPrincipal:       &models.Principal{},
-			expectedResponseType: "OK",
-			expectedErr:          nil,
-			expectedErrMsg:       "Failed to reduce image size",
+			expectedResponseType: "errReturn400",
+			expectedErr:          errInvalidBase64Pic,
+			expectedErrMsg:       errInvalidBase64Pic.Error(),
+		},
+		{
+			name: "WithPicUnsupported",
+			inputParams: connections.UsersConnectionsGroupsByUserIDPostParams{
+				UserID: "dc9dbe3e-60d5-4a07-8c9c-42027b555b01",
+				Body: &models.UsersConnectionsGroupsPostRequest{
+					GroupName:         &groupName1,
+					ConnectionUserIds: connectionUserIds,
+					GroupPic:          "data:image/bmp;base64,Qk0AAAAAAAAAAA==",
+				},
+			},
+			inputPrincipal:       &models.Principal{},
+			expectedResponseType: "errReturn415",
+			expectedErr:          errUnsupportedPic,
+			expectedErrMsg:       errUnsupportedPic.Error(),
+		},
+		{
+			name: "MissingGroupName",
+			inputParams: connections.UsersConnectionsGroupsByUserIDPostParams{
+				UserID: "dc9dbe3e-60d5-4a07-8c9c-42027b555b01",
+				Body: &models.UsersConnectionsGroupsPostRequest{
+					ConnectionUserIds: connectionUserIds,
+				},
+			},
+			inputPrincipal:       &models.Principal{},
+			expectedResponseType: "errReturn400",
+			expectedErr:          errGroupNameRequired,
+			expectedErrMsg:       "group_name is required",
 		},
 	}
 
@@ -134,6 +176,79 @@ type TestCaseGetGroup struct {
 	expectedErr          error
 }
 
+func TestCreateConnectionsGroupsConcurrently(t *testing.T) {
+
+	concurrentCtlr := GetControllerMockDB()
+	groupName := "Concurrent Group"
+	userID := "dc9dbe3e-60d5-4a07-8c9c-42027b555b71"
+
+	responses := make(chan CreateConnectionsGroupsByUserIDResponse, 8)
+	var wg sync.WaitGroup
+	for i := 0; i < cap(responses); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			responses <- concurrentCtlr.CreateConnectionsGroupsByUserID(connections.UsersConnectionsGroupsByUserIDPostParams{
+				UserID: userID,
+				Body:   &models.UsersConnectionsGroupsPostRequest{GroupName: &groupName, ConnectionUserIds: connectionUserIds},
+			}, &models.Principal{})
+		}()
+	}
+	wg.Wait()
+	close(responses)
+
+	created := ""
+	existing := []string{}
+	for res := range responses {
+		switch res.resType {
+		case "Created":
+			if created != "" {
+				t.Fatalf("group created twice (%s, %s)", created, *res.createdPayload.GroupID)
+			}
+			created = *res.createdPayload.GroupID
+		case "OK":
+			existing = append(existing, *res.existsPayload.GroupID)
+		default:
+			t.Fatalf("unexpected response %+v", res)
+		}
+	}
+
+	for _, groupID := range existing {
+		assertEqual(t, groupID, created)
+	}
+}
+
+func TestGroupNameConflictInStorage(t *testing.T) {
+
+	db := GetControllerMockDB().DB
+	userID := "dc9dbe3e-60d5-4a07-8c9c-42027b555b72"
+	groupID, _ := db.CreateUserConnectionGroup(userID, internal.UserConnectionGroupInfo{GroupName: "Taken"}, nil)
+	otherID, _ := db.CreateUserConnectionGroup(userID, internal.UserConnectionGroupInfo{GroupName: "Other"}, nil)
+
+	var conflict *database.GroupNameConflictError
+
+	_, err := db.CreateUserConnectionGroup(userID, internal.UserConnectionGroupInfo{GroupName: "Taken"}, nil)
+	if !errors.As(err, &conflict) || conflict.GroupID != groupID {
+		t.Fatalf("expected a conflict with %s, got %v", groupID, err)
+	}
+	assertEqual(t, status.Code(err), codes.AlreadyExists)
+
+	_, err = db.UpdateUserConnectionGroup(userID, otherID, database.GroupPatch{GroupName: mergepatch.Set("Taken")}, nil)
+	if !errors.As(err, &conflict) {
+		t.Fatalf("expected a conflict on rename, got %v", err)
+	}
+
+	// Renaming a group to its own name is not a conflict.
+	if _, err := db.UpdateUserConnectionGroup(userID, groupID, database.GroupPatch{GroupName: mergepatch.Set("Taken")}, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// Another user may use the name.
+	if _, err := db.CreateUserConnectionGroup("dc9dbe3e-60d5-4a07-8c9c-42027b555b73", internal.UserConnectionGroupInfo{GroupName: "Taken"}, nil); err != nil {
+		t.Fatal(err)
+	}
+}
+
 func TestGetUsersConnectionsGroupsByUserIDAndGroupID(t *testing.T) {
 
 	// In Case if you need to add group manually into memory db then uncomment below code
@@ -208,6 +323,9 @@ func TestGetUsersConnectionsGroupsByUserID(t *testing.T) {
 	limit := int32(10)
 	offset := int32(0)
 	order := "asc"
+	negativeOffset := int32(-1)
+	maxLimit := config.Get().Pagination.MaxLimit
+	aboveMaxLimit := maxLimit + 1
 
 	testCases := []TestCaseGetGroups{
 		{
@@ -236,6 +354,30 @@ func TestGetUsersConnectionsGroupsByUserID(t *testing.T) {
 			expectedErr:          status.Error(codes.NotFound, "row does not found"),
 			expectedErrMsg:       "records not found",
 		},
+		{
+			name: "NegativeOffset",
+			inputParams: connections.UsersConnectionsGroupsByUserIDGetParams{
+				UserID: "dc9dbe3e-60d5-4a07-8c9c-42027b555b01",
+				Limit:  &limit,
+				Offset: &negativeOffset,
+			},
+			inputPrincipal:       &models.Principal{},
+			expectedResponseType: "errReturn400",
+			expectedErr:          status.Error(codes.InvalidArgument, "offset must not be negative"),
+			expectedErrMsg:       "offset must not be negative",
+		},
+		{
+			name: "LimitAboveMax",
+			inputParams: connections.UsersConnectionsGroupsByUserIDGetParams{
+				UserID: "dc9dbe3e-60d5-4a07-8c9c-42027b555b01",
+				Limit:  &aboveMaxLimit,
+				Offset: &offset,
+			},
+			inputPrincipal:       &models.Principal{},
+			expectedResponseType: "errReturn400",
+			expectedErr:          status.Errorf(codes.InvalidArgument, "limit must be between 1 and %d", maxLimit),
+			expectedErrMsg:       fmt.Sprintf("limit must be between 1 and %d", maxLimit),
+		},
 	}
 
 	for _, test := range testCases {
@@ -254,6 +396,89 @@ func TestGetUsersConnectionsGroupsByUserID(t *testing.T) {
 	}
 }
 
+type TestCaseGroupsTimeRange struct {
+	name                 string
+	after                *strfmt.DateTime
+	before               *strfmt.DateTime
+	timeBounds           string
+	expectedResponseType string
+	expectedGroups       []string
+}
+
+func TestGetUsersConnectionsGroupsByTimeRange(t *testing.T) {
+
+	rangeCtlr := GetControllerMockDB()
+	userID := "dc9dbe3e-60d5-4a07-8c9c-42027b555b94"
+	order := "asc"
+
+	interactions := []strfmt.DateTime{}
+	for i, groupName := range []string{"First Ranged Group", "Second Ranged Group", "Third Ranged Group"} {
+		interactedAt := time.Date(2021, 10, 18, 12+i, 0, 0, 0, time.UTC)
+		rangeCtlr.DB.CreateUserConnectionGroup(userID, internal.UserConnectionGroupInfo{GroupName: groupName, LatestInteractionTime: interactedAt}, nil)
+		interactions = append(interactions, strfmt.DateTime(interactedAt))
+	}
+
+	testCases := []TestCaseGroupsTimeRange{
+		{
+			name:                 "AfterOnly",
+			after:                &interactions[0],
+			expectedResponseType: "OK",
+			expectedGroups:       []string{"Second Ranged Group", "Third Ranged Group"},
+		},
+		{
+			name:                 "AfterOnlyInclusive",
+			after:                &interactions[0],
+			timeBounds:           "inclusive",
+			expectedResponseType: "OK",
+			expectedGroups:       []string{"First Ranged Group", "Second Ranged Group", "Third Ranged Group"},
+		},
+		{
+			name:                 "BeforeOnly",
+			before:               &interactions[2],
+			expectedResponseType: "OK",
+			expectedGroups:       []string{"First Ranged Group", "Second Ranged Group"},
+		},
+		{
+			name:                 "Between",
+			after:                &interactions[0],
+			before:               &interactions[2],
+			expectedResponseType: "OK",
+			expectedGroups:       []string{"Second Ranged Group"},
+		},
+		{
+			name:                 "Reversed",
+			after:                &interactions[2],
+			before:               &interactions[0],
+			expectedResponseType: "errReturn400",
+			expectedGroups:       []string{},
+		},
+	}
+
+	for _, test := range testCases {
+
+		t.Run(test.name, func(t *testing.T) {
+			params := connections.UsersConnectionsGroupsByUserIDGetParams{
+				UserID:                      userID,
+				Order:                       &order,
+				LatestInteractionTimeAfter:  test.after,
+				LatestInteractionTimeBefore: test.before,
+			}
+			if test.timeBounds != "" {
+				params.TimeBounds = &test.timeBounds
+			}
+
+			res := rangeCtlr.GetUsersConnectionsGroupsByUserID(params, &models.Principal{})
+			assertEqual(t, res.resType, test.expectedResponseType)
+
+			groups := []string{}
+			for _, group := range res.payload.Groups {
+				groups = append(groups, *group.GroupName)
+			}
+			assertEqual(t, groups, test.expectedGroups)
+		})
+	}
+}
+
 type TestCaseUpdateGroup struct {
 	name                 string
 	inputParams          connections.UsersConnectionsGroupsByUserIDAndGroupIDPatchParams
@@ -314,9 +539,9 @@ func TestUpdateUsersConnectionsGroupsByUserIDAndGroupID(t *testing.T) {
 				},
 			},
 			inputPrincipal:       &models.Principal{},
-			expectedResponseType: "OK",
-			expectedErr:          nil,
-			expectedErrMsg:       "Failed to reduce image size",
+			expectedResponseType: "errReturn400",
+			expectedErr:          errInvalidBase64Pic,
+			expectedErrMsg:       errInvalidBase64Pic.Error(),
 		},
 		{
 			name: "InternalError",
@@ -352,6 +577,129 @@ func TestUpdateUsersConnectionsGroupsByUserIDAndGroupID(t *testing.T) {
 	}
 }
 
+type TestCaseMergePatchGroup struct {
+	name                 string
+	document             string
+	expectedResponseType string
+	expectedErrMsg       string
+	expectedGroupName    string
+	expectedGroupPic     string
+}
+
+func TestUpdateGroupMergePatch(t *testing.T) {
+
+	patchCtlr := GetControllerMockDB()
+	userID := "dc9dbe3e-60d5-4a07-8c9c-42027b555b41"
+	groupID, _ := patchCtlr.DB.CreateUserConnectionGroup(userID, internal.UserConnectionGroupInfo{GroupName: "Merge Patch Group"}, nil)
+	if _, err := patchCtlr.DB.SetUserConnectionGroupPic(userID, groupID, "pic_1", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []TestCaseMergePatchGroup{
+		{
+			name:                 "AbsentKeepsPicture",
+			document:             `{"group_name": "Renamed Group"}`,
+			expectedResponseType: "Updated",
+			expectedGroupName:    "Renamed Group",
+			expectedGroupPic:     "pic_1",
+		},
+		{
+			name:                 "NullName",
+			document:             `{"group_name": null}`,
+			expectedResponseType: "errReturn400",
+			expectedErrMsg:       "group_name cannot be removed",
+			expectedGroupName:    "Renamed Group",
+			expectedGroupPic:     "pic_1",
+		},
+		{
+			name:                 "NotAnObject",
+			document:             `["group_pic"]`,
+			expectedResponseType: "errReturn400",
+			expectedErrMsg:       errInvalidPatch.Error(),
+			expectedGroupName:    "Renamed Group",
+			expectedGroupPic:     "pic_1",
+		},
+		{
+			name:                 "NullClearsPicture",
+			document:             `{"group_pic": null}`,
+			expectedResponseType: "Updated",
+			expectedGroupName:    "Renamed Group",
+			expectedGroupPic:     "",
+		},
+	}
+
+	for _, test := range testCases {
+
+		t.Run(test.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPatch, "/users/"+userID+"/connections/groups/"+groupID, nil)
+			req = req.WithContext(mergepatch.NewContext(req.Context(), []byte(test.document)))
+
+			res := patchCtlr.UpdateUsersConnectionsGroupsByUserIDAndGroupID(
+				connections.UsersConnectionsGroupsByUserIDAndGroupIDPatchParams{HTTPRequest: req, UserID: userID, GroupID: groupID},
+				&models.Principal{},
+			)
+
+			assertEqual(t, res.resType, test.expectedResponseType)
+			assertEqual(t, res.errMsg, test.expectedErrMsg)
+
+			group, _ := patchCtlr.DB.GetUserConnectionGroupByGroupID(userID, groupID)
+			assertEqual(t, group.GroupName, test.expectedGroupName)
+			assertEqual(t, group.GroupPic, test.expectedGroupPic)
+		})
+	}
+}
+
+func TestUpdateGroupHistoryConcurrently(t *testing.T) {
+
+	patchCtlr := GetControllerMockDB()
+	userID := "dc9dbe3e-60d5-4a07-8c9c-42027b555b42"
+	groupID, _ := patchCtlr.DB.CreateUserConnectionGroup(userID, internal.UserConnectionGroupInfo{GroupName: "Concurrent History Group"}, nil)
+
+	const members = 20
+	var wg sync.WaitGroup
+	for i := 0; i < members; i++ {
+		wg.Add(1)
+		go func(member string) {
+			defer wg.Done()
+
+			req := httptest.NewRequest(http.MethodPatch, "/users/"+userID+"/connections/groups/"+groupID, nil)
+			req = req.WithContext(mergepatch.NewContext(req.Context(), []byte(`{"connection_user_id_to_add": "`+member+`"}`)))
+			res := patchCtlr.UpdateUsersConnectionsGroupsByUserIDAndGroupID(
+				connections.UsersConnectionsGroupsByUserIDAndGroupIDPatchParams{HTTPRequest: req, UserID: userID, GroupID: groupID},
+				&models.Principal{},
+			)
+			if res.resType != "Updated" {
+				t.Errorf("unexpected response %+v", res)
+			}
+		}(fmt.Sprintf("member_%d", i))
+	}
+	wg.Wait()
+
+	// Every entry after the creation adds exactly its member to the members of the entry before it.
+	entries, total, err := patchCtlr.DB.ListGroupHistory(userID, groupID, 0, members)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, total, members+1)
+
+	for _, entry := range entries {
+		assertEqual(t, len(entry.Changes), 1)
+		change := entry.Changes[0]
+		assertEqual(t, change.Field, "connection_user_ids")
+		assertEqual(t, len(change.Added), 1)
+		assertEqual(t, len(change.Removed), 0)
+		assertEqual(t, len(change.After.([]string)), len(change.Before.([]string))+1)
+	}
+
+	// A rename refused by the name index records nothing.
+	patchCtlr.DB.CreateUserConnectionGroup(userID, internal.UserConnectionGroupInfo{GroupName: "Taken History Name"}, nil)
+	if _, err := patchCtlr.DB.UpdateUserConnectionGroup(userID, groupID, database.GroupPatch{GroupName: mergepatch.Set("Taken History Name")}, nil); err == nil {
+		t.Fatal("expected a conflict on rename")
+	}
+	_, total, _ = patchCtlr.DB.ListGroupHistory(userID, groupID, 0, members)
+	assertEqual(t, total, members+1)
+}
+
 type TestCaseDeleteGroup struct {
 	name                 string
 	inputParams          connections.UsersConnectionsGroupsByUserIDAndGroupIDDeleteParams
@@ -1,9 +1,76 @@
 package controllers
 
-import "learning/unit-testing/database"
+import (
+	"fmt"
+	"sync"
+
+	"learning/unit-testing/blobstore"
+	"learning/unit-testing/config"
+	"learning/unit-testing/database"
+)
 
 type Ctlr struct {
-	DB database.Storage
+	DB    database.Storage
+	Blobs blobstore.BlobStore
+}
+
+var (
+	memoryDB     database.Storage
+	memoryDBOnce sync.Once
+
+	blobs     blobstore.BlobStore
+	blobsErr  error
+	blobsOnce sync.Once
+)
+
+// GetController - Controller backed by the storage selected in the configuration.
+func GetController() (Ctlr, error) {
+
+	switch backend := config.Get().Storage.Backend; backend {
+	case config.BackendFirestore:
+		return GetControllerDB()
+	case config.BackendMemory:
+		// The memory storage must outlive a single request to be of any use.
+		memoryDBOnce.Do(func() {
+			memoryDB = database.NewMetricsStorage(database.NewMockConnection())
+		})
+		blobStore, err := GetBlobStore()
+		if err != nil {
+			return Ctlr{}, err
+		}
+		return Ctlr{DB: memoryDB, Blobs: blobStore}, nil
+	default:
+		return Ctlr{}, fmt.Errorf("unknown storage backend %q", backend)
+	}
+}
+
+// GetBlobStore - Blob store selected in the configuration, shared by all requests.
+func GetBlobStore() (blobstore.BlobStore, error) {
+
+	blobsOnce.Do(func() {
+		cfg := config.Get().Blobs
+
+		switch cfg.Backend {
+		case config.BlobBackendMemory:
+			blobs = blobstore.NewMemory()
+		case config.BlobBackendFilesystem:
+			blobs, blobsErr = blobstore.NewFilesystem(cfg.Dir)
+		case config.BlobBackendS3:
+			blobs, blobsErr = blobstore.NewS3(blobstore.S3Options{
+				Endpoint:  cfg.S3.Endpoint,
+				Region:    cfg.S3.Region,
+				Bucket:    cfg.S3.Bucket,
+				AccessKey: cfg.S3.AccessKey,
+				SecretKey: cfg.S3.SecretKey,
+				UseSSL:    cfg.S3.UseSSL,
+				Prefix:    cfg.S3.Prefix,
+			})
+		default:
+			blobsErr = fmt.Errorf("unknown blob backend %q", cfg.Backend)
+		}
+	})
+
+	return blobs, blobsErr
 }
 
 func GetControllerDB() (Ctlr, error) {
@@ -15,7 +82,12 @@ func GetControllerDB() (Ctlr, error) {
 		return ctlr, err
 	}
 
-	ctlr.DB = dbConnection
+	ctlr.DB = database.NewMetricsStorage(dbConnection)
+
+	ctlr.Blobs, err = GetBlobStore()
+	if err != nil {
+		return ctlr, err
+	}
 
 	return ctlr, nil
 }
@@ -24,5 +96,5 @@ func GetControllerMockDB() Ctlr {
 
 	dbConnection := database.NewMockConnection()
 
-	return Ctlr{DB: dbConnection}
+	return Ctlr{DB: dbConnection, Blobs: blobstore.NewMemory()}
 }
@@ -0,0 +1,181 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math/rand"
+	"sync"
+	"time"
+
+	"learning/unit-testing/config"
+	"learning/unit-testing/database"
+	"learning/unit-testing/events"
+	"learning/unit-testing/tracing"
+
+	"go.opentelemetry.io/otel/attribute"
+	otelcodes "go.opentelemetry.io/otel/codes"
+)
+
+// eventStream - In-process sink, consumers of this instance subscribe to it.
+var eventStream = events.NewChannelSink()
+
+// EventStream - Events dispatched by this instance when the channel sink is configured.
+func EventStream() *events.ChannelSink {
+	return eventStream
+}
+
+// NewEventSinks - Sinks of the configuration, in order, the subscriptions sink queueing deliveries in ctlr's storage.
+func NewEventSinks(ctlr Ctlr, cfg config.EventsConfig) ([]events.Sink, error) {
+	sinks := []events.Sink{}
+	for _, name := range cfg.Sinks {
+		sink, err := newEventSink(ctlr, name, cfg)
+		if err != nil {
+			for _, opened := range sinks {
+				opened.Close()
+			}
+			return nil, err
+		}
+		sinks = append(sinks, sink)
+	}
+	return sinks, nil
+}
+
+func newEventSink(ctlr Ctlr, name string, cfg config.EventsConfig) (events.Sink, error) {
+	switch name {
+	case config.EventSinkSubscriptions:
+		return NewSubscriptionSink(ctlr.DB), nil
+	case config.EventSinkChannel:
+		return eventStream, nil
+	case config.EventSinkFile:
+		return events.NewFileSink(cfg.File)
+	case config.EventSinkWebhook:
+		return events.NewWebhookSink(cfg.WebhookURL, nil), nil
+	case config.EventSinkNATS:
+		return events.NewNATSSink(cfg.NATSURL, cfg.NATSSubject)
+	}
+	return nil, fmt.Errorf("unknown event sink %q", name)
+}
+
+// EventDispatcher - Publish the domain events of the outbox to every sink. Events are delivered at least once:
+// an event that failed on one sink is published again to all of them.
+type EventDispatcher struct {
+	ctlr   Ctlr
+	config config.EventsConfig
+	sinks  []events.Sink
+
+	// jitter returns a random duration in [0, n), replaced in tests.
+	jitter func(n time.Duration) time.Duration
+	now    func() time.Time
+
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// NewEventDispatcher - Dispatcher of the outbox of ctlr's storage to sinks.
+func NewEventDispatcher(ctlr Ctlr, cfg config.EventsConfig, sinks []events.Sink) *EventDispatcher {
+	return &EventDispatcher{
+		ctlr:   ctlr,
+		config: cfg,
+		sinks:  sinks,
+		jitter: func(n time.Duration) time.Duration { return time.Duration(rand.Int63n(int64(n))) },
+		now:    time.Now,
+	}
+}
+
+// Start - Dispatch every PollInterval until Stop is called.
+func (d *EventDispatcher) Start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	d.cancel = cancel
+
+	d.wg.Add(1)
+	go func() {
+		defer d.wg.Done()
+
+		ticker := time.NewTicker(time.Duration(d.config.PollInterval))
+		defer ticker.Stop()
+
+		for {
+			// Keep draining while there are events, wait for the next tick otherwise.
+			for ctx.Err() == nil && d.poll(ctx) > 0 {
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Stop - Stop dispatching, wait for the dispatch in progress and close the sinks. Events left claimed are
+// dispatched again once their lease expires.
+func (d *EventDispatcher) Stop() {
+	if d.cancel != nil {
+		d.cancel()
+	}
+	d.wg.Wait()
+
+	for _, sink := range d.sinks {
+		if err := sink.Close(); err != nil {
+			log.Printf("failed to close %s event sink (%s)", sink.Name(), err.Error())
+		}
+	}
+}
+
+// poll - Claim a batch of events and dispatch them, returning how many were claimed.
+func (d *EventDispatcher) poll(ctx context.Context) int {
+	claimed, err := d.ctlr.DB.ClaimOutboxEvents(d.now(), time.Duration(d.config.Lease), d.config.BatchSize)
+	if err != nil {
+		log.Printf("failed to claim outbox events (%s)", err.Error())
+		return 0
+	}
+
+	for _, event := range claimed {
+		d.dispatch(ctx, event)
+	}
+	return len(claimed)
+}
+
+// dispatch - Publish a claimed event to every sink, then complete, retry or fail it.
+func (d *EventDispatcher) dispatch(ctx context.Context, event database.OutboxEvent) {
+
+	ctx, span := tracing.Tracer().Start(ctx, "EventDispatcher.Dispatch")
+	defer span.End()
+	span.SetAttributes(attribute.String("event.id", event.EventID), attribute.String("event.type", event.Type), attribute.Int("event.attempts", event.Attempts))
+
+	db := database.NewTracingStorage(ctx, d.ctlr.DB)
+
+	var publishErr error
+	envelope := event.Envelope()
+	for _, sink := range d.sinks {
+		if err := sink.Publish(ctx, envelope); err != nil {
+			publishErr = fmt.Errorf("%s sink: %w", sink.Name(), err)
+			break
+		}
+	}
+
+	if publishErr == nil {
+		if err := db.CompleteOutboxEvent(event.EventID); err != nil {
+			log.Printf("failed to complete outbox event (%s) (%s)", event.EventID, err.Error())
+		}
+		return
+	}
+
+	span.RecordError(publishErr)
+	span.SetStatus(otelcodes.Error, publishErr.Error())
+	log.Printf("outbox event (%s) of group (%s) failed on attempt %d (%s)", event.EventID, event.GroupID, event.Attempts, publishErr.Error())
+
+	if event.Attempts < d.config.MaxAttempts {
+		availableAt := d.now().Add(retryBackoff(time.Duration(d.config.BaseBackoff), time.Duration(d.config.MaxBackoff), event.Attempts, d.jitter))
+		if err := db.RetryOutboxEvent(event.EventID, availableAt, publishErr.Error()); err != nil {
+			log.Printf("failed to reschedule outbox event (%s) (%s)", event.EventID, err.Error())
+		}
+		return
+	}
+
+	if err := db.FailOutboxEvent(event.EventID, publishErr.Error()); err != nil {
+		log.Printf("failed to mark outbox event (%s) as failed (%s)", event.EventID, err.Error())
+	}
+}
@@ -0,0 +1,154 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"learning/unit-testing/config"
+	"learning/unit-testing/database"
+	"learning/unit-testing/events"
+	"learning/unit-testing/internal"
+	"learning/unit-testing/jsonpatch"
+	"learning/unit-testing/models"
+	"learning/unit-testing/restapi/operations/connections"
+)
+
+// failingSink - Sink rejecting every event.
+type failingSink struct{}
+
+func (failingSink) Name() string { return "failing" }
+
+func (failingSink) Publish(ctx context.Context, event events.Envelope) error {
+	return errors.New("sink unavailable")
+}
+
+func (failingSink) Close() error { return nil }
+
+type TestCaseEventDispatcher struct {
+	name           string
+	action         func()
+	expectedEvents []events.Event
+}
+
+func TestEventDispatcher(t *testing.T) {
+
+	eventsCtlr := GetControllerMockDB()
+	userID := "dc9dbe3e-60d5-4a07-8c9c-42027b555b71"
+	memberID := connectionUserIds[0].UserID
+	groupName := "Evented Group"
+	var groupID string
+
+	sink := events.NewChannelSink()
+	received, cancel := sink.Subscribe(10)
+	defer cancel()
+	dispatcher := NewEventDispatcher(eventsCtlr, config.Defaults().Events, []events.Sink{sink})
+
+	testCases := []TestCaseEventDispatcher{
+		{
+			name: "Created",
+			action: func() {
+				eventsCtlr.CreateConnectionsGroupsByUserID(connections.UsersConnectionsGroupsByUserIDPostParams{
+					UserID: userID,
+					Body:   &models.UsersConnectionsGroupsPostRequest{GroupName: &groupName, ConnectionUserIds: connectionUserIds},
+				}, &models.Principal{})
+				group, _ := eventsCtlr.DB.GetUserConnectionGroupByName(userID, groupName)
+				groupID = group.GroupID
+			},
+			expectedEvents: []events.Event{events.GroupCreated{GroupName: groupName, ConnectionUserIDs: []string{memberID}}},
+		},
+		{
+			name: "RenamedAndMembersChanged",
+			action: func() {
+				patch, _ := jsonpatch.Decode([]byte(`[
+					{"op": "replace", "path": "/group_name", "value": "Renamed Evented Group"},
+					{"op": "replace", "path": "/connection_user_ids", "value": ["member_2"]}
+				]`))
+				eventsCtlr.PatchGroup(GroupJSONPatchParams{UserID: userID, GroupID: groupID, Patch: patch}, &models.Principal{})
+			},
+			expectedEvents: []events.Event{
+				events.GroupRenamed{OldName: groupName, NewName: "Renamed Evented Group"},
+				events.MemberAdded{MemberUserID: "member_2"},
+				events.MemberRemoved{MemberUserID: memberID},
+			},
+		},
+		{
+			name: "PictureChanged",
+			action: func() {
+				eventsCtlr.DB.SetUserConnectionGroupPic(userID, groupID, "pic_1", nil)
+			},
+			expectedEvents: []events.Event{events.PictureChanged{NewGroupPic: "pic_1"}},
+		},
+		{
+			name: "FailedChangeHasNoEvents",
+			action: func() {
+				patch, _ := jsonpatch.Decode([]byte(`[{"op": "test", "path": "/group_name", "value": "Other Name"}, {"op": "remove", "path": "/group_pic"}]`))
+				eventsCtlr.PatchGroup(GroupJSONPatchParams{UserID: userID, GroupID: groupID, Patch: patch}, &models.Principal{})
+			},
+			expectedEvents: []events.Event{},
+		},
+		{
+			name: "DeletedAndRestored",
+			action: func() {
+				eventsCtlr.DeleteUsersConnectionsGroupsByUserIDAndGroupID(connections.UsersConnectionsGroupsByUserIDAndGroupIDDeleteParams{UserID: userID, GroupID: groupID}, &models.Principal{})
+				eventsCtlr.RestoreGroup(TrashParams{UserID: userID, GroupID: groupID}, &models.Principal{})
+			},
+			expectedEvents: []events.Event{
+				events.GroupDeleted{GroupName: "Renamed Evented Group"},
+				events.GroupRestored{GroupName: "Renamed Evented Group"},
+			},
+		},
+	}
+
+	for _, test := range testCases {
+
+		t.Run(test.name, func(t *testing.T) {
+			test.action()
+			assertEqual(t, dispatcher.poll(context.Background()), len(test.expectedEvents))
+
+			dispatched := []events.Event{}
+			for range test.expectedEvents {
+				envelope := <-received
+				assertEqual(t, envelope.GroupID, groupID)
+				event, err := envelope.Decode()
+				if err != nil {
+					t.Fatal(err)
+				}
+				dispatched = append(dispatched, event)
+			}
+			assertEqual(t, dispatched, test.expectedEvents)
+			assertEqual(t, len(eventsCtlr.DB.(*database.MockConnection).OutboxEvents()), 0)
+		})
+	}
+}
+
+func TestEventDispatcherFailures(t *testing.T) {
+
+	now := time.Now().Round(0)
+	eventsCtlr := GetControllerMockDB()
+	userID := "dc9dbe3e-60d5-4a07-8c9c-42027b555b72"
+	eventsCtlr.DB.CreateUserConnectionGroup(userID, internal.UserConnectionGroupInfo{GroupName: "Undeliverable Group"}, nil)
+
+	cfg := config.Defaults().Events
+	cfg.MaxAttempts = 2
+	dispatcher := NewEventDispatcher(eventsCtlr, cfg, []events.Sink{failingSink{}})
+	dispatcher.jitter = func(time.Duration) time.Duration { return 0 }
+	dispatcher.now = func() time.Time { return now.Add(time.Hour) }
+
+	// Retried after the base backoff.
+	assertEqual(t, dispatcher.poll(context.Background()), 1)
+	outbox := eventsCtlr.DB.(*database.MockConnection).OutboxEvents()
+	assertEqual(t, outbox[0].Status, database.OutboxEventPending)
+	assertEqual(t, outbox[0].AvailableAt, now.Add(time.Hour+time.Duration(cfg.BaseBackoff)))
+	assertEqual(t, outbox[0].LastError, "failing sink: sink unavailable")
+
+	// Not available before then.
+	assertEqual(t, dispatcher.poll(context.Background()), 0)
+
+	dispatcher.now = func() time.Time { return now.Add(2 * time.Hour) }
+	assertEqual(t, dispatcher.poll(context.Background()), 1)
+	outbox = eventsCtlr.DB.(*database.MockConnection).OutboxEvents()
+	assertEqual(t, outbox[0].Status, database.OutboxEventFailed)
+	assertEqual(t, outbox[0].Attempts, 2)
+}
@@ -0,0 +1,24 @@
+package controllers
+
+import (
+	"encoding/json"
+
+	"learning/unit-testing/models"
+)
+
+// principalClaims - Authenticated caller as recorded in group history, nil for background work.
+func principalClaims(principal *models.Principal) map[string]interface{} {
+	if principal == nil {
+		return nil
+	}
+
+	raw, err := json.Marshal(principal)
+	if err != nil {
+		return nil
+	}
+	var claims map[string]interface{}
+	if err := json.Unmarshal(raw, &claims); err != nil {
+		return nil
+	}
+	return claims
+}
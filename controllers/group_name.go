@@ -0,0 +1,14 @@
+package controllers
+
+import (
+	"learning/unit-testing/config"
+	"learning/unit-testing/groupname"
+)
+
+// applyGroupNamePolicy - Normalized form of a new group name, or a *groupname.ViolationError when the configured
+// policy rejects it. Names already stored are left as they are.
+func applyGroupNamePolicy(groupName string) (string, error) {
+	groupNames := config.Get().GroupNames
+	policy := groupname.Policy{MaxGraphemes: groupNames.MaxGraphemes, Blocked: groupNames.Blocked}
+	return policy.Apply(groupName)
+}
@@ -0,0 +1,89 @@
+package controllers
+
+import (
+	"testing"
+
+	"learning/unit-testing/models"
+	"learning/unit-testing/restapi/operations/connections"
+)
+
+type TestCaseGroupNamePolicy struct {
+	name                 string
+	groupName            string
+	expectedResponseType string
+	expectedGroupName    string
+}
+
+func TestCreateGroupNamePolicy(t *testing.T) {
+
+	policyCtlr := GetControllerMockDB()
+	userID := "dc9dbe3e-60d5-4a07-8c9c-42027b555b81"
+
+	testCases := []TestCaseGroupNamePolicy{
+		{
+			name:                 "Normalized",
+			groupName:            "  Famílie \t Home ",
+			expectedResponseType: "Created",
+			expectedGroupName:    "Famílie Home",
+		},
+		{
+			name:                 "SameKeyExists",
+			groupName:            "FAMI\u0301LIE HOME",
+			expectedResponseType: "OK",
+			expectedGroupName:    "Famílie Home",
+		},
+		{
+			name:                 "Blank",
+			groupName:            " \n ",
+			expectedResponseType: "errReturn400",
+		},
+		{
+			name:                 "ControlCharacter",
+			groupName:            "Home\x00",
+			expectedResponseType: "errReturn400",
+		},
+	}
+
+	for _, test := range testCases {
+
+		t.Run(test.name, func(t *testing.T) {
+			groupName := test.groupName
+			res := policyCtlr.CreateConnectionsGroupsByUserID(connections.UsersConnectionsGroupsByUserIDPostParams{
+				UserID: userID,
+				Body:   &models.UsersConnectionsGroupsPostRequest{GroupName: &groupName, ConnectionUserIds: connectionUserIds},
+			}, &models.Principal{})
+			t.Logf("Actual Response: %+v\n", res)
+			assertEqual(t, res.resType, test.expectedResponseType)
+
+			if test.expectedGroupName != "" {
+				group, err := policyCtlr.DB.GetUserConnectionGroupByName(userID, test.groupName)
+				if err != nil {
+					t.Fatal(err)
+				}
+				assertEqual(t, group.GroupName, test.expectedGroupName)
+			}
+		})
+	}
+}
+
+func TestRenameGroupCase(t *testing.T) {
+
+	policyCtlr := GetControllerMockDB()
+	userID := "dc9dbe3e-60d5-4a07-8c9c-42027b555b82"
+	groupName := "family"
+	created := policyCtlr.CreateConnectionsGroupsByUserID(connections.UsersConnectionsGroupsByUserIDPostParams{
+		UserID: userID,
+		Body:   &models.UsersConnectionsGroupsPostRequest{GroupName: &groupName, ConnectionUserIds: connectionUserIds},
+	}, &models.Principal{})
+	groupID := *created.createdPayload.GroupID
+
+	res := policyCtlr.UpdateUsersConnectionsGroupsByUserIDAndGroupID(connections.UsersConnectionsGroupsByUserIDAndGroupIDPatchParams{
+		UserID:  userID,
+		GroupID: groupID,
+		Body:    &models.UsersConnectionsGroupsPatchRequest{GroupName: " Family "},
+	}, &models.Principal{})
+	assertEqual(t, res.resType, "Updated")
+
+	group, _ := policyCtlr.DB.GetUserConnectionGroupByGroupID(userID, groupID)
+	assertEqual(t, group.GroupName, "Family")
+}
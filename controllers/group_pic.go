@@ -0,0 +1,331 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"learning/unit-testing/blobstore"
+	"learning/unit-testing/config"
+	"learning/unit-testing/database"
+	"learning/unit-testing/imaging"
+	"learning/unit-testing/metrics"
+	"learning/unit-testing/models"
+	"learning/unit-testing/tracing"
+
+	"github.com/go-openapi/swag"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	grpccodes "google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// groupPicture - A group picture as uploaded and as reduced for storage.
+type groupPicture struct {
+	original []byte
+	reduced  []byte
+}
+
+// uploadKeyPrefix - blob key prefix of sanitized uploads waiting for the picture workers.
+const uploadKeyPrefix = "upload-"
+
+// stageEncodedGroupPic - Stage a base64 encoded group picture of a JSON body, optionally prefixed by a data URI.
+func (c Ctlr) stageEncodedGroupPic(ctx context.Context, groupPic string) (string, error) {
+
+	if strings.Contains(groupPic, "base64,") {
+		groupPic = groupPic[strings.IndexByte(groupPic, ',')+1:]
+	}
+
+	data, err := base64.StdEncoding.DecodeString(groupPic)
+	if err != nil {
+		return "", &imaging.RejectionError{Reason: imaging.ReasonCorrupt, Detail: "picture is not valid base64"}
+	}
+
+	return c.stageGroupPic(ctx, data)
+}
+
+// stageGroupPic - Validate a group picture and keep the sanitized bytes in the blob store until a picture worker
+// reduces them. Returns the blob key of the upload.
+func (c Ctlr) stageGroupPic(ctx context.Context, data []byte) (string, error) {
+
+	sanitized, err := sanitizeGroupPic(data, config.Get().Images)
+	if err != nil {
+		return "", err
+	}
+
+	key := uploadKeyPrefix + database.GenerateUUID()
+	if err := c.Blobs.Put(ctx, key, bytes.NewReader(sanitized.Data), int64(len(sanitized.Data)), sanitized.ContentType); err != nil {
+		return "", err
+	}
+
+	return key, nil
+}
+
+// discardStagedGroupPic - Delete a staged upload that no group will use.
+func (c Ctlr) discardStagedGroupPic(ctx context.Context, uploadKey string) {
+	if err := c.Blobs.Delete(ctx, uploadKey); err != nil && !errors.Is(err, blobstore.ErrNotFound) {
+		log.Printf("failed to delete staged picture (%s) (%s)", uploadKey, err.Error())
+	}
+}
+
+// enqueueGroupPic - Mark the group picture as processing and queue its staged upload for the picture workers, which
+// change the picture on behalf of principal.
+func enqueueGroupPic(db database.Storage, userID string, groupID string, uploadKey string, principal *models.Principal) error {
+
+	// The status goes first so that a fast worker cannot have its result overwritten.
+	if err := db.SetUserConnectionGroupPicStatus(userID, groupID, database.PictureStatusProcessing, ""); err != nil {
+		return err
+	}
+
+	_, err := db.EnqueuePictureJob(database.PictureJob{UserID: userID, GroupID: groupID, UploadKey: uploadKey, Principal: principalClaims(principal)})
+	return err
+}
+
+// reduceGroupPic - Reduce a sanitized group picture to the configured size bounds, recording processing time and sizes.
+func reduceGroupPic(ctx context.Context, data []byte) (*groupPicture, error) {
+
+	_, span := tracing.Tracer().Start(ctx, "ReduceBase64EncodedImage")
+	defer span.End()
+
+	start := time.Now()
+
+	imageConfig := config.Get().Images
+	max := imageConfig.MaxSizeBytes
+	min := imageConfig.MinSizeBytes()
+	sizeSpecs := ImageOptions{
+		MaxImageSizeBytes: &max,
+		MinImageSizeBytes: &min,
+	}
+
+	metrics.ImageInputBytes.Observe(float64(len(data)))
+
+	picture := groupPicture{original: data}
+	reducedGroupPic, err := ReduceBase64EncodedImage(base64.StdEncoding.EncodeToString(data), &sizeSpecs)
+	if err == nil && reducedGroupPic == nil {
+		err = errors.New("image reduction produced no picture")
+	}
+	if err == nil {
+		picture.reduced, err = base64.StdEncoding.DecodeString(*reducedGroupPic)
+	}
+
+	elapsed := time.Since(start)
+	metrics.ImageProcessingDuration.Observe(elapsed.Seconds())
+
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+
+	span.SetAttributes(attribute.Int("image.input_bytes", len(data)))
+	span.SetAttributes(attribute.Int("image.output_bytes", len(picture.reduced)))
+	metrics.ImageOutputBytes.Observe(float64(len(picture.reduced)))
+
+	log.Printf("Image Processing took %s", elapsed)
+
+	return &picture, nil
+}
+
+// sanitizeGroupPic - Validate a picture and strip its metadata before it reaches the image reducer.
+func sanitizeGroupPic(data []byte, imageConfig config.ImageConfig) (*imaging.Sanitized, error) {
+	return imaging.Sanitize(data, imaging.Limits{
+		MaxBytes:     int(imageConfig.MaxUploadBytes),
+		MaxDimension: imageConfig.MaxDimension,
+		MaxPixels:    imageConfig.MaxPixels,
+	})
+}
+
+// rejectionResType - Result type of a picture rejected by validation: 415 for unsupported formats,
+// 413 for oversized pictures and 400 otherwise. ok is false for other errors.
+func rejectionResType(err error) (resType string, ok bool) {
+	var rejection *imaging.RejectionError
+	if !errors.As(err, &rejection) {
+		return "", false
+	}
+
+	switch rejection.Reason {
+	case imaging.ReasonUnsupportedFormat:
+		return "errReturn415", true
+	case imaging.ReasonTooLarge, imaging.ReasonTooManyPixels:
+		return "errReturn413", true
+	}
+	return "errReturn400", true
+}
+
+// renditionKey - Blob key of a rendition of a picture.
+func renditionKey(groupPicID string, rendition string) string {
+	if rendition == "" || rendition == config.OriginalRendition {
+		return groupPicID
+	}
+	return groupPicID + "_" + rendition
+}
+
+// storeGroupPic - Store a reduced group picture and its configured renditions in the blob store under its content hash.
+// Returns the picture ID to keep on the group.
+func (c Ctlr) storeGroupPic(ctx context.Context, picture *groupPicture) (string, error) {
+
+	key := blobstore.ContentKey(picture.reduced)
+
+	// Identical pictures share the blob, no need to upload it twice.
+	if err := c.putBlobIfMissing(ctx, key, picture.reduced, http.DetectContentType(picture.reduced)); err != nil {
+		return "", err
+	}
+
+	specs := []imaging.Spec{}
+	for _, rendition := range config.Get().Images.Renditions {
+		if _, err := c.Blobs.Stat(ctx, renditionKey(key, rendition.Name)); errors.Is(err, blobstore.ErrNotFound) {
+			specs = append(specs, imaging.Spec{Name: rendition.Name, Size: rendition.Size, Square: rendition.Square})
+		}
+	}
+	if len(specs) == 0 {
+		return key, nil
+	}
+
+	source := picture.original
+	if len(source) == 0 {
+		source = picture.reduced
+	}
+	renditions, err := imaging.Renditions(source, specs)
+	if err != nil {
+		// Clients fall back to the original picture when a rendition is missing.
+		log.Printf("failed to generate renditions of group picture (%s) (%s)", key, err.Error())
+		return key, nil
+	}
+
+	for _, rendition := range renditions {
+		if err := c.putBlobIfMissing(ctx, renditionKey(key, rendition.Name), rendition.Data, rendition.ContentType); err != nil {
+			return "", err
+		}
+	}
+
+	return key, nil
+}
+
+// unreferencedGroupPicsBatch - pictures freed per call of freeUnreferencedGroupPics.
+const unreferencedGroupPicsBatch = 100
+
+// reusableGroupPic - Picture already reduced from the sanitized upload with sourceHash, if its blob is still stored.
+func (c Ctlr) reusableGroupPic(ctx context.Context, db database.Storage, sourceHash string) (string, error) {
+	groupPicID, err := db.FindGroupPicBySource(sourceHash)
+	if status.Code(err) == grpccodes.NotFound {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	if _, err := c.Blobs.Stat(ctx, groupPicID); err != nil {
+		if errors.Is(err, blobstore.ErrNotFound) {
+			return "", nil
+		}
+		return "", err
+	}
+	return groupPicID, nil
+}
+
+// maxAttachGroupPicAttempts - times attachGroupPic stores a picture freed under it again before giving up.
+const maxAttachGroupPicAttempts = 3
+
+// attachGroupPic - Make groupPicID the picture of a group on behalf of the caller with principal and return the
+// picture the group ends up with. The reference the group takes keeps the picture from being freed from then on,
+// but a free that completed before may have deleted its blobs, which are then stored again from the picture reduce
+// returns.
+func (c Ctlr) attachGroupPic(ctx context.Context, db database.Storage, userID string, groupID string, groupPicID string, principal map[string]interface{}, reduce func() (*groupPicture, error)) (string, error) {
+
+	for attempt := 0; attempt < maxAttachGroupPicAttempts; attempt++ {
+		if _, err := db.SetUserConnectionGroupPic(userID, groupID, groupPicID, principal); err != nil {
+			return "", err
+		}
+
+		_, err := c.Blobs.Stat(ctx, groupPicID)
+		if err == nil {
+			return groupPicID, nil
+		}
+		if !errors.Is(err, blobstore.ErrNotFound) {
+			return "", err
+		}
+
+		picture, err := reduce()
+		if err != nil {
+			return "", err
+		}
+		if groupPicID, err = c.storeGroupPic(ctx, picture); err != nil {
+			return "", err
+		}
+	}
+
+	return "", database.ErrGroupPicFreeing
+}
+
+// freeUnreferencedGroupPics - Delete the blobs of the pictures no group uses anymore, then their records.
+// Failures are logged only, the group change that released the picture already succeeded. Pictures whose blobs
+// could not all be deleted keep their record and are claimed again by a later call. Only the picture worker and the
+// trash purger call it, requests just drop their reference so that they never sweep the whole storage.
+func (c Ctlr) freeUnreferencedGroupPics(ctx context.Context, db database.Storage) {
+	groupPicIDs, err := db.ClaimUnreferencedGroupPics(unreferencedGroupPicsBatch)
+	if err != nil {
+		log.Printf("failed to list unreferenced group pictures (%s)", err.Error())
+	}
+
+	for _, groupPicID := range groupPicIDs {
+		keys := []string{groupPicID}
+		for _, rendition := range config.Get().Images.Renditions {
+			keys = append(keys, renditionKey(groupPicID, rendition.Name))
+		}
+
+		deleted := true
+		for _, key := range keys {
+			if err := c.Blobs.Delete(ctx, key); err != nil && !errors.Is(err, blobstore.ErrNotFound) {
+				log.Printf("failed to delete group picture blob (%s) (%s)", key, err.Error())
+				deleted = false
+			}
+		}
+
+		if !deleted {
+			continue
+		}
+		if err := db.ForgetFreedGroupPic(groupPicID); err != nil {
+			log.Printf("failed to forget freed group picture (%s) (%s)", groupPicID, err.Error())
+		}
+	}
+}
+
+// putBlobIfMissing - Upload data under key unless a blob is already stored there.
+func (c Ctlr) putBlobIfMissing(ctx context.Context, key string, data []byte, contentType string) error {
+	if _, err := c.Blobs.Stat(ctx, key); err == nil {
+		return nil
+	} else if !errors.Is(err, blobstore.ErrNotFound) {
+		return err
+	}
+
+	return c.Blobs.Put(ctx, key, bytes.NewReader(data), int64(len(data)), contentType)
+}
+
+// attachGroupPicRenditions - Expose the URL of every rendition of the group picture in the group payload.
+func attachGroupPicRenditions(userID string, group *models.Group) {
+	if group == nil || group.GroupPic == "" {
+		return
+	}
+
+	pictureURL := fmt.Sprintf("/users/%s/connections/groups/%s/picture", url.PathEscape(userID), url.PathEscape(swag.StringValue(group.GroupID)))
+
+	renditions := []*models.GroupPicRendition{
+		{Name: config.OriginalRendition, URL: pictureURL},
+	}
+	for _, rendition := range config.Get().Images.Renditions {
+		renditions = append(renditions, &models.GroupPicRendition{
+			Name:   rendition.Name,
+			Size:   int32(rendition.Size),
+			Square: rendition.Square,
+			URL:    pictureURL + "?rendition=" + url.QueryEscape(rendition.Name),
+		})
+	}
+	group.GroupPicRenditions = renditions
+}
@@ -0,0 +1,199 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"image/png"
+	"sync"
+	"testing"
+
+	"learning/unit-testing/blobstore"
+	"learning/unit-testing/config"
+	"learning/unit-testing/database"
+	"learning/unit-testing/internal"
+	"learning/unit-testing/models"
+	"learning/unit-testing/restapi/operations/connections"
+)
+
+func TestStoreGroupPic(t *testing.T) {
+
+	c := GetControllerMockDB()
+	ctx := context.Background()
+	pic := &groupPicture{reduced: []byte("GIF89a fake picture bytes")}
+
+	firstID, err := c.storeGroupPic(ctx, pic)
+	if err != nil {
+		t.Fatalf("storeGroupPic: %s", err.Error())
+	}
+
+	secondID, err := c.storeGroupPic(ctx, pic)
+	if err != nil {
+		t.Fatalf("storeGroupPic: %s", err.Error())
+	}
+	assertEqual(t, secondID, firstID)
+
+	info, err := c.Blobs.Stat(ctx, firstID)
+	if err != nil {
+		t.Fatalf("picture not stored: %s", err.Error())
+	}
+	assertEqual(t, info.ContentType, "image/gif")
+
+	// Undecodable pictures are stored without renditions.
+	if _, err := c.Blobs.Stat(ctx, renditionKey(firstID, "thumbnail")); err == nil {
+		t.Fatalf("unexpected rendition of an undecodable picture")
+	}
+}
+
+func TestStoreGroupPicRenditions(t *testing.T) {
+
+	c := GetControllerMockDB()
+	ctx := context.Background()
+
+	var original bytes.Buffer
+	if err := png.Encode(&original, image.NewRGBA(image.Rect(0, 0, 300, 200))); err != nil {
+		t.Fatal(err)
+	}
+
+	picID, err := c.storeGroupPic(ctx, &groupPicture{original: original.Bytes(), reduced: original.Bytes()})
+	if err != nil {
+		t.Fatalf("storeGroupPic: %s", err.Error())
+	}
+
+	for _, rendition := range config.Get().Images.Renditions {
+		r, _, err := c.Blobs.Get(ctx, renditionKey(picID, rendition.Name))
+		if err != nil {
+			t.Fatalf("rendition %s not stored: %s", rendition.Name, err.Error())
+		}
+		img, _, err := image.Decode(r)
+		r.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if img.Bounds().Dx() > rendition.Size || img.Bounds().Dy() > rendition.Size {
+			t.Fatalf("rendition %s is %v, larger than %d", rendition.Name, img.Bounds(), rendition.Size)
+		}
+	}
+}
+
+func TestGroupPicReferenceCounting(t *testing.T) {
+
+	c := GetControllerMockDB()
+	ctx := context.Background()
+	userID := "dc9dbe3e-60d5-4a07-8c9c-42027b555b31"
+	firstID, _ := c.DB.CreateUserConnectionGroup(userID, internal.UserConnectionGroupInfo{GroupName: "First Group"}, nil)
+	secondID, _ := c.DB.CreateUserConnectionGroup(userID, internal.UserConnectionGroupInfo{GroupName: "Second Group"}, nil)
+
+	picID, err := c.storeGroupPic(ctx, &groupPicture{reduced: []byte("GIF89a shared picture bytes")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, groupID := range []string{firstID, secondID} {
+		if _, err := c.DB.SetUserConnectionGroupPic(userID, groupID, picID, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	assertEqual(t, c.DB.(*database.MockConnection).GroupPicRefCount(picID), 2)
+
+	deleteGroup := func(groupID string) {
+		res := c.DeleteUsersConnectionsGroupsByUserIDAndGroupID(connections.UsersConnectionsGroupsByUserIDAndGroupIDDeleteParams{UserID: userID, GroupID: groupID}, &models.Principal{})
+		assertEqual(t, res.resType, "Deleted")
+	}
+	purgeGroup := func(groupID string) {
+		res := c.PurgeGroup(TrashParams{UserID: userID, GroupID: groupID}, &models.Principal{})
+		assertEqual(t, res.resType, "Purged")
+	}
+
+	// Trashed groups keep their picture.
+	deleteGroup(firstID)
+	assertEqual(t, c.DB.(*database.MockConnection).GroupPicRefCount(picID), 2)
+
+	// Still used by the second group.
+	purgeGroup(firstID)
+	if _, err := c.Blobs.Stat(ctx, picID); err != nil {
+		t.Fatalf("shared picture freed too early: %s", err.Error())
+	}
+
+	// Left to the next run of the trash purger rather than freed by the request.
+	deleteGroup(secondID)
+	purgeGroup(secondID)
+	if _, err := c.Blobs.Stat(ctx, picID); err != nil {
+		t.Fatalf("unreferenced picture freed by the request: %s", err.Error())
+	}
+	NewTrashPurger(c, config.Defaults().Trash).purge(ctx)
+	if _, err := c.Blobs.Stat(ctx, picID); !errors.Is(err, blobstore.ErrNotFound) {
+		t.Fatalf("expected unreferenced picture to be freed, got %v", err)
+	}
+}
+
+func TestAttachGroupPicRacingFree(t *testing.T) {
+
+	c := GetControllerMockDB()
+	ctx := context.Background()
+	userID := "dc9dbe3e-60d5-4a07-8c9c-42027b555b32"
+	mock := c.DB.(*database.MockConnection)
+
+	picture := &groupPicture{reduced: []byte("GIF89a raced picture bytes")}
+	reduce := func() (*groupPicture, error) { return picture, nil }
+	picID, err := c.storeGroupPic(ctx, picture)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Free claimed before the group takes its reference: the picture cannot be used until its blobs are gone.
+	firstID, _ := c.DB.CreateUserConnectionGroup(userID, internal.UserConnectionGroupInfo{GroupName: "First Raced Group"}, nil)
+	c.DB.SetUserConnectionGroupPic(userID, firstID, picID, nil)
+	c.DB.SetUserConnectionGroupPic(userID, firstID, "", nil)
+	if _, err := c.DB.ClaimUnreferencedGroupPics(unreferencedGroupPicsBatch); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.attachGroupPic(ctx, c.DB, userID, firstID, picID, nil, reduce); !errors.Is(err, database.ErrGroupPicFreeing) {
+		t.Fatalf("expected the picture being freed to be refused, got %v", err)
+	}
+
+	// Free completed between the reuse check and the reference: the blobs are stored again.
+	c.Blobs.Delete(ctx, picID)
+	c.DB.ForgetFreedGroupPic(picID)
+	attached, err := c.attachGroupPic(ctx, c.DB, userID, firstID, picID, nil, reduce)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, attached, picID)
+	assertEqual(t, mock.GroupPicRefCount(picID), 1)
+	if _, err := c.Blobs.Stat(ctx, picID); err != nil {
+		t.Fatalf("attached picture not stored again: %s", err.Error())
+	}
+	c.DB.SetUserConnectionGroupPic(userID, firstID, "", nil)
+
+	// Groups taking and releasing the picture while others free it: a group holding a reference always finds the blob.
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		groupID, _ := c.DB.CreateUserConnectionGroup(userID, internal.UserConnectionGroupInfo{GroupName: fmt.Sprintf("Concurrent Raced Group %d", i)}, nil)
+
+		wg.Add(1)
+		go func(groupID string) {
+			defer wg.Done()
+
+			for j := 0; j < 50; j++ {
+				attached, err := c.attachGroupPic(ctx, c.DB, userID, groupID, picID, nil, reduce)
+				if errors.Is(err, database.ErrGroupPicFreeing) {
+					continue
+				}
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				if _, err := c.Blobs.Stat(ctx, attached); err != nil {
+					t.Errorf("picture freed while group (%s) uses it: %s", groupID, err.Error())
+					return
+				}
+
+				c.DB.SetUserConnectionGroupPic(userID, groupID, "", nil)
+				c.freeUnreferencedGroupPics(ctx, c.DB)
+			}
+		}(groupID)
+	}
+	wg.Wait()
+}
@@ -0,0 +1,219 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"learning/unit-testing/blobstore"
+	"learning/unit-testing/config"
+	"learning/unit-testing/database"
+	"learning/unit-testing/models"
+	"learning/unit-testing/tracing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var (
+	errInvalidPage               = errors.New("offset and limit must be non-negative integers within the page limit")
+	errHistoryEntryNotRevertible = errors.New("a group can only be reverted to a version it had while it existed")
+)
+
+// GroupHistoryParams - Parameters of the group history endpoints, EntryID is empty for the listing.
+type GroupHistoryParams struct {
+	HTTPRequest *http.Request
+	UserID      string
+	GroupID     string
+	EntryID     string
+	Offset      int
+	Limit       int
+}
+
+// GroupHistoryPayload - Body of the group history listing.
+type GroupHistoryPayload struct {
+	Entries            []database.GroupHistoryEntry `json:"entries"`
+	PaginationMetadata *models.PaginationData       `json:"pagination_metadata"`
+}
+
+// ListGroupHistoryResponse - Holding reponse for ListGroupHistory()
+type ListGroupHistoryResponse struct {
+	payload GroupHistoryPayload
+	resType string
+	errMsg  string
+	err     error
+}
+
+// RevertGroupResponse - Holding reponse for RevertGroup()
+type RevertGroupResponse struct {
+	resType string
+	errMsg  string
+	err     error
+}
+
+// groupHistoryParams - Parameters of a request routed on /users/{userID}/connections/groups/{groupID}/history.
+func groupHistoryParams(r *http.Request) (GroupHistoryParams, error) {
+	params := GroupHistoryParams{
+		HTTPRequest: r,
+		UserID:      r.PathValue("userID"),
+		GroupID:     r.PathValue("groupID"),
+		EntryID:     r.PathValue("entryID"),
+	}
+
+	offset, limit, err := pageParams(r.URL.Query())
+	if err != nil {
+		return params, err
+	}
+	params.Offset, params.Limit = offset, limit
+	return params, nil
+}
+
+// pageParams - Offset and limit of a listing, the default page size when no limit is given.
+func pageParams(query url.Values) (int, int, error) {
+	offset, limit := 0, int(config.Get().Pagination.DefaultLimit)
+
+	if value := query.Get("offset"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 0 {
+			return 0, 0, errInvalidPage
+		}
+		offset = parsed
+	}
+	if value := query.Get("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 || parsed > int(config.Get().Pagination.MaxLimit) {
+			return 0, 0, errInvalidPage
+		}
+		limit = parsed
+	}
+	return offset, limit, nil
+}
+
+// GroupHistoryGetController - List the changes of a group.
+func GroupHistoryGetController(rw http.ResponseWriter, r *http.Request, principal *models.Principal) {
+
+	ctlr, err := GetController()
+	if err != nil {
+		writeProblem(rw, r, "errReturn500", "")
+		return
+	}
+
+	params, err := groupHistoryParams(r)
+	if err != nil {
+		writeProblem(rw, r, "errReturn400", err.Error())
+		return
+	}
+
+	response := ctlr.ListGroupHistory(params, principal)
+	if response.err != nil {
+		writeProblem(rw, r, response.resType, response.errMsg)
+		return
+	}
+
+	setPaginationLinks(rw, r, params.Offset, response.payload.PaginationMetadata)
+	rw.Header().Set("Content-Type", "application/json")
+	rw.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(rw).Encode(response.payload)
+}
+
+// GroupHistoryRevertController - Revert a group to the version left by a history entry.
+func GroupHistoryRevertController(rw http.ResponseWriter, r *http.Request, principal *models.Principal) {
+
+	ctlr, err := GetController()
+	if err != nil {
+		writeProblem(rw, r, "errReturn500", "")
+		return
+	}
+
+	params, _ := groupHistoryParams(r)
+	response := ctlr.RevertGroup(params, principal)
+	if response.err != nil {
+		writeProblem(rw, r, response.resType, response.errMsg)
+		return
+	}
+
+	rw.WriteHeader(http.StatusNoContent)
+}
+
+// ListGroupHistory - Changes of a group, most recent first. The history outlives the group.
+func (c Ctlr) ListGroupHistory(params GroupHistoryParams, principal *models.Principal) ListGroupHistoryResponse {
+
+	ctx, span := tracing.Start(params.HTTPRequest, "Ctlr.ListGroupHistory")
+	defer span.End()
+
+	db := database.NewTracingStorage(ctx, c.DB)
+
+	entries, total, err := db.ListGroupHistory(params.UserID, params.GroupID, params.Offset, params.Limit)
+	if err != nil {
+		return ListGroupHistoryResponse{resType: "errReturn500", errMsg: "failed to list group history", err: err}
+	}
+	if total == 0 {
+		err := status.Error(codes.NotFound, "group has no history")
+		return ListGroupHistoryResponse{resType: "errReturn404", errMsg: "record not found", err: err}
+	}
+
+	pagination := &database.PaginatedQuery{Offset: params.Offset, Limit: params.Limit, ResultCount: total}
+	payload := GroupHistoryPayload{Entries: entries, PaginationMetadata: pagination.GetPaginatedQueryMetadata()}
+
+	return ListGroupHistoryResponse{resType: "OK", payload: payload}
+}
+
+// RevertGroup - Set the name, picture and members of a group back to the version left by a history entry. The
+// current picture stays when the one of that version has been freed since.
+func (c Ctlr) RevertGroup(params GroupHistoryParams, principal *models.Principal) RevertGroupResponse {
+
+	ctx, span := tracing.Start(params.HTTPRequest, "Ctlr.RevertGroup")
+	defer span.End()
+
+	db := database.NewTracingStorage(ctx, c.DB)
+
+	entry, err := db.GetGroupHistoryEntry(params.UserID, params.GroupID, params.EntryID)
+	if status.Code(err) == codes.NotFound {
+		return RevertGroupResponse{resType: "errReturn404", errMsg: "record not found", err: err}
+	}
+	if err != nil {
+		return RevertGroupResponse{resType: "errReturn500", errMsg: "failed to parse group history from database", err: err}
+	}
+	if entry.Action == database.GroupDeleted || entry.Action == database.GroupPurged {
+		return RevertGroupResponse{resType: "errReturn422", errMsg: errHistoryEntryNotRevertible.Error(), err: errHistoryEntryNotRevertible}
+	}
+
+	target := entry.Group
+	keepGroupPic := false
+	if target.GroupPic != "" {
+		if _, err := c.Blobs.Stat(ctx, target.GroupPic); errors.Is(err, blobstore.ErrNotFound) {
+			keepGroupPic = true
+		} else if err != nil {
+			return RevertGroupResponse{resType: "errReturn500", errMsg: "failed to read group picture", err: err}
+		}
+	}
+
+	record := database.ChangeRecord{Action: database.GroupReverted, Principal: principalClaims(principal), RevertedFrom: entry.EntryID}
+	revert := func(group *database.GroupDocument) error {
+		groupPic := group.GroupPic
+		*group = target
+		if keepGroupPic {
+			group.GroupPic = groupPic
+		}
+		return nil
+	}
+	_, err = db.ModifyUserConnectionGroup(params.UserID, params.GroupID, record, revert)
+	if errors.Is(err, database.ErrGroupPicFreeing) {
+		keepGroupPic = true
+		_, err = db.ModifyUserConnectionGroup(params.UserID, params.GroupID, record, revert)
+	}
+
+	var conflict *database.GroupNameConflictError
+	switch {
+	case errors.As(err, &conflict):
+		return RevertGroupResponse{resType: "errReturn409", errMsg: errGroupNameInUse.Error(), err: err}
+	case status.Code(err) == codes.NotFound:
+		return RevertGroupResponse{resType: "errReturn404", errMsg: "record not found", err: err}
+	case err != nil:
+		return RevertGroupResponse{resType: "errReturn500", errMsg: "failed to update group in database", err: err}
+	}
+
+	return RevertGroupResponse{resType: "Reverted"}
+}
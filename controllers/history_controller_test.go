@@ -0,0 +1,133 @@
+package controllers
+
+import (
+	"testing"
+
+	"learning/unit-testing/database"
+	"learning/unit-testing/jsonpatch"
+	"learning/unit-testing/models"
+	"learning/unit-testing/restapi/operations/connections"
+)
+
+type TestCaseGroupHistory struct {
+	name                 string
+	action               func() string
+	expectedResponseType string
+	expectedActions      []string
+	expectedGroup        database.GroupDocument
+}
+
+func TestGroupHistory(t *testing.T) {
+
+	historyCtlr := GetControllerMockDB()
+	userID := "dc9dbe3e-60d5-4a07-8c9c-42027b555b61"
+	memberID := connectionUserIds[0].UserID
+	groupName := "History Group"
+	historyCtlr.CreateConnectionsGroupsByUserID(connections.UsersConnectionsGroupsByUserIDPostParams{
+		UserID: userID,
+		Body:   &models.UsersConnectionsGroupsPostRequest{GroupName: &groupName, ConnectionUserIds: connectionUserIds},
+	}, &models.Principal{})
+	group, _ := historyCtlr.DB.GetUserConnectionGroupByName(userID, groupName)
+	groupID := group.GroupID
+
+	patchGroup := func(document string) func() string {
+		return func() string {
+			patch, _ := jsonpatch.Decode([]byte(document))
+			return historyCtlr.PatchGroup(GroupJSONPatchParams{UserID: userID, GroupID: groupID, Patch: patch}, &models.Principal{}).resType
+		}
+	}
+	revertTo := func(action string) func() string {
+		return func() string {
+			entries, _, _ := historyCtlr.DB.ListGroupHistory(userID, groupID, 0, 10)
+			entryID := "unknown_entry"
+			for _, entry := range entries {
+				if entry.Action == action {
+					entryID = entry.EntryID
+				}
+			}
+			return historyCtlr.RevertGroup(GroupHistoryParams{UserID: userID, GroupID: groupID, EntryID: entryID}, &models.Principal{}).resType
+		}
+	}
+
+	testCases := []TestCaseGroupHistory{
+		{
+			name:                 "Created",
+			action:               func() string { return "OK" },
+			expectedResponseType: "OK",
+			expectedActions:      []string{"created"},
+			expectedGroup:        database.GroupDocument{GroupName: "History Group", ConnectionUserIds: []string{memberID}},
+		},
+		{
+			name:                 "RemoveMember",
+			action:               patchGroup(`[{"op": "remove", "path": "/connection_user_ids/0"}]`),
+			expectedResponseType: "Updated",
+			expectedActions:      []string{"updated", "created"},
+			expectedGroup:        database.GroupDocument{GroupName: "History Group", ConnectionUserIds: []string{}},
+		},
+		{
+			name:                 "Rename",
+			action:               patchGroup(`[{"op": "replace", "path": "/group_name", "value": "Renamed History Group"}]`),
+			expectedResponseType: "Updated",
+			expectedActions:      []string{"updated", "updated", "created"},
+			expectedGroup:        database.GroupDocument{GroupName: "Renamed History Group", ConnectionUserIds: []string{}},
+		},
+		{
+			name:                 "RevertToCreated",
+			action:               revertTo("created"),
+			expectedResponseType: "Reverted",
+			expectedActions:      []string{"reverted", "updated", "updated", "created"},
+			expectedGroup:        database.GroupDocument{GroupName: "History Group", ConnectionUserIds: []string{memberID}},
+		},
+		{
+			name:                 "RevertUnknownEntry",
+			action:               revertTo("restored"),
+			expectedResponseType: "errReturn404",
+			expectedActions:      []string{"reverted", "updated", "updated", "created"},
+			expectedGroup:        database.GroupDocument{GroupName: "History Group", ConnectionUserIds: []string{memberID}},
+		},
+		{
+			name: "RevertToDeleted",
+			action: func() string {
+				historyCtlr.DeleteUsersConnectionsGroupsByUserIDAndGroupID(connections.UsersConnectionsGroupsByUserIDAndGroupIDDeleteParams{UserID: userID, GroupID: groupID}, &models.Principal{})
+				historyCtlr.RestoreGroup(TrashParams{UserID: userID, GroupID: groupID}, &models.Principal{})
+				return revertTo("deleted")()
+			},
+			expectedResponseType: "errReturn422",
+			expectedActions:      []string{"restored", "deleted", "reverted", "updated", "updated", "created"},
+			expectedGroup:        database.GroupDocument{GroupName: "History Group", ConnectionUserIds: []string{memberID}},
+		},
+	}
+
+	for _, test := range testCases {
+
+		t.Run(test.name, func(t *testing.T) {
+			assertEqual(t, test.action(), test.expectedResponseType)
+
+			res := historyCtlr.ListGroupHistory(GroupHistoryParams{UserID: userID, GroupID: groupID, Limit: 10}, &models.Principal{})
+			actions := []string{}
+			for _, entry := range res.payload.Entries {
+				actions = append(actions, entry.Action)
+			}
+			assertEqual(t, actions, test.expectedActions)
+
+			group, _ := historyCtlr.DB.GetUserConnectionGroupByGroupID(userID, groupID)
+			assertEqual(t, database.NewGroupDocument(group), test.expectedGroup)
+		})
+	}
+
+	// Who removed the member, and when.
+	res := historyCtlr.ListGroupHistory(GroupHistoryParams{UserID: userID, GroupID: groupID, Offset: 4, Limit: 1}, &models.Principal{})
+	assertEqual(t, *res.payload.PaginationMetadata.ResultCount, int32(6))
+	removal := res.payload.Entries[0]
+	assertEqual(t, removal.Changes, []database.FieldChange{{
+		Field:   "connection_user_ids",
+		Before:  []string{memberID},
+		After:   []string{},
+		Added:   []string{},
+		Removed: []string{memberID},
+	}})
+	assertEqual(t, removal.ChangedAt.IsZero(), false)
+
+	res = historyCtlr.ListGroupHistory(GroupHistoryParams{UserID: userID, GroupID: "unknown_group", Limit: 10}, &models.Principal{})
+	assertEqual(t, res.resType, "errReturn404")
+}
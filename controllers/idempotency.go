@@ -0,0 +1,147 @@
+package controllers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"learning/unit-testing/config"
+	"learning/unit-testing/database"
+	"learning/unit-testing/models"
+	"learning/unit-testing/problem"
+	"learning/unit-testing/restapi/operations/connections"
+	"learning/unit-testing/tracing"
+
+	"github.com/go-openapi/runtime"
+)
+
+// IdempotencyKeyHeader - Header carrying the client chosen key of a request that is safe to retry.
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+// maxIdempotencyKeyLength - Longest key accepted, clients usually send UUIDs.
+const maxIdempotencyKeyLength = 255
+
+var (
+	errInvalidIdempotencyKey    = errors.New("Idempotency-Key must be 1 to 255 printable ASCII characters")
+	errIdempotencyKeyReused     = errors.New("Idempotency-Key was already used with a different request body")
+	errIdempotencyKeyInProgress = errors.New("a request with this Idempotency-Key is still being processed")
+)
+
+// CreateConnectionsGroupsIdempotently - Create a group once per Idempotency-Key. Retries with the same key and body
+// get the response of the first request, retries with another body are rejected. Requests without a key are
+// handled by CreateConnectionsGroupsByUserID alone.
+func (c Ctlr) CreateConnectionsGroupsIdempotently(params connections.UsersConnectionsGroupsByUserIDPostParams, principal *models.Principal) CreateConnectionsGroupsByUserIDResponse {
+
+	if params.HTTPRequest == nil || len(params.HTTPRequest.Header.Values(IdempotencyKeyHeader)) == 0 {
+		return c.CreateConnectionsGroupsByUserID(params, principal)
+	}
+
+	ctx, span := tracing.Start(params.HTTPRequest, "Ctlr.CreateConnectionsGroupsIdempotently")
+	defer span.End()
+
+	db := database.NewTracingStorage(ctx, c.DB)
+
+	key := params.HTTPRequest.Header.Get(IdempotencyKeyHeader)
+	if !validIdempotencyKey(key) {
+		return CreateConnectionsGroupsByUserIDResponse{resType: "errReturn400", errMsg: errInvalidIdempotencyKey.Error(), err: errInvalidIdempotencyKey}
+	}
+
+	requestHash, err := idempotencyRequestHash(params.Body)
+	if err != nil {
+		return CreateConnectionsGroupsByUserIDResponse{resType: "errReturn500", errMsg: "failed to hash request", err: err}
+	}
+
+	now := time.Now()
+	record, reserved, err := db.ReserveIdempotencyKey(database.IdempotencyRecord{
+		UserID:      params.UserID,
+		Key:         key,
+		RequestHash: requestHash,
+		CreatedAt:   now,
+		ExpiresAt:   now.Add(time.Duration(config.Get().Idempotency.TTL)),
+	})
+	if err != nil {
+		return CreateConnectionsGroupsByUserIDResponse{resType: "errReturn500", errMsg: "failed to reserve idempotency key", err: err}
+	}
+
+	if !reserved {
+		switch {
+		case record.RequestHash != requestHash:
+			return CreateConnectionsGroupsByUserIDResponse{resType: "errReturn422", errMsg: errIdempotencyKeyReused.Error(), err: errIdempotencyKeyReused}
+		case !record.Completed:
+			return CreateConnectionsGroupsByUserIDResponse{resType: "errReturn409", errMsg: errIdempotencyKeyInProgress.Error(), err: errIdempotencyKeyInProgress}
+		}
+		return CreateConnectionsGroupsByUserIDResponse{resType: "Replayed", replay: &record}
+	}
+
+	response := c.CreateConnectionsGroupsByUserID(params, principal)
+
+	// Server errors are not kept, the retry runs the request again.
+	statusCode, contentType, body, err := idempotentResponse(params.HTTPRequest, response)
+	if err == nil && statusCode < http.StatusInternalServerError {
+		err = db.CompleteIdempotencyKey(params.UserID, key, statusCode, contentType, body)
+	} else {
+		err = db.ReleaseIdempotencyKey(params.UserID, key)
+	}
+	if err != nil {
+		log.Printf("failed to record response of idempotency key (%s) (%s)", key, err.Error())
+	}
+
+	return response
+}
+
+// validIdempotencyKey - Whether key is made of 1 to maxIdempotencyKeyLength printable ASCII characters.
+func validIdempotencyKey(key string) bool {
+	if key == "" || len(key) > maxIdempotencyKeyLength {
+		return false
+	}
+	for i := 0; i < len(key); i++ {
+		if key[i] < 0x20 || key[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+// idempotencyRequestHash - Hash of the request body, retries with the same key must send the same one.
+func idempotencyRequestHash(body *models.UsersConnectionsGroupsPostRequest) (string, error) {
+	raw, err := json.Marshal(body)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(raw)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// idempotentResponse - Status, content type and body sent for response, as kept to be replayed.
+func idempotentResponse(r *http.Request, response CreateConnectionsGroupsByUserIDResponse) (int, string, []byte, error) {
+	switch response.resType {
+	case "OK":
+		body, err := json.Marshal(response.existsPayload)
+		return http.StatusOK, runtime.JSONMime, body, err
+	case "Created":
+		body, err := json.Marshal(response.createdPayload)
+		return http.StatusCreated, runtime.JSONMime, body, err
+	}
+
+	details := problem.New(problemStatus(response.resType), response.errMsg)
+	details.Instance = r.URL.Path
+	body, err := json.Marshal(details)
+	return details.Status, problem.ContentType, body, err
+}
+
+// replayResponder - go-swagger responder writing the response kept for an idempotency key.
+type replayResponder struct {
+	record database.IdempotencyRecord
+}
+
+// WriteResponse - implements middleware.Responder
+func (p *replayResponder) WriteResponse(rw http.ResponseWriter, _ runtime.Producer) {
+	rw.Header().Set("Content-Type", p.record.ContentType)
+	rw.Header().Set("Idempotent-Replayed", "true")
+	rw.WriteHeader(p.record.StatusCode)
+	_, _ = rw.Write(p.record.Response)
+}
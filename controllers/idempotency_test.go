@@ -0,0 +1,107 @@
+package controllers
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"learning/unit-testing/database"
+	"learning/unit-testing/models"
+	"learning/unit-testing/restapi/operations/connections"
+)
+
+type TestCaseIdempotentCreateGroup struct {
+	name                 string
+	key                  string
+	groupName            string
+	expectedResponseType string
+	expectedStatusCode   int
+}
+
+func TestCreateConnectionsGroupsIdempotently(t *testing.T) {
+
+	idempotencyCtlr := GetControllerMockDB()
+	userID := "dc9dbe3e-60d5-4a07-8c9c-42027b555b61"
+
+	// A key left over from a request whose record expired is free again.
+	now := time.Now()
+	idempotencyCtlr.DB.ReserveIdempotencyKey(database.IdempotencyRecord{
+		UserID: userID, Key: "expired-key", RequestHash: "other", Completed: true,
+		CreatedAt: now.Add(-48 * time.Hour), ExpiresAt: now.Add(-24 * time.Hour),
+	})
+
+	testCases := []TestCaseIdempotentCreateGroup{
+		{
+			name:                 "FirstRequest",
+			key:                  "key-1",
+			groupName:            "Idempotent Group",
+			expectedResponseType: "Created",
+		},
+		{
+			name:                 "RetryReplayed",
+			key:                  "key-1",
+			groupName:            "Idempotent Group",
+			expectedResponseType: "Replayed",
+			expectedStatusCode:   201,
+		},
+		{
+			name:                 "DifferentBody",
+			key:                  "key-1",
+			groupName:            "Another Group",
+			expectedResponseType: "errReturn422",
+		},
+		{
+			name:                 "ClientErrorReplayed",
+			key:                  "key-2",
+			groupName:            "",
+			expectedResponseType: "errReturn400",
+		},
+		{
+			name:                 "ClientErrorRetry",
+			key:                  "key-2",
+			groupName:            "",
+			expectedResponseType: "Replayed",
+			expectedStatusCode:   400,
+		},
+		{
+			name:                 "ExpiredKey",
+			key:                  "expired-key",
+			groupName:            "Expired Key Group",
+			expectedResponseType: "Created",
+		},
+		{
+			name:                 "InvalidKey",
+			key:                  "",
+			groupName:            "Invalid Key Group",
+			expectedResponseType: "errReturn400",
+		},
+	}
+
+	for _, test := range testCases {
+
+		t.Run(test.name, func(t *testing.T) {
+			request := httptest.NewRequest("POST", "/users/"+userID+"/connections/groups", nil)
+			request.Header.Set(IdempotencyKeyHeader, test.key)
+
+			body := &models.UsersConnectionsGroupsPostRequest{ConnectionUserIds: connectionUserIds}
+			if test.groupName != "" {
+				groupName := test.groupName
+				body.GroupName = &groupName
+			}
+
+			params := connections.UsersConnectionsGroupsByUserIDPostParams{HTTPRequest: request, UserID: userID, Body: body}
+			res := idempotencyCtlr.CreateConnectionsGroupsIdempotently(params, &models.Principal{})
+			t.Logf("Actual Response: %+v\n", res)
+			assertEqual(t, res.resType, test.expectedResponseType)
+
+			if res.replay != nil {
+				assertEqual(t, res.replay.StatusCode, test.expectedStatusCode)
+			}
+		})
+	}
+
+	// The rejected body created nothing.
+	if _, err := idempotencyCtlr.DB.GetUserConnectionGroupByName(userID, "Another Group"); err == nil {
+		t.Fatal("expected no group for the mismatched retry")
+	}
+}
@@ -0,0 +1,113 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"time"
+
+	"learning/unit-testing/database"
+	"learning/unit-testing/models"
+	"learning/unit-testing/tracing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// interactionClockSkew - how far ahead of the server clock a client may date an interaction.
+const interactionClockSkew = time.Minute
+
+var (
+	errInvalidInteractionBody = errors.New("request body must be empty or a JSON object with an RFC 3339 interacted_at")
+	errInteractionInFuture    = errors.New("interacted_at cannot be in the future")
+)
+
+// GroupInteractionParams - Parameters of the group interaction endpoint.
+type GroupInteractionParams struct {
+	HTTPRequest  *http.Request
+	UserID       string
+	GroupID      string
+	InteractedAt time.Time
+}
+
+// GroupInteractionBody - Optional body of the group interaction endpoint, the interaction happens now without it.
+type GroupInteractionBody struct {
+	InteractedAt *time.Time `json:"interacted_at"`
+}
+
+// RecordGroupInteractionResponse - Holding reponse for RecordGroupInteraction()
+type RecordGroupInteractionResponse struct {
+	resType string
+	errMsg  string
+	err     error
+}
+
+// groupInteractionParams - Parameters of a request routed on /users/{userID}/connections/groups/{groupID}/interactions.
+func groupInteractionParams(rw http.ResponseWriter, r *http.Request) (GroupInteractionParams, error) {
+	params := GroupInteractionParams{
+		HTTPRequest:  r,
+		UserID:       r.PathValue("userID"),
+		GroupID:      r.PathValue("groupID"),
+		InteractedAt: time.Now(),
+	}
+
+	var body GroupInteractionBody
+	decoder := json.NewDecoder(http.MaxBytesReader(rw, r.Body, 4<<10))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&body); err != nil && err != io.EOF {
+		return params, errInvalidInteractionBody
+	}
+	if body.InteractedAt != nil {
+		params.InteractedAt = *body.InteractedAt
+	}
+	return params, nil
+}
+
+// GroupInteractionPostController - Record that the user interacted with a group.
+func GroupInteractionPostController(rw http.ResponseWriter, r *http.Request, principal *models.Principal) {
+
+	ctlr, err := GetController()
+	if err != nil {
+		writeProblem(rw, r, "errReturn500", "")
+		return
+	}
+
+	params, err := groupInteractionParams(rw, r)
+	if err != nil {
+		writeProblem(rw, r, "errReturn400", err.Error())
+		return
+	}
+
+	response := ctlr.RecordGroupInteraction(params, principal)
+	if response.err != nil {
+		writeProblem(rw, r, response.resType, response.errMsg)
+		return
+	}
+
+	rw.WriteHeader(http.StatusNoContent)
+}
+
+// RecordGroupInteraction - Move the latest interaction time of a group to the time of the interaction, unless a
+// later interaction was already recorded.
+func (c Ctlr) RecordGroupInteraction(params GroupInteractionParams, principal *models.Principal) RecordGroupInteractionResponse {
+
+	ctx, span := tracing.Start(params.HTTPRequest, "Ctlr.RecordGroupInteraction")
+	defer span.End()
+
+	if params.InteractedAt.After(time.Now().Add(interactionClockSkew)) {
+		return RecordGroupInteractionResponse{resType: "errReturn400", errMsg: errInteractionInFuture.Error(), err: errInteractionInFuture}
+	}
+
+	db := database.NewTracingStorage(ctx, c.DB)
+
+	err := db.RecordUserConnectionGroupInteraction(params.UserID, params.GroupID, params.InteractedAt)
+	if status.Code(err) == codes.NotFound {
+		return RecordGroupInteractionResponse{resType: "errReturn404", errMsg: "record not found", err: err}
+	}
+	if err != nil {
+		return RecordGroupInteractionResponse{resType: "errReturn500", errMsg: "failed to record group interaction", err: err}
+	}
+
+	return RecordGroupInteractionResponse{resType: "Recorded"}
+}
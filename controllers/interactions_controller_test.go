@@ -0,0 +1,97 @@
+package controllers
+
+import (
+	"testing"
+	"time"
+
+	"learning/unit-testing/internal"
+	"learning/unit-testing/jsonpatch"
+	"learning/unit-testing/models"
+)
+
+type TestCaseGroupInteraction struct {
+	name                 string
+	action               func() string
+	expectedResponseType string
+	expectedMoved        bool
+}
+
+func TestRecordGroupInteraction(t *testing.T) {
+
+	interactionCtlr := GetControllerMockDB()
+	userID := "dc9dbe3e-60d5-4a07-8c9c-42027b555b93"
+	groupID, _ := interactionCtlr.DB.CreateUserConnectionGroup(userID, internal.UserConnectionGroupInfo{GroupName: "Interacted Group"}, nil)
+
+	created, _ := interactionCtlr.DB.GetUserConnectionGroupByGroupID(userID, groupID)
+	assertEqual(t, created.CreatedAt.IsZero(), false)
+	assertEqual(t, created.UpdatedAt, created.CreatedAt)
+	assertEqual(t, created.LatestInteractionTime, created.CreatedAt)
+
+	recordInteraction := func(groupID string, interactedAt time.Time) func() string {
+		return func() string {
+			return interactionCtlr.RecordGroupInteraction(GroupInteractionParams{UserID: userID, GroupID: groupID, InteractedAt: interactedAt}, &models.Principal{}).resType
+		}
+	}
+	patchGroup := func(document string) func() string {
+		return func() string {
+			patch, _ := jsonpatch.Decode([]byte(document))
+			return interactionCtlr.PatchGroup(GroupJSONPatchParams{UserID: userID, GroupID: groupID, Patch: patch}, &models.Principal{}).resType
+		}
+	}
+
+	testCases := []TestCaseGroupInteraction{
+		{
+			name:                 "Recorded",
+			action:               recordInteraction(groupID, time.Now()),
+			expectedResponseType: "Recorded",
+			expectedMoved:        true,
+		},
+		{
+			name:                 "OutOfOrder",
+			action:               recordInteraction(groupID, time.Now().Add(-time.Hour)),
+			expectedResponseType: "Recorded",
+		},
+		{
+			name:                 "InFuture",
+			action:               recordInteraction(groupID, time.Now().Add(time.Hour)),
+			expectedResponseType: "errReturn400",
+		},
+		{
+			name:                 "UnknownGroup",
+			action:               recordInteraction("group_id_404", time.Now()),
+			expectedResponseType: "errReturn404",
+		},
+		{
+			name:                 "Renamed",
+			action:               patchGroup(`[{"op": "replace", "path": "/group_name", "value": "Renamed Interacted Group"}]`),
+			expectedResponseType: "Updated",
+			expectedMoved:        true,
+		},
+		{
+			name:                 "MemberAdded",
+			action:               patchGroup(`[{"op": "add", "path": "/connection_user_ids/-", "value": "member_1"}]`),
+			expectedResponseType: "Updated",
+			expectedMoved:        true,
+		},
+		{
+			name: "PictureChanged",
+			action: func() string {
+				interactionCtlr.DB.SetUserConnectionGroupPic(userID, groupID, "pic_1", nil)
+				return ""
+			},
+		},
+	}
+
+	for _, test := range testCases {
+
+		t.Run(test.name, func(t *testing.T) {
+			before, _ := interactionCtlr.DB.GetUserConnectionGroupByGroupID(userID, groupID)
+
+			assertEqual(t, test.action(), test.expectedResponseType)
+
+			after, _ := interactionCtlr.DB.GetUserConnectionGroupByGroupID(userID, groupID)
+			assertEqual(t, after.LatestInteractionTime.After(before.LatestInteractionTime), test.expectedMoved)
+			assertEqual(t, after.CreatedAt, created.CreatedAt)
+		})
+	}
+}
@@ -0,0 +1,234 @@
+package controllers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+
+	"learning/unit-testing/blobstore"
+	"learning/unit-testing/config"
+	"learning/unit-testing/database"
+	"learning/unit-testing/groupname"
+	"learning/unit-testing/jsonpatch"
+	"learning/unit-testing/models"
+	"learning/unit-testing/tracing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// groupPicPath - JSON Pointer of the picture in group documents.
+const groupPicPath = "/group_pic"
+
+var (
+	errGroupNameInUse       = errors.New("group name is already in use, choose another group name")
+	errGroupPicIDChanged    = errors.New("group_pic can only be replaced by picture data or removed")
+	errInvalidGroupDocument = errors.New("patched group is not a valid group document")
+)
+
+// GroupJSONPatchParams - Parameters of a JSON Patch request on a group.
+type GroupJSONPatchParams struct {
+	HTTPRequest *http.Request
+	UserID      string
+	GroupID     string
+	Patch       jsonpatch.Patch
+}
+
+// PatchGroupResponse - Holding reponse for PatchGroup()
+type PatchGroupResponse struct {
+	resType string
+	errMsg  string
+	err     error
+}
+
+// GroupJSONPatchController - Apply a JSON Patch (RFC 6902) document to a group.
+func GroupJSONPatchController(rw http.ResponseWriter, r *http.Request, principal *models.Principal) {
+
+	ctlr, err := GetController()
+	if err != nil {
+		writeProblem(rw, r, "errReturn500", "")
+		return
+	}
+
+	// Pictures travel base64 encoded inside the document.
+	maxBytes := config.Get().Images.MaxUploadBytes*4/3 + 64*1024
+	raw, err := io.ReadAll(http.MaxBytesReader(rw, r.Body, maxBytes))
+	if err != nil {
+		writeProblem(rw, r, "errReturn413", "patch document exceeds the size limit")
+		return
+	}
+
+	patch, err := jsonpatch.Decode(raw)
+	if err != nil {
+		writeProblem(rw, r, "errReturn400", err.Error())
+		return
+	}
+
+	params := GroupJSONPatchParams{HTTPRequest: r, UserID: r.PathValue("userID"), GroupID: r.PathValue("groupID"), Patch: patch}
+	response := ctlr.PatchGroup(params, principal)
+	if response.err != nil {
+		writeProblem(rw, r, response.resType, response.errMsg)
+		return
+	}
+
+	rw.WriteHeader(http.StatusNoContent)
+}
+
+// PatchGroup - Apply a JSON Patch to the name, picture and members of a group in one storage transaction.
+// Pictures given as data are validated first and reduced in the background, like any other picture change.
+func (c Ctlr) PatchGroup(params GroupJSONPatchParams, principal *models.Principal) PatchGroupResponse {
+
+	ctx, span := tracing.Start(params.HTTPRequest, "Ctlr.PatchGroup")
+	defer span.End()
+
+	db := database.NewTracingStorage(ctx, c.DB)
+
+	// Staged pictures replace the picture data in the patch, the group document only knows their upload key.
+	patch := append(jsonpatch.Patch(nil), params.Patch...)
+	stagedUploads := map[string]bool{}
+	queuedUpload := ""
+	defer func() {
+		for uploadKey := range stagedUploads {
+			if uploadKey == queuedUpload {
+				continue
+			}
+			if err := c.Blobs.Delete(ctx, uploadKey); err != nil && !errors.Is(err, blobstore.ErrNotFound) {
+				log.Printf("failed to delete staged picture (%s) (%s)", uploadKey, err.Error())
+			}
+		}
+	}()
+
+	for i, operation := range patch {
+		if operation.Path != groupPicPath || operation.Op != jsonpatch.OpAdd && operation.Op != jsonpatch.OpReplace {
+			continue
+		}
+		groupPic, ok := operation.StringValue()
+		if !ok || groupPic == "" {
+			continue
+		}
+
+		uploadKey, err := c.stageEncodedGroupPic(ctx, groupPic)
+		if err != nil {
+			if resType, rejected := rejectionResType(err); rejected {
+				return PatchGroupResponse{resType: resType, errMsg: err.Error(), err: err}
+			}
+			return PatchGroupResponse{resType: "errReturn500", errMsg: "failed to store group picture", err: err}
+		}
+		stagedUploads[uploadKey] = true
+		patch[i].Value, _ = json.Marshal(uploadKey)
+	}
+
+	groupInfo, err := db.GetUserConnectionGroupByGroupID(params.UserID, params.GroupID)
+	if err != nil {
+		return patchGroupError(err)
+	}
+
+	// Check the new name before the transaction, which then applies the patch to the latest version of the group.
+	preview, err := applyGroupPatch(patch, database.NewGroupDocument(groupInfo), stagedUploads)
+	if err != nil {
+		return patchGroupError(err)
+	}
+	if preview.GroupName != groupInfo.GroupName {
+		existing, err := db.GetUserConnectionGroupByName(params.UserID, preview.GroupName)
+		if err != nil && status.Code(err) != codes.NotFound {
+			return PatchGroupResponse{resType: "errReturn500", errMsg: "failed to parse group from database", err: err}
+		}
+		if existing.GroupID != "" && existing.GroupID != params.GroupID {
+			return PatchGroupResponse{resType: "errReturn409", errMsg: errGroupNameInUse.Error(), err: errGroupNameInUse}
+		}
+	}
+
+	// Patches of test operations only, or leaving the group as it was, change nothing and record nothing.
+	record := database.ChangeRecord{Action: database.GroupUpdated, Principal: principalClaims(principal)}
+	_, err = db.ModifyUserConnectionGroup(params.UserID, params.GroupID, record, func(group *database.GroupDocument) error {
+		modified, err := applyGroupPatch(patch, *group, stagedUploads)
+		if err != nil {
+			return err
+		}
+
+		// The current picture stays until the picture worker replaces it.
+		queuedUpload = ""
+		if stagedUploads[modified.GroupPic] {
+			queuedUpload = modified.GroupPic
+			modified.GroupPic = group.GroupPic
+		}
+
+		*group = modified
+		return nil
+	})
+	if err != nil {
+		queuedUpload = ""
+		return patchGroupError(err)
+	}
+
+	if queuedUpload != "" {
+		if err := enqueueGroupPic(db, params.UserID, params.GroupID, queuedUpload, principal); err != nil {
+			return PatchGroupResponse{resType: "errReturn500", errMsg: "failed to queue group picture", err: err}
+		}
+	}
+
+	return PatchGroupResponse{resType: "Updated"}
+}
+
+// applyGroupPatch - Group document resulting from patch. The picture may only be removed or replaced by one of
+// the staged uploads.
+func applyGroupPatch(patch jsonpatch.Patch, group database.GroupDocument, stagedUploads map[string]bool) (database.GroupDocument, error) {
+
+	raw, err := json.Marshal(group)
+	if err != nil {
+		return group, err
+	}
+	patched, err := patch.Apply(raw)
+	if err != nil {
+		return group, err
+	}
+
+	var modified database.GroupDocument
+	decoder := json.NewDecoder(bytes.NewReader(patched))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&modified); err != nil {
+		return group, fmt.Errorf("%w (%s)", errInvalidGroupDocument, err.Error())
+	}
+
+	if strings.TrimSpace(modified.GroupName) == "" {
+		return group, errGroupNameRequired
+	}
+	if modified.GroupName != group.GroupName {
+		if modified.GroupName, err = applyGroupNamePolicy(modified.GroupName); err != nil {
+			return group, err
+		}
+	}
+	if modified.GroupPic != group.GroupPic && modified.GroupPic != "" && !stagedUploads[modified.GroupPic] {
+		return group, errGroupPicIDChanged
+	}
+	if modified.ConnectionUserIds == nil {
+		modified.ConnectionUserIds = []string{}
+	}
+
+	return modified, nil
+}
+
+// patchGroupError - Result of a failed JSON Patch: 409 for failed tests and names in use, 422 for patches the group cannot take.
+func patchGroupError(err error) PatchGroupResponse {
+	var conflict *database.GroupNameConflictError
+	var violation *groupname.ViolationError
+	switch {
+	case errors.As(err, &conflict):
+		return PatchGroupResponse{resType: "errReturn409", errMsg: errGroupNameInUse.Error(), err: err}
+	case errors.Is(err, jsonpatch.ErrTestFailed):
+		return PatchGroupResponse{resType: "errReturn409", errMsg: err.Error(), err: err}
+	case errors.Is(err, jsonpatch.ErrInvalidPatch):
+		return PatchGroupResponse{resType: "errReturn400", errMsg: err.Error(), err: err}
+	case errors.Is(err, jsonpatch.ErrUnprocessable), errors.Is(err, errInvalidGroupDocument),
+		errors.Is(err, errGroupNameRequired), errors.Is(err, errGroupPicIDChanged), errors.As(err, &violation):
+		return PatchGroupResponse{resType: "errReturn422", errMsg: err.Error(), err: err}
+	case status.Code(err) == codes.NotFound:
+		return PatchGroupResponse{resType: "errReturn404", errMsg: "record not found", err: err}
+	}
+	return PatchGroupResponse{resType: "errReturn500", errMsg: "failed to update group in database", err: err}
+}
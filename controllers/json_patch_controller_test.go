@@ -0,0 +1,141 @@
+package controllers
+
+import (
+	"reflect"
+	"testing"
+
+	"learning/unit-testing/database"
+	"learning/unit-testing/internal"
+	"learning/unit-testing/jsonpatch"
+	"learning/unit-testing/models"
+)
+
+type TestCasePatchGroup struct {
+	name                 string
+	patch                string
+	expectedResponseType string
+	expectedGroup        database.GroupDocument
+}
+
+func TestPatchGroup(t *testing.T) {
+
+	patchCtlr := GetControllerMockDB()
+	userID := "dc9dbe3e-60d5-4a07-8c9c-42027b555b51"
+	groupID, _ := patchCtlr.DB.CreateUserConnectionGroup(userID, internal.UserConnectionGroupInfo{
+		GroupName:         "JSON Patch Group",
+		ConnectionUserIds: []internal.GroupConnectionUserID{{UserID: "member_1"}, {UserID: "member_2"}},
+	}, nil)
+	patchCtlr.DB.CreateUserConnectionGroup(userID, internal.UserConnectionGroupInfo{GroupName: "Taken Name"}, nil)
+	if _, err := patchCtlr.DB.SetUserConnectionGroupPic(userID, groupID, "pic_1", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []TestCasePatchGroup{
+		{
+			name: "OrderedMemberEdits",
+			patch: `[
+				{"op": "test", "path": "/connection_user_ids/0", "value": "member_1"},
+				{"op": "remove", "path": "/connection_user_ids/0"},
+				{"op": "add", "path": "/connection_user_ids/-", "value": "member_3"},
+				{"op": "replace", "path": "/group_name", "value": "Renamed Group"}
+			]`,
+			expectedResponseType: "Updated",
+			expectedGroup:        database.GroupDocument{GroupName: "Renamed Group", GroupPic: "pic_1", ConnectionUserIds: []string{"member_2", "member_3"}},
+		},
+		{
+			name: "FailedTestChangesNothing",
+			patch: `[
+				{"op": "replace", "path": "/group_name", "value": "Other Name"},
+				{"op": "test", "path": "/connection_user_ids/0", "value": "member_1"}
+			]`,
+			expectedResponseType: "errReturn409",
+			expectedGroup:        database.GroupDocument{GroupName: "Renamed Group", GroupPic: "pic_1", ConnectionUserIds: []string{"member_2", "member_3"}},
+		},
+		{
+			name:                 "NameInUse",
+			patch:                `[{"op": "replace", "path": "/group_name", "value": "Taken Name"}]`,
+			expectedResponseType: "errReturn409",
+			expectedGroup:        database.GroupDocument{GroupName: "Renamed Group", GroupPic: "pic_1", ConnectionUserIds: []string{"member_2", "member_3"}},
+		},
+		{
+			name:                 "RemoveName",
+			patch:                `[{"op": "remove", "path": "/group_name"}]`,
+			expectedResponseType: "errReturn422",
+			expectedGroup:        database.GroupDocument{GroupName: "Renamed Group", GroupPic: "pic_1", ConnectionUserIds: []string{"member_2", "member_3"}},
+		},
+		{
+			name:                 "UnknownField",
+			patch:                `[{"op": "add", "path": "/color", "value": "red"}]`,
+			expectedResponseType: "errReturn422",
+			expectedGroup:        database.GroupDocument{GroupName: "Renamed Group", GroupPic: "pic_1", ConnectionUserIds: []string{"member_2", "member_3"}},
+		},
+		{
+			name:                 "RemovePicture",
+			patch:                `[{"op": "test", "path": "/group_pic", "value": "pic_1"}, {"op": "remove", "path": "/group_pic"}]`,
+			expectedResponseType: "Updated",
+			expectedGroup:        database.GroupDocument{GroupName: "Renamed Group", ConnectionUserIds: []string{"member_2", "member_3"}},
+		},
+	}
+
+	for _, test := range testCases {
+
+		t.Run(test.name, func(t *testing.T) {
+			patch, err := jsonpatch.Decode([]byte(test.patch))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			res := patchCtlr.PatchGroup(GroupJSONPatchParams{UserID: userID, GroupID: groupID, Patch: patch}, &models.Principal{})
+			t.Logf("Actual Response: %+v\n", res)
+			assertEqual(t, res.resType, test.expectedResponseType)
+
+			group, _ := patchCtlr.DB.GetUserConnectionGroupByGroupID(userID, groupID)
+			if document := database.NewGroupDocument(group); !reflect.DeepEqual(document, test.expectedGroup) {
+				t.Fatalf("expected %+v, got %+v", test.expectedGroup, document)
+			}
+		})
+	}
+}
+
+func TestPatchGroupWithoutChanges(t *testing.T) {
+
+	patchCtlr := GetControllerMockDB()
+	userID := "dc9dbe3e-60d5-4a07-8c9c-42027b555b52"
+	groupID, _ := patchCtlr.DB.CreateUserConnectionGroup(userID, internal.UserConnectionGroupInfo{
+		GroupName:         "Unchanged Group",
+		ConnectionUserIds: []internal.GroupConnectionUserID{{UserID: "member_1"}},
+	}, nil)
+	mock := patchCtlr.DB.(*database.MockConnection)
+
+	patches := []string{
+		`[{"op": "test", "path": "/group_name", "value": "Unchanged Group"}]`,
+		`[{"op": "replace", "path": "/group_name", "value": "Unchanged Group"}]`,
+		`[
+			{"op": "add", "path": "/connection_user_ids/-", "value": "member_2"},
+			{"op": "remove", "path": "/connection_user_ids/1"}
+		]`,
+	}
+
+	before, _ := patchCtlr.DB.GetUserConnectionGroupByGroupID(userID, groupID)
+	outboxEvents := len(mock.OutboxEvents())
+	_, entries, err := patchCtlr.DB.ListGroupHistory(userID, groupID, 0, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, document := range patches {
+		patch, err := jsonpatch.Decode([]byte(document))
+		if err != nil {
+			t.Fatal(err)
+		}
+		res := patchCtlr.PatchGroup(GroupJSONPatchParams{UserID: userID, GroupID: groupID, Patch: patch}, &models.Principal{})
+		assertEqual(t, res.resType, "Updated")
+	}
+
+	after, _ := patchCtlr.DB.GetUserConnectionGroupByGroupID(userID, groupID)
+	assertEqual(t, after.UpdatedAt, before.UpdatedAt)
+	assertEqual(t, len(mock.OutboxEvents()), outboxEvents)
+
+	_, recorded, _ := patchCtlr.DB.ListGroupHistory(userID, groupID, 0, 10)
+	assertEqual(t, recorded, entries)
+}
@@ -0,0 +1,72 @@
+package controllers
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"learning/unit-testing/models"
+
+	"github.com/go-openapi/runtime"
+	"github.com/go-openapi/runtime/middleware"
+)
+
+// paginationLinks - RFC 8288 Link header value pointing to the first, previous, next and last pages of a listing
+// served at u, whose current page starts at offset. The links keep the other query parameters of u.
+func paginationLinks(u *url.URL, offset int, meta *models.PaginationData) string {
+	if u == nil || meta == nil || meta.PageLimit == nil || *meta.PageLimit < 1 {
+		return ""
+	}
+	limit := int(*meta.PageLimit)
+
+	link := func(rel string, offset int) string {
+		query := u.Query()
+		query.Set("offset", strconv.Itoa(offset))
+		query.Set("limit", strconv.Itoa(limit))
+		return "<" + u.Path + "?" + query.Encode() + `>; rel="` + rel + `"`
+	}
+
+	last := 0
+	if meta.PageCount != nil && *meta.PageCount > 0 {
+		last = (int(*meta.PageCount) - 1) * limit
+	}
+
+	links := []string{link("first", 0)}
+	if meta.HasPrev != nil && *meta.HasPrev {
+		prev := offset - limit
+		if prev < 0 {
+			prev = 0
+		}
+		links = append(links, link("prev", prev))
+	}
+	if meta.HasNext != nil && *meta.HasNext {
+		links = append(links, link("next", offset+limit))
+	}
+	links = append(links, link("last", last))
+
+	return strings.Join(links, ", ")
+}
+
+// setPaginationLinks - Add the Link header of a listing page to rw.
+func setPaginationLinks(rw http.ResponseWriter, r *http.Request, offset int, meta *models.PaginationData) {
+	if links := paginationLinks(r.URL, offset, meta); links != "" {
+		rw.Header().Set("Link", links)
+	}
+}
+
+// linkResponder - go-swagger responder adding the Link header of a listing page to another responder.
+type linkResponder struct {
+	middleware.Responder
+	r      *http.Request
+	offset int
+	meta   *models.PaginationData
+}
+
+// WriteResponse - implements middleware.Responder
+func (p *linkResponder) WriteResponse(rw http.ResponseWriter, producer runtime.Producer) {
+	if p.r != nil {
+		setPaginationLinks(rw, p.r, p.offset, p.meta)
+	}
+	p.Responder.WriteResponse(rw, producer)
+}
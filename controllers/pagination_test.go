@@ -0,0 +1,85 @@
+package controllers
+
+import (
+	"net/url"
+	"testing"
+
+	"learning/unit-testing/database"
+)
+
+type TestCasePagination struct {
+	name                string
+	page                database.PaginatedQuery
+	expectedPageCount   int32
+	expectedCurrentPage int32
+	expectedHasNext     bool
+	expectedHasPrev     bool
+	expectedLinks       string
+}
+
+func TestPaginationLinks(t *testing.T) {
+
+	u, _ := url.Parse("/users/user_1/connections/groups?order=asc&offset=20&limit=10")
+
+	testCases := []TestCasePagination{
+		{
+			name:                "FirstPage",
+			page:                database.PaginatedQuery{Offset: 0, Limit: 10, ResultCount: 25},
+			expectedPageCount:   3,
+			expectedCurrentPage: 1,
+			expectedHasNext:     true,
+			expectedLinks: `</users/user_1/connections/groups?limit=10&offset=0&order=asc>; rel="first", ` +
+				`</users/user_1/connections/groups?limit=10&offset=10&order=asc>; rel="next", ` +
+				`</users/user_1/connections/groups?limit=10&offset=20&order=asc>; rel="last"`,
+		},
+		{
+			name:                "LastPage",
+			page:                database.PaginatedQuery{Offset: 20, Limit: 10, ResultCount: 25},
+			expectedPageCount:   3,
+			expectedCurrentPage: 3,
+			expectedHasPrev:     true,
+			expectedLinks: `</users/user_1/connections/groups?limit=10&offset=0&order=asc>; rel="first", ` +
+				`</users/user_1/connections/groups?limit=10&offset=10&order=asc>; rel="prev", ` +
+				`</users/user_1/connections/groups?limit=10&offset=20&order=asc>; rel="last"`,
+		},
+		{
+			name:                "UnalignedOffset",
+			page:                database.PaginatedQuery{Offset: 5, Limit: 10, ResultCount: 25},
+			expectedPageCount:   3,
+			expectedCurrentPage: 1,
+			expectedHasNext:     true,
+			expectedHasPrev:     true,
+			expectedLinks: `</users/user_1/connections/groups?limit=10&offset=0&order=asc>; rel="first", ` +
+				`</users/user_1/connections/groups?limit=10&offset=0&order=asc>; rel="prev", ` +
+				`</users/user_1/connections/groups?limit=10&offset=15&order=asc>; rel="next", ` +
+				`</users/user_1/connections/groups?limit=10&offset=20&order=asc>; rel="last"`,
+		},
+		{
+			name:                "NoResults",
+			page:                database.PaginatedQuery{Offset: 0, Limit: 10, ResultCount: 0},
+			expectedPageCount:   0,
+			expectedCurrentPage: 1,
+			expectedLinks: `</users/user_1/connections/groups?limit=10&offset=0&order=asc>; rel="first", ` +
+				`</users/user_1/connections/groups?limit=10&offset=0&order=asc>; rel="last"`,
+		},
+		{
+			name:                "ZeroLimit",
+			page:                database.PaginatedQuery{Offset: 0, Limit: 0, ResultCount: 25},
+			expectedPageCount:   0,
+			expectedCurrentPage: 1,
+			expectedLinks:       "",
+		},
+	}
+
+	for _, test := range testCases {
+
+		t.Run(test.name, func(t *testing.T) {
+			meta := test.page.GetPaginatedQueryMetadata()
+			assertEqual(t, *meta.PageCount, test.expectedPageCount)
+			assertEqual(t, *meta.CurrentPage, test.expectedCurrentPage)
+			assertEqual(t, *meta.HasNext, test.expectedHasNext)
+			assertEqual(t, *meta.HasPrev, test.expectedHasPrev)
+			assertEqual(t, paginationLinks(u, test.page.Offset, meta), test.expectedLinks)
+		})
+	}
+}
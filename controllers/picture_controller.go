@@ -0,0 +1,339 @@
+package controllers
+
+import (
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"learning/unit-testing/blobstore"
+	"learning/unit-testing/config"
+	"learning/unit-testing/database"
+	"learning/unit-testing/models"
+	"learning/unit-testing/problem"
+	"learning/unit-testing/tracing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// pictureFormField - multipart form field carrying the uploaded picture.
+const pictureFormField = "picture"
+
+// pictureCacheControl - pictures live behind a stable URL but may change, so clients must revalidate with the ETag.
+const pictureCacheControl = "private, no-cache"
+
+var (
+	errPictureTooLarge       = errors.New("picture exceeds the upload size limit")
+	errPictureMissing        = errors.New("no picture found in the request body")
+	errUnsupportedMediaType  = errors.New("picture must be uploaded as multipart/form-data, image/* or application/octet-stream")
+	errGroupPictureNotExists = errors.New("group has no picture")
+	errUnknownRendition      = errors.New("unknown picture rendition")
+)
+
+// GroupPictureParams - Path parameters of the group picture endpoints.
+type GroupPictureParams struct {
+	HTTPRequest *http.Request
+	UserID      string
+	GroupID     string
+}
+
+// PutGroupPictureResponse - Holding reponse for PutGroupPicture()
+type PutGroupPictureResponse struct {
+	resType string
+	errMsg  string
+	err     error
+}
+
+// GetGroupPictureResponse - Holding reponse for GetGroupPicture()
+type GetGroupPictureResponse struct {
+	body    io.ReadCloser
+	info    blobstore.Info
+	resType string
+	errMsg  string
+	err     error
+}
+
+// DeleteGroupPictureResponse - Holding reponse for DeleteGroupPicture()
+type DeleteGroupPictureResponse struct {
+	resType string
+	errMsg  string
+	err     error
+}
+
+// groupPictureParams - Path parameters of a request routed on /users/{userID}/connections/groups/{groupID}/picture.
+func groupPictureParams(r *http.Request) GroupPictureParams {
+	return GroupPictureParams{HTTPRequest: r, UserID: r.PathValue("userID"), GroupID: r.PathValue("groupID")}
+}
+
+// renditionConfigured - Whether rendition names the original picture or one of the configured renditions.
+func renditionConfigured(rendition string) bool {
+	if rendition == "" || rendition == config.OriginalRendition {
+		return true
+	}
+	for _, r := range config.Get().Images.Renditions {
+		if r.Name == rendition {
+			return true
+		}
+	}
+	return false
+}
+
+// writeProblem - Map a controller result type onto a problem response.
+func writeProblem(rw http.ResponseWriter, r *http.Request, resType string, errMsg string) {
+	details := problem.New(problemStatus(resType), errMsg)
+	details.Instance = r.URL.Path
+	problem.Write(rw, details)
+}
+
+// GroupPicturePutController - Upload the picture of a group as multipart/form-data or raw binary.
+// The picture is reduced in the background, progress shows in the picture_status of the group.
+func GroupPicturePutController(rw http.ResponseWriter, r *http.Request, principal *models.Principal) {
+
+	ctlr, err := GetController()
+	if err != nil {
+		writeProblem(rw, r, "errReturn500", "")
+		return
+	}
+
+	response := ctlr.PutGroupPicture(groupPictureParams(r), principal)
+	if response.err != nil {
+		writeProblem(rw, r, response.resType, response.errMsg)
+		return
+	}
+
+	// The group reports the processing status of its picture.
+	rw.Header().Set("Location", strings.TrimSuffix(r.URL.Path, "/picture"))
+	rw.WriteHeader(http.StatusAccepted)
+}
+
+// GroupPictureGetController - Download the picture of a group, honouring If-None-Match.
+func GroupPictureGetController(rw http.ResponseWriter, r *http.Request, principal *models.Principal) {
+
+	ctlr, err := GetController()
+	if err != nil {
+		writeProblem(rw, r, "errReturn500", "")
+		return
+	}
+
+	response := ctlr.GetGroupPicture(groupPictureParams(r), principal)
+	if response.err != nil {
+		writeProblem(rw, r, response.resType, response.errMsg)
+		return
+	}
+	defer response.body.Close()
+
+	etag := strconv.Quote(response.info.ETag)
+	rw.Header().Set("ETag", etag)
+	rw.Header().Set("Cache-Control", pictureCacheControl)
+
+	if etagMatches(r.Header.Get("If-None-Match"), etag) {
+		rw.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	rw.Header().Set("Content-Type", response.info.ContentType)
+	rw.Header().Set("Content-Length", strconv.FormatInt(response.info.Size, 10))
+	rw.Header().Set("X-Content-Type-Options", "nosniff")
+	rw.WriteHeader(http.StatusOK)
+	_, _ = io.Copy(rw, response.body)
+}
+
+// GroupPictureDeleteController - Remove the picture of a group.
+func GroupPictureDeleteController(rw http.ResponseWriter, r *http.Request, principal *models.Principal) {
+
+	ctlr, err := GetController()
+	if err != nil {
+		writeProblem(rw, r, "errReturn500", "")
+		return
+	}
+
+	response := ctlr.DeleteGroupPicture(groupPictureParams(r), principal)
+	if response.err != nil {
+		writeProblem(rw, r, response.resType, response.errMsg)
+		return
+	}
+
+	rw.WriteHeader(http.StatusNoContent)
+}
+
+// etagMatches - Whether an If-None-Match header matches etag, using the weak comparison of RFC 7232.
+func etagMatches(ifNoneMatch string, etag string) bool {
+	if ifNoneMatch == "" {
+		return false
+	}
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// readPictureUpload - Read the uploaded picture, bounded by maxBytes.
+func readPictureUpload(r *http.Request, maxBytes int64) ([]byte, error) {
+
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil {
+		return nil, errUnsupportedMediaType
+	}
+
+	// Leave room for the multipart envelope around the picture.
+	r.Body = http.MaxBytesReader(nil, r.Body, maxBytes+64*1024)
+
+	var body io.Reader
+	switch {
+	case mediaType == "multipart/form-data":
+		reader, err := r.MultipartReader()
+		if err != nil {
+			return nil, err
+		}
+		for {
+			part, err := reader.NextPart()
+			if err == io.EOF {
+				return nil, errPictureMissing
+			}
+			if err != nil {
+				return nil, uploadError(err)
+			}
+			if part.FormName() == pictureFormField {
+				body = part
+				break
+			}
+		}
+	case strings.HasPrefix(mediaType, "image/"), mediaType == "application/octet-stream":
+		body = r.Body
+	default:
+		return nil, errUnsupportedMediaType
+	}
+
+	data, err := io.ReadAll(io.LimitReader(body, maxBytes+1))
+	if err != nil {
+		return nil, uploadError(err)
+	}
+	if int64(len(data)) > maxBytes {
+		return nil, errPictureTooLarge
+	}
+	if len(data) == 0 {
+		return nil, errPictureMissing
+	}
+
+	return data, nil
+}
+
+func uploadError(err error) error {
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		return errPictureTooLarge
+	}
+	return err
+}
+
+// PutGroupPicture -
+func (c Ctlr) PutGroupPicture(params GroupPictureParams, principal *models.Principal) PutGroupPictureResponse {
+
+	ctx, span := tracing.Start(params.HTTPRequest, "Ctlr.PutGroupPicture")
+	defer span.End()
+
+	db := database.NewTracingStorage(ctx, c.DB)
+
+	if _, err := db.GetUserConnectionGroupByGroupID(params.UserID, params.GroupID); err != nil {
+		if status.Code(err) == codes.NotFound {
+			return PutGroupPictureResponse{resType: "errReturn404", errMsg: "record not found", err: err}
+		}
+		return PutGroupPictureResponse{resType: "errReturn500", errMsg: "failed to parse group from database", err: err}
+	}
+
+	data, err := readPictureUpload(params.HTTPRequest, config.Get().Images.MaxUploadBytes)
+	if err != nil {
+		switch err {
+		case errPictureTooLarge:
+			return PutGroupPictureResponse{resType: "errReturn413", errMsg: err.Error(), err: err}
+		case errUnsupportedMediaType:
+			return PutGroupPictureResponse{resType: "errReturn415", errMsg: err.Error(), err: err}
+		}
+		return PutGroupPictureResponse{resType: "errReturn400", errMsg: "failed to read picture upload", err: err}
+	}
+
+	uploadKey, err := c.stageGroupPic(ctx, data)
+	if err != nil {
+		if resType, rejected := rejectionResType(err); rejected {
+			return PutGroupPictureResponse{resType: resType, errMsg: err.Error(), err: err}
+		}
+		return PutGroupPictureResponse{resType: "errReturn500", errMsg: "failed to store group picture", err: err}
+	}
+
+	if err := enqueueGroupPic(db, params.UserID, params.GroupID, uploadKey, principal); err != nil {
+		if status.Code(err) == codes.NotFound {
+			return PutGroupPictureResponse{resType: "errReturn404", errMsg: "record not found", err: err}
+		}
+		return PutGroupPictureResponse{resType: "errReturn500", errMsg: "failed to queue group picture", err: err}
+	}
+
+	return PutGroupPictureResponse{resType: "Accepted"}
+}
+
+// GetGroupPicture -
+func (c Ctlr) GetGroupPicture(params GroupPictureParams, principal *models.Principal) GetGroupPictureResponse {
+
+	ctx, span := tracing.Start(params.HTTPRequest, "Ctlr.GetGroupPicture")
+	defer span.End()
+
+	db := database.NewTracingStorage(ctx, c.DB)
+
+	groupInfo, err := db.GetUserConnectionGroupByGroupID(params.UserID, params.GroupID)
+	if err != nil {
+		if status.Code(err) == codes.NotFound {
+			return GetGroupPictureResponse{resType: "errReturn404", errMsg: "record not found", err: err}
+		}
+		return GetGroupPictureResponse{resType: "errReturn500", errMsg: "failed to parse group from database", err: err}
+	}
+
+	if groupInfo.GroupPic == "" {
+		return GetGroupPictureResponse{resType: "errReturn404", errMsg: errGroupPictureNotExists.Error(), err: errGroupPictureNotExists}
+	}
+
+	rendition := ""
+	if params.HTTPRequest != nil {
+		rendition = params.HTTPRequest.URL.Query().Get("rendition")
+	}
+	if !renditionConfigured(rendition) {
+		return GetGroupPictureResponse{resType: "errReturn404", errMsg: errUnknownRendition.Error(), err: errUnknownRendition}
+	}
+
+	body, info, err := c.Blobs.Get(ctx, renditionKey(groupInfo.GroupPic, rendition))
+	if errors.Is(err, blobstore.ErrNotFound) && renditionKey(groupInfo.GroupPic, rendition) != groupInfo.GroupPic {
+		// Renditions are missing when they could not be generated, serve the original instead.
+		body, info, err = c.Blobs.Get(ctx, groupInfo.GroupPic)
+	}
+	if err != nil {
+		if errors.Is(err, blobstore.ErrNotFound) {
+			return GetGroupPictureResponse{resType: "errReturn404", errMsg: errGroupPictureNotExists.Error(), err: err}
+		}
+		return GetGroupPictureResponse{resType: "errReturn500", errMsg: "failed to read group picture", err: err}
+	}
+
+	return GetGroupPictureResponse{resType: "OK", body: body, info: info}
+}
+
+// DeleteGroupPicture -
+func (c Ctlr) DeleteGroupPicture(params GroupPictureParams, principal *models.Principal) DeleteGroupPictureResponse {
+
+	ctx, span := tracing.Start(params.HTTPRequest, "Ctlr.DeleteGroupPicture")
+	defer span.End()
+
+	db := database.NewTracingStorage(ctx, c.DB)
+
+	// The history entry and the events are recorded with the change.
+	if _, err := db.SetUserConnectionGroupPic(params.UserID, params.GroupID, "", principalClaims(principal)); err != nil {
+		if status.Code(err) == codes.NotFound {
+			return DeleteGroupPictureResponse{resType: "errReturn404", errMsg: "record not found", err: err}
+		}
+		return DeleteGroupPictureResponse{resType: "errReturn500", errMsg: "failed to update group in database", err: err}
+	}
+
+	return DeleteGroupPictureResponse{resType: "Deleted"}
+}
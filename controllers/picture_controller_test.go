@@ -0,0 +1,134 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"learning/unit-testing/internal"
+	"learning/unit-testing/models"
+)
+
+type TestCasePutGroupPicture struct {
+	name                 string
+	userID               string
+	groupID              string
+	contentType          string
+	body                 []byte
+	expectedResponseType string
+	expectedErrMsg       string
+}
+
+func TestPutGroupPicture(t *testing.T) {
+
+	picCtlr := GetControllerMockDB()
+	userID := "dc9dbe3e-60d5-4a07-8c9c-42027b555b11"
+	groupID, _ := picCtlr.DB.CreateUserConnectionGroup(userID, internal.UserConnectionGroupInfo{GroupName: "Picture Group"}, nil)
+
+	testCases := []TestCasePutGroupPicture{
+		{
+			name:                 "NotFound",
+			userID:               userID,
+			groupID:              "group_id_9",
+			contentType:          "image/png",
+			body:                 []byte("picture"),
+			expectedResponseType: "errReturn404",
+			expectedErrMsg:       "record not found",
+		},
+		{
+			name:                 "UnsupportedMediaType",
+			userID:               userID,
+			groupID:              groupID,
+			contentType:          "text/plain",
+			body:                 []byte("picture"),
+			expectedResponseType: "errReturn415",
+			expectedErrMsg:       errUnsupportedMediaType.Error(),
+		},
+		{
+			name:                 "TooLarge",
+			userID:               userID,
+			groupID:              groupID,
+			contentType:          "application/octet-stream",
+			body:                 bytes.Repeat([]byte{0xff}, 11<<20),
+			expectedResponseType: "errReturn413",
+			expectedErrMsg:       errPictureTooLarge.Error(),
+		},
+		{
+			name:                 "Empty",
+			userID:               userID,
+			groupID:              groupID,
+			contentType:          "image/jpeg",
+			expectedResponseType: "errReturn400",
+			expectedErrMsg:       "failed to read picture upload",
+		},
+		{
+			name:                 "NotAnImage",
+			userID:               userID,
+			groupID:              groupID,
+			contentType:          "image/jpeg",
+			body:                 []byte("fake_image"),
+			expectedResponseType: "errReturn415",
+			expectedErrMsg:       "picture rejected (unsupported_format): only JPEG, PNG, GIF and WebP pictures are accepted",
+		},
+	}
+
+	for _, test := range testCases {
+
+		t.Run(test.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPut, "/users/"+test.userID+"/connections/groups/"+test.groupID+"/picture", bytes.NewReader(test.body))
+			req.Header.Set("Content-Type", test.contentType)
+
+			res := picCtlr.PutGroupPicture(GroupPictureParams{HTTPRequest: req, UserID: test.userID, GroupID: test.groupID}, &models.Principal{})
+
+			assertEqual(t, res.resType, test.expectedResponseType)
+			assertEqual(t, res.errMsg, test.expectedErrMsg)
+		})
+	}
+}
+
+func TestGetGroupPicture(t *testing.T) {
+
+	picCtlr := GetControllerMockDB()
+	userID := "dc9dbe3e-60d5-4a07-8c9c-42027b555b12"
+	groupID, _ := picCtlr.DB.CreateUserConnectionGroup(userID, internal.UserConnectionGroupInfo{GroupName: "Picture Group"}, nil)
+	params := GroupPictureParams{UserID: userID, GroupID: groupID}
+
+	res := picCtlr.GetGroupPicture(params, &models.Principal{})
+	assertEqual(t, res.resType, "errReturn404")
+	assertEqual(t, res.errMsg, errGroupPictureNotExists.Error())
+
+	data := []byte("GIF89a fake picture bytes")
+	picID, err := picCtlr.storeGroupPic(context.Background(), &groupPicture{reduced: data})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := picCtlr.DB.SetUserConnectionGroupPic(userID, groupID, picID, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	res = picCtlr.GetGroupPicture(params, &models.Principal{})
+	assertEqual(t, res.resType, "OK")
+	got, _ := io.ReadAll(res.body)
+	assertEqual(t, got, data)
+	assertEqual(t, res.info.ContentType, "image/gif")
+
+	deleted := picCtlr.DeleteGroupPicture(params, &models.Principal{})
+	assertEqual(t, deleted.resType, "Deleted")
+
+	res = picCtlr.GetGroupPicture(params, &models.Principal{})
+	assertEqual(t, res.resType, "errReturn404")
+}
+
+func TestEtagMatches(t *testing.T) {
+	etag := `"abc"`
+
+	assertEqual(t, etagMatches("", etag), false)
+	assertEqual(t, etagMatches(`"abc"`, etag), true)
+	assertEqual(t, etagMatches(`W/"abc"`, etag), true)
+	assertEqual(t, etagMatches(`"xyz", "abc"`, etag), true)
+	assertEqual(t, etagMatches(`*`, etag), true)
+	assertEqual(t, etagMatches(`"xyz"`, etag), false)
+}
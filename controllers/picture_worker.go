@@ -0,0 +1,239 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"math/rand"
+	"sync"
+	"time"
+
+	"learning/unit-testing/blobstore"
+	"learning/unit-testing/config"
+	"learning/unit-testing/database"
+	"learning/unit-testing/imaging"
+	"learning/unit-testing/tracing"
+
+	"go.opentelemetry.io/otel/attribute"
+	otelcodes "go.opentelemetry.io/otel/codes"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// PictureWorkerPool - Workers reducing the group pictures queued by the API.
+type PictureWorkerPool struct {
+	ctlr   Ctlr
+	config config.PictureQueue
+
+	// jitter returns a random duration in [0, n), replaced in tests.
+	jitter func(n time.Duration) time.Duration
+	now    func() time.Time
+
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// NewPictureWorkerPool - Pool processing the picture jobs of ctlr's storage.
+func NewPictureWorkerPool(ctlr Ctlr, cfg config.PictureQueue) *PictureWorkerPool {
+	return &PictureWorkerPool{
+		ctlr:   ctlr,
+		config: cfg,
+		jitter: func(n time.Duration) time.Duration { return time.Duration(rand.Int63n(int64(n))) },
+		now:    time.Now,
+	}
+}
+
+// Start - Run the configured number of workers until Stop is called.
+func (p *PictureWorkerPool) Start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	p.cancel = cancel
+
+	for i := 0; i < p.config.Workers; i++ {
+		p.wg.Add(1)
+		go func() {
+			defer p.wg.Done()
+			p.run(ctx)
+		}()
+	}
+}
+
+// Stop - Stop claiming jobs and wait for the jobs in progress. Jobs left claimed are retried once their lease expires.
+func (p *PictureWorkerPool) Stop() {
+	if p.cancel != nil {
+		p.cancel()
+	}
+	p.wg.Wait()
+}
+
+func (p *PictureWorkerPool) run(ctx context.Context) {
+	ticker := time.NewTicker(time.Duration(p.config.PollInterval))
+	defer ticker.Stop()
+
+	for {
+		// Keep draining while there is work, wait for the next tick otherwise.
+		for ctx.Err() == nil && p.poll(ctx) > 0 {
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// poll - Claim a batch of jobs and process them, returning how many were claimed.
+func (p *PictureWorkerPool) poll(ctx context.Context) int {
+	jobs, err := p.ctlr.DB.ClaimPictureJobs(p.now(), time.Duration(p.config.Lease), p.config.BatchSize)
+	if err != nil {
+		log.Printf("failed to claim picture jobs (%s)", err.Error())
+		return 0
+	}
+
+	for _, job := range jobs {
+		p.process(ctx, job)
+	}
+	return len(jobs)
+}
+
+// process - Run a claimed job, then complete, retry or fail it.
+func (p *PictureWorkerPool) process(ctx context.Context, job database.PictureJob) {
+
+	ctx, span := tracing.Tracer().Start(ctx, "PictureWorker.Process")
+	defer span.End()
+	span.SetAttributes(attribute.String("job.id", job.JobID), attribute.Int("job.attempts", job.Attempts))
+
+	db := database.NewTracingStorage(ctx, p.ctlr.DB)
+
+	jobErr := p.processJob(ctx, db, job)
+	if jobErr == nil {
+		if err := db.CompletePictureJob(job.JobID); err != nil {
+			log.Printf("failed to complete picture job (%s) (%s)", job.JobID, err.Error())
+		}
+		return
+	}
+
+	span.RecordError(jobErr)
+	span.SetStatus(otelcodes.Error, jobErr.Error())
+	log.Printf("picture job (%s) of group (%s) failed on attempt %d (%s)", job.JobID, job.GroupID, job.Attempts, jobErr.Error())
+
+	pictureStatus := database.PictureStatusFailed
+	if job.Attempts < p.config.MaxAttempts && !permanentPictureError(jobErr) {
+		pictureStatus = database.PictureStatusProcessing
+		if err := db.RetryPictureJob(job.JobID, p.now().Add(p.backoff(job.Attempts)), jobErr.Error()); err != nil {
+			log.Printf("failed to reschedule picture job (%s) (%s)", job.JobID, err.Error())
+		}
+	} else {
+		if err := db.FailPictureJob(job.JobID, jobErr.Error()); err != nil {
+			log.Printf("failed to mark picture job (%s) as failed (%s)", job.JobID, err.Error())
+		}
+		p.deleteUpload(ctx, job.UploadKey)
+	}
+
+	// The group keeps the last error, also while the job is retried.
+	if err := db.SetUserConnectionGroupPicStatus(job.UserID, job.GroupID, pictureStatus, jobErr.Error()); err != nil {
+		log.Printf("failed to record picture error of group (%s) (%s)", job.GroupID, err.Error())
+	}
+}
+
+// processJob - Reduce the staged upload of job and make it the picture of its group.
+func (p *PictureWorkerPool) processJob(ctx context.Context, db database.Storage, job database.PictureJob) error {
+
+	body, _, err := p.ctlr.Blobs.Get(ctx, job.UploadKey)
+	if err != nil {
+		return err
+	}
+	data, err := io.ReadAll(body)
+	body.Close()
+	if err != nil {
+		return err
+	}
+
+	var picture *groupPicture
+	reduce := func() (*groupPicture, error) {
+		if picture == nil {
+			reduced, err := reduceGroupPic(ctx, data)
+			if err != nil {
+				return nil, err
+			}
+			picture = reduced
+		}
+		return picture, nil
+	}
+
+	// Identical uploads share the reduced picture and its renditions.
+	sourceHash := blobstore.ContentKey(data)
+	groupPicID, err := p.ctlr.reusableGroupPic(ctx, db, sourceHash)
+	if err != nil {
+		return err
+	}
+
+	if groupPicID == "" {
+		picture, err := reduce()
+		if err != nil {
+			return err
+		}
+
+		groupPicID, err = p.ctlr.storeGroupPic(ctx, picture)
+		if err != nil {
+			return err
+		}
+	}
+
+	// A picture being freed fails the job, which is retried once the picture is gone.
+	groupPicID, err = p.ctlr.attachGroupPic(ctx, db, job.UserID, job.GroupID, groupPicID, job.Principal, reduce)
+	if err == nil {
+		err = db.SetGroupPicSource(groupPicID, sourceHash)
+	}
+	if err == nil {
+		err = db.SetUserConnectionGroupPicStatus(job.UserID, job.GroupID, database.PictureStatusReady, "")
+	}
+	if status.Code(err) == codes.NotFound {
+		// The group was deleted in the meantime, nothing left to update.
+		err = nil
+	}
+	if err != nil {
+		return err
+	}
+
+	// The previous picture of the group may not be used anymore.
+	p.ctlr.freeUnreferencedGroupPics(ctx, db)
+
+	p.deleteUpload(ctx, job.UploadKey)
+	return nil
+}
+
+func (p *PictureWorkerPool) deleteUpload(ctx context.Context, key string) {
+	if err := p.ctlr.Blobs.Delete(ctx, key); err != nil && !errors.Is(err, blobstore.ErrNotFound) {
+		log.Printf("failed to delete staged picture (%s) (%s)", key, err.Error())
+	}
+}
+
+// backoff - Delay before the next attempt of a job that failed attempts times.
+func (p *PictureWorkerPool) backoff(attempts int) time.Duration {
+	return retryBackoff(time.Duration(p.config.BaseBackoff), time.Duration(p.config.MaxBackoff), attempts, p.jitter)
+}
+
+// retryBackoff - Delay before the next attempt of work that failed attempts times: base doubled after every
+// failure up to max, plus up to half of it as jitter so that failing work spreads out.
+func retryBackoff(base time.Duration, max time.Duration, attempts int, jitter func(n time.Duration) time.Duration) time.Duration {
+	delay := base
+	for i := 1; i < attempts && delay < max; i++ {
+		delay *= 2
+	}
+	if delay > max {
+		delay = max
+	}
+
+	if half := delay / 2; half > 0 {
+		delay += jitter(half)
+	}
+	return delay
+}
+
+// permanentPictureError - Whether retrying a failed job cannot help.
+func permanentPictureError(err error) bool {
+	var rejection *imaging.RejectionError
+	return errors.As(err, &rejection) || errors.Is(err, blobstore.ErrNotFound)
+}
@@ -0,0 +1,203 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"learning/unit-testing/blobstore"
+	"learning/unit-testing/config"
+	"learning/unit-testing/database"
+	"learning/unit-testing/internal"
+	"learning/unit-testing/models"
+)
+
+// unavailableBlobStore - Blob store whose reads always fail.
+type unavailableBlobStore struct {
+	blobstore.BlobStore
+}
+
+func (unavailableBlobStore) Get(ctx context.Context, key string) (io.ReadCloser, blobstore.Info, error) {
+	return nil, blobstore.Info{}, errors.New("blob store unavailable")
+}
+
+type TestCasePictureWorker struct {
+	name                  string
+	blobs                 blobstore.BlobStore
+	maxAttempts           int
+	expectedJobStatus     string
+	expectedAvailableAt   time.Time
+	expectedPictureStatus string
+	expectedPictureError  string
+}
+
+func TestPictureWorkerFailures(t *testing.T) {
+
+	now := time.Date(2021, 3, 1, 12, 0, 0, 0, time.UTC)
+	queue := config.Defaults().Pictures
+
+	testCases := []TestCasePictureWorker{
+		{
+			name:                  "Retried",
+			blobs:                 unavailableBlobStore{blobstore.NewMemory()},
+			maxAttempts:           3,
+			expectedJobStatus:     database.PictureJobQueued,
+			expectedAvailableAt:   now.Add(time.Duration(queue.BaseBackoff)),
+			expectedPictureStatus: database.PictureStatusProcessing,
+			expectedPictureError:  "blob store unavailable",
+		},
+		{
+			name:                  "AttemptsExhausted",
+			blobs:                 unavailableBlobStore{blobstore.NewMemory()},
+			maxAttempts:           1,
+			expectedJobStatus:     database.PictureJobFailed,
+			expectedAvailableAt:   now.Add(time.Duration(queue.Lease)),
+			expectedPictureStatus: database.PictureStatusFailed,
+			expectedPictureError:  "blob store unavailable",
+		},
+		{
+			name:                  "UploadMissing",
+			blobs:                 blobstore.NewMemory(),
+			maxAttempts:           3,
+			expectedJobStatus:     database.PictureJobFailed,
+			expectedAvailableAt:   now.Add(time.Duration(queue.Lease)),
+			expectedPictureStatus: database.PictureStatusFailed,
+			expectedPictureError:  blobstore.ErrNotFound.Error(),
+		},
+	}
+
+	for _, test := range testCases {
+
+		t.Run(test.name, func(t *testing.T) {
+			workerCtlr := GetControllerMockDB()
+			workerCtlr.Blobs = test.blobs
+			userID := "dc9dbe3e-60d5-4a07-8c9c-42027b555b21"
+			groupID, _ := workerCtlr.DB.CreateUserConnectionGroup(userID, internal.UserConnectionGroupInfo{GroupName: "Worker Group"}, nil)
+			if err := enqueueGroupPic(workerCtlr.DB, userID, groupID, uploadKeyPrefix+"missing", nil); err != nil {
+				t.Fatal(err)
+			}
+
+			cfg := queue
+			cfg.MaxAttempts = test.maxAttempts
+			pool := NewPictureWorkerPool(workerCtlr, cfg)
+			pool.now = func() time.Time { return now }
+			pool.jitter = func(time.Duration) time.Duration { return 0 }
+
+			assertEqual(t, pool.poll(context.Background()), 1)
+
+			jobs := workerCtlr.DB.(*database.MockConnection).PictureJobs()
+			assertEqual(t, len(jobs), 1)
+			assertEqual(t, jobs[0].Status, test.expectedJobStatus)
+			assertEqual(t, jobs[0].Attempts, 1)
+			assertEqual(t, jobs[0].AvailableAt, test.expectedAvailableAt)
+
+			group, _ := workerCtlr.DB.GetUserConnectionGroupByGroupID(userID, groupID)
+			assertEqual(t, group.PictureStatus, test.expectedPictureStatus)
+			assertEqual(t, group.PictureError, test.expectedPictureError)
+		})
+	}
+}
+
+func TestPictureWorkerReusesIdenticalPicture(t *testing.T) {
+
+	workerCtlr := GetControllerMockDB()
+	ctx := context.Background()
+	userID := "dc9dbe3e-60d5-4a07-8c9c-42027b555b22"
+	firstID, _ := workerCtlr.DB.CreateUserConnectionGroup(userID, internal.UserConnectionGroupInfo{GroupName: "First Group"}, nil)
+	secondID, _ := workerCtlr.DB.CreateUserConnectionGroup(userID, internal.UserConnectionGroupInfo{GroupName: "Second Group"}, nil)
+
+	// The first group already uses the picture reduced from the upload.
+	upload := []byte("GIF89a sanitized upload bytes")
+	picID, err := workerCtlr.storeGroupPic(ctx, &groupPicture{reduced: []byte("GIF89a reduced bytes")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := workerCtlr.DB.SetUserConnectionGroupPic(userID, firstID, picID, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := workerCtlr.DB.SetGroupPicSource(picID, blobstore.ContentKey(upload)); err != nil {
+		t.Fatal(err)
+	}
+
+	uploadKey := uploadKeyPrefix + "second"
+	if err := workerCtlr.Blobs.Put(ctx, uploadKey, bytes.NewReader(upload), int64(len(upload)), "image/gif"); err != nil {
+		t.Fatal(err)
+	}
+	if err := enqueueGroupPic(workerCtlr.DB, userID, secondID, uploadKey, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	pool := NewPictureWorkerPool(workerCtlr, config.Defaults().Pictures)
+	assertEqual(t, pool.poll(ctx), 1)
+
+	group, _ := workerCtlr.DB.GetUserConnectionGroupByGroupID(userID, secondID)
+	assertEqual(t, group.GroupPic, picID)
+	assertEqual(t, group.PictureStatus, database.PictureStatusReady)
+	assertEqual(t, workerCtlr.DB.(*database.MockConnection).GroupPicRefCount(picID), 2)
+	assertEqual(t, len(workerCtlr.DB.(*database.MockConnection).PictureJobs()), 0)
+
+	if _, err := workerCtlr.Blobs.Stat(ctx, uploadKey); !errors.Is(err, blobstore.ErrNotFound) {
+		t.Fatalf("expected the staged upload to be deleted, got %v", err)
+	}
+}
+
+func TestPictureWorkerRecordsHistory(t *testing.T) {
+
+	workerCtlr := GetControllerMockDB()
+	ctx := context.Background()
+	userID := "dc9dbe3e-60d5-4a07-8c9c-42027b555b23"
+	principal := &models.Principal{UserID: userID}
+	firstID, _ := workerCtlr.DB.CreateUserConnectionGroup(userID, internal.UserConnectionGroupInfo{GroupName: "First History Group"}, nil)
+	secondID, _ := workerCtlr.DB.CreateUserConnectionGroup(userID, internal.UserConnectionGroupInfo{GroupName: "Second History Group"}, nil)
+
+	upload := []byte("GIF89a sanitized history upload bytes")
+	picID, err := workerCtlr.storeGroupPic(ctx, &groupPicture{reduced: []byte("GIF89a reduced history bytes")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	workerCtlr.DB.SetUserConnectionGroupPic(userID, firstID, picID, nil)
+	workerCtlr.DB.SetGroupPicSource(picID, blobstore.ContentKey(upload))
+
+	uploadKey := uploadKeyPrefix + "history"
+	if err := workerCtlr.Blobs.Put(ctx, uploadKey, bytes.NewReader(upload), int64(len(upload)), "image/gif"); err != nil {
+		t.Fatal(err)
+	}
+	if err := enqueueGroupPic(workerCtlr.DB, userID, secondID, uploadKey, principal); err != nil {
+		t.Fatal(err)
+	}
+	pool := NewPictureWorkerPool(workerCtlr, config.Defaults().Pictures)
+	assertEqual(t, pool.poll(ctx), 1)
+
+	// The worker records the change on behalf of the uploader.
+	entries, total, _ := workerCtlr.DB.ListGroupHistory(userID, secondID, 0, 10)
+	assertEqual(t, total, 2)
+	assertEqual(t, entries[0].Action, database.GroupUpdated)
+	assertEqual(t, entries[0].Changes, []database.FieldChange{{Field: "group_pic", Before: "", After: picID}})
+	assertEqual(t, entries[0].Principal, principalClaims(principal))
+
+	// Removing the picture is recorded too, and the version left by the worker can be restored.
+	assertEqual(t, workerCtlr.DeleteGroupPicture(GroupPictureParams{UserID: userID, GroupID: secondID}, principal).resType, "Deleted")
+	_, total, _ = workerCtlr.DB.ListGroupHistory(userID, secondID, 0, 10)
+	assertEqual(t, total, 3)
+
+	assertEqual(t, workerCtlr.RevertGroup(GroupHistoryParams{UserID: userID, GroupID: secondID, EntryID: entries[0].EntryID}, principal).resType, "Reverted")
+	group, _ := workerCtlr.DB.GetUserConnectionGroupByGroupID(userID, secondID)
+	assertEqual(t, group.GroupPic, picID)
+}
+
+func TestPictureWorkerBackoff(t *testing.T) {
+
+	pool := NewPictureWorkerPool(Ctlr{}, config.PictureQueue{
+		BaseBackoff: config.Duration(time.Second),
+		MaxBackoff:  config.Duration(10 * time.Second),
+	})
+	pool.jitter = func(n time.Duration) time.Duration { return n - 1 }
+
+	assertEqual(t, pool.backoff(1), time.Second+500*time.Millisecond-1)
+	assertEqual(t, pool.backoff(2), 2*time.Second+time.Second-1)
+	assertEqual(t, pool.backoff(4), 8*time.Second+4*time.Second-1)
+	assertEqual(t, pool.backoff(30), 10*time.Second+5*time.Second-1)
+}
@@ -0,0 +1,52 @@
+package controllers
+
+import (
+	"net/http"
+
+	"learning/unit-testing/problem"
+	"learning/unit-testing/requestid"
+
+	"github.com/go-openapi/runtime"
+	"github.com/go-openapi/runtime/middleware"
+)
+
+// problemStatus - HTTP status of a controller result type such as "errReturn404".
+func problemStatus(resType string) int {
+	switch resType {
+	case "errReturn400":
+		return http.StatusBadRequest
+	case "errReturn403":
+		return http.StatusForbidden
+	case "errReturn404":
+		return http.StatusNotFound
+	case "errReturn409":
+		return http.StatusConflict
+	case "errReturn413":
+		return http.StatusRequestEntityTooLarge
+	case "errReturn415":
+		return http.StatusUnsupportedMediaType
+	case "errReturn422":
+		return http.StatusUnprocessableEntity
+	}
+	return http.StatusInternalServerError
+}
+
+// problemResponder - go-swagger responder writing an RFC 7807 problem document.
+type problemResponder struct {
+	details problem.Details
+}
+
+// newProblemResponder - Problem response for the given status, tagged with the request ID carried by r.
+func newProblemResponder(r *http.Request, status int, detail string) middleware.Responder {
+	details := problem.New(status, detail)
+	if r != nil {
+		details.Instance = r.URL.Path
+		details.RequestID = requestid.FromContext(r.Context())
+	}
+	return &problemResponder{details: details}
+}
+
+// WriteResponse - implements middleware.Responder
+func (p *problemResponder) WriteResponse(rw http.ResponseWriter, _ runtime.Producer) {
+	problem.Write(rw, p.details)
+}
@@ -0,0 +1,181 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"learning/unit-testing/config"
+	"learning/unit-testing/database"
+	"learning/unit-testing/models"
+	"learning/unit-testing/tracing"
+)
+
+var errInvalidLastEventID = errors.New("Last-Event-ID must be the id of an event of this stream")
+
+// GroupChangesParams - Parameters of the group changes stream. Changes recorded from Since on are streamed,
+// except AfterEntryID which the client already received.
+type GroupChangesParams struct {
+	HTTPRequest  *http.Request
+	UserID       string
+	Since        time.Time
+	AfterEntryID string
+}
+
+// GroupChangeEvent - Data of an event of the group changes stream.
+type GroupChangeEvent struct {
+	GroupID   string                 `json:"group_id"`
+	Action    string                 `json:"action"`
+	ChangedAt time.Time              `json:"changed_at"`
+	Changes   []database.FieldChange `json:"changes"`
+	// Group - the group after the change, or before it for deletions.
+	Group database.GroupDocument `json:"group"`
+}
+
+// WatchGroupChangesResponse - Holding reponse for WatchGroupChanges()
+type WatchGroupChangesResponse struct {
+	changes <-chan database.GroupHistoryEntry
+	resType string
+	errMsg  string
+	err     error
+}
+
+// groupChangesParams - Parameters of a request routed on /users/{userID}/connections/groups/events. Without a
+// Last-Event-ID header, the stream starts with the changes made from now on.
+func groupChangesParams(r *http.Request) (GroupChangesParams, error) {
+	params := GroupChangesParams{
+		HTTPRequest: r,
+		UserID:      r.PathValue("userID"),
+		Since:       time.Now(),
+	}
+
+	if lastEventID := r.Header.Get("Last-Event-ID"); lastEventID != "" {
+		since, entryID, err := parseGroupChangeID(lastEventID)
+		if err != nil {
+			return params, err
+		}
+		params.Since, params.AfterEntryID = since, entryID
+	}
+	return params, nil
+}
+
+// groupChangeID - ID of the event of a change: when it was recorded and its history entry, so that the stream
+// can resume after it.
+func groupChangeID(entry database.GroupHistoryEntry) string {
+	return strconv.FormatInt(entry.ChangedAt.UnixNano(), 10) + "-" + entry.EntryID
+}
+
+// parseGroupChangeID - Time and history entry of an event ID.
+func parseGroupChangeID(id string) (time.Time, string, error) {
+	nanos, entryID, found := strings.Cut(id, "-")
+	unixNano, err := strconv.ParseInt(nanos, 10, 64)
+	if !found || err != nil || entryID == "" {
+		return time.Time{}, "", errInvalidLastEventID
+	}
+	return time.Unix(0, unixNano), entryID, nil
+}
+
+// writeGroupChangeEvent - Write a change as an event named after its action.
+func writeGroupChangeEvent(w io.Writer, entry database.GroupHistoryEntry) error {
+	data, err := json.Marshal(GroupChangeEvent{
+		GroupID:   entry.GroupID,
+		Action:    entry.Action,
+		ChangedAt: entry.ChangedAt,
+		Changes:   entry.Changes,
+		Group:     entry.Group,
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(w, "id: %s\nevent: %s\ndata: %s\n\n", groupChangeID(entry), entry.Action, data)
+	return err
+}
+
+// GroupChangesStreamController - Stream the changes of the groups of a user as Server-Sent Events. A client
+// reconnecting with the Last-Event-ID header resumes after the last change it received.
+func GroupChangesStreamController(rw http.ResponseWriter, r *http.Request, principal *models.Principal) {
+
+	ctlr, err := GetController()
+	if err != nil {
+		writeProblem(rw, r, "errReturn500", "")
+		return
+	}
+
+	params, err := groupChangesParams(r)
+	if err != nil {
+		writeProblem(rw, r, "errReturn400", err.Error())
+		return
+	}
+
+	response := ctlr.WatchGroupChanges(params, principal)
+	if response.err != nil {
+		writeProblem(rw, r, response.resType, response.errMsg)
+		return
+	}
+
+	cfg := config.Get().Stream
+	flusher := http.NewResponseController(rw)
+
+	rw.Header().Set("Content-Type", "text/event-stream")
+	rw.Header().Set("Cache-Control", "no-cache")
+	// Keep reverse proxies from buffering the stream.
+	rw.Header().Set("X-Accel-Buffering", "no")
+	rw.WriteHeader(http.StatusOK)
+	fmt.Fprintf(rw, "retry: %d\n\n", time.Duration(cfg.Retry).Milliseconds())
+	if err := flusher.Flush(); err != nil {
+		return
+	}
+
+	heartbeat := time.NewTicker(time.Duration(cfg.Heartbeat))
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-heartbeat.C:
+			if _, err := io.WriteString(rw, ": heartbeat\n\n"); err != nil {
+				return
+			}
+		case entry, ok := <-response.changes:
+			// The storage stopped listening, the client reconnects and resumes.
+			if !ok {
+				return
+			}
+			if err := writeGroupChangeEvent(rw, entry); err != nil {
+				return
+			}
+		}
+		if err := flusher.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+// WatchGroupChanges - Listen to the changes of the groups of a user until the request is done. Only the user
+// itself may listen.
+func (c Ctlr) WatchGroupChanges(params GroupChangesParams, principal *models.Principal) WatchGroupChangesResponse {
+
+	ctx, span := tracing.Start(params.HTTPRequest, "Ctlr.WatchGroupChanges")
+	defer span.End()
+
+	if err := AuthorizeUser(principal, params.UserID); err != nil {
+		return WatchGroupChangesResponse{resType: "errReturn403", errMsg: err.Error(), err: err}
+	}
+
+	db := database.NewTracingStorage(ctx, c.DB)
+
+	// ctx is done with the request, not with the span.
+	changes, err := db.WatchGroupChanges(ctx, params.UserID, params.Since, params.AfterEntryID)
+	if err != nil {
+		return WatchGroupChangesResponse{resType: "errReturn500", errMsg: "failed to listen to group changes", err: err}
+	}
+
+	return WatchGroupChangesResponse{resType: "OK", changes: changes}
+}
@@ -0,0 +1,160 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"learning/unit-testing/blobstore"
+	"learning/unit-testing/config"
+	"learning/unit-testing/database"
+	"learning/unit-testing/internal"
+	"learning/unit-testing/jsonpatch"
+	"learning/unit-testing/models"
+	"learning/unit-testing/restapi/operations/connections"
+)
+
+type TestCaseLastEventID struct {
+	name                 string
+	lastEventID          string
+	expectedErr          error
+	expectedAfterEntryID string
+}
+
+func TestGroupChangesParams(t *testing.T) {
+
+	testCases := []TestCaseLastEventID{
+		{
+			name:        "NotTimed",
+			lastEventID: "entry_1",
+			expectedErr: errInvalidLastEventID,
+		},
+		{
+			name:        "WithoutEntry",
+			lastEventID: "1634567890000000000-",
+			expectedErr: errInvalidLastEventID,
+		},
+		{
+			name:                 "EntryWithDashes",
+			lastEventID:          "1634567890000000000-dc9dbe3e-60d5-4a07",
+			expectedAfterEntryID: "dc9dbe3e-60d5-4a07",
+		},
+	}
+
+	for _, test := range testCases {
+
+		t.Run(test.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/users/user_1/connections/groups/events", nil)
+			r.Header.Set("Last-Event-ID", test.lastEventID)
+
+			params, err := groupChangesParams(r)
+			assertEqual(t, err, test.expectedErr)
+			if err == nil {
+				assertEqual(t, params.Since, time.Unix(0, 1634567890000000000))
+				assertEqual(t, params.AfterEntryID, test.expectedAfterEntryID)
+			}
+		})
+	}
+}
+
+func TestWatchGroupChanges(t *testing.T) {
+
+	streamCtlr := GetControllerMockDB()
+	userID := "dc9dbe3e-60d5-4a07-8c9c-42027b555b91"
+	principal := &models.Principal{UserID: userID}
+	groupName := "Streamed Group"
+
+	ctx, cancel := context.WithCancel(context.Background())
+	r := httptest.NewRequest(http.MethodGet, "/users/"+userID+"/connections/groups/events", nil).WithContext(ctx)
+	params := GroupChangesParams{HTTPRequest: r, UserID: userID, Since: time.Now()}
+
+	// The changes of a user are not streamed to others.
+	forbidden := streamCtlr.WatchGroupChanges(params, &models.Principal{UserID: "dc9dbe3e-60d5-4a07-8c9c-42027b555b92"})
+	assertEqual(t, forbidden.resType, "errReturn403")
+	assertEqual(t, forbidden.changes == nil, true)
+	assertEqual(t, streamCtlr.WatchGroupChanges(params, nil).resType, "errReturn403")
+
+	response := streamCtlr.WatchGroupChanges(params, principal)
+	assertEqual(t, response.resType, "OK")
+
+	streamCtlr.CreateConnectionsGroupsByUserID(connections.UsersConnectionsGroupsByUserIDPostParams{
+		UserID: userID,
+		Body:   &models.UsersConnectionsGroupsPostRequest{GroupName: &groupName, ConnectionUserIds: connectionUserIds},
+	}, &models.Principal{})
+	group, _ := streamCtlr.DB.GetUserConnectionGroupByName(userID, groupName)
+	patch, _ := jsonpatch.Decode([]byte(`[{"op": "replace", "path": "/group_name", "value": "Renamed Streamed Group"}]`))
+	streamCtlr.PatchGroup(GroupJSONPatchParams{UserID: userID, GroupID: group.GroupID, Patch: patch}, &models.Principal{})
+
+	created := <-response.changes
+	assertEqual(t, created.Action, database.GroupCreated)
+	assertEqual(t, created.GroupID, group.GroupID)
+	renamed := <-response.changes
+	assertEqual(t, renamed.Action, database.GroupUpdated)
+	assertEqual(t, renamed.Group.GroupName, "Renamed Streamed Group")
+
+	var event bytes.Buffer
+	if err := writeGroupChangeEvent(&event, created); err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, strings.HasPrefix(event.String(), "id: "+groupChangeID(created)+"\nevent: created\ndata: {"), true)
+	assertEqual(t, strings.HasSuffix(event.String(), "}\n\n"), true)
+
+	// Resuming after the creation replays the rename only.
+	params.Since, params.AfterEntryID, _ = parseGroupChangeID(groupChangeID(created))
+	resumed := streamCtlr.WatchGroupChanges(params, principal)
+	assertEqual(t, (<-resumed.changes).EntryID, renamed.EntryID)
+
+	// Changes of other users are not streamed, and the streams end with the request.
+	otherName := "Other Streamed Group"
+	streamCtlr.CreateConnectionsGroupsByUserID(connections.UsersConnectionsGroupsByUserIDPostParams{
+		UserID: "dc9dbe3e-60d5-4a07-8c9c-42027b555b92",
+		Body:   &models.UsersConnectionsGroupsPostRequest{GroupName: &otherName, ConnectionUserIds: connectionUserIds},
+	}, &models.Principal{})
+	cancel()
+	for range response.changes {
+		t.Fatal("unexpected change")
+	}
+	for range resumed.changes {
+		t.Fatal("unexpected change")
+	}
+}
+
+func TestWatchGroupChangesOfPictureJobs(t *testing.T) {
+
+	streamCtlr := GetControllerMockDB()
+	userID := "dc9dbe3e-60d5-4a07-8c9c-42027b555b93"
+	principal := &models.Principal{UserID: userID}
+	groupID, _ := streamCtlr.DB.CreateUserConnectionGroup(userID, internal.UserConnectionGroupInfo{GroupName: "Streamed Picture Group"}, nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	r := httptest.NewRequest(http.MethodGet, "/users/"+userID+"/connections/groups/events", nil).WithContext(ctx)
+	response := streamCtlr.WatchGroupChanges(GroupChangesParams{HTTPRequest: r, UserID: userID, Since: time.Now()}, principal)
+	assertEqual(t, response.resType, "OK")
+
+	upload := []byte("GIF89a sanitized streamed upload bytes")
+	picID, err := streamCtlr.storeGroupPic(ctx, &groupPicture{reduced: []byte("GIF89a reduced streamed bytes")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	streamCtlr.DB.SetGroupPicSource(picID, blobstore.ContentKey(upload))
+	uploadKey := uploadKeyPrefix + "streamed"
+	if err := streamCtlr.Blobs.Put(ctx, uploadKey, bytes.NewReader(upload), int64(len(upload)), "image/gif"); err != nil {
+		t.Fatal(err)
+	}
+	if err := enqueueGroupPic(streamCtlr.DB, userID, groupID, uploadKey, principal); err != nil {
+		t.Fatal(err)
+	}
+
+	// The picture set by the worker, after the request returned, is streamed like any other change.
+	assertEqual(t, NewPictureWorkerPool(streamCtlr, config.Defaults().Pictures).poll(ctx), 1)
+	changed := <-response.changes
+	assertEqual(t, changed.Action, database.GroupUpdated)
+	assertEqual(t, changed.GroupID, groupID)
+	assertEqual(t, changed.Group.GroupPic, picID)
+	assertEqual(t, changed.Principal, principalClaims(principal))
+}
@@ -0,0 +1,158 @@
+package controllers
+
+import (
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"learning/unit-testing/config"
+	"learning/unit-testing/database"
+	"learning/unit-testing/models"
+	"learning/unit-testing/tracing"
+)
+
+// syncTokenVersion - prefix of the sync tokens, bumped when their content changes.
+const syncTokenVersion = "v1"
+
+var errInvalidSyncToken = errors.New("sync_token must be a token returned by a previous sync")
+
+// GroupSyncParams - Parameters of the delta sync of groups. Changes made after Until are left to the next sync.
+type GroupSyncParams struct {
+	HTTPRequest *http.Request
+	UserID      string
+	After       database.SyncCursor
+	Until       time.Time
+	Limit       int
+}
+
+// GroupSyncPayload - Groups changed and deleted since a sync token, and the token of the next sync.
+type GroupSyncPayload struct {
+	Changed   []string `json:"changed"`
+	Deleted   []string `json:"deleted"`
+	SyncToken string   `json:"sync_token"`
+	// HasMore - more changes are ready, sync again right away with SyncToken.
+	HasMore bool `json:"has_more"`
+}
+
+// SyncGroupsResponse - Holding reponse for SyncGroups()
+type SyncGroupsResponse struct {
+	payload GroupSyncPayload
+	resType string
+	errMsg  string
+	err     error
+}
+
+// groupSyncParams - Parameters of a request routed on /users/{userID}/connections/groups/sync. Without a
+// sync_token, every group and deletion is returned.
+func groupSyncParams(r *http.Request) (GroupSyncParams, error) {
+	params := GroupSyncParams{
+		HTTPRequest: r,
+		UserID:      r.PathValue("userID"),
+		Until:       time.Now().Add(-time.Duration(config.Get().Sync.SettleWindow)),
+	}
+
+	_, limit, err := pageParams(r.URL.Query())
+	if err != nil {
+		return params, err
+	}
+	params.Limit = limit
+
+	if token := r.URL.Query().Get("sync_token"); token != "" {
+		after, err := decodeSyncToken(token)
+		if err != nil {
+			return params, err
+		}
+		params.After = after
+	}
+	return params, nil
+}
+
+// encodeSyncToken - Opaque token of a cursor, empty for the zero cursor.
+func encodeSyncToken(cursor database.SyncCursor) string {
+	if cursor.IsZero() {
+		return ""
+	}
+	raw := syncTokenVersion + ":" + strconv.FormatInt(cursor.ChangedAt.UnixNano(), 10) + ":" + cursor.GroupID
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// decodeSyncToken - Cursor of a token made by encodeSyncToken.
+func decodeSyncToken(token string) (database.SyncCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return database.SyncCursor{}, errInvalidSyncToken
+	}
+
+	parts := strings.SplitN(string(raw), ":", 3)
+	if len(parts) != 3 || parts[0] != syncTokenVersion || parts[2] == "" {
+		return database.SyncCursor{}, errInvalidSyncToken
+	}
+	unixNano, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return database.SyncCursor{}, errInvalidSyncToken
+	}
+	return database.SyncCursor{ChangedAt: time.Unix(0, unixNano), GroupID: parts[2]}, nil
+}
+
+// GroupSyncGetController - Groups of a user changed and deleted since a sync token.
+func GroupSyncGetController(rw http.ResponseWriter, r *http.Request, principal *models.Principal) {
+
+	ctlr, err := GetController()
+	if err != nil {
+		writeProblem(rw, r, "errReturn500", "")
+		return
+	}
+
+	params, err := groupSyncParams(r)
+	if err != nil {
+		writeProblem(rw, r, "errReturn400", err.Error())
+		return
+	}
+
+	response := ctlr.SyncGroups(params, principal)
+	if response.err != nil {
+		writeProblem(rw, r, response.resType, response.errMsg)
+		return
+	}
+
+	rw.Header().Set("Cache-Control", "no-store")
+	writeJSON(rw, http.StatusOK, response.payload)
+}
+
+// SyncGroups - IDs of the groups changed and deleted after the cursor of the request, each group listed once with
+// its latest change. The returned token is the cursor of the last change, or the same cursor when there is none.
+func (c Ctlr) SyncGroups(params GroupSyncParams, principal *models.Principal) SyncGroupsResponse {
+
+	ctx, span := tracing.Start(params.HTTPRequest, "Ctlr.SyncGroups")
+	defer span.End()
+
+	db := database.NewTracingStorage(ctx, c.DB)
+
+	// One more change tells whether there are more.
+	changes, err := db.SyncUserConnectionGroups(params.UserID, params.After, params.Until, params.Limit+1)
+	if err != nil {
+		return SyncGroupsResponse{resType: "errReturn500", errMsg: "failed to sync groups", err: err}
+	}
+
+	payload := GroupSyncPayload{Changed: []string{}, Deleted: []string{}}
+	if len(changes) > params.Limit {
+		changes = changes[:params.Limit]
+		payload.HasMore = true
+	}
+
+	cursor := params.After
+	for _, change := range changes {
+		if change.Deleted {
+			payload.Deleted = append(payload.Deleted, change.GroupID)
+		} else {
+			payload.Changed = append(payload.Changed, change.GroupID)
+		}
+		cursor = change.Cursor()
+	}
+	payload.SyncToken = encodeSyncToken(cursor)
+
+	return SyncGroupsResponse{resType: "OK", payload: payload}
+}
@@ -0,0 +1,162 @@
+package controllers
+
+import (
+	"testing"
+	"time"
+
+	"learning/unit-testing/database"
+	"learning/unit-testing/jsonpatch"
+	"learning/unit-testing/models"
+	"learning/unit-testing/restapi/operations/connections"
+)
+
+type TestCaseGroupSync struct {
+	name            string
+	action          func()
+	expectedChanged []string
+	expectedDeleted []string
+}
+
+func TestSyncGroups(t *testing.T) {
+
+	syncCtlr := GetControllerMockDB()
+	userID := "dc9dbe3e-60d5-4a07-8c9c-42027b555ba1"
+
+	createGroup := func(groupName string) string {
+		syncCtlr.CreateConnectionsGroupsByUserID(connections.UsersConnectionsGroupsByUserIDPostParams{
+			UserID: userID,
+			Body:   &models.UsersConnectionsGroupsPostRequest{GroupName: &groupName, ConnectionUserIds: connectionUserIds},
+		}, &models.Principal{})
+		group, _ := syncCtlr.DB.GetUserConnectionGroupByName(userID, groupName)
+		return group.GroupID
+	}
+	syncGroups := func(token string, until time.Time, limit int) GroupSyncPayload {
+		params := GroupSyncParams{UserID: userID, Until: until, Limit: limit}
+		if token != "" {
+			params.After, _ = decodeSyncToken(token)
+		}
+		response := syncCtlr.SyncGroups(params, &models.Principal{})
+		assertEqual(t, response.resType, "OK")
+		return response.payload
+	}
+
+	var firstID, secondID string
+
+	testCases := []TestCaseGroupSync{
+		{
+			name: "Created",
+			action: func() {
+				firstID = createGroup("First Synced Group")
+				secondID = createGroup("Second Synced Group")
+			},
+			expectedChanged: []string{"group_id_1", "group_id_2"},
+			expectedDeleted: []string{},
+		},
+		{
+			name: "Renamed",
+			action: func() {
+				patch, _ := jsonpatch.Decode([]byte(`[{"op": "replace", "path": "/group_name", "value": "Renamed Synced Group"}]`))
+				syncCtlr.PatchGroup(GroupJSONPatchParams{UserID: userID, GroupID: firstID, Patch: patch}, &models.Principal{})
+			},
+			expectedChanged: []string{"group_id_1"},
+			expectedDeleted: []string{},
+		},
+		{
+			name: "Deleted",
+			action: func() {
+				syncCtlr.DeleteUsersConnectionsGroupsByUserIDAndGroupID(connections.UsersConnectionsGroupsByUserIDAndGroupIDDeleteParams{UserID: userID, GroupID: secondID}, &models.Principal{})
+			},
+			expectedChanged: []string{},
+			expectedDeleted: []string{"group_id_2"},
+		},
+		{
+			name:            "Unchanged",
+			action:          func() {},
+			expectedChanged: []string{},
+			expectedDeleted: []string{},
+		},
+		{
+			name: "RestoredAndPictureStatus",
+			action: func() {
+				syncCtlr.RestoreGroup(TrashParams{UserID: userID, GroupID: secondID}, &models.Principal{})
+				syncCtlr.DB.SetUserConnectionGroupPicStatus(userID, firstID, database.PictureStatusReady, "")
+			},
+			expectedChanged: []string{"group_id_2", "group_id_1"},
+			expectedDeleted: []string{},
+		},
+	}
+
+	token := ""
+	for _, test := range testCases {
+
+		t.Run(test.name, func(t *testing.T) {
+			test.action()
+
+			payload := syncGroups(token, time.Now(), 10)
+			assertEqual(t, payload.Changed, test.expectedChanged)
+			assertEqual(t, payload.Deleted, test.expectedDeleted)
+			assertEqual(t, payload.HasMore, false)
+			if len(test.expectedChanged)+len(test.expectedDeleted) == 0 {
+				assertEqual(t, payload.SyncToken, token)
+			}
+			token = payload.SyncToken
+		})
+	}
+
+	// Changes still settling are left to the next sync.
+	createGroup("Settling Synced Group")
+	assertEqual(t, syncGroups(token, time.Now().Add(-time.Hour), 10).Changed, []string{})
+
+	// A full sync in pages of one group lists every group once.
+	synced := []string{}
+	for token, hasMore := "", true; hasMore; {
+		payload := syncGroups(token, time.Now(), 1)
+		synced = append(synced, payload.Changed...)
+		token, hasMore = payload.SyncToken, payload.HasMore
+	}
+	assertEqual(t, synced, []string{"group_id_2", "group_id_1", "group_id_3"})
+}
+
+type TestCaseSyncToken struct {
+	name        string
+	token       string
+	expectedErr error
+}
+
+func TestDecodeSyncToken(t *testing.T) {
+
+	cursor := database.SyncCursor{ChangedAt: time.Unix(0, 1634567890123456789), GroupID: "group_id_1"}
+
+	testCases := []TestCaseSyncToken{
+		{
+			name:  "Encoded",
+			token: encodeSyncToken(cursor),
+		},
+		{
+			name:        "NotBase64",
+			token:       "not a token",
+			expectedErr: errInvalidSyncToken,
+		},
+		{
+			name:        "UnknownVersion",
+			token:       "djA6MTYzNDU2Nzg5MDEyMzQ1Njc4OTpncm91cF9pZF8x",
+			expectedErr: errInvalidSyncToken,
+		},
+		{
+			name:        "WithoutGroup",
+			token:       "djE6MTYzNDU2Nzg5MDEyMzQ1Njc4OTo",
+			expectedErr: errInvalidSyncToken,
+		},
+	}
+
+	for _, test := range testCases {
+
+		t.Run(test.name, func(t *testing.T) {
+			decoded, err := decodeSyncToken(test.token)
+			assertEqual(t, err, test.expectedErr)
+			if err == nil {
+				assertEqual(t, decoded, cursor)
+			}
+		})
+	}
+}
@@ -0,0 +1,182 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"learning/unit-testing/config"
+	"learning/unit-testing/database"
+	"learning/unit-testing/models"
+	"learning/unit-testing/tracing"
+
+	"github.com/go-openapi/strfmt"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// TrashParams - Path parameters of the trash endpoints, GroupID is empty for the listing.
+type TrashParams struct {
+	HTTPRequest *http.Request
+	UserID      string
+	GroupID     string
+}
+
+// TrashedGroupPayload - A deleted group and when it will be purged.
+type TrashedGroupPayload struct {
+	Group     *models.Group   `json:"group"`
+	DeletedAt strfmt.DateTime `json:"deleted_at"`
+	PurgeAt   strfmt.DateTime `json:"purge_at"`
+}
+
+// TrashedGroupsPayload - Body of the trash listing.
+type TrashedGroupsPayload struct {
+	Groups []TrashedGroupPayload `json:"groups"`
+}
+
+// ListTrashedGroupsResponse - Holding reponse for ListTrashedGroups()
+type ListTrashedGroupsResponse struct {
+	payload TrashedGroupsPayload
+	resType string
+	errMsg  string
+	err     error
+}
+
+// TrashedGroupResponse - Holding reponse for RestoreGroup() and PurgeGroup()
+type TrashedGroupResponse struct {
+	resType string
+	errMsg  string
+	err     error
+}
+
+// trashParams - Path parameters of a request routed on /users/{userID}/connections/trash/groups.
+func trashParams(r *http.Request) TrashParams {
+	return TrashParams{HTTPRequest: r, UserID: r.PathValue("userID"), GroupID: r.PathValue("groupID")}
+}
+
+// TrashedGroupsGetController - List the deleted groups of a user.
+func TrashedGroupsGetController(rw http.ResponseWriter, r *http.Request, principal *models.Principal) {
+
+	ctlr, err := GetController()
+	if err != nil {
+		writeProblem(rw, r, "errReturn500", "")
+		return
+	}
+
+	response := ctlr.ListTrashedGroups(trashParams(r), principal)
+	if response.err != nil {
+		writeProblem(rw, r, response.resType, response.errMsg)
+		return
+	}
+
+	rw.Header().Set("Content-Type", "application/json")
+	rw.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(rw).Encode(response.payload)
+}
+
+// TrashedGroupRestoreController - Restore a deleted group, pointing to it with the Location header.
+func TrashedGroupRestoreController(rw http.ResponseWriter, r *http.Request, principal *models.Principal) {
+
+	ctlr, err := GetController()
+	if err != nil {
+		writeProblem(rw, r, "errReturn500", "")
+		return
+	}
+
+	params := trashParams(r)
+	response := ctlr.RestoreGroup(params, principal)
+	if response.err != nil {
+		writeProblem(rw, r, response.resType, response.errMsg)
+		return
+	}
+
+	rw.Header().Set("Location", "/users/"+params.UserID+"/connections/groups/"+params.GroupID)
+	rw.WriteHeader(http.StatusNoContent)
+}
+
+// TrashedGroupPurgeController - Permanently delete a group from the trash.
+func TrashedGroupPurgeController(rw http.ResponseWriter, r *http.Request, principal *models.Principal) {
+
+	ctlr, err := GetController()
+	if err != nil {
+		writeProblem(rw, r, "errReturn500", "")
+		return
+	}
+
+	response := ctlr.PurgeGroup(trashParams(r), principal)
+	if response.err != nil {
+		writeProblem(rw, r, response.resType, response.errMsg)
+		return
+	}
+
+	rw.WriteHeader(http.StatusNoContent)
+}
+
+// ListTrashedGroups - Deleted groups of a user, most recently deleted first.
+func (c Ctlr) ListTrashedGroups(params TrashParams, principal *models.Principal) ListTrashedGroupsResponse {
+
+	ctx, span := tracing.Start(params.HTTPRequest, "Ctlr.ListTrashedGroups")
+	defer span.End()
+
+	db := database.NewTracingStorage(ctx, c.DB)
+
+	trashed, err := db.ListTrashedUserConnectionGroups(params.UserID)
+	if err != nil {
+		return ListTrashedGroupsResponse{resType: "errReturn500", errMsg: "failed to list deleted groups", err: err}
+	}
+
+	retention := time.Duration(config.Get().Trash.Retention)
+	payload := TrashedGroupsPayload{Groups: []TrashedGroupPayload{}}
+	for _, group := range trashed {
+		payload.Groups = append(payload.Groups, TrashedGroupPayload{
+			Group:     database.ToResponseGroup(group.Group),
+			DeletedAt: strfmt.DateTime(group.DeletedAt),
+			PurgeAt:   strfmt.DateTime(group.DeletedAt.Add(retention)),
+		})
+	}
+
+	return ListTrashedGroupsResponse{resType: "OK", payload: payload}
+}
+
+// RestoreGroup - Move a deleted group back among the groups of its user.
+func (c Ctlr) RestoreGroup(params TrashParams, principal *models.Principal) TrashedGroupResponse {
+
+	ctx, span := tracing.Start(params.HTTPRequest, "Ctlr.RestoreGroup")
+	defer span.End()
+
+	db := database.NewTracingStorage(ctx, c.DB)
+
+	err := db.RestoreUserConnectionGroup(params.UserID, params.GroupID, principalClaims(principal))
+
+	var conflict *database.GroupNameConflictError
+	switch {
+	case errors.As(err, &conflict):
+		return TrashedGroupResponse{resType: "errReturn409", errMsg: errGroupNameInUse.Error(), err: err}
+	case status.Code(err) == codes.NotFound:
+		return TrashedGroupResponse{resType: "errReturn404", errMsg: "record not found", err: err}
+	case err != nil:
+		return TrashedGroupResponse{resType: "errReturn500", errMsg: "failed to restore group", err: err}
+	}
+
+	return TrashedGroupResponse{resType: "Restored"}
+}
+
+// PurgeGroup - Permanently delete a group from the trash, with its picture when no other group uses it.
+func (c Ctlr) PurgeGroup(params TrashParams, principal *models.Principal) TrashedGroupResponse {
+
+	ctx, span := tracing.Start(params.HTTPRequest, "Ctlr.PurgeGroup")
+	defer span.End()
+
+	db := database.NewTracingStorage(ctx, c.DB)
+
+	err := db.PurgeUserConnectionGroup(params.UserID, params.GroupID, principalClaims(principal))
+	if status.Code(err) == codes.NotFound {
+		return TrashedGroupResponse{resType: "errReturn404", errMsg: "record not found", err: err}
+	}
+	if err != nil {
+		return TrashedGroupResponse{resType: "errReturn500", errMsg: "failed to purge group", err: err}
+	}
+
+	return TrashedGroupResponse{resType: "Purged"}
+}
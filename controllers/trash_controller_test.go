@@ -0,0 +1,134 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"learning/unit-testing/config"
+	"learning/unit-testing/internal"
+	"learning/unit-testing/models"
+	"learning/unit-testing/restapi/operations/connections"
+)
+
+type TestCaseTrash struct {
+	name                 string
+	action               func() string
+	expectedResponseType string
+	expectedActive       []string
+	expectedTrashed      []string
+}
+
+func TestTrash(t *testing.T) {
+
+	trashCtlr := GetControllerMockDB()
+	userID := "dc9dbe3e-60d5-4a07-8c9c-42027b555b91"
+	groupID, _ := trashCtlr.DB.CreateUserConnectionGroup(userID, internal.UserConnectionGroupInfo{GroupName: "Trashed Group"}, nil)
+	otherID, _ := trashCtlr.DB.CreateUserConnectionGroup(userID, internal.UserConnectionGroupInfo{GroupName: "Other Group"}, nil)
+	order := "asc"
+
+	deleteGroup := func(groupID string) func() string {
+		return func() string {
+			return trashCtlr.DeleteUsersConnectionsGroupsByUserIDAndGroupID(connections.UsersConnectionsGroupsByUserIDAndGroupIDDeleteParams{UserID: userID, GroupID: groupID}, &models.Principal{}).resType
+		}
+	}
+	restoreGroup := func(groupID string) func() string {
+		return func() string {
+			return trashCtlr.RestoreGroup(TrashParams{UserID: userID, GroupID: groupID}, &models.Principal{}).resType
+		}
+	}
+
+	testCases := []TestCaseTrash{
+		{
+			name:                 "Delete",
+			action:               deleteGroup(groupID),
+			expectedResponseType: "Deleted",
+			expectedActive:       []string{"Other Group"},
+			expectedTrashed:      []string{"Trashed Group"},
+		},
+		{
+			name: "NameFreedByTrash",
+			action: func() string {
+				groupName := "Trashed Group"
+				return trashCtlr.CreateConnectionsGroupsByUserID(connections.UsersConnectionsGroupsByUserIDPostParams{
+					UserID: userID,
+					Body:   &models.UsersConnectionsGroupsPostRequest{GroupName: &groupName, ConnectionUserIds: connectionUserIds},
+				}, &models.Principal{}).resType
+			},
+			expectedResponseType: "Created",
+			expectedActive:       []string{"Other Group", "Trashed Group"},
+			expectedTrashed:      []string{"Trashed Group"},
+		},
+		{
+			name:                 "RestoreNameTaken",
+			action:               restoreGroup(groupID),
+			expectedResponseType: "errReturn409",
+			expectedActive:       []string{"Other Group", "Trashed Group"},
+			expectedTrashed:      []string{"Trashed Group"},
+		},
+		{
+			name:                 "Restore",
+			action:               func() string { deleteGroup("group_id_3")(); return restoreGroup(groupID)() },
+			expectedResponseType: "Restored",
+			expectedActive:       []string{"Other Group", "Trashed Group"},
+			expectedTrashed:      []string{"Trashed Group"},
+		},
+		{
+			name:                 "RestoreUnknown",
+			action:               restoreGroup(otherID),
+			expectedResponseType: "errReturn404",
+			expectedActive:       []string{"Other Group", "Trashed Group"},
+			expectedTrashed:      []string{"Trashed Group"},
+		},
+		{
+			name: "Purge",
+			action: func() string {
+				return trashCtlr.PurgeGroup(TrashParams{UserID: userID, GroupID: "group_id_3"}, &models.Principal{}).resType
+			},
+			expectedResponseType: "Purged",
+			expectedActive:       []string{"Other Group", "Trashed Group"},
+			expectedTrashed:      []string{},
+		},
+	}
+
+	for _, test := range testCases {
+
+		t.Run(test.name, func(t *testing.T) {
+			assertEqual(t, test.action(), test.expectedResponseType)
+
+			active := []string{}
+			groups, _, _ := trashCtlr.DB.GetPaginatedUserConnectionGroup(connections.UsersConnectionsGroupsByUserIDGetParams{UserID: userID, Order: &order})
+			for _, group := range groups {
+				active = append(active, *group.GroupName)
+			}
+			assertEqual(t, active, test.expectedActive)
+
+			trashed := []string{}
+			res := trashCtlr.ListTrashedGroups(TrashParams{UserID: userID}, &models.Principal{})
+			for _, group := range res.payload.Groups {
+				trashed = append(trashed, *group.Group.GroupName)
+			}
+			assertEqual(t, trashed, test.expectedTrashed)
+		})
+	}
+}
+
+func TestTrashPurger(t *testing.T) {
+
+	purgerCtlr := GetControllerMockDB()
+	userID := "dc9dbe3e-60d5-4a07-8c9c-42027b555b92"
+	groupID, _ := purgerCtlr.DB.CreateUserConnectionGroup(userID, internal.UserConnectionGroupInfo{GroupName: "Expiring Group"}, nil)
+	purgerCtlr.DeleteUsersConnectionsGroupsByUserIDAndGroupID(connections.UsersConnectionsGroupsByUserIDAndGroupIDDeleteParams{UserID: userID, GroupID: groupID}, &models.Principal{})
+
+	cfg := config.Defaults().Trash
+	purger := NewTrashPurger(purgerCtlr, cfg)
+
+	// Within the retention period.
+	assertEqual(t, purger.purge(context.Background()), 0)
+
+	purger.now = func() time.Time { return time.Now().Add(time.Duration(cfg.Retention) + time.Minute) }
+	assertEqual(t, purger.purge(context.Background()), 1)
+
+	trashed, _ := purgerCtlr.DB.ListTrashedUserConnectionGroups(userID)
+	assertEqual(t, len(trashed), 0)
+}
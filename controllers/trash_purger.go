@@ -0,0 +1,88 @@
+package controllers
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"learning/unit-testing/config"
+	"learning/unit-testing/database"
+	"learning/unit-testing/tracing"
+)
+
+// trashPurgeBatch - Groups purged per storage call.
+const trashPurgeBatch = 100
+
+// TrashPurger - Background purge of the groups deleted longer than the retention period ago.
+type TrashPurger struct {
+	ctlr   Ctlr
+	config config.TrashConfig
+	now    func() time.Time
+
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// NewTrashPurger - Purger of the trash of ctlr's storage.
+func NewTrashPurger(ctlr Ctlr, cfg config.TrashConfig) *TrashPurger {
+	return &TrashPurger{ctlr: ctlr, config: cfg, now: time.Now}
+}
+
+// Start - Purge every PurgeInterval until Stop is called.
+func (p *TrashPurger) Start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	p.cancel = cancel
+
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+
+		ticker := time.NewTicker(time.Duration(p.config.PurgeInterval))
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				p.purge(ctx)
+			}
+		}
+	}()
+}
+
+// Stop - Stop purging and wait for the purge in progress.
+func (p *TrashPurger) Stop() {
+	if p.cancel != nil {
+		p.cancel()
+	}
+	p.wg.Wait()
+}
+
+// purge - Purge the expired groups batch after batch, returning how many were purged, then free the pictures no
+// group uses anymore, whether released by the purge or by requests since the last run.
+func (p *TrashPurger) purge(ctx context.Context) int {
+
+	ctx, span := tracing.Tracer().Start(ctx, "TrashPurger.Purge")
+	defer span.End()
+
+	db := database.NewTracingStorage(ctx, p.ctlr.DB)
+	deletedBefore := p.now().Add(-time.Duration(p.config.Retention))
+
+	total := 0
+	for ctx.Err() == nil {
+		purged, err := db.PurgeTrashedUserConnectionGroups(deletedBefore, trashPurgeBatch)
+		total += len(purged)
+		if err != nil {
+			log.Printf("failed to purge deleted groups (%s)", err.Error())
+			break
+		}
+		if len(purged) < trashPurgeBatch {
+			break
+		}
+	}
+
+	p.ctlr.freeUnreferencedGroupPics(ctx, db)
+	return total
+}
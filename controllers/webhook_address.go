@@ -0,0 +1,98 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/netip"
+	"syscall"
+	"time"
+)
+
+var errWebhookAddressNotPublic = errors.New("url must point to a public address")
+
+// nonPublicPrefixes - Special-purpose ranges not covered by the netip predicates, no webhook endpoint lives there.
+var nonPublicPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"),
+	netip.MustParsePrefix("192.0.0.0/24"),
+	netip.MustParsePrefix("192.0.2.0/24"),
+	netip.MustParsePrefix("198.18.0.0/15"),
+	netip.MustParsePrefix("198.51.100.0/24"),
+	netip.MustParsePrefix("203.0.113.0/24"),
+	netip.MustParsePrefix("240.0.0.0/4"),
+	netip.MustParsePrefix("64:ff9b::/96"),
+	netip.MustParsePrefix("64:ff9b:1::/48"),
+	netip.MustParsePrefix("100::/64"),
+	netip.MustParsePrefix("2001:db8::/32"),
+	netip.MustParsePrefix("2002::/16"),
+}
+
+// resolveWebhookHost - Addresses of the host of a webhook endpoint, replaced in tests.
+var resolveWebhookHost = func(ctx context.Context, host string) ([]netip.Addr, error) {
+	return net.DefaultResolver.LookupNetIP(ctx, "ip", host)
+}
+
+// publicAddress - Whether addr is reachable on the internet, as opposed to loopback, private, link-local (cloud
+// metadata services among them) and other special-purpose addresses.
+func publicAddress(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	if !addr.IsValid() || addr.IsUnspecified() || addr.IsLoopback() || addr.IsPrivate() || addr.IsMulticast() ||
+		addr.IsLinkLocalUnicast() || addr.IsLinkLocalMulticast() || addr.IsInterfaceLocalMulticast() {
+		return false
+	}
+	for _, prefix := range nonPublicPrefixes {
+		if prefix.Contains(addr) {
+			return false
+		}
+	}
+	return true
+}
+
+// checkWebhookHost - Every address host resolves to must be public, a single private one would let deliveries
+// reach the internal network.
+func checkWebhookHost(ctx context.Context, host string) error {
+	if addr, err := netip.ParseAddr(host); err == nil {
+		if !publicAddress(addr) {
+			return errWebhookAddressNotPublic
+		}
+		return nil
+	}
+
+	addrs, err := resolveWebhookHost(ctx, host)
+	if err != nil || len(addrs) == 0 {
+		return errWebhookAddressNotPublic
+	}
+	for _, addr := range addrs {
+		if !publicAddress(addr) {
+			return errWebhookAddressNotPublic
+		}
+	}
+	return nil
+}
+
+// publicDialControl - Refuse connections to non-public addresses, checked on the address actually dialed so that
+// a host resolving differently since the subscription can't reach the internal network.
+func publicDialControl(network string, address string, _ syscall.RawConn) error {
+	addrPort, err := netip.ParseAddrPort(address)
+	if err != nil || !publicAddress(addrPort.Addr()) {
+		return errWebhookAddressNotPublic
+	}
+	return nil
+}
+
+// webhookTransport - Transport of the webhook deliveries, bypassing proxies and restricted to public addresses
+// unless allowPrivateNetworks.
+func webhookTransport(allowPrivateNetworks bool) *http.Transport {
+	dialer := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}
+	if !allowPrivateNetworks {
+		dialer.Control = publicDialControl
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	// A proxy would dial on our behalf, out of reach of the dialer check.
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+	return transport
+}
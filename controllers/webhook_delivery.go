@@ -0,0 +1,187 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"math/rand"
+	"net/http"
+	"sync"
+	"time"
+
+	"learning/unit-testing/config"
+	"learning/unit-testing/database"
+	"learning/unit-testing/events"
+	"learning/unit-testing/tracing"
+
+	"go.opentelemetry.io/otel/attribute"
+	otelcodes "go.opentelemetry.io/otel/codes"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Headers of webhook deliveries, besides the signature. The delivery ID stays the same across attempts.
+const (
+	HeaderWebhookDelivery = "X-Webhook-Delivery"
+	HeaderWebhookEvent    = "X-Webhook-Event"
+)
+
+// WebhookWorkerPool - Workers calling the webhook subscriptions with the deliveries queued by group changes.
+type WebhookWorkerPool struct {
+	ctlr   Ctlr
+	config config.WebhooksConfig
+	client *http.Client
+
+	// jitter returns a random duration in [0, n), replaced in tests.
+	jitter func(n time.Duration) time.Duration
+	now    func() time.Time
+
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// NewWebhookWorkerPool - Pool delivering the webhooks of ctlr's storage.
+func NewWebhookWorkerPool(ctlr Ctlr, cfg config.WebhooksConfig) *WebhookWorkerPool {
+	return &WebhookWorkerPool{
+		ctlr:   ctlr,
+		config: cfg,
+		client: &http.Client{
+			Timeout:   time.Duration(cfg.Timeout),
+			Transport: webhookTransport(cfg.AllowPrivateNetworks),
+			// A redirect could send the signed payload to another host.
+			CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+		},
+		jitter: func(n time.Duration) time.Duration { return time.Duration(rand.Int63n(int64(n))) },
+		now:    time.Now,
+	}
+}
+
+// Start - Run the configured number of workers until Stop is called.
+func (p *WebhookWorkerPool) Start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	p.cancel = cancel
+
+	for i := 0; i < p.config.Workers; i++ {
+		p.wg.Add(1)
+		go func() {
+			defer p.wg.Done()
+			p.run(ctx)
+		}()
+	}
+}
+
+// Stop - Stop claiming deliveries and wait for the attempts in progress. Deliveries left claimed are attempted
+// again once their lease expires.
+func (p *WebhookWorkerPool) Stop() {
+	if p.cancel != nil {
+		p.cancel()
+	}
+	p.wg.Wait()
+	p.client.CloseIdleConnections()
+}
+
+func (p *WebhookWorkerPool) run(ctx context.Context) {
+	ticker := time.NewTicker(time.Duration(p.config.PollInterval))
+	defer ticker.Stop()
+
+	for {
+		// Keep draining while there are deliveries, wait for the next tick otherwise.
+		for ctx.Err() == nil && p.poll(ctx) > 0 {
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// poll - Claim a batch of deliveries and attempt them, returning how many were claimed.
+func (p *WebhookWorkerPool) poll(ctx context.Context) int {
+	deliveries, err := p.ctlr.DB.ClaimWebhookDeliveries(p.now(), time.Duration(p.config.Lease), p.config.BatchSize)
+	if err != nil {
+		log.Printf("failed to claim webhook deliveries (%s)", err.Error())
+		return 0
+	}
+
+	for _, delivery := range deliveries {
+		p.deliver(ctx, delivery)
+	}
+	return len(deliveries)
+}
+
+// deliver - Attempt a claimed delivery and log the attempt, then retry it or give up.
+func (p *WebhookWorkerPool) deliver(ctx context.Context, delivery database.WebhookDelivery) {
+
+	ctx, span := tracing.Tracer().Start(ctx, "WebhookWorker.Deliver")
+	defer span.End()
+	span.SetAttributes(attribute.String("delivery.id", delivery.DeliveryID), attribute.String("event.type", delivery.EventType), attribute.Int("delivery.attempts", len(delivery.Attempts)))
+
+	db := database.NewTracingStorage(ctx, p.ctlr.DB)
+
+	attempt := database.WebhookAttempt{At: p.now()}
+	deliveryStatus, retry := database.WebhookDeliveryDelivered, false
+
+	subscription, err := db.GetWebhookSubscription(delivery.UserID, delivery.SubscriptionID)
+	switch {
+	case status.Code(err) == codes.NotFound:
+		// Unsubscribed since the delivery was queued, there is nowhere to deliver it anymore.
+		attempt.Error = "webhook subscription deleted"
+	case err != nil:
+		attempt.Error = err.Error()
+		retry = true
+	default:
+		attempt.StatusCode, err = p.post(ctx, subscription, delivery)
+		attempt.Duration = p.now().Sub(attempt.At)
+		if err != nil {
+			attempt.Error = err.Error()
+			retry = true
+		}
+	}
+
+	availableAt := attempt.At
+	if attempt.Error != "" {
+		span.SetStatus(otelcodes.Error, attempt.Error)
+		log.Printf("webhook delivery (%s) of event (%s) failed (%s)", delivery.DeliveryID, delivery.EventID, attempt.Error)
+
+		deliveryStatus = database.WebhookDeliveryDead
+		// This attempt is not counted in SeriesAttempts yet.
+		if attempts := delivery.SeriesAttempts() + 1; retry && attempts < p.config.MaxAttempts {
+			deliveryStatus = database.WebhookDeliveryPending
+			availableAt = availableAt.Add(retryBackoff(time.Duration(p.config.BaseBackoff), time.Duration(p.config.MaxBackoff), attempts, p.jitter))
+		}
+	}
+
+	if err := db.RecordWebhookAttempt(delivery.DeliveryID, attempt, deliveryStatus, availableAt); err != nil {
+		log.Printf("failed to record attempt of webhook delivery (%s) (%s)", delivery.DeliveryID, err.Error())
+	}
+}
+
+// post - Send the signed payload of a delivery to its subscription, returning the status of the answer. Any
+// status other than 2xx is an error.
+func (p *WebhookWorkerPool) post(ctx context.Context, subscription database.WebhookSubscription, delivery database.WebhookDelivery) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, subscription.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HeaderWebhookDelivery, delivery.DeliveryID)
+	req.Header.Set(HeaderWebhookEvent, delivery.EventType)
+	req.Header.Set(events.HeaderEventID, delivery.EventID)
+	req.Header.Set(events.SignatureHeader, events.Sign(subscription.Secret, p.now(), delivery.Payload))
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("webhook answered %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
@@ -0,0 +1,66 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+
+	"learning/unit-testing/database"
+	"learning/unit-testing/events"
+)
+
+// SubscriptionSink - Queue every event for the webhook subscriptions of its user wanting it. Deliveries are keyed
+// on the outbox event ID, so an event published again queues nothing new.
+type SubscriptionSink struct {
+	db database.Storage
+}
+
+// NewSubscriptionSink - Sink queueing the webhook deliveries in db.
+func NewSubscriptionSink(db database.Storage) *SubscriptionSink {
+	return &SubscriptionSink{db: db}
+}
+
+// Name - function
+func (s *SubscriptionSink) Name() string {
+	return "subscriptions"
+}
+
+// Publish - Queue event for the subscriptions of its user, receivers deduplicate redeliveries on its ID.
+func (s *SubscriptionSink) Publish(ctx context.Context, event events.Envelope) error {
+	db := database.NewTracingStorage(ctx, s.db)
+
+	subscriptions, err := db.ListWebhookSubscriptions(event.UserID)
+	if err != nil {
+		return err
+	}
+
+	deliveries := []database.WebhookDelivery{}
+	for _, subscription := range subscriptions {
+		if !subscription.Wants(event.Type) {
+			continue
+		}
+		deliveries = append(deliveries, database.WebhookDelivery{
+			DeliveryID:     database.WebhookDeliveryID(event.EventID, subscription.SubscriptionID),
+			SubscriptionID: subscription.SubscriptionID,
+			UserID:         event.UserID,
+			EventID:        event.EventID,
+			EventType:      event.Type,
+		})
+	}
+	if len(deliveries) == 0 {
+		return nil
+	}
+
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	for index := range deliveries {
+		deliveries[index].Payload = payload
+	}
+	return db.EnqueueWebhookDeliveries(deliveries)
+}
+
+// Close - function
+func (s *SubscriptionSink) Close() error {
+	return nil
+}
@@ -0,0 +1,68 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"learning/unit-testing/blobstore"
+	"learning/unit-testing/config"
+	"learning/unit-testing/database"
+	"learning/unit-testing/events"
+	"learning/unit-testing/internal"
+	"learning/unit-testing/models"
+)
+
+func TestSubscriptionSink(t *testing.T) {
+
+	sinkCtlr := GetControllerMockDB()
+	ctx := context.Background()
+	userID := "dc9dbe3e-60d5-4a07-8c9c-42027b555b84"
+	principal := &models.Principal{UserID: userID}
+	groupID, _ := sinkCtlr.DB.CreateUserConnectionGroup(userID, internal.UserConnectionGroupInfo{GroupName: "Subscribed Picture Group"}, nil)
+
+	allowPrivateWebhooks(t)
+	subscription := sinkCtlr.CreateWebhookSubscription(WebhookParams{UserID: userID}, WebhookSubscriptionBody{
+		URL:        "https://127.0.0.1/hooks",
+		EventTypes: []string{events.TypePictureChanged},
+	}, principal).payload
+
+	sink := NewSubscriptionSink(sinkCtlr.DB)
+	dispatcher := NewEventDispatcher(sinkCtlr, config.Defaults().Events, []events.Sink{sink})
+	deliveries := func() []WebhookDeliveryPayload {
+		return sinkCtlr.ListWebhookDeliveries(WebhookParams{UserID: userID, SubscriptionID: subscription.SubscriptionID, Limit: 10}, principal).payload.Deliveries
+	}
+
+	// Unwanted events queue nothing.
+	assertEqual(t, dispatcher.poll(ctx), 1)
+	assertEqual(t, len(deliveries()), 0)
+
+	// The picture set by the worker reaches the subscription with the ID of its outbox event.
+	upload := []byte("GIF89a sanitized subscribed upload bytes")
+	picID, err := sinkCtlr.storeGroupPic(ctx, &groupPicture{reduced: []byte("GIF89a reduced subscribed bytes")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sinkCtlr.DB.SetGroupPicSource(picID, blobstore.ContentKey(upload))
+	uploadKey := uploadKeyPrefix + "subscribed"
+	if err := sinkCtlr.Blobs.Put(ctx, uploadKey, bytes.NewReader(upload), int64(len(upload)), "image/gif"); err != nil {
+		t.Fatal(err)
+	}
+	if err := enqueueGroupPic(sinkCtlr.DB, userID, groupID, uploadKey, principal); err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, NewPictureWorkerPool(sinkCtlr, config.Defaults().Pictures).poll(ctx), 1)
+
+	outbox := sinkCtlr.DB.(*database.MockConnection).OutboxEvents()
+	assertEqual(t, len(outbox), 1)
+	assertEqual(t, dispatcher.poll(ctx), 1)
+
+	queued := deliveries()
+	assertEqual(t, len(queued), 1)
+	assertEqual(t, queued[0].EventID, outbox[0].EventID)
+	assertEqual(t, queued[0].EventType, events.TypePictureChanged)
+
+	// An event published again, after a failure of another sink, is not delivered twice.
+	assertEqual(t, sink.Publish(ctx, outbox[0].Envelope()), nil)
+	assertEqual(t, len(deliveries()), 1)
+}
@@ -0,0 +1,492 @@
+package controllers
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"learning/unit-testing/config"
+	"learning/unit-testing/database"
+	"learning/unit-testing/events"
+	"learning/unit-testing/models"
+	"learning/unit-testing/tracing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// webhookSecretPrefix - prefix of generated subscription secrets, telling them apart from other credentials.
+const webhookSecretPrefix = "whsec_"
+
+var (
+	errInvalidWebhookBody     = errors.New("body must be a JSON object with a url and optional event_types")
+	errInvalidWebhookURL      = errors.New("url must be an absolute https URL")
+	errInvalidWebhookStatus   = errors.New("status must be pending, delivered or dead")
+	errTooManyWebhooks        = errors.New("maximum number of webhook subscriptions reached")
+	errWebhookDeliveryNotDead = errors.New("only dead deliveries can be redelivered")
+)
+
+// WebhookParams - Parameters of the webhook endpoints, IDs absent from the route are empty.
+type WebhookParams struct {
+	HTTPRequest    *http.Request
+	UserID         string
+	SubscriptionID string
+	DeliveryID     string
+	// Status - deliveries listed, every status when empty.
+	Status string
+	Offset int
+	Limit  int
+}
+
+// WebhookSubscriptionBody - Body creating a webhook subscription.
+type WebhookSubscriptionBody struct {
+	URL string `json:"url"`
+	// EventTypes - events delivered, every event when empty.
+	EventTypes []string `json:"event_types"`
+}
+
+// WebhookSubscriptionsPayload - Body of the webhook subscription listing.
+type WebhookSubscriptionsPayload struct {
+	Subscriptions []database.WebhookSubscription `json:"subscriptions"`
+}
+
+// WebhookDeliveryPayload - A delivery with the event it carries.
+type WebhookDeliveryPayload struct {
+	database.WebhookDelivery
+	Event json.RawMessage `json:"event"`
+}
+
+// WebhookDeliveriesPayload - Body of the delivery log and dead-letter listings.
+type WebhookDeliveriesPayload struct {
+	Deliveries         []WebhookDeliveryPayload `json:"deliveries"`
+	PaginationMetadata *models.PaginationData   `json:"pagination_metadata"`
+}
+
+// WebhookSubscriptionResponse - Holding reponse for CreateWebhookSubscription() and GetWebhookSubscription()
+type WebhookSubscriptionResponse struct {
+	payload database.WebhookSubscription
+	resType string
+	errMsg  string
+	err     error
+}
+
+// ListWebhookSubscriptionsResponse - Holding reponse for ListWebhookSubscriptions()
+type ListWebhookSubscriptionsResponse struct {
+	payload WebhookSubscriptionsPayload
+	resType string
+	errMsg  string
+	err     error
+}
+
+// ListWebhookDeliveriesResponse - Holding reponse for ListWebhookDeliveries()
+type ListWebhookDeliveriesResponse struct {
+	payload WebhookDeliveriesPayload
+	resType string
+	errMsg  string
+	err     error
+}
+
+// WebhookResponse - Holding reponse for DeleteWebhookSubscription() and RedeliverWebhookDelivery()
+type WebhookResponse struct {
+	resType string
+	errMsg  string
+	err     error
+}
+
+// webhookParams - Parameters of a request routed on /users/{userID}/connections/webhooks.
+func webhookParams(r *http.Request) (WebhookParams, error) {
+	params := WebhookParams{
+		HTTPRequest:    r,
+		UserID:         r.PathValue("userID"),
+		SubscriptionID: r.PathValue("subscriptionID"),
+		DeliveryID:     r.PathValue("deliveryID"),
+		Status:         r.URL.Query().Get("status"),
+	}
+
+	switch params.Status {
+	case "", database.WebhookDeliveryPending, database.WebhookDeliveryDelivered, database.WebhookDeliveryDead:
+	default:
+		return params, errInvalidWebhookStatus
+	}
+
+	offset, limit, err := pageParams(r.URL.Query())
+	if err != nil {
+		return params, err
+	}
+	params.Offset, params.Limit = offset, limit
+	return params, nil
+}
+
+// writeJSON - Write payload as the JSON body of a response with status code.
+func writeJSON(rw http.ResponseWriter, code int, payload interface{}) {
+	rw.Header().Set("Content-Type", "application/json")
+	rw.WriteHeader(code)
+	_ = json.NewEncoder(rw).Encode(payload)
+}
+
+// WebhooksGetController - List the webhook subscriptions of a user.
+func WebhooksGetController(rw http.ResponseWriter, r *http.Request, principal *models.Principal) {
+
+	ctlr, err := GetController()
+	if err != nil {
+		writeProblem(rw, r, "errReturn500", "")
+		return
+	}
+
+	params, _ := webhookParams(r)
+	response := ctlr.ListWebhookSubscriptions(params, principal)
+	if response.err != nil {
+		writeProblem(rw, r, response.resType, response.errMsg)
+		return
+	}
+
+	writeJSON(rw, http.StatusOK, response.payload)
+}
+
+// WebhooksPostController - Subscribe an endpoint to the group events of a user. The secret signing the
+// deliveries is only returned by this call.
+func WebhooksPostController(rw http.ResponseWriter, r *http.Request, principal *models.Principal) {
+
+	ctlr, err := GetController()
+	if err != nil {
+		writeProblem(rw, r, "errReturn500", "")
+		return
+	}
+
+	var body WebhookSubscriptionBody
+	decoder := json.NewDecoder(http.MaxBytesReader(rw, r.Body, 64<<10))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&body); err != nil {
+		writeProblem(rw, r, "errReturn400", errInvalidWebhookBody.Error())
+		return
+	}
+
+	params, _ := webhookParams(r)
+	response := ctlr.CreateWebhookSubscription(params, body, principal)
+	if response.err != nil {
+		writeProblem(rw, r, response.resType, response.errMsg)
+		return
+	}
+
+	rw.Header().Set("Location", strings.TrimSuffix(r.URL.Path, "/")+"/"+response.payload.SubscriptionID)
+	writeJSON(rw, http.StatusCreated, response.payload)
+}
+
+// WebhookGetController - Read a webhook subscription, without its secret.
+func WebhookGetController(rw http.ResponseWriter, r *http.Request, principal *models.Principal) {
+
+	ctlr, err := GetController()
+	if err != nil {
+		writeProblem(rw, r, "errReturn500", "")
+		return
+	}
+
+	params, _ := webhookParams(r)
+	response := ctlr.GetWebhookSubscription(params, principal)
+	if response.err != nil {
+		writeProblem(rw, r, response.resType, response.errMsg)
+		return
+	}
+
+	writeJSON(rw, http.StatusOK, response.payload)
+}
+
+// WebhookDeleteController - Unsubscribe an endpoint, keeping its delivery log.
+func WebhookDeleteController(rw http.ResponseWriter, r *http.Request, principal *models.Principal) {
+
+	ctlr, err := GetController()
+	if err != nil {
+		writeProblem(rw, r, "errReturn500", "")
+		return
+	}
+
+	params, _ := webhookParams(r)
+	response := ctlr.DeleteWebhookSubscription(params, principal)
+	if response.err != nil {
+		writeProblem(rw, r, response.resType, response.errMsg)
+		return
+	}
+
+	rw.WriteHeader(http.StatusNoContent)
+}
+
+// WebhookDeliveriesGetController - List the delivery log of a subscription, optionally filtered by status.
+func WebhookDeliveriesGetController(rw http.ResponseWriter, r *http.Request, principal *models.Principal) {
+	listWebhookDeliveries(rw, r, principal, false)
+}
+
+// WebhookDeadLettersGetController - List the deliveries of a subscription that gave up.
+func WebhookDeadLettersGetController(rw http.ResponseWriter, r *http.Request, principal *models.Principal) {
+	listWebhookDeliveries(rw, r, principal, true)
+}
+
+func listWebhookDeliveries(rw http.ResponseWriter, r *http.Request, principal *models.Principal, deadLetters bool) {
+
+	ctlr, err := GetController()
+	if err != nil {
+		writeProblem(rw, r, "errReturn500", "")
+		return
+	}
+
+	params, err := webhookParams(r)
+	if err != nil {
+		writeProblem(rw, r, "errReturn400", err.Error())
+		return
+	}
+	if deadLetters {
+		params.Status = database.WebhookDeliveryDead
+	}
+
+	response := ctlr.ListWebhookDeliveries(params, principal)
+	if response.err != nil {
+		writeProblem(rw, r, response.resType, response.errMsg)
+		return
+	}
+
+	setPaginationLinks(rw, r, params.Offset, response.payload.PaginationMetadata)
+	writeJSON(rw, http.StatusOK, response.payload)
+}
+
+// WebhookRedeliverController - Queue a dead letter again for a new series of attempts.
+func WebhookRedeliverController(rw http.ResponseWriter, r *http.Request, principal *models.Principal) {
+
+	ctlr, err := GetController()
+	if err != nil {
+		writeProblem(rw, r, "errReturn500", "")
+		return
+	}
+
+	params, _ := webhookParams(r)
+	response := ctlr.RedeliverWebhookDelivery(params, principal)
+	if response.err != nil {
+		writeProblem(rw, r, response.resType, response.errMsg)
+		return
+	}
+
+	rw.WriteHeader(http.StatusAccepted)
+}
+
+// CreateWebhookSubscription - Validate and persist a subscription with a new secret.
+func (c Ctlr) CreateWebhookSubscription(params WebhookParams, body WebhookSubscriptionBody, principal *models.Principal) WebhookSubscriptionResponse {
+
+	ctx, span := tracing.Start(params.HTTPRequest, "Ctlr.CreateWebhookSubscription")
+	defer span.End()
+
+	if err := AuthorizeUser(principal, params.UserID); err != nil {
+		return WebhookSubscriptionResponse{resType: "errReturn403", errMsg: err.Error(), err: err}
+	}
+
+	db := database.NewTracingStorage(ctx, c.DB)
+	cfg := config.Get().Webhooks
+
+	if err := validateWebhookURL(body.URL, cfg.AllowHTTP); err != nil {
+		return WebhookSubscriptionResponse{resType: "errReturn400", errMsg: err.Error(), err: err}
+	}
+	if !cfg.AllowPrivateNetworks {
+		endpoint, _ := url.Parse(body.URL)
+		if err := checkWebhookHost(ctx, endpoint.Hostname()); err != nil {
+			return WebhookSubscriptionResponse{resType: "errReturn400", errMsg: err.Error(), err: err}
+		}
+	}
+	eventTypes, err := validateWebhookEventTypes(body.EventTypes)
+	if err != nil {
+		return WebhookSubscriptionResponse{resType: "errReturn400", errMsg: err.Error(), err: err}
+	}
+
+	subscriptions, err := db.ListWebhookSubscriptions(params.UserID)
+	if err != nil {
+		return WebhookSubscriptionResponse{resType: "errReturn500", errMsg: "failed to list webhook subscriptions", err: err}
+	}
+	if len(subscriptions) >= cfg.MaxSubscriptions {
+		return WebhookSubscriptionResponse{resType: "errReturn409", errMsg: errTooManyWebhooks.Error(), err: errTooManyWebhooks}
+	}
+
+	secret, err := newWebhookSecret()
+	if err != nil {
+		return WebhookSubscriptionResponse{resType: "errReturn500", errMsg: "failed to generate webhook secret", err: err}
+	}
+
+	subscription := database.WebhookSubscription{
+		UserID:     params.UserID,
+		URL:        body.URL,
+		Secret:     secret,
+		EventTypes: eventTypes,
+		CreatedAt:  time.Now(),
+	}
+	subscription.SubscriptionID, err = db.CreateWebhookSubscription(subscription)
+	if err != nil {
+		return WebhookSubscriptionResponse{resType: "errReturn500", errMsg: "failed to create webhook subscription", err: err}
+	}
+
+	return WebhookSubscriptionResponse{resType: "Created", payload: subscription}
+}
+
+// ListWebhookSubscriptions - Subscriptions of a user, oldest first, without their secrets.
+func (c Ctlr) ListWebhookSubscriptions(params WebhookParams, principal *models.Principal) ListWebhookSubscriptionsResponse {
+
+	ctx, span := tracing.Start(params.HTTPRequest, "Ctlr.ListWebhookSubscriptions")
+	defer span.End()
+
+	if err := AuthorizeUser(principal, params.UserID); err != nil {
+		return ListWebhookSubscriptionsResponse{resType: "errReturn403", errMsg: err.Error(), err: err}
+	}
+
+	db := database.NewTracingStorage(ctx, c.DB)
+
+	subscriptions, err := db.ListWebhookSubscriptions(params.UserID)
+	if err != nil {
+		return ListWebhookSubscriptionsResponse{resType: "errReturn500", errMsg: "failed to list webhook subscriptions", err: err}
+	}
+	for i := range subscriptions {
+		subscriptions[i].Secret = ""
+	}
+
+	return ListWebhookSubscriptionsResponse{resType: "OK", payload: WebhookSubscriptionsPayload{Subscriptions: subscriptions}}
+}
+
+// GetWebhookSubscription - A subscription of a user, without its secret.
+func (c Ctlr) GetWebhookSubscription(params WebhookParams, principal *models.Principal) WebhookSubscriptionResponse {
+
+	ctx, span := tracing.Start(params.HTTPRequest, "Ctlr.GetWebhookSubscription")
+	defer span.End()
+
+	if err := AuthorizeUser(principal, params.UserID); err != nil {
+		return WebhookSubscriptionResponse{resType: "errReturn403", errMsg: err.Error(), err: err}
+	}
+
+	db := database.NewTracingStorage(ctx, c.DB)
+
+	subscription, err := db.GetWebhookSubscription(params.UserID, params.SubscriptionID)
+	if status.Code(err) == codes.NotFound {
+		return WebhookSubscriptionResponse{resType: "errReturn404", errMsg: "record not found", err: err}
+	}
+	if err != nil {
+		return WebhookSubscriptionResponse{resType: "errReturn500", errMsg: "failed to parse webhook subscription from database", err: err}
+	}
+	subscription.Secret = ""
+
+	return WebhookSubscriptionResponse{resType: "OK", payload: subscription}
+}
+
+// DeleteWebhookSubscription - Remove a subscription of a user.
+func (c Ctlr) DeleteWebhookSubscription(params WebhookParams, principal *models.Principal) WebhookResponse {
+
+	ctx, span := tracing.Start(params.HTTPRequest, "Ctlr.DeleteWebhookSubscription")
+	defer span.End()
+
+	if err := AuthorizeUser(principal, params.UserID); err != nil {
+		return WebhookResponse{resType: "errReturn403", errMsg: err.Error(), err: err}
+	}
+
+	db := database.NewTracingStorage(ctx, c.DB)
+
+	err := db.DeleteWebhookSubscription(params.UserID, params.SubscriptionID)
+	if status.Code(err) == codes.NotFound {
+		return WebhookResponse{resType: "errReturn404", errMsg: "record not found", err: err}
+	}
+	if err != nil {
+		return WebhookResponse{resType: "errReturn500", errMsg: "failed to delete webhook subscription", err: err}
+	}
+
+	return WebhookResponse{resType: "Deleted"}
+}
+
+// ListWebhookDeliveries - Deliveries of a subscription, most recent first. The log outlives the subscription.
+func (c Ctlr) ListWebhookDeliveries(params WebhookParams, principal *models.Principal) ListWebhookDeliveriesResponse {
+
+	ctx, span := tracing.Start(params.HTTPRequest, "Ctlr.ListWebhookDeliveries")
+	defer span.End()
+
+	if err := AuthorizeUser(principal, params.UserID); err != nil {
+		return ListWebhookDeliveriesResponse{resType: "errReturn403", errMsg: err.Error(), err: err}
+	}
+
+	db := database.NewTracingStorage(ctx, c.DB)
+
+	deliveries, total, err := db.ListWebhookDeliveries(params.UserID, params.SubscriptionID, params.Status, params.Offset, params.Limit)
+	if err != nil {
+		return ListWebhookDeliveriesResponse{resType: "errReturn500", errMsg: "failed to list webhook deliveries", err: err}
+	}
+
+	payload := WebhookDeliveriesPayload{Deliveries: []WebhookDeliveryPayload{}}
+	for _, delivery := range deliveries {
+		payload.Deliveries = append(payload.Deliveries, WebhookDeliveryPayload{WebhookDelivery: delivery, Event: delivery.Payload})
+	}
+	pagination := &database.PaginatedQuery{Offset: params.Offset, Limit: params.Limit, ResultCount: total}
+	payload.PaginationMetadata = pagination.GetPaginatedQueryMetadata()
+
+	return ListWebhookDeliveriesResponse{resType: "OK", payload: payload}
+}
+
+// RedeliverWebhookDelivery - Queue a dead letter of a subscription for immediate delivery.
+func (c Ctlr) RedeliverWebhookDelivery(params WebhookParams, principal *models.Principal) WebhookResponse {
+
+	ctx, span := tracing.Start(params.HTTPRequest, "Ctlr.RedeliverWebhookDelivery")
+	defer span.End()
+
+	if err := AuthorizeUser(principal, params.UserID); err != nil {
+		return WebhookResponse{resType: "errReturn403", errMsg: err.Error(), err: err}
+	}
+
+	db := database.NewTracingStorage(ctx, c.DB)
+
+	err := db.RedeliverWebhookDelivery(params.UserID, params.SubscriptionID, params.DeliveryID, time.Now())
+	switch {
+	case errors.Is(err, database.ErrDeliveryNotDead):
+		return WebhookResponse{resType: "errReturn409", errMsg: errWebhookDeliveryNotDead.Error(), err: err}
+	case status.Code(err) == codes.NotFound:
+		return WebhookResponse{resType: "errReturn404", errMsg: "record not found", err: err}
+	case err != nil:
+		return WebhookResponse{resType: "errReturn500", errMsg: "failed to redeliver webhook delivery", err: err}
+	}
+
+	return WebhookResponse{resType: "Redelivered"}
+}
+
+// validateWebhookURL - Endpoints must be absolute https URLs, or http ones when allowHTTP.
+func validateWebhookURL(rawURL string, allowHTTP bool) error {
+	endpoint, err := url.Parse(rawURL)
+	if err != nil || endpoint.Host == "" || endpoint.User != nil {
+		return errInvalidWebhookURL
+	}
+	if endpoint.Scheme != "https" && !(allowHTTP && endpoint.Scheme == "http") {
+		return errInvalidWebhookURL
+	}
+	return nil
+}
+
+// validateWebhookEventTypes - Distinct known event types, in the order given.
+func validateWebhookEventTypes(eventTypes []string) ([]string, error) {
+	known := map[string]bool{}
+	for _, eventType := range events.Types {
+		known[eventType] = true
+	}
+
+	distinct := []string{}
+	seen := map[string]bool{}
+	for _, eventType := range eventTypes {
+		if !known[eventType] {
+			return nil, fmt.Errorf("unknown event type %q, expected one of %s", eventType, strings.Join(events.Types, ", "))
+		}
+		if !seen[eventType] {
+			seen[eventType] = true
+			distinct = append(distinct, eventType)
+		}
+	}
+	return distinct, nil
+}
+
+// newWebhookSecret - Random signing key of a subscription.
+func newWebhookSecret() (string, error) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return "", err
+	}
+	return webhookSecretPrefix + hex.EncodeToString(key), nil
+}
@@ -0,0 +1,315 @@
+package controllers
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"learning/unit-testing/config"
+	"learning/unit-testing/database"
+	"learning/unit-testing/events"
+	"learning/unit-testing/jsonpatch"
+	"learning/unit-testing/models"
+	"learning/unit-testing/restapi/operations/connections"
+)
+
+// stubWebhookResolver - Resolve the hosts of webhook endpoints with addrs until the test ends.
+func stubWebhookResolver(t *testing.T, addrs map[string][]netip.Addr) {
+	resolve := resolveWebhookHost
+	resolveWebhookHost = func(ctx context.Context, host string) ([]netip.Addr, error) {
+		if hostAddrs, ok := addrs[host]; ok {
+			return hostAddrs, nil
+		}
+		return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+	}
+	t.Cleanup(func() { resolveWebhookHost = resolve })
+}
+
+// allowPrivateWebhooks - Accept webhook endpoints on private networks, such as test servers, until the test ends.
+func allowPrivateWebhooks(t *testing.T) {
+	cfg := config.Get()
+	allowed := cfg
+	allowed.Webhooks.AllowPrivateNetworks = true
+	config.Set(allowed)
+	t.Cleanup(func() { config.Set(cfg) })
+}
+
+type TestCaseWebhookSubscription struct {
+	name                 string
+	body                 WebhookSubscriptionBody
+	principal            *models.Principal
+	expectedResponseType string
+	expectedEventTypes   []string
+}
+
+func TestCreateWebhookSubscription(t *testing.T) {
+
+	webhooksCtlr := GetControllerMockDB()
+	userID := "dc9dbe3e-60d5-4a07-8c9c-42027b555b81"
+	principal := &models.Principal{UserID: userID}
+	stubWebhookResolver(t, map[string][]netip.Addr{
+		"partner.example":  {netip.MustParseAddr("93.184.215.14")},
+		"internal.example": {netip.MustParseAddr("93.184.215.14"), netip.MustParseAddr("10.0.0.12")},
+	})
+
+	testCases := []TestCaseWebhookSubscription{
+		{
+			name:                 "PlainHTTP",
+			body:                 WebhookSubscriptionBody{URL: "http://partner.example/hooks"},
+			expectedResponseType: "errReturn400",
+		},
+		{
+			name:                 "RelativeURL",
+			body:                 WebhookSubscriptionBody{URL: "/hooks"},
+			expectedResponseType: "errReturn400",
+		},
+		{
+			name:                 "Loopback",
+			body:                 WebhookSubscriptionBody{URL: "https://127.0.0.1:8443/hooks"},
+			expectedResponseType: "errReturn400",
+		},
+		{
+			name:                 "MetadataService",
+			body:                 WebhookSubscriptionBody{URL: "https://169.254.169.254/latest/meta-data"},
+			expectedResponseType: "errReturn400",
+		},
+		{
+			name:                 "UniqueLocalIPv6",
+			body:                 WebhookSubscriptionBody{URL: "https://[fd00::1]/hooks"},
+			expectedResponseType: "errReturn400",
+		},
+		{
+			name:                 "MappedLoopback",
+			body:                 WebhookSubscriptionBody{URL: "https://[::ffff:127.0.0.1]/hooks"},
+			expectedResponseType: "errReturn400",
+		},
+		{
+			name:                 "ResolvesToPrivate",
+			body:                 WebhookSubscriptionBody{URL: "https://internal.example/hooks"},
+			expectedResponseType: "errReturn400",
+		},
+		{
+			name:                 "Unresolvable",
+			body:                 WebhookSubscriptionBody{URL: "https://unknown.example/hooks"},
+			expectedResponseType: "errReturn400",
+		},
+		{
+			name:                 "OtherUser",
+			body:                 WebhookSubscriptionBody{URL: "https://partner.example/hooks"},
+			principal:            &models.Principal{UserID: "dc9dbe3e-60d5-4a07-8c9c-42027b555b8f"},
+			expectedResponseType: "errReturn403",
+		},
+		{
+			name:                 "UnknownEventType",
+			body:                 WebhookSubscriptionBody{URL: "https://partner.example/hooks", EventTypes: []string{"GroupExploded"}},
+			expectedResponseType: "errReturn400",
+		},
+		{
+			name:                 "EveryEvent",
+			body:                 WebhookSubscriptionBody{URL: "https://partner.example/hooks"},
+			expectedResponseType: "Created",
+			expectedEventTypes:   []string{},
+		},
+		{
+			name:                 "DistinctEventTypes",
+			body:                 WebhookSubscriptionBody{URL: "https://partner.example/hooks", EventTypes: []string{"GroupCreated", "GroupDeleted", "GroupCreated"}},
+			expectedResponseType: "Created",
+			expectedEventTypes:   []string{"GroupCreated", "GroupDeleted"},
+		},
+	}
+
+	for _, test := range testCases {
+
+		t.Run(test.name, func(t *testing.T) {
+			if test.principal == nil {
+				test.principal = principal
+			}
+			response := webhooksCtlr.CreateWebhookSubscription(WebhookParams{UserID: userID}, test.body, test.principal)
+			assertEqual(t, response.resType, test.expectedResponseType)
+			if response.err != nil {
+				return
+			}
+
+			assertEqual(t, strings.HasPrefix(response.payload.Secret, webhookSecretPrefix), true)
+			assertEqual(t, response.payload.EventTypes, test.expectedEventTypes)
+
+			// The secret is only shown on creation.
+			stored := webhooksCtlr.GetWebhookSubscription(WebhookParams{UserID: userID, SubscriptionID: response.payload.SubscriptionID}, principal)
+			assertEqual(t, stored.resType, "OK")
+			assertEqual(t, stored.payload.Secret, "")
+
+			// Subscriptions are only shown to their user.
+			other := &models.Principal{UserID: "dc9dbe3e-60d5-4a07-8c9c-42027b555b8f"}
+			assertEqual(t, webhooksCtlr.GetWebhookSubscription(WebhookParams{UserID: userID, SubscriptionID: response.payload.SubscriptionID}, other).resType, "errReturn403")
+		})
+	}
+
+	// Subscriptions of a user are limited.
+	for i := 2; i < config.Defaults().Webhooks.MaxSubscriptions; i++ {
+		webhooksCtlr.CreateWebhookSubscription(WebhookParams{UserID: userID}, WebhookSubscriptionBody{URL: "https://partner.example/hooks"}, principal)
+	}
+	response := webhooksCtlr.CreateWebhookSubscription(WebhookParams{UserID: userID}, WebhookSubscriptionBody{URL: "https://partner.example/hooks"}, principal)
+	assertEqual(t, response.resType, "errReturn409")
+}
+
+// webhookRequest - A delivery as received by a webhook endpoint.
+type webhookRequest struct {
+	header http.Header
+	body   []byte
+}
+
+func TestWebhookDelivery(t *testing.T) {
+
+	now := time.Now().Round(0)
+	webhooksCtlr := GetControllerMockDB()
+	userID := "dc9dbe3e-60d5-4a07-8c9c-42027b555b82"
+	principal := &models.Principal{UserID: userID}
+	groupName := "Webhooked Group"
+	// The test server listens on loopback.
+	allowPrivateWebhooks(t)
+
+	received := make(chan webhookRequest, 10)
+	var answer atomic.Int32
+	answer.Store(http.StatusNoContent)
+	server := httptest.NewTLSServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		received <- webhookRequest{header: r.Header, body: body}
+		rw.WriteHeader(int(answer.Load()))
+	}))
+	defer server.Close()
+
+	subscription := webhooksCtlr.CreateWebhookSubscription(WebhookParams{UserID: userID}, WebhookSubscriptionBody{
+		URL:        server.URL,
+		EventTypes: []string{events.TypeGroupCreated, events.TypeGroupRenamed},
+	}, principal).payload
+
+	cfg := config.Defaults().Webhooks
+	cfg.MaxAttempts = 2
+	pool := NewWebhookWorkerPool(webhooksCtlr, cfg)
+	pool.client = server.Client()
+	pool.jitter = func(time.Duration) time.Duration { return 0 }
+	pool.now = func() time.Time { return now.Add(time.Hour) }
+
+	// Deliveries are queued as the outbox is dispatched.
+	dispatcher := NewEventDispatcher(webhooksCtlr, config.Defaults().Events, []events.Sink{NewSubscriptionSink(webhooksCtlr.DB)})
+
+	deliveries := func(deliveryStatus string) []WebhookDeliveryPayload {
+		return webhooksCtlr.ListWebhookDeliveries(WebhookParams{UserID: userID, SubscriptionID: subscription.SubscriptionID, Status: deliveryStatus, Limit: 10}, principal).payload.Deliveries
+	}
+
+	// Signed creation event, carrying the ID of the outbox event.
+	webhooksCtlr.CreateConnectionsGroupsByUserID(connections.UsersConnectionsGroupsByUserIDPostParams{
+		UserID: userID,
+		Body:   &models.UsersConnectionsGroupsPostRequest{GroupName: &groupName, ConnectionUserIds: connectionUserIds},
+	}, &models.Principal{})
+	group, _ := webhooksCtlr.DB.GetUserConnectionGroupByName(userID, groupName)
+	outbox := webhooksCtlr.DB.(*database.MockConnection).OutboxEvents()
+	assertEqual(t, dispatcher.poll(context.Background()), 1)
+
+	assertEqual(t, pool.poll(context.Background()), 1)
+	request := <-received
+	assertEqual(t, request.header.Get(HeaderWebhookEvent), events.TypeGroupCreated)
+	assertEqual(t, request.header.Get(events.HeaderEventID), outbox[0].EventID)
+	assertEqual(t, events.VerifySignature(subscription.Secret, request.header.Get(events.SignatureHeader), request.body, now.Add(time.Hour), time.Minute), nil)
+	assertEqual(t, len(deliveries(database.WebhookDeliveryDelivered)), 1)
+	assertEqual(t, deliveries(database.WebhookDeliveryDelivered)[0].Attempts[0].StatusCode, http.StatusNoContent)
+
+	// Member changes are not subscribed to.
+	patch, _ := jsonpatch.Decode([]byte(`[{"op": "remove", "path": "/connection_user_ids/0"}]`))
+	webhooksCtlr.PatchGroup(GroupJSONPatchParams{UserID: userID, GroupID: group.GroupID, Patch: patch}, &models.Principal{})
+	assertEqual(t, dispatcher.poll(context.Background()), 1)
+	assertEqual(t, pool.poll(context.Background()), 0)
+
+	// A failing endpoint is retried after the base backoff, then given up on.
+	answer.Store(http.StatusInternalServerError)
+	patch, _ = jsonpatch.Decode([]byte(`[{"op": "replace", "path": "/group_name", "value": "Renamed Webhooked Group"}]`))
+	webhooksCtlr.PatchGroup(GroupJSONPatchParams{UserID: userID, GroupID: group.GroupID, Patch: patch}, &models.Principal{})
+	assertEqual(t, dispatcher.poll(context.Background()), 1)
+
+	assertEqual(t, pool.poll(context.Background()), 1)
+	<-received
+	pending := deliveries(database.WebhookDeliveryPending)
+	assertEqual(t, len(pending), 1)
+	assertEqual(t, pending[0].AvailableAt, now.Add(time.Hour+time.Duration(cfg.BaseBackoff)))
+	assertEqual(t, pool.poll(context.Background()), 0)
+
+	pool.now = func() time.Time { return now.Add(2 * time.Hour) }
+	assertEqual(t, pool.poll(context.Background()), 1)
+	<-received
+	dead := deliveries(database.WebhookDeliveryDead)
+	assertEqual(t, len(dead), 1)
+	assertEqual(t, len(dead[0].Attempts), 2)
+	assertEqual(t, dead[0].Attempts[1].Error, "webhook answered 500 Internal Server Error")
+
+	// Dead letters are listed separately and can be redelivered once.
+	redeliver := WebhookParams{UserID: userID, SubscriptionID: subscription.SubscriptionID, DeliveryID: dead[0].DeliveryID}
+	assertEqual(t, webhooksCtlr.RedeliverWebhookDelivery(redeliver, principal).resType, "Redelivered")
+	assertEqual(t, webhooksCtlr.RedeliverWebhookDelivery(redeliver, principal).resType, "errReturn409")
+
+	answer.Store(http.StatusOK)
+	assertEqual(t, pool.poll(context.Background()), 1)
+	request = <-received
+	assertEqual(t, request.header.Get(HeaderWebhookDelivery), dead[0].DeliveryID)
+	assertEqual(t, len(deliveries(database.WebhookDeliveryDead)), 0)
+	assertEqual(t, len(deliveries(database.WebhookDeliveryDelivered)), 2)
+
+	// Deliveries of a deleted subscription are given up without calling it.
+	patch, _ = jsonpatch.Decode([]byte(`[{"op": "replace", "path": "/group_name", "value": "Webhooked Group"}]`))
+	webhooksCtlr.PatchGroup(GroupJSONPatchParams{UserID: userID, GroupID: group.GroupID, Patch: patch}, &models.Principal{})
+	assertEqual(t, dispatcher.poll(context.Background()), 1)
+	webhooksCtlr.DeleteWebhookSubscription(WebhookParams{UserID: userID, SubscriptionID: subscription.SubscriptionID}, principal)
+
+	assertEqual(t, pool.poll(context.Background()), 1)
+	assertEqual(t, len(received), 0)
+	dead = deliveries(database.WebhookDeliveryDead)
+	assertEqual(t, len(dead), 1)
+	assertEqual(t, dead[0].Attempts[0].Error, "webhook subscription deleted")
+}
+
+func TestWebhookDeliveryToPrivateNetwork(t *testing.T) {
+
+	now := time.Now().Round(0)
+	webhooksCtlr := GetControllerMockDB()
+	userID := "dc9dbe3e-60d5-4a07-8c9c-42027b555b83"
+	principal := &models.Principal{UserID: userID}
+	groupName := "Privately Webhooked Group"
+
+	var calls atomic.Int32
+	server := httptest.NewTLSServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		rw.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	// Subscribed while private networks were allowed, or to a host resolving to a public address back then.
+	allowPrivateWebhooks(t)
+	subscription := webhooksCtlr.CreateWebhookSubscription(WebhookParams{UserID: userID}, WebhookSubscriptionBody{URL: server.URL}, principal).payload
+
+	cfg := config.Defaults().Webhooks
+	cfg.MaxAttempts = 1
+	pool := NewWebhookWorkerPool(webhooksCtlr, cfg)
+	pool.client.Transport.(*http.Transport).TLSClientConfig = server.Client().Transport.(*http.Transport).TLSClientConfig
+	pool.now = func() time.Time { return now.Add(time.Hour) }
+	defer pool.Stop()
+
+	webhooksCtlr.CreateConnectionsGroupsByUserID(connections.UsersConnectionsGroupsByUserIDPostParams{
+		UserID: userID,
+		Body:   &models.UsersConnectionsGroupsPostRequest{GroupName: &groupName, ConnectionUserIds: connectionUserIds},
+	}, principal)
+	dispatcher := NewEventDispatcher(webhooksCtlr, config.Defaults().Events, []events.Sink{NewSubscriptionSink(webhooksCtlr.DB)})
+	assertEqual(t, dispatcher.poll(context.Background()), 1)
+
+	// The workers refuse to connect to it.
+	assertEqual(t, pool.poll(context.Background()), 1)
+	assertEqual(t, calls.Load(), int32(0))
+	dead := webhooksCtlr.ListWebhookDeliveries(WebhookParams{UserID: userID, SubscriptionID: subscription.SubscriptionID, Status: database.WebhookDeliveryDead, Limit: 10}, principal).payload.Deliveries
+	assertEqual(t, len(dead), 1)
+	assertEqual(t, strings.Contains(dead[0].Attempts[0].Error, errWebhookAddressNotPublic.Error()), true)
+}
@@ -2,12 +2,17 @@ package database
 
 import (
 	"log"
+	"time"
 
+	"learning/unit-testing/config"
+	"learning/unit-testing/events"
 	"learning/unit-testing/models"
 	"learning/unit-testing/restapi/operations/connections"
+	"learning/unit-testing/tracing"
 
 	"golang.org/x/net/context"
 	"google.golang.org/api/iterator"
+	"google.golang.org/api/option"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 
@@ -21,11 +26,25 @@ type Connection struct {
 	Context context.Context
 }
 
-// NewConnection - Initialize new firestore connection
+// NewConnection - Initialize new firestore connection using the configured storage DSN
 func NewConnection() (Storage, error) {
 
+	projectID, credentialsFile, err := config.Get().Storage.FirestoreDSN()
+	if err != nil {
+		return nil, err
+	}
+
+	var firebaseConfig *firebase.Config
+	if projectID != "" {
+		firebaseConfig = &firebase.Config{ProjectID: projectID}
+	}
+	var opts []option.ClientOption
+	if credentialsFile != "" {
+		opts = append(opts, option.WithCredentialsFile(credentialsFile))
+	}
+
 	ctx := context.Background()
-	app, err := firebase.NewApp(ctx, nil)
+	app, err := firebase.NewApp(ctx, firebaseConfig, opts...)
 	if err != nil {
 		log.Printf("Error initializing Firebase app: %v\n", err)
 		return nil, err
@@ -40,11 +59,25 @@ func NewConnection() (Storage, error) {
 	return &Connection{Client: client, Context: ctx}, nil
 }
 
-// GetUserConnectionGroupByName - function
+// WithContext - Copy of the connection running its queries under ctx.
+func (c *Connection) WithContext(ctx context.Context) Storage {
+	return &Connection{Client: c.Client, Context: ctx}
+}
+
+// GetUserConnectionGroupByName - Group whose name has the same key as groupName, ignoring case and spacing.
 func (c *Connection) GetUserConnectionGroupByName(userID string, groupName string) (internal.UserConnectionGroupInfo, error) {
+	groupinfoObj, err := c.getUserConnectionGroupWhere(userID, "group_name_key", groupNameKey(groupName))
+	if status.Code(err) == codes.NotFound {
+		// Groups created before names had keys.
+		groupinfoObj, err = c.getUserConnectionGroupWhere(userID, "group_name", groupName)
+	}
+	return groupinfoObj, err
+}
+
+func (c *Connection) getUserConnectionGroupWhere(userID string, path string, value string) (internal.UserConnectionGroupInfo, error) {
 	var groupinfoObj internal.UserConnectionGroupInfo
 
-	existingGroupRef := c.Client.Collection(internal.GetGroupCollectionPath(userID)).Where("group_name", "==", groupName).Limit(1).Documents(c.Context)
+	existingGroupRef := c.Client.Collection(internal.GetGroupCollectionPath(userID)).Where(path, "==", value).Limit(1).Documents(c.Context)
 	for {
 		doc, err := existingGroupRef.Next()
 		if err == iterator.Done {
@@ -83,14 +116,38 @@ func (c *Connection) GetUserConnectionGroupByGroupID(userID string, groupID stri
 	return groupinfoObj, nil
 }
 
-// CreateUserConnectionGroup - function
-func (c *Connection) CreateUserConnectionGroup(userID string, group internal.UserConnectionGroupInfo) (string, error) {
+// CreateUserConnectionGroup - Create a group on behalf of the caller with principal, taking its name and recording
+// its creation in the history in the same transaction.
+// Fails with a *GroupNameConflictError when another group of the user has the name.
+func (c *Connection) CreateUserConnectionGroup(userID string, group internal.UserConnectionGroupInfo, principal map[string]interface{}) (string, error) {
 	// Set the group into the database.
 	groupRef := c.Client.Collection(internal.GetGroupCollectionPath(userID)).NewDoc()
 	group.GroupID = groupRef.ID
+	group.GroupNameKey = groupNameKey(group.GroupName)
+	group.CreatedAt = time.Now()
+	group.UpdatedAt = group.CreatedAt
+	if group.LatestInteractionTime.IsZero() {
+		group.LatestInteractionTime = group.CreatedAt
+	}
 
-	if _, groupSetErr := groupRef.Set(c.Context, group); groupSetErr != nil {
-		return "", groupSetErr
+	err := c.Client.RunTransaction(c.Context, func(ctx context.Context, tx *firestore.Transaction) error {
+		if err := c.checkGroupName(tx, userID, group.GroupID, group.GroupName); err != nil {
+			return err
+		}
+		if err := c.moveGroupName(tx, userID, group.GroupID, "", group.GroupName); err != nil {
+			return err
+		}
+		if err := tx.Create(groupRef, group); err != nil {
+			return err
+		}
+		if err := c.writeOutbox(tx, userID, group.GroupID, []events.Event{GroupCreatedEvent(NewGroupDocument(group))}); err != nil {
+			return err
+		}
+		_, err := c.appendGroupHistory(tx, NewGroupHistoryEntry(userID, group.GroupID, GroupCreated, principal, emptyGroupDocument(), NewGroupDocument(group)))
+		return err
+	})
+	if err != nil {
+		return "", err
 	}
 	return group.GroupID, nil
 }
@@ -98,19 +155,31 @@ func (c *Connection) CreateUserConnectionGroup(userID string, group internal.Use
 // GetPaginatedUserConnectionGroup - function
 func (c *Connection) GetPaginatedUserConnectionGroup(params connections.UsersConnectionsGroupsByUserIDGetParams) (groupsList []*models.Group, paginationMeta *models.PaginationData, err error) {
 
+	timeRanges, err := groupTimeRanges(params)
+	if err != nil {
+		return groupsList, paginationMeta, err
+	}
+
 	// Create the paginated query.
 	var limit int32
 	if internal.IsZeroOfUnderlyingType(params.Limit) {
-		limit = internal.DefaultConnectionsQueryLimit
+		limit = config.Get().Pagination.DefaultLimit
 	} else {
 		limit = *params.Limit
 	}
 
+	// Pages are checked and described the same way as in memory, Firestore only runs the query.
+	page := PaginatedQuery{CollectionName: "users_connections_groups"}
+	page.SetPaginatedQuery(params.Offset, &limit, nil, nil)
+	if err := page.ValidatePage(); err != nil {
+		return groupsList, paginationMeta, err
+	}
+
 	paginatedQuery := internal.NewPaginatedQuery(c.Client.Collection(internal.GetGroupCollectionPath(params.UserID)).Query, params.Offset, &limit, params.OrderBy, params.Order)
 
-	// Set time interaction filter.
-	if err := paginatedQuery.AddTimeSetFilterToQuery("latest_interaction_time", params.LatestInteractionTimeAfter, params.LatestInteractionTimeAfter); err != nil {
-		return groupsList, paginationMeta, err
+	// Set the time range filters.
+	for _, timeRange := range timeRanges {
+		*paginatedQuery.Query = timeRange.applyTo(*paginatedQuery.Query)
 	}
 
 	// Set filter for group name.
@@ -118,17 +187,23 @@ func (c *Connection) GetPaginatedUserConnectionGroup(params connections.UsersCon
 		*paginatedQuery.Query = paginatedQuery.Query.Where("group_name", "==", params.GroupName)
 	}
 
-	connectionGroupsDocs, err := paginatedQuery.Query.Documents(c.Context).GetAll()
+	queryCtx, querySpan := tracing.Tracer().Start(c.Context, "Firestore.QueryUserConnectionGroups")
+	connectionGroupsDocs, err := paginatedQuery.Query.Documents(queryCtx).GetAll()
+	endSpan(querySpan, err)
 	if err != nil {
 		return groupsList, paginationMeta, err
 	}
 
-	dbConnection := internal.DataBaseConnection{Client: c.Client, Context: c.Context}
+	metaCtx, metaSpan := tracing.Tracer().Start(c.Context, "GetPaginatedQueryMetadata")
+	dbConnection := internal.DataBaseConnection{Client: c.Client, Context: metaCtx}
 	// Get the pagination metadata.
-	paginationMeta, err = paginatedQuery.GetPaginatedQueryMetadata(&dbConnection)
+	queryMeta, err := paginatedQuery.GetPaginatedQueryMetadata(&dbConnection)
+	endSpan(metaSpan, err)
 	if err != nil {
 		return groupsList, paginationMeta, err
 	}
+	page.ResultCount = int(*queryMeta.ResultCount)
+	paginationMeta = page.GetPaginatedQueryMetadata()
 
 	// If the query returned no results, its still a good query with no results.
 	if len(connectionGroupsDocs) < 1 {
@@ -142,7 +217,7 @@ func (c *Connection) GetPaginatedUserConnectionGroup(params connections.UsersCon
 			return groupsList, paginationMeta, err
 		}
 
-		groupData := groupInfo.TransformToResponseGroup()
+		groupData := ToResponseGroup(groupInfo)
 
 		groupsList = append(groupsList, groupData)
 	}
@@ -150,77 +225,222 @@ func (c *Connection) GetPaginatedUserConnectionGroup(params connections.UsersCon
 	return groupsList, paginationMeta, nil
 }
 
-// UpdateUserConnectionGroup - function
-func (c *Connection) UpdateUserConnectionGroup(params connections.UsersConnectionsGroupsByUserIDAndGroupIDPatchParams) error {
+// UpdateUserConnectionGroup - Apply patch to a group on behalf of the caller with principal. A picture change moves
+// the picture reference, a new name moves the name index, the change is appended to the group history and its
+// events go to the outbox in the same transaction.
+func (c *Connection) UpdateUserConnectionGroup(userID string, groupID string, patch GroupPatch, principal map[string]interface{}) (RecordedChange, error) {
 
-	groupObj, err := c.GetUserConnectionGroupByGroupID(params.UserID, params.GroupID)
-	if err != nil {
-		return err
+	if err := patch.validate(); err != nil {
+		return RecordedChange{}, err
 	}
 
-	var updates []firestore.Update
+	groupRef := c.Client.Doc(internal.GetGroupDocPath(userID, groupID))
 
-	if !internal.IsZeroOfUnderlyingType(params.Body.GroupName) {
-		updates = append(updates, firestore.Update{
-			Path:  "group_name",
-			Value: params.Body.GroupName,
-		})
-	}
+	var change RecordedChange
+	err := c.Client.RunTransaction(c.Context, func(ctx context.Context, tx *firestore.Transaction) error {
+		change = RecordedChange{}
 
-	changeConnectionUserIds := false
-	connectionUserIds := groupObj.ConnectionUserIds
+		groupDoc, err := tx.Get(groupRef)
+		if err != nil {
+			return err
+		}
 
-	if !internal.IsZeroOfUnderlyingType(params.Body.ConnectionUserIDToAdd) {
-		cgUIDAdd := internal.GroupConnectionUserID{UserID: params.Body.ConnectionUserIDToAdd}
-		connectionUserIds = append(connectionUserIds, cgUIDAdd)
-		changeConnectionUserIds = true
-	}
+		var groupObj internal.UserConnectionGroupInfo
+		if err := groupDoc.DataTo(&groupObj); err != nil {
+			return err
+		}
 
-	if !internal.IsZeroOfUnderlyingType(params.Body.ConnectionUserIDToRemove) {
+		before := NewGroupDocument(groupObj)
+		after := NewGroupDocument(groupObj)
 
-		for i, CU := range connectionUserIds {
-			if CU.UserID == params.Body.ConnectionUserIDToRemove {
-				connectionUserIds = append(connectionUserIds[:i], connectionUserIds[i+1:]...)
+		renamed := patch.GroupName.IsSet() && patch.GroupName.Value != groupObj.GroupName
+		if renamed {
+			if err := c.checkGroupName(tx, userID, groupID, patch.GroupName.Value); err != nil {
+				return err
 			}
 		}
 
-		changeConnectionUserIds = true
-	}
+		var updates []firestore.Update
+
+		if patch.GroupName.IsSet() {
+			updates = append(updates, firestore.Update{
+				Path:  "group_name",
+				Value: patch.GroupName.Value,
+			}, firestore.Update{
+				Path:  "group_name_key",
+				Value: groupNameKey(patch.GroupName.Value),
+			})
+			after.GroupName = patch.GroupName.Value
+		}
 
-	if changeConnectionUserIds {
-		updates = append(updates, firestore.Update{
-			Path:  "connection_user_ids",
-			Value: connectionUserIds,
-		})
-	}
+		changeConnectionUserIds := false
+		connectionUserIds := groupObj.ConnectionUserIds
 
-	if !internal.IsZeroOfUnderlyingType(params.Body.GroupPic) {
-		updates = append(updates, firestore.Update{
-			Path:  "group_pic",
-			Value: params.Body.GroupPic,
-		})
-	}
+		if !internal.IsZeroOfUnderlyingType(patch.ConnectionUserIDToAdd) {
+			cgUIDAdd := internal.GroupConnectionUserID{UserID: patch.ConnectionUserIDToAdd}
+			connectionUserIds = append(connectionUserIds, cgUIDAdd)
+			changeConnectionUserIds = true
+		}
+
+		if !internal.IsZeroOfUnderlyingType(patch.ConnectionUserIDToRemove) {
+
+			remaining := []internal.GroupConnectionUserID{}
+			for _, CU := range connectionUserIds {
+				if CU.UserID != patch.ConnectionUserIDToRemove {
+					remaining = append(remaining, CU)
+				}
+			}
+			connectionUserIds = remaining
+
+			changeConnectionUserIds = true
+		}
+
+		if changeConnectionUserIds {
+			updates = append(updates, firestore.Update{
+				Path:  "connection_user_ids",
+				Value: connectionUserIds,
+			})
+			after.ConnectionUserIds = []string{}
+			for _, CU := range connectionUserIds {
+				after.ConnectionUserIds = append(after.ConnectionUserIds, CU.UserID)
+			}
+		}
+
+		// Null removes the picture.
+		if patch.GroupPic.Present {
+			if err := c.swapGroupPicRefs(tx, groupObj.GroupPic, patch.GroupPic.Value); err != nil {
+				return err
+			}
+			updates = append(updates, firestore.Update{
+				Path:  "group_pic",
+				Value: patch.GroupPic.Value,
+			})
+			after.GroupPic = patch.GroupPic.Value
+		}
 
-	if !internal.IsZeroOfUnderlyingType(updates) && len(updates) > 0 {
-		if _, err := c.Client.Doc(internal.GetGroupDocPath(params.UserID, params.GroupID)).Update(c.Context, updates); err != nil {
+		if len(updates) == 0 {
+			return nil
+		}
+		now := time.Now()
+		updates = append(updates, firestore.Update{Path: "updated_at", Value: now})
+		if isInteraction(before, after) {
+			updates = append(updates, firestore.Update{Path: "latest_interaction_time", Value: now})
+		}
+		if renamed {
+			if err := c.moveGroupName(tx, userID, groupID, groupObj.GroupName, patch.GroupName.Value); err != nil {
+				return err
+			}
+		}
+		if err := c.writeOutbox(tx, userID, groupID, GroupChangeEvents(before, after)); err != nil {
 			return err
 		}
-	}
 
-	return nil
+		entry, err := c.appendGroupHistory(tx, NewGroupHistoryEntry(userID, groupID, GroupUpdated, principal, before, after))
+		if err != nil {
+			return err
+		}
+
+		if err := tx.Update(groupRef, updates); err != nil {
+			return err
+		}
+		change = RecordedChange{Before: before, After: after, Entry: entry}
+		return nil
+	})
+	return change, err
 }
 
-// DeleteUserConnectionGroup - function
-func (c *Connection) DeleteUserConnectionGroup(params connections.UsersConnectionsGroupsByUserIDAndGroupIDDeleteParams) error {
+// DeleteUserConnectionGroup - Move a group to the trash on behalf of the caller with principal, releasing its name.
+// It can be restored until it is purged.
+func (c *Connection) DeleteUserConnectionGroup(params connections.UsersConnectionsGroupsByUserIDAndGroupIDDeleteParams, principal map[string]interface{}) error {
 
-	// Check Group exists before delete.
-	_, err := c.GetUserConnectionGroupByGroupID(params.UserID, params.GroupID)
-	if err != nil {
+	groupRef := c.Client.Doc(internal.GetGroupDocPath(params.UserID, params.GroupID))
+	deletedAt := time.Now()
+
+	return c.Client.RunTransaction(c.Context, func(ctx context.Context, tx *firestore.Transaction) error {
+
+		// Check Group exists before delete.
+		groupDoc, err := tx.Get(groupRef)
+		if err != nil {
+			return err
+		}
+
+		var groupinfoObj internal.UserConnectionGroupInfo
+		if err := groupDoc.DataTo(&groupinfoObj); err != nil {
+			return err
+		}
+
+		if err := c.trashUserConnectionGroup(tx, params.UserID, groupinfoObj, deletedAt); err != nil {
+			return err
+		}
+		if err := c.writeOutbox(tx, params.UserID, params.GroupID, []events.Event{events.GroupDeleted{GroupName: groupinfoObj.GroupName}}); err != nil {
+			return err
+		}
+		// Entries of deletions keep the group as it was.
+		document := NewGroupDocument(groupinfoObj)
+		_, err = c.appendGroupHistory(tx, NewGroupHistoryEntry(params.UserID, params.GroupID, GroupDeleted, principal, document, document))
 		return err
-	}
+	})
+}
+
+// SetUserConnectionGroupPic - Replace the picture ID of a group on behalf of the caller with principal, an empty
+// groupPic removes the picture. The reference moves from the previous picture to the new one, and a change is
+// appended to the group history with a PictureChanged event in the outbox, in the same transaction.
+func (c *Connection) SetUserConnectionGroupPic(userID string, groupID string, groupPic string, principal map[string]interface{}) (RecordedChange, error) {
+
+	groupRef := c.Client.Doc(internal.GetGroupDocPath(userID, groupID))
+
+	var change RecordedChange
+	err := c.Client.RunTransaction(c.Context, func(ctx context.Context, tx *firestore.Transaction) error {
+		change = RecordedChange{}
+
+		// Check Group exists before update.
+		groupDoc, err := tx.Get(groupRef)
+		if err != nil {
+			return err
+		}
+
+		var groupinfoObj internal.UserConnectionGroupInfo
+		if err := groupDoc.DataTo(&groupinfoObj); err != nil {
+			return err
+		}
+
+		if err := c.swapGroupPicRefs(tx, groupinfoObj.GroupPic, groupPic); err != nil {
+			return err
+		}
+
+		before := NewGroupDocument(groupinfoObj)
+		after := before
+		after.GroupPic = groupPic
+		if before.GroupPic != after.GroupPic {
+			if err := c.writeOutbox(tx, userID, groupID, GroupChangeEvents(before, after)); err != nil {
+				return err
+			}
+			entry, err := c.appendGroupHistory(tx, NewGroupHistoryEntry(userID, groupID, GroupUpdated, principal, before, after))
+			if err != nil {
+				return err
+			}
+			change = RecordedChange{Before: before, After: after, Entry: entry}
+		}
+
+		updates := []firestore.Update{
+			{
+				Path:  "group_pic",
+				Value: groupPic,
+			},
+			{
+				Path:  "updated_at",
+				Value: time.Now(),
+			},
+		}
+		return tx.Update(groupRef, updates)
+	})
+	return change, err
+}
 
-	// Remove the connection group from the users groups database.
-	if _, err := c.Client.Doc(internal.GetGroupDocPath(params.UserID, params.GroupID)).Delete(c.Context); err != nil {
+// Ping - Check that Firestore answers within the deadline of ctx.
+func (c *Connection) Ping(ctx context.Context) error {
+	_, err := c.Client.Collections(ctx).Next()
+	if err != nil && err != iterator.Done {
 		return err
 	}
 
@@ -0,0 +1,149 @@
+package database
+
+import (
+	"time"
+
+	"learning/unit-testing/events"
+	"learning/unit-testing/internal"
+	"learning/unit-testing/models"
+
+	"github.com/go-openapi/strfmt"
+	"golang.org/x/net/context"
+
+	"cloud.google.com/go/firestore"
+)
+
+// GroupDocument - Editable fields of a group, as targeted by JSON Patch operations.
+type GroupDocument struct {
+	GroupName string `firestore:"group_name" json:"group_name"`
+	// GroupPic - picture ID, empty when the group has no picture.
+	GroupPic          string   `firestore:"group_pic" json:"group_pic"`
+	ConnectionUserIds []string `firestore:"connection_user_ids" json:"connection_user_ids"`
+}
+
+// NewGroupDocument - Editable fields of a stored group.
+func NewGroupDocument(group internal.UserConnectionGroupInfo) GroupDocument {
+	document := GroupDocument{
+		GroupName:         group.GroupName,
+		GroupPic:          group.GroupPic,
+		ConnectionUserIds: []string{},
+	}
+	for _, CU := range group.ConnectionUserIds {
+		document.ConnectionUserIds = append(document.ConnectionUserIds, CU.UserID)
+	}
+	return document
+}
+
+// ToResponseGroup - Response payload of a stored group, including its picture processing state and when it was
+// created and last updated.
+func ToResponseGroup(groupInfo internal.UserConnectionGroupInfo) *models.Group {
+	groupData := groupInfo.TransformToResponseGroup()
+	groupData.PictureStatus = groupInfo.PictureStatus
+	groupData.PictureError = groupInfo.PictureError
+	groupData.CreatedAt = strfmt.DateTime(groupInfo.CreatedAt)
+	groupData.UpdatedAt = strfmt.DateTime(groupInfo.UpdatedAt)
+	return groupData
+}
+
+// Equal - Whether two versions of a group have the same fields, with the members in the same order.
+func (d GroupDocument) Equal(other GroupDocument) bool {
+	if d.GroupName != other.GroupName || d.GroupPic != other.GroupPic || len(d.ConnectionUserIds) != len(other.ConnectionUserIds) {
+		return false
+	}
+	for i := range d.ConnectionUserIds {
+		if d.ConnectionUserIds[i] != other.ConnectionUserIds[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// connectionUserIds - Members of the document as stored on groups.
+func (d GroupDocument) connectionUserIds() []internal.GroupConnectionUserID {
+	ids := []internal.GroupConnectionUserID{}
+	for _, userID := range d.ConnectionUserIds {
+		ids = append(ids, internal.GroupConnectionUserID{UserID: userID})
+	}
+	return ids
+}
+
+// ModifyUserConnectionGroup - Read a group, let modify change its document and write the changes back, with their
+// events in the outbox and their history entry as described by record, in one transaction. Nothing is written,
+// and an empty change returned, when modify leaves the document as it was.
+// Firestore may call modify again when the transaction is retried.
+func (c *Connection) ModifyUserConnectionGroup(userID string, groupID string, record ChangeRecord, modify func(group *GroupDocument) error) (RecordedChange, error) {
+
+	groupRef := c.Client.Doc(internal.GetGroupDocPath(userID, groupID))
+
+	var change RecordedChange
+	err := c.Client.RunTransaction(c.Context, func(ctx context.Context, tx *firestore.Transaction) error {
+		change = RecordedChange{}
+
+		groupDoc, err := tx.Get(groupRef)
+		if err != nil {
+			return err
+		}
+
+		var groupObj internal.UserConnectionGroupInfo
+		if err := groupDoc.DataTo(&groupObj); err != nil {
+			return err
+		}
+
+		current := NewGroupDocument(groupObj)
+		modified := NewGroupDocument(groupObj)
+		if err := modify(&modified); err != nil {
+			return err
+		}
+		if modified.Equal(current) {
+			return nil
+		}
+
+		renamed := modified.GroupName != current.GroupName
+		if renamed {
+			if err := c.checkGroupName(tx, userID, groupID, modified.GroupName); err != nil {
+				return err
+			}
+		}
+
+		var updates []firestore.Update
+		if renamed {
+			updates = append(updates,
+				firestore.Update{Path: "group_name", Value: modified.GroupName},
+				firestore.Update{Path: "group_name_key", Value: groupNameKey(modified.GroupName)})
+		}
+		if modified.GroupPic != current.GroupPic {
+			if err := c.swapGroupPicRefs(tx, current.GroupPic, modified.GroupPic); err != nil {
+				return err
+			}
+			updates = append(updates, firestore.Update{Path: "group_pic", Value: modified.GroupPic})
+		}
+		now := time.Now()
+		updates = append(updates,
+			firestore.Update{Path: "connection_user_ids", Value: modified.connectionUserIds()},
+			firestore.Update{Path: "updated_at", Value: now})
+		if isInteraction(current, modified) {
+			updates = append(updates, firestore.Update{Path: "latest_interaction_time", Value: now})
+		}
+
+		if renamed {
+			if err := c.moveGroupName(tx, userID, groupID, current.GroupName, modified.GroupName); err != nil {
+				return err
+			}
+		}
+		if err := c.writeOutbox(tx, userID, groupID, GroupChangeEvents(current, modified)); err != nil {
+			return err
+		}
+
+		entry, err := c.appendGroupHistory(tx, record.entry(userID, groupID, current, modified))
+		if err != nil {
+			return err
+		}
+
+		if err := tx.Update(groupRef, updates); err != nil {
+			return err
+		}
+		change = RecordedChange{Before: current, After: modified, Entry: entry}
+		return nil
+	})
+	return change, err
+}
@@ -0,0 +1,255 @@
+package database
+
+import (
+	"sort"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"google.golang.org/api/iterator"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"cloud.google.com/go/firestore"
+)
+
+// groupHistoryCollection - Firestore collection of group changes, only ever appended to.
+const groupHistoryCollection = "users_connections_groups_history"
+
+// Group history actions.
+const (
+	GroupCreated  = "created"
+	GroupUpdated  = "updated"
+	GroupDeleted  = "deleted"
+	GroupRestored = "restored"
+	GroupPurged   = "purged"
+	GroupReverted = "reverted"
+)
+
+var errHistoryEntryNotFound = status.Error(codes.NotFound, "row does not found")
+
+// FieldChange - Change of one field of a group. Members also list who was added and removed.
+type FieldChange struct {
+	Field   string      `firestore:"field" json:"field"`
+	Before  interface{} `firestore:"before" json:"before"`
+	After   interface{} `firestore:"after" json:"after"`
+	Added   []string    `firestore:"added,omitempty" json:"added,omitempty"`
+	Removed []string    `firestore:"removed,omitempty" json:"removed,omitempty"`
+}
+
+// GroupHistoryEntry - One change of a group: who made it, when, what changed and the group as it was left.
+type GroupHistoryEntry struct {
+	EntryID string `firestore:"entry_id" json:"entry_id"`
+	UserID  string `firestore:"user_id" json:"user_id"`
+	GroupID string `firestore:"group_id" json:"group_id"`
+	Action  string `firestore:"action" json:"action"`
+	// Principal - claims of the authenticated caller.
+	Principal map[string]interface{} `firestore:"principal" json:"principal"`
+	ChangedAt time.Time              `firestore:"changed_at" json:"changed_at"`
+	Changes   []FieldChange          `firestore:"changes" json:"changes"`
+	// Group - the group after the change, or before it for deletions.
+	Group GroupDocument `firestore:"group" json:"group"`
+	// RevertedFrom - entry whose version a revert went back to.
+	RevertedFrom string `firestore:"reverted_from,omitempty" json:"reverted_from,omitempty"`
+}
+
+// RecordedChange - Versions of a group around a change and the history entry recorded for it in the same
+// transaction. Entry is empty when nothing was written.
+type RecordedChange struct {
+	Before GroupDocument
+	After  GroupDocument
+	Entry  GroupHistoryEntry
+}
+
+// ChangeRecord - How a change is recorded in the history of its group.
+type ChangeRecord struct {
+	Action string
+	// Principal - claims of the caller, nil for background work.
+	Principal map[string]interface{}
+	// RevertedFrom - entry whose version the change goes back to.
+	RevertedFrom string
+}
+
+// entry - History entry recording a change of a group from before to after.
+func (r ChangeRecord) entry(userID string, groupID string, before GroupDocument, after GroupDocument) GroupHistoryEntry {
+	entry := NewGroupHistoryEntry(userID, groupID, r.Action, r.Principal, before, after)
+	entry.RevertedFrom = r.RevertedFrom
+	return entry
+}
+
+// emptyGroupDocument - Version of a group before its creation.
+func emptyGroupDocument() GroupDocument {
+	return GroupDocument{ConnectionUserIds: []string{}}
+}
+
+// NewGroupHistoryEntry - Entry recording a change of a group from before to after by the caller with principal.
+func NewGroupHistoryEntry(userID string, groupID string, action string, principal map[string]interface{}, before GroupDocument, after GroupDocument) GroupHistoryEntry {
+	return GroupHistoryEntry{
+		UserID:    userID,
+		GroupID:   groupID,
+		Action:    action,
+		Principal: principal,
+		ChangedAt: time.Now(),
+		Changes:   DiffGroupDocuments(before, after),
+		Group:     after,
+	}
+}
+
+// DiffGroupDocuments - Fields that differ between two versions of a group.
+func DiffGroupDocuments(before GroupDocument, after GroupDocument) []FieldChange {
+	changes := []FieldChange{}
+
+	if before.GroupName != after.GroupName {
+		changes = append(changes, FieldChange{Field: "group_name", Before: before.GroupName, After: after.GroupName})
+	}
+	if before.GroupPic != after.GroupPic {
+		changes = append(changes, FieldChange{Field: "group_pic", Before: before.GroupPic, After: after.GroupPic})
+	}
+
+	added := missingFrom(after.ConnectionUserIds, before.ConnectionUserIds)
+	removed := missingFrom(before.ConnectionUserIds, after.ConnectionUserIds)
+	if len(added) > 0 || len(removed) > 0 {
+		changes = append(changes, FieldChange{
+			Field:   "connection_user_ids",
+			Before:  before.ConnectionUserIds,
+			After:   after.ConnectionUserIds,
+			Added:   added,
+			Removed: removed,
+		})
+	}
+
+	return changes
+}
+
+// missingFrom - Items of ids that are not in others.
+func missingFrom(ids []string, others []string) []string {
+	known := map[string]bool{}
+	for _, id := range others {
+		known[id] = true
+	}
+
+	missing := []string{}
+	for _, id := range ids {
+		if !known[id] {
+			missing = append(missing, id)
+		}
+	}
+	sort.Strings(missing)
+	return missing
+}
+
+// appendGroupHistory - Within tx, record a change of a group, returning the entry with its ID.
+func (c *Connection) appendGroupHistory(tx *firestore.Transaction, entry GroupHistoryEntry) (GroupHistoryEntry, error) {
+	entryRef := c.Client.Collection(groupHistoryCollection).NewDoc()
+	entry.EntryID = entryRef.ID
+
+	if err := tx.Create(entryRef, entry); err != nil {
+		return GroupHistoryEntry{}, err
+	}
+	return entry, nil
+}
+
+// ListGroupHistory - Changes of a group, most recent first, skipping offset entries and returning at most limit,
+// with the total number of entries.
+func (c *Connection) ListGroupHistory(userID string, groupID string, offset int, limit int) ([]GroupHistoryEntry, int, error) {
+
+	query := c.Client.Collection(groupHistoryCollection).Where("user_id", "==", userID).Where("group_id", "==", groupID)
+
+	counts, err := query.NewAggregationQuery().WithCount("total").Get(c.Context)
+	if err != nil {
+		return nil, 0, err
+	}
+	total := 0
+	if count, ok := counts["total"].(interface{ GetIntegerValue() int64 }); ok {
+		total = int(count.GetIntegerValue())
+	}
+
+	docs := query.OrderBy("changed_at", firestore.Desc).Offset(offset).Limit(limit).Documents(c.Context)
+	defer docs.Stop()
+
+	entries := []GroupHistoryEntry{}
+	for {
+		doc, err := docs.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, 0, err
+		}
+
+		var entry GroupHistoryEntry
+		if err := doc.DataTo(&entry); err != nil {
+			return nil, 0, err
+		}
+		entries = append(entries, entry)
+	}
+
+	return entries, total, nil
+}
+
+// GetGroupHistoryEntry - One recorded change of a group.
+func (c *Connection) GetGroupHistoryEntry(userID string, groupID string, entryID string) (GroupHistoryEntry, error) {
+	var entry GroupHistoryEntry
+
+	doc, err := c.Client.Collection(groupHistoryCollection).Doc(entryID).Get(c.Context)
+	if err != nil {
+		return entry, err
+	}
+	if err := doc.DataTo(&entry); err != nil {
+		return entry, err
+	}
+
+	// Entries of other groups do not exist for this one.
+	if entry.UserID != userID || entry.GroupID != groupID {
+		return GroupHistoryEntry{}, errHistoryEntryNotFound
+	}
+
+	return entry, nil
+}
+
+// WatchGroupChanges - Changes of the groups of a user recorded from since on, skipping the entry afterEntryID
+// already seen by the caller, then every change recorded until ctx is done. The channel is closed when ctx is done
+// or the listener fails, callers resume from the last change they received.
+func (c *Connection) WatchGroupChanges(ctx context.Context, userID string, since time.Time, afterEntryID string) (<-chan GroupHistoryEntry, error) {
+
+	snapshots := c.Client.Collection(groupHistoryCollection).
+		Where("user_id", "==", userID).
+		Where("changed_at", ">=", since).
+		OrderBy("changed_at", firestore.Asc).
+		Snapshots(ctx)
+
+	changes := make(chan GroupHistoryEntry)
+	go func() {
+		defer close(changes)
+		defer snapshots.Stop()
+
+		for {
+			snapshot, err := snapshots.Next()
+			if err != nil {
+				return
+			}
+
+			for _, change := range snapshot.Changes {
+				// History is only appended to.
+				if change.Kind != firestore.DocumentAdded {
+					continue
+				}
+				var entry GroupHistoryEntry
+				if err := change.Doc.DataTo(&entry); err != nil {
+					return
+				}
+				if entry.EntryID == afterEntryID {
+					continue
+				}
+
+				select {
+				case changes <- entry:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+
+	return changes, nil
+}
@@ -0,0 +1,98 @@
+package database
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+
+	"learning/unit-testing/groupname"
+	"learning/unit-testing/internal"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"cloud.google.com/go/firestore"
+)
+
+// groupNamesCollection - Firestore collection indexing the group names of every user. A name is taken while its
+// document exists, so that creates and renames reserve it in the same transaction as the group.
+const groupNamesCollection = "users_connections_group_names"
+
+// GroupNameConflictError - Another group of the user already has the name.
+type GroupNameConflictError struct {
+	GroupName string
+	// GroupID - group holding the name, empty when unknown.
+	GroupID string
+}
+
+// Error - implements error
+func (e *GroupNameConflictError) Error() string {
+	return fmt.Sprintf("group name %q is already in use", e.GroupName)
+}
+
+// GRPCStatus - Conflicts carry the AlreadyExists code, like the other storage errors carry theirs.
+func (e *GroupNameConflictError) GRPCStatus() *status.Status {
+	return status.New(codes.AlreadyExists, e.Error())
+}
+
+// groupNameEntry - Document of a taken group name.
+type groupNameEntry struct {
+	UserID    string `firestore:"user_id"`
+	GroupName string `firestore:"group_name"`
+	GroupID   string `firestore:"group_id"`
+}
+
+// groupNameKey - Form of a group name that must be unique among the groups of a user, stored as group_name_key.
+func groupNameKey(groupName string) string {
+	return groupname.Key(groupName)
+}
+
+func (c *Connection) groupNameRef(userID string, groupName string) *firestore.DocumentRef {
+	sum := sha256.Sum256([]byte(userID + "\x00" + groupNameKey(groupName)))
+	return c.Client.Collection(groupNamesCollection).Doc(hex.EncodeToString(sum[:]))
+}
+
+// checkGroupName - Conflict when a group other than groupID holds the key of groupName. Only reads, so that it can
+// run before the writes of tx. Groups created before the index existed are found by querying their name.
+func (c *Connection) checkGroupName(tx *firestore.Transaction, userID string, groupID string, groupName string) error {
+
+	entryDoc, err := tx.Get(c.groupNameRef(userID, groupName))
+	if err != nil && status.Code(err) != codes.NotFound {
+		return err
+	}
+	if err == nil {
+		var entry groupNameEntry
+		if err := entryDoc.DataTo(&entry); err != nil {
+			return err
+		}
+		if entry.GroupID != groupID {
+			return &GroupNameConflictError{GroupName: groupName, GroupID: entry.GroupID}
+		}
+	}
+
+	query := c.Client.Collection(internal.GetGroupCollectionPath(userID)).Where("group_name", "==", groupName).Limit(2)
+	groupDocs, err := tx.Documents(query).GetAll()
+	if err != nil {
+		return err
+	}
+	for _, groupDoc := range groupDocs {
+		if groupDoc.Ref.ID != groupID {
+			return &GroupNameConflictError{GroupName: groupName, GroupID: groupDoc.Ref.ID}
+		}
+	}
+
+	return nil
+}
+
+// moveGroupName - Release oldName, if any, and take newName for groupID in tx.
+func (c *Connection) moveGroupName(tx *firestore.Transaction, userID string, groupID string, oldName string, newName string) error {
+	if oldName != "" && groupNameKey(oldName) != groupNameKey(newName) {
+		if err := tx.Delete(c.groupNameRef(userID, oldName)); err != nil {
+			return err
+		}
+	}
+	if newName == "" {
+		return nil
+	}
+	return tx.Set(c.groupNameRef(userID, newName), groupNameEntry{UserID: userID, GroupName: newName, GroupID: groupID})
+}
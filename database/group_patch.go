@@ -0,0 +1,48 @@
+package database
+
+import (
+	"learning/unit-testing/mergepatch"
+	"learning/unit-testing/models"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// GroupPatch - Changes to a group following JSON Merge Patch: absent fields are left untouched and
+// null ones are removed. GroupPic holds a picture ID, never picture bytes.
+type GroupPatch struct {
+	GroupName                mergepatch.Field[string] `json:"group_name"`
+	GroupPic                 mergepatch.Field[string] `json:"group_pic"`
+	ConnectionUserIDToAdd    string                   `json:"connection_user_id_to_add"`
+	ConnectionUserIDToRemove string                   `json:"connection_user_id_to_remove"`
+}
+
+// errGroupNameRemoved - groups cannot lose their name.
+var errGroupNameRemoved = status.Error(codes.InvalidArgument, "group_name cannot be removed")
+
+// GroupPatchFromBody - Patch of a body bound to the generated model, where empty fields can only mean absent.
+func GroupPatchFromBody(body *models.UsersConnectionsGroupsPatchRequest) GroupPatch {
+	var patch GroupPatch
+	if body == nil {
+		return patch
+	}
+
+	if body.GroupName != "" {
+		patch.GroupName = mergepatch.Set(body.GroupName)
+	}
+	if body.GroupPic != "" {
+		patch.GroupPic = mergepatch.Set(body.GroupPic)
+	}
+	patch.ConnectionUserIDToAdd = body.ConnectionUserIDToAdd
+	patch.ConnectionUserIDToRemove = body.ConnectionUserIDToRemove
+
+	return patch
+}
+
+// validate - Reject patches no storage can apply.
+func (p GroupPatch) validate() error {
+	if p.GroupName.Null || p.GroupName.Present && p.GroupName.Value == "" {
+		return errGroupNameRemoved
+	}
+	return nil
+}
@@ -0,0 +1,192 @@
+package database
+
+import (
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// groupPicturesCollection - Firestore collection of the reduced group pictures, keyed by picture ID.
+const groupPicturesCollection = "group_pictures"
+
+// groupPicFreeLease - how long a picture claimed for freeing is left to its claimer before it can be claimed again.
+// Claims never overlap within the lease, so a late claimer cannot delete blobs stored again after the free.
+const groupPicFreeLease = 10 * time.Minute
+
+// ErrGroupPicFreeing - The picture is being freed, no group can take a reference on it until it is stored again.
+var ErrGroupPicFreeing = status.Error(codes.FailedPrecondition, "group picture is being freed")
+
+// GroupPictureRef - Reduced group picture shared by every group using it.
+type GroupPictureRef struct {
+	GroupPic string `firestore:"group_pic"`
+	// SourceHash - content hash of the sanitized upload the picture was reduced from.
+	SourceHash string `firestore:"source_hash"`
+	// RefCount - number of groups using the picture, its blobs are freed once it drops to zero.
+	RefCount int `firestore:"ref_count"`
+	// Freeing - set once the picture is claimed for freeing, until its blobs are deleted. The record outlives the
+	// blobs, so that no group takes a reference on a picture whose blobs are being deleted.
+	Freeing   bool      `firestore:"freeing"`
+	ClaimedAt time.Time `firestore:"claimed_at"`
+}
+
+// claimable - Whether the picture can be claimed for freeing at now.
+func (p GroupPictureRef) claimable(now time.Time) bool {
+	return p.RefCount <= 0 && (!p.Freeing || now.Sub(p.ClaimedAt) >= groupPicFreeLease)
+}
+
+// FindGroupPicBySource - Picture ID already reduced from the upload with sourceHash.
+func (c *Connection) FindGroupPicBySource(sourceHash string) (string, error) {
+	docs, err := c.Client.Collection(groupPicturesCollection).Where("source_hash", "==", sourceHash).Limit(1).Documents(c.Context).GetAll()
+	if err != nil {
+		return "", err
+	}
+	if len(docs) == 0 {
+		return "", status.Error(codes.NotFound, "row does not found")
+	}
+
+	var picture GroupPictureRef
+	if err := docs[0].DataTo(&picture); err != nil {
+		return "", err
+	}
+	return picture.GroupPic, nil
+}
+
+// SetGroupPicSource - Remember the upload a picture in use was reduced from, so that later uploads of the same
+// picture reuse it. Pictures no group uses anymore are left alone.
+func (c *Connection) SetGroupPicSource(groupPic string, sourceHash string) error {
+	_, err := c.Client.Collection(groupPicturesCollection).Doc(groupPic).Update(c.Context, []firestore.Update{
+		{Path: "source_hash", Value: sourceHash},
+	})
+	if status.Code(err) == codes.NotFound {
+		return nil
+	}
+	return err
+}
+
+// ClaimUnreferencedGroupPics - Mark up to limit pictures no group uses anymore as being freed and return their IDs,
+// so that their blobs can be deleted. Pictures whose free did not complete are claimed again once their lease ends.
+func (c *Connection) ClaimUnreferencedGroupPics(limit int) ([]string, error) {
+	docs, err := c.Client.Collection(groupPicturesCollection).Where("ref_count", "<=", 0).Limit(limit).Documents(c.Context).GetAll()
+	if err != nil {
+		return nil, err
+	}
+
+	groupPics := []string{}
+	for _, doc := range docs {
+		claimed := false
+		err := c.Client.RunTransaction(c.Context, func(ctx context.Context, tx *firestore.Transaction) error {
+			claimed = false
+
+			snapshot, err := tx.Get(doc.Ref)
+			if status.Code(err) == codes.NotFound {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+
+			var picture GroupPictureRef
+			if err := snapshot.DataTo(&picture); err != nil {
+				return err
+			}
+			// A group may have picked the picture up again since the query, or another instance be freeing it.
+			now := time.Now()
+			if !picture.claimable(now) {
+				return nil
+			}
+
+			claimed = true
+			return tx.Update(doc.Ref, []firestore.Update{
+				{Path: "freeing", Value: true},
+				{Path: "claimed_at", Value: now},
+			})
+		})
+		if err != nil {
+			return groupPics, err
+		}
+		if claimed {
+			groupPics = append(groupPics, doc.Ref.ID)
+		}
+	}
+
+	return groupPics, nil
+}
+
+// ForgetFreedGroupPic - Drop the record of a claimed picture once its blobs are deleted.
+func (c *Connection) ForgetFreedGroupPic(groupPic string) error {
+	ref := c.Client.Collection(groupPicturesCollection).Doc(groupPic)
+
+	return c.Client.RunTransaction(c.Context, func(ctx context.Context, tx *firestore.Transaction) error {
+		snapshot, err := tx.Get(ref)
+		if status.Code(err) == codes.NotFound {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		var picture GroupPictureRef
+		if err := snapshot.DataTo(&picture); err != nil {
+			return err
+		}
+		if !picture.Freeing {
+			return nil
+		}
+		return tx.Delete(ref)
+	})
+}
+
+// swapGroupPicRefs - Within tx, move one reference from the picture oldPic to newPic. Taking a reference on a
+// picture being freed fails with ErrGroupPicFreeing. Pictures stored before reference counting, or freed
+// completely, get their record on first use. All reads happen before the writes, as Firestore transactions require.
+func (c *Connection) swapGroupPicRefs(tx *firestore.Transaction, oldPic string, newPic string) error {
+	if oldPic == newPic {
+		return nil
+	}
+
+	var oldRef, newRef *firestore.DocumentRef
+	var oldExists, newExists bool
+	if oldPic != "" {
+		oldRef = c.Client.Collection(groupPicturesCollection).Doc(oldPic)
+		_, err := tx.Get(oldRef)
+		if err != nil && status.Code(err) != codes.NotFound {
+			return err
+		}
+		oldExists = err == nil
+	}
+	if newPic != "" {
+		newRef = c.Client.Collection(groupPicturesCollection).Doc(newPic)
+		snapshot, err := tx.Get(newRef)
+		if err != nil && status.Code(err) != codes.NotFound {
+			return err
+		}
+		newExists = err == nil
+
+		if newExists {
+			var picture GroupPictureRef
+			if err := snapshot.DataTo(&picture); err != nil {
+				return err
+			}
+			if picture.Freeing {
+				return ErrGroupPicFreeing
+			}
+		}
+	}
+
+	if oldExists {
+		if err := tx.Update(oldRef, []firestore.Update{{Path: "ref_count", Value: firestore.Increment(-1)}}); err != nil {
+			return err
+		}
+	}
+	if newRef != nil {
+		if newExists {
+			return tx.Update(newRef, []firestore.Update{{Path: "ref_count", Value: firestore.Increment(1)}})
+		}
+		return tx.Set(newRef, GroupPictureRef{GroupPic: newPic, RefCount: 1})
+	}
+
+	return nil
+}
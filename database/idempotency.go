@@ -0,0 +1,86 @@
+package database
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"time"
+
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"cloud.google.com/go/firestore"
+)
+
+// idempotencyKeysCollection - Firestore collection of idempotency keys. A TTL policy on expires_at lets Firestore
+// delete expired keys, which are otherwise ignored.
+const idempotencyKeysCollection = "idempotency_keys"
+
+// IdempotencyRecord - Request made with an idempotency key, and its response once completed.
+type IdempotencyRecord struct {
+	UserID string `firestore:"user_id"`
+	Key    string `firestore:"key"`
+	// RequestHash - hash of the request, retries must send the same one.
+	RequestHash string    `firestore:"request_hash"`
+	Completed   bool      `firestore:"completed"`
+	StatusCode  int       `firestore:"status_code"`
+	ContentType string    `firestore:"content_type"`
+	Response    []byte    `firestore:"response"`
+	CreatedAt   time.Time `firestore:"created_at"`
+	ExpiresAt   time.Time `firestore:"expires_at"`
+}
+
+// idempotencyDocID - Document ID of a key, keys are scoped to their user.
+func idempotencyDocID(userID string, key string) string {
+	sum := sha256.Sum256([]byte(userID + "\x00" + key))
+	return hex.EncodeToString(sum[:])
+}
+
+// ReserveIdempotencyKey - Store record unless its key is already in use and not expired.
+// Returns the record in place and whether it is the one just reserved.
+func (c *Connection) ReserveIdempotencyKey(record IdempotencyRecord) (IdempotencyRecord, bool, error) {
+
+	keyRef := c.Client.Collection(idempotencyKeysCollection).Doc(idempotencyDocID(record.UserID, record.Key))
+
+	existing := record
+	reserved := false
+	err := c.Client.RunTransaction(c.Context, func(ctx context.Context, tx *firestore.Transaction) error {
+		existing, reserved = record, false
+
+		doc, err := tx.Get(keyRef)
+		if err != nil && status.Code(err) != codes.NotFound {
+			return err
+		}
+		if err == nil {
+			if err := doc.DataTo(&existing); err != nil {
+				return err
+			}
+			if existing.ExpiresAt.After(record.CreatedAt) {
+				return nil
+			}
+			existing = record
+		}
+
+		reserved = true
+		return tx.Set(keyRef, record)
+	})
+
+	return existing, reserved, err
+}
+
+// CompleteIdempotencyKey - Keep the response of the request reserving the key, to be replayed to its retries.
+func (c *Connection) CompleteIdempotencyKey(userID string, key string, statusCode int, contentType string, response []byte) error {
+	_, err := c.Client.Collection(idempotencyKeysCollection).Doc(idempotencyDocID(userID, key)).Update(c.Context, []firestore.Update{
+		{Path: "completed", Value: true},
+		{Path: "status_code", Value: statusCode},
+		{Path: "content_type", Value: contentType},
+		{Path: "response", Value: response},
+	})
+	return err
+}
+
+// ReleaseIdempotencyKey - Forget a key whose request failed, so that a retry runs it again.
+func (c *Connection) ReleaseIdempotencyKey(userID string, key string) error {
+	_, err := c.Client.Collection(idempotencyKeysCollection).Doc(idempotencyDocID(userID, key)).Delete(c.Context)
+	return err
+}
@@ -0,0 +1,55 @@
+package database
+
+import (
+	"time"
+
+	"learning/unit-testing/internal"
+
+	"golang.org/x/net/context"
+
+	"cloud.google.com/go/firestore"
+)
+
+// isInteraction - Whether a change of a group is an interaction with it: a rename or a change of its members.
+// Picture changes are not.
+func isInteraction(before GroupDocument, after GroupDocument) bool {
+	return before.GroupName != after.GroupName ||
+		len(missingFrom(after.ConnectionUserIds, before.ConnectionUserIds)) > 0 ||
+		len(missingFrom(before.ConnectionUserIds, after.ConnectionUserIds)) > 0
+}
+
+// RecordUserConnectionGroupInteraction - Move the latest interaction time of a group to at. The time never moves
+// back, interactions recorded out of order leave it on the latest one.
+func (c *Connection) RecordUserConnectionGroupInteraction(userID string, groupID string, at time.Time) error {
+
+	groupRef := c.Client.Doc(internal.GetGroupDocPath(userID, groupID))
+
+	return c.Client.RunTransaction(c.Context, func(ctx context.Context, tx *firestore.Transaction) error {
+
+		groupDoc, err := tx.Get(groupRef)
+		if err != nil {
+			return err
+		}
+
+		var groupObj internal.UserConnectionGroupInfo
+		if err := groupDoc.DataTo(&groupObj); err != nil {
+			return err
+		}
+
+		if !at.After(groupObj.LatestInteractionTime) {
+			return nil
+		}
+
+		updates := []firestore.Update{
+			{
+				Path:  "latest_interaction_time",
+				Value: at,
+			},
+			{
+				Path:  "updated_at",
+				Value: time.Now(),
+			},
+		}
+		return tx.Update(groupRef, updates)
+	})
+}
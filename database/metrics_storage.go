@@ -0,0 +1,301 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"learning/unit-testing/internal"
+	"learning/unit-testing/metrics"
+	"learning/unit-testing/models"
+	"learning/unit-testing/restapi/operations/connections"
+
+	"google.golang.org/grpc/status"
+)
+
+// MetricsStorage - Storage decorator recording latency and result codes of every call.
+type MetricsStorage struct {
+	Storage Storage
+}
+
+// NewMetricsStorage - Wrap a Storage so that every call is measured.
+func NewMetricsStorage(storage Storage) Storage {
+	return &MetricsStorage{Storage: storage}
+}
+
+// WithContext - Bind the wrapped storage to ctx when it supports it.
+func (m *MetricsStorage) WithContext(ctx context.Context) Storage {
+	if binder, ok := m.Storage.(contextBinder); ok {
+		return &MetricsStorage{Storage: binder.WithContext(ctx)}
+	}
+	return m
+}
+
+// observe - Record the duration and gRPC status code of a storage call.
+func observe(method string, start time.Time, err error) {
+	metrics.StorageOperationDuration.WithLabelValues(method).Observe(time.Since(start).Seconds())
+	metrics.StorageOperationsTotal.WithLabelValues(method, status.Code(err).String()).Inc()
+}
+
+// GetUserConnectionGroupByName - function
+func (m *MetricsStorage) GetUserConnectionGroupByName(userID string, groupName string) (group internal.UserConnectionGroupInfo, err error) {
+	defer func(start time.Time) { observe("GetUserConnectionGroupByName", start, err) }(time.Now())
+	return m.Storage.GetUserConnectionGroupByName(userID, groupName)
+}
+
+// GetUserConnectionGroupByGroupID - function
+func (m *MetricsStorage) GetUserConnectionGroupByGroupID(userID string, groupID string) (group internal.UserConnectionGroupInfo, err error) {
+	defer func(start time.Time) { observe("GetUserConnectionGroupByGroupID", start, err) }(time.Now())
+	return m.Storage.GetUserConnectionGroupByGroupID(userID, groupID)
+}
+
+// CreateUserConnectionGroup - function
+func (m *MetricsStorage) CreateUserConnectionGroup(userID string, group internal.UserConnectionGroupInfo, principal map[string]interface{}) (groupID string, err error) {
+	defer func(start time.Time) { observe("CreateUserConnectionGroup", start, err) }(time.Now())
+	return m.Storage.CreateUserConnectionGroup(userID, group, principal)
+}
+
+// GetPaginatedUserConnectionGroup - function
+func (m *MetricsStorage) GetPaginatedUserConnectionGroup(params connections.UsersConnectionsGroupsByUserIDGetParams) (groupsList []*models.Group, paginationMeta *models.PaginationData, err error) {
+	defer func(start time.Time) { observe("GetPaginatedUserConnectionGroup", start, err) }(time.Now())
+	return m.Storage.GetPaginatedUserConnectionGroup(params)
+}
+
+// UpdateUserConnectionGroup - function
+func (m *MetricsStorage) UpdateUserConnectionGroup(userID string, groupID string, patch GroupPatch, principal map[string]interface{}) (change RecordedChange, err error) {
+	defer func(start time.Time) { observe("UpdateUserConnectionGroup", start, err) }(time.Now())
+	return m.Storage.UpdateUserConnectionGroup(userID, groupID, patch, principal)
+}
+
+// ModifyUserConnectionGroup - function
+func (m *MetricsStorage) ModifyUserConnectionGroup(userID string, groupID string, record ChangeRecord, modify func(group *GroupDocument) error) (change RecordedChange, err error) {
+	defer func(start time.Time) { observe("ModifyUserConnectionGroup", start, err) }(time.Now())
+	return m.Storage.ModifyUserConnectionGroup(userID, groupID, record, modify)
+}
+
+// DeleteUserConnectionGroup - function
+func (m *MetricsStorage) DeleteUserConnectionGroup(params connections.UsersConnectionsGroupsByUserIDAndGroupIDDeleteParams, principal map[string]interface{}) (err error) {
+	defer func(start time.Time) { observe("DeleteUserConnectionGroup", start, err) }(time.Now())
+	return m.Storage.DeleteUserConnectionGroup(params, principal)
+}
+
+// SetUserConnectionGroupPic - function
+func (m *MetricsStorage) SetUserConnectionGroupPic(userID string, groupID string, groupPic string, principal map[string]interface{}) (change RecordedChange, err error) {
+	defer func(start time.Time) { observe("SetUserConnectionGroupPic", start, err) }(time.Now())
+	return m.Storage.SetUserConnectionGroupPic(userID, groupID, groupPic, principal)
+}
+
+// Ping - function
+func (m *MetricsStorage) Ping(ctx context.Context) (err error) {
+	defer func(start time.Time) { observe("Ping", start, err) }(time.Now())
+	return m.Storage.Ping(ctx)
+}
+
+// SetUserConnectionGroupPicStatus - function
+func (m *MetricsStorage) SetUserConnectionGroupPicStatus(userID string, groupID string, pictureStatus string, pictureError string) (err error) {
+	defer func(start time.Time) { observe("SetUserConnectionGroupPicStatus", start, err) }(time.Now())
+	return m.Storage.SetUserConnectionGroupPicStatus(userID, groupID, pictureStatus, pictureError)
+}
+
+// RecordUserConnectionGroupInteraction - function
+func (m *MetricsStorage) RecordUserConnectionGroupInteraction(userID string, groupID string, at time.Time) (err error) {
+	defer func(start time.Time) { observe("RecordUserConnectionGroupInteraction", start, err) }(time.Now())
+	return m.Storage.RecordUserConnectionGroupInteraction(userID, groupID, at)
+}
+
+// EnqueuePictureJob - function
+func (m *MetricsStorage) EnqueuePictureJob(job PictureJob) (jobID string, err error) {
+	defer func(start time.Time) { observe("EnqueuePictureJob", start, err) }(time.Now())
+	return m.Storage.EnqueuePictureJob(job)
+}
+
+// ClaimPictureJobs - function
+func (m *MetricsStorage) ClaimPictureJobs(now time.Time, lease time.Duration, limit int) (jobs []PictureJob, err error) {
+	defer func(start time.Time) { observe("ClaimPictureJobs", start, err) }(time.Now())
+	return m.Storage.ClaimPictureJobs(now, lease, limit)
+}
+
+// RetryPictureJob - function
+func (m *MetricsStorage) RetryPictureJob(jobID string, availableAt time.Time, lastError string) (err error) {
+	defer func(start time.Time) { observe("RetryPictureJob", start, err) }(time.Now())
+	return m.Storage.RetryPictureJob(jobID, availableAt, lastError)
+}
+
+// FailPictureJob - function
+func (m *MetricsStorage) FailPictureJob(jobID string, lastError string) (err error) {
+	defer func(start time.Time) { observe("FailPictureJob", start, err) }(time.Now())
+	return m.Storage.FailPictureJob(jobID, lastError)
+}
+
+// CompletePictureJob - function
+func (m *MetricsStorage) CompletePictureJob(jobID string) (err error) {
+	defer func(start time.Time) { observe("CompletePictureJob", start, err) }(time.Now())
+	return m.Storage.CompletePictureJob(jobID)
+}
+
+// FindGroupPicBySource - function
+func (m *MetricsStorage) FindGroupPicBySource(sourceHash string) (groupPic string, err error) {
+	defer func(start time.Time) { observe("FindGroupPicBySource", start, err) }(time.Now())
+	return m.Storage.FindGroupPicBySource(sourceHash)
+}
+
+// SetGroupPicSource - function
+func (m *MetricsStorage) SetGroupPicSource(groupPic string, sourceHash string) (err error) {
+	defer func(start time.Time) { observe("SetGroupPicSource", start, err) }(time.Now())
+	return m.Storage.SetGroupPicSource(groupPic, sourceHash)
+}
+
+// ClaimUnreferencedGroupPics - function
+func (m *MetricsStorage) ClaimUnreferencedGroupPics(limit int) (groupPics []string, err error) {
+	defer func(start time.Time) { observe("ClaimUnreferencedGroupPics", start, err) }(time.Now())
+	return m.Storage.ClaimUnreferencedGroupPics(limit)
+}
+
+// ForgetFreedGroupPic - function
+func (m *MetricsStorage) ForgetFreedGroupPic(groupPic string) (err error) {
+	defer func(start time.Time) { observe("ForgetFreedGroupPic", start, err) }(time.Now())
+	return m.Storage.ForgetFreedGroupPic(groupPic)
+}
+
+// ReserveIdempotencyKey - function
+func (m *MetricsStorage) ReserveIdempotencyKey(record IdempotencyRecord) (existing IdempotencyRecord, reserved bool, err error) {
+	defer func(start time.Time) { observe("ReserveIdempotencyKey", start, err) }(time.Now())
+	return m.Storage.ReserveIdempotencyKey(record)
+}
+
+// CompleteIdempotencyKey - function
+func (m *MetricsStorage) CompleteIdempotencyKey(userID string, key string, statusCode int, contentType string, response []byte) (err error) {
+	defer func(start time.Time) { observe("CompleteIdempotencyKey", start, err) }(time.Now())
+	return m.Storage.CompleteIdempotencyKey(userID, key, statusCode, contentType, response)
+}
+
+// ReleaseIdempotencyKey - function
+func (m *MetricsStorage) ReleaseIdempotencyKey(userID string, key string) (err error) {
+	defer func(start time.Time) { observe("ReleaseIdempotencyKey", start, err) }(time.Now())
+	return m.Storage.ReleaseIdempotencyKey(userID, key)
+}
+
+// ListTrashedUserConnectionGroups - function
+func (m *MetricsStorage) ListTrashedUserConnectionGroups(userID string) (trashed []TrashedGroup, err error) {
+	defer func(start time.Time) { observe("ListTrashedUserConnectionGroups", start, err) }(time.Now())
+	return m.Storage.ListTrashedUserConnectionGroups(userID)
+}
+
+// RestoreUserConnectionGroup - function
+func (m *MetricsStorage) RestoreUserConnectionGroup(userID string, groupID string, principal map[string]interface{}) (err error) {
+	defer func(start time.Time) { observe("RestoreUserConnectionGroup", start, err) }(time.Now())
+	return m.Storage.RestoreUserConnectionGroup(userID, groupID, principal)
+}
+
+// PurgeUserConnectionGroup - function
+func (m *MetricsStorage) PurgeUserConnectionGroup(userID string, groupID string, principal map[string]interface{}) (err error) {
+	defer func(start time.Time) { observe("PurgeUserConnectionGroup", start, err) }(time.Now())
+	return m.Storage.PurgeUserConnectionGroup(userID, groupID, principal)
+}
+
+// PurgeTrashedUserConnectionGroups - function
+func (m *MetricsStorage) PurgeTrashedUserConnectionGroups(deletedBefore time.Time, limit int) (purged []TrashedGroup, err error) {
+	defer func(start time.Time) { observe("PurgeTrashedUserConnectionGroups", start, err) }(time.Now())
+	return m.Storage.PurgeTrashedUserConnectionGroups(deletedBefore, limit)
+}
+
+// SyncUserConnectionGroups - function
+func (m *MetricsStorage) SyncUserConnectionGroups(userID string, after SyncCursor, until time.Time, limit int) (changes []GroupSyncChange, err error) {
+	defer func(start time.Time) { observe("SyncUserConnectionGroups", start, err) }(time.Now())
+	return m.Storage.SyncUserConnectionGroups(userID, after, until, limit)
+}
+
+// ListGroupHistory - function
+func (m *MetricsStorage) ListGroupHistory(userID string, groupID string, offset int, limit int) (entries []GroupHistoryEntry, total int, err error) {
+	defer func(start time.Time) { observe("ListGroupHistory", start, err) }(time.Now())
+	return m.Storage.ListGroupHistory(userID, groupID, offset, limit)
+}
+
+// GetGroupHistoryEntry - function
+func (m *MetricsStorage) GetGroupHistoryEntry(userID string, groupID string, entryID string) (entry GroupHistoryEntry, err error) {
+	defer func(start time.Time) { observe("GetGroupHistoryEntry", start, err) }(time.Now())
+	return m.Storage.GetGroupHistoryEntry(userID, groupID, entryID)
+}
+
+// WatchGroupChanges - function
+func (m *MetricsStorage) WatchGroupChanges(ctx context.Context, userID string, since time.Time, afterEntryID string) (changes <-chan GroupHistoryEntry, err error) {
+	defer func(start time.Time) { observe("WatchGroupChanges", start, err) }(time.Now())
+	return m.Storage.WatchGroupChanges(ctx, userID, since, afterEntryID)
+}
+
+// ClaimOutboxEvents - function
+func (m *MetricsStorage) ClaimOutboxEvents(now time.Time, lease time.Duration, limit int) (claimed []OutboxEvent, err error) {
+	defer func(start time.Time) { observe("ClaimOutboxEvents", start, err) }(time.Now())
+	return m.Storage.ClaimOutboxEvents(now, lease, limit)
+}
+
+// RetryOutboxEvent - function
+func (m *MetricsStorage) RetryOutboxEvent(eventID string, availableAt time.Time, lastError string) (err error) {
+	defer func(start time.Time) { observe("RetryOutboxEvent", start, err) }(time.Now())
+	return m.Storage.RetryOutboxEvent(eventID, availableAt, lastError)
+}
+
+// FailOutboxEvent - function
+func (m *MetricsStorage) FailOutboxEvent(eventID string, lastError string) (err error) {
+	defer func(start time.Time) { observe("FailOutboxEvent", start, err) }(time.Now())
+	return m.Storage.FailOutboxEvent(eventID, lastError)
+}
+
+// CompleteOutboxEvent - function
+func (m *MetricsStorage) CompleteOutboxEvent(eventID string) (err error) {
+	defer func(start time.Time) { observe("CompleteOutboxEvent", start, err) }(time.Now())
+	return m.Storage.CompleteOutboxEvent(eventID)
+}
+
+// CreateWebhookSubscription - function
+func (m *MetricsStorage) CreateWebhookSubscription(subscription WebhookSubscription) (subscriptionID string, err error) {
+	defer func(start time.Time) { observe("CreateWebhookSubscription", start, err) }(time.Now())
+	return m.Storage.CreateWebhookSubscription(subscription)
+}
+
+// ListWebhookSubscriptions - function
+func (m *MetricsStorage) ListWebhookSubscriptions(userID string) (subscriptions []WebhookSubscription, err error) {
+	defer func(start time.Time) { observe("ListWebhookSubscriptions", start, err) }(time.Now())
+	return m.Storage.ListWebhookSubscriptions(userID)
+}
+
+// GetWebhookSubscription - function
+func (m *MetricsStorage) GetWebhookSubscription(userID string, subscriptionID string) (subscription WebhookSubscription, err error) {
+	defer func(start time.Time) { observe("GetWebhookSubscription", start, err) }(time.Now())
+	return m.Storage.GetWebhookSubscription(userID, subscriptionID)
+}
+
+// DeleteWebhookSubscription - function
+func (m *MetricsStorage) DeleteWebhookSubscription(userID string, subscriptionID string) (err error) {
+	defer func(start time.Time) { observe("DeleteWebhookSubscription", start, err) }(time.Now())
+	return m.Storage.DeleteWebhookSubscription(userID, subscriptionID)
+}
+
+// EnqueueWebhookDeliveries - function
+func (m *MetricsStorage) EnqueueWebhookDeliveries(deliveries []WebhookDelivery) (err error) {
+	defer func(start time.Time) { observe("EnqueueWebhookDeliveries", start, err) }(time.Now())
+	return m.Storage.EnqueueWebhookDeliveries(deliveries)
+}
+
+// ClaimWebhookDeliveries - function
+func (m *MetricsStorage) ClaimWebhookDeliveries(now time.Time, lease time.Duration, limit int) (claimed []WebhookDelivery, err error) {
+	defer func(start time.Time) { observe("ClaimWebhookDeliveries", start, err) }(time.Now())
+	return m.Storage.ClaimWebhookDeliveries(now, lease, limit)
+}
+
+// RecordWebhookAttempt - function
+func (m *MetricsStorage) RecordWebhookAttempt(deliveryID string, attempt WebhookAttempt, deliveryStatus string, availableAt time.Time) (err error) {
+	defer func(start time.Time) { observe("RecordWebhookAttempt", start, err) }(time.Now())
+	return m.Storage.RecordWebhookAttempt(deliveryID, attempt, deliveryStatus, availableAt)
+}
+
+// ListWebhookDeliveries - function
+func (m *MetricsStorage) ListWebhookDeliveries(userID string, subscriptionID string, deliveryStatus string, offset int, limit int) (deliveries []WebhookDelivery, total int, err error) {
+	defer func(start time.Time) { observe("ListWebhookDeliveries", start, err) }(time.Now())
+	return m.Storage.ListWebhookDeliveries(userID, subscriptionID, deliveryStatus, offset, limit)
+}
+
+// RedeliverWebhookDelivery - function
+func (m *MetricsStorage) RedeliverWebhookDelivery(userID string, subscriptionID string, deliveryID string, availableAt time.Time) (err error) {
+	defer func(start time.Time) { observe("RedeliverWebhookDelivery", start, err) }(time.Now())
+	return m.Storage.RedeliverWebhookDelivery(userID, subscriptionID, deliveryID, availableAt)
+}
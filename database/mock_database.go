@@ -1,9 +1,13 @@
 package database
 
 import (
+	"context"
 	"fmt"
 	"sync"
+	"time"
 
+	"learning/unit-testing/config"
+	"learning/unit-testing/events"
 	"learning/unit-testing/models"
 	"learning/unit-testing/restapi/operations/connections"
 
@@ -13,12 +17,45 @@ import (
 
 // MockConnection - handler
 type MockConnection struct {
+	groupsMx             sync.RWMutex
 	userConnectionGroups map[string][]internal.UserConnectionGroupInfo
+	groupCounts          map[string]int
+	trash                map[string]TrashedGroup
+	tombstones           map[string]GroupTombstone
+
+	jobsMx      sync.Mutex
+	pictureJobs []PictureJob
+
+	picsMx    sync.Mutex
+	groupPics map[string]*GroupPictureRef
+
+	keysMx          sync.Mutex
+	idempotencyKeys map[string]IdempotencyRecord
+
+	historyMx       sync.Mutex
+	groupHistory    []GroupHistoryEntry
+	historyWatchers map[*historyWatcher]bool
+
+	// outboxMx - taken while holding groupsMx, never the other way around.
+	outboxMx    sync.Mutex
+	outbox      []OutboxEvent
+	outboxCount int
+
+	webhooksMx           sync.Mutex
+	webhookSubscriptions []WebhookSubscription
+	webhookDeliveries    []WebhookDelivery
 }
 
 // NewMockConnection - Initialize Memory Storage
 func NewMockConnection() Storage {
-	return &MockConnection{userConnectionGroups: make(map[string][]internal.UserConnectionGroupInfo)}
+	return &MockConnection{
+		userConnectionGroups: make(map[string][]internal.UserConnectionGroupInfo),
+		groupCounts:          make(map[string]int),
+		trash:                make(map[string]TrashedGroup),
+		tombstones:           make(map[string]GroupTombstone),
+		groupPics:            make(map[string]*GroupPictureRef),
+		idempotencyKeys:      make(map[string]IdempotencyRecord),
+	}
 }
 
 // GenerateUUID -
@@ -29,95 +66,85 @@ func GenerateUUID() string {
 
 // GetUserConnectionGroupByName - function
 func (m *MockConnection) GetUserConnectionGroupByName(userID string, groupName string) (internal.UserConnectionGroupInfo, error) {
+	m.groupsMx.RLock()
+	defer m.groupsMx.RUnlock()
 
-	errNotFound := status.Error(codes.NotFound, "row does not found")
-
-	var group internal.UserConnectionGroupInfo
-	var mx sync.RWMutex
-
-	mx.RLock()
-
-	groups, ok := m.userConnectionGroups[userID]
-	if !ok {
-		return group, errNotFound
-	}
-
-	if len(groups) == 0 {
-		return group, errNotFound
-	}
-
-	for _, g := range groups {
-		if g.GroupName == groupName {
-			group = g
-			break
-		}
-	}
-
-	if group.GroupID == "" {
-		return group, errNotFound
-	}
-
-	mx.RUnlock()
-
-	return group, nil
+	return m.findGroupByName(userID, groupName)
 }
 
 // GetUserConnectionGroupByGroupID - function
 func (m *MockConnection) GetUserConnectionGroupByGroupID(userID string, groupID string) (internal.UserConnectionGroupInfo, error) {
+	m.groupsMx.RLock()
+	defer m.groupsMx.RUnlock()
 
-	errNotFound := status.Error(codes.NotFound, "row does not found")
-	errCollectionNotExists := status.Error(codes.Internal, "something went wrong")
+	group, _, err := m.findGroup(userID, groupID)
+	return group, err
+}
 
-	var group internal.UserConnectionGroupInfo
-	var mx sync.RWMutex
+func (m *MockConnection) findGroupByName(userID string, groupName string) (internal.UserConnectionGroupInfo, error) {
+	key := groupNameKey(groupName)
+	for _, g := range m.userConnectionGroups[userID] {
+		if g.GroupNameKey == key {
+			return g, nil
+		}
+	}
 
-	mx.RLock()
+	return internal.UserConnectionGroupInfo{}, status.Error(codes.NotFound, "row does not found")
+}
 
+// findGroup - Group and its index in the groups of the user.
+func (m *MockConnection) findGroup(userID string, groupID string) (internal.UserConnectionGroupInfo, int, error) {
 	groups, ok := m.userConnectionGroups[userID]
 	if !ok {
-		return group, errCollectionNotExists
-	}
-
-	if len(groups) == 0 {
-		return group, errNotFound
+		return internal.UserConnectionGroupInfo{}, -1, status.Error(codes.Internal, "something went wrong")
 	}
 
-	for _, g := range groups {
+	for index, g := range groups {
 		if g.GroupID == groupID {
-			group = g
-			break
+			return g, index, nil
 		}
 	}
 
-	if group.GroupID == "" {
-		return group, errNotFound
-	}
-
-	mx.RUnlock()
+	return internal.UserConnectionGroupInfo{}, -1, status.Error(codes.NotFound, "row does not found")
+}
 
-	return group, nil
+// checkGroupName - Conflict when another group of the user has groupName.
+func (m *MockConnection) checkGroupName(userID string, groupID string, groupName string) error {
+	existing, err := m.findGroupByName(userID, groupName)
+	if err == nil && existing.GroupID != groupID {
+		return &GroupNameConflictError{GroupName: groupName, GroupID: existing.GroupID}
+	}
+	return nil
 }
 
 // CreateUserConnectionGroup - function
-func (m *MockConnection) CreateUserConnectionGroup(userID string, group internal.UserConnectionGroupInfo) (string, error) {
+func (m *MockConnection) CreateUserConnectionGroup(userID string, group internal.UserConnectionGroupInfo, principal map[string]interface{}) (string, error) {
+	m.groupsMx.Lock()
+	defer m.groupsMx.Unlock()
 
-	var mx sync.RWMutex
-	mx.Lock()
+	if err := m.checkGroupName(userID, "", group.GroupName); err != nil {
+		return "", err
+	}
 
 	// group.GroupID = GenerateUUID()
-
-	if groups, ok := m.userConnectionGroups[userID]; ok {
-		group.GroupID = fmt.Sprintf("group_id_%d", len(groups)+1)
-		groups = append(groups, group)
-		m.userConnectionGroups[userID] = groups
-	} else {
-		group.GroupID = fmt.Sprintf("group_id_%d", 1)
-		connectionGroups := []internal.UserConnectionGroupInfo{}
-		connectionGroups = append(connectionGroups, group)
-		m.userConnectionGroups[userID] = connectionGroups
+	group.GroupNameKey = groupNameKey(group.GroupName)
+	group.CreatedAt = time.Now()
+	group.UpdatedAt = group.CreatedAt
+	if group.LatestInteractionTime.IsZero() {
+		group.LatestInteractionTime = group.CreatedAt
 	}
 
-	mx.Unlock()
+	// IDs are never reused, trashed groups keep theirs.
+	m.groupCounts[userID]++
+	group.GroupID = fmt.Sprintf("group_id_%d", m.groupCounts[userID])
+	m.userConnectionGroups[userID] = append(m.userConnectionGroups[userID], group)
+
+	if err := m.writeOutbox(userID, group.GroupID, []events.Event{GroupCreatedEvent(NewGroupDocument(group))}); err != nil {
+		return "", err
+	}
+	if _, err := m.appendGroupHistory(NewGroupHistoryEntry(userID, group.GroupID, GroupCreated, principal, emptyGroupDocument(), NewGroupDocument(group))); err != nil {
+		return "", err
+	}
 
 	return group.GroupID, nil
 }
@@ -128,22 +155,36 @@ func (m *MockConnection) GetPaginatedUserConnectionGroup(params connections.User
 	errNotFound := status.Error(codes.NotFound, "row does not found")
 	// errCollectionNotExists := status.Error(codes.Internal, "something went wrong")
 
-	var mx sync.RWMutex
-	mx.RLock()
-
-	groups, ok := m.userConnectionGroups[params.UserID]
-	if !ok {
-		return groupsList, paginationMeta, errNotFound
+	timeRanges, err := groupTimeRanges(params)
+	if err != nil {
+		return groupsList, paginationMeta, err
 	}
 
 	// Create the paginated query.
 	var limit int32
 	if internal.IsZeroOfUnderlyingType(params.Limit) {
-		limit = internal.DefaultConnectionsQueryLimit
+		limit = config.Get().Pagination.DefaultLimit
 	} else {
 		limit = *params.Limit
 	}
 
+	paginatedQuery := PaginatedQuery{CollectionName: "users_connections_groups"}
+	paginatedQuery.SetPaginatedQuery(params.Offset, &limit, params.OrderBy, params.Order)
+	if err := paginatedQuery.ValidatePage(); err != nil {
+		return groupsList, paginationMeta, err
+	}
+
+	m.groupsMx.RLock()
+	defer m.groupsMx.RUnlock()
+
+	groups, ok := m.userConnectionGroups[params.UserID]
+	if !ok {
+		return groupsList, paginationMeta, errNotFound
+	}
+
+	// Filtering and sorting work on a copy, readers share the stored groups.
+	groups = append([]internal.UserConnectionGroupInfo(nil), groups...)
+
 	if !internal.IsZeroOfUnderlyingType(params.GroupName) {
 		var groupsF []internal.UserConnectionGroupInfo
 		for _, g := range groups {
@@ -155,14 +196,13 @@ func (m *MockConnection) GetPaginatedUserConnectionGroup(params connections.User
 		groups = groupsF
 	}
 
-	paginatedQuery := PaginatedQuery{CollectionName: "users_connections_groups", UserConnectionGroups: groups}
+	paginatedQuery.UserConnectionGroups = groups
 
-	// Set time interaction filter.
-	if err := paginatedQuery.AddTimeSetFilterToQuery("latest_interaction_time", params.LatestInteractionTimeAfter, params.LatestInteractionTimeBefore); err != nil {
-		return groupsList, paginationMeta, err
+	// Set the time range filters.
+	for _, timeRange := range timeRanges {
+		paginatedQuery.AddTimeSetFilterToQuery(timeRange)
 	}
 
-	paginatedQuery.SetPaginatedQuery(params.Offset, &limit, params.OrderBy, params.Order)
 	paginatedQuery.SortPaginatedQuery()
 	paginatedQuery.LimitPaginatedQuery()
 
@@ -173,47 +213,55 @@ func (m *MockConnection) GetPaginatedUserConnectionGroup(params connections.User
 	}
 
 	for _, groupInfo := range paginatedQuery.UserConnectionGroups {
-		groupData := groupInfo.TransformToResponseGroup()
+		groupData := ToResponseGroup(groupInfo)
 		groupsList = append(groupsList, groupData)
 	}
 
-	mx.RUnlock()
-
 	return groupsList, paginationMeta, nil
 }
 
 // UpdateUserConnectionGroup - function
-func (m *MockConnection) UpdateUserConnectionGroup(params connections.UsersConnectionsGroupsByUserIDAndGroupIDPatchParams) error {
+func (m *MockConnection) UpdateUserConnectionGroup(userID string, groupID string, patch GroupPatch, principal map[string]interface{}) (RecordedChange, error) {
+
+	if err := patch.validate(); err != nil {
+		return RecordedChange{}, err
+	}
+
+	m.groupsMx.Lock()
+	defer m.groupsMx.Unlock()
 
-	var mx sync.RWMutex
-	mx.RLock()
-	group, err := m.GetUserConnectionGroupByGroupID(params.UserID, params.GroupID)
+	group, index, err := m.findGroup(userID, groupID)
 	if err != nil {
-		return err
+		return RecordedChange{}, err
 	}
-	mx.RUnlock()
+	before := NewGroupDocument(group)
 
-	mx.Lock()
-	if !internal.IsZeroOfUnderlyingType(params.Body.GroupName) {
-		group.GroupName = params.Body.GroupName
+	if patch.GroupName.IsSet() {
+		if err := m.checkGroupName(userID, groupID, patch.GroupName.Value); err != nil {
+			return RecordedChange{}, err
+		}
+		group.GroupName = patch.GroupName.Value
+		group.GroupNameKey = groupNameKey(group.GroupName)
 	}
 
 	changeConnectionUserIds := false
 	connectionUserIds := group.ConnectionUserIds
 
-	if !internal.IsZeroOfUnderlyingType(params.Body.ConnectionUserIDToAdd) {
-		cgUIDAdd := internal.GroupConnectionUserID{UserID: params.Body.ConnectionUserIDToAdd}
+	if !internal.IsZeroOfUnderlyingType(patch.ConnectionUserIDToAdd) {
+		cgUIDAdd := internal.GroupConnectionUserID{UserID: patch.ConnectionUserIDToAdd}
 		connectionUserIds = append(connectionUserIds, cgUIDAdd)
 		changeConnectionUserIds = true
 	}
 
-	if !internal.IsZeroOfUnderlyingType(params.Body.ConnectionUserIDToRemove) {
+	if !internal.IsZeroOfUnderlyingType(patch.ConnectionUserIDToRemove) {
 
-		for i, CU := range connectionUserIds {
-			if CU.UserID == params.Body.ConnectionUserIDToRemove {
-				connectionUserIds = append(connectionUserIds[:i], connectionUserIds[i+1:]...)
+		remaining := []internal.GroupConnectionUserID{}
+		for _, CU := range connectionUserIds {
+			if CU.UserID != patch.ConnectionUserIDToRemove {
+				remaining = append(remaining, CU)
 			}
 		}
+		connectionUserIds = remaining
 
 		changeConnectionUserIds = true
 	}
@@ -222,40 +270,148 @@ func (m *MockConnection) UpdateUserConnectionGroup(params connections.UsersConne
 		group.ConnectionUserIds = connectionUserIds
 	}
 
-	if !internal.IsZeroOfUnderlyingType(params.Body.GroupPic) {
-		group.GroupPic = params.Body.GroupPic
+	// Null removes the picture.
+	previousPic := group.GroupPic
+	if patch.GroupPic.Present {
+		group.GroupPic = patch.GroupPic.Value
 	}
 
-	for index, g := range m.userConnectionGroups[params.UserID] {
-		if g.GroupID == params.GroupID {
-			m.userConnectionGroups[params.UserID][index] = group
-			break
-		}
+	if !patch.GroupName.IsSet() && !changeConnectionUserIds && !patch.GroupPic.Present {
+		return RecordedChange{}, nil
 	}
-	mx.Unlock()
+	after := NewGroupDocument(group)
 
-	return nil
+	group.UpdatedAt = time.Now()
+	if isInteraction(before, after) {
+		group.LatestInteractionTime = group.UpdatedAt
+	}
+
+	if err := m.swapGroupPicRefs(previousPic, group.GroupPic); err != nil {
+		return RecordedChange{}, err
+	}
+
+	m.userConnectionGroups[userID][index] = group
+
+	if err := m.writeOutbox(userID, groupID, GroupChangeEvents(before, after)); err != nil {
+		return RecordedChange{}, err
+	}
+
+	entry := NewGroupHistoryEntry(userID, groupID, GroupUpdated, principal, before, after)
+	if entry.EntryID, err = m.appendGroupHistory(entry); err != nil {
+		return RecordedChange{}, err
+	}
+	return RecordedChange{Before: before, After: after, Entry: entry}, nil
 }
 
 // DeleteUserConnectionGroup - function
-func (m *MockConnection) DeleteUserConnectionGroup(params connections.UsersConnectionsGroupsByUserIDAndGroupIDDeleteParams) error {
+func (m *MockConnection) DeleteUserConnectionGroup(params connections.UsersConnectionsGroupsByUserIDAndGroupIDDeleteParams, principal map[string]interface{}) error {
+
+	m.groupsMx.Lock()
+	defer m.groupsMx.Unlock()
 
-	var mx sync.RWMutex
-	mx.RLock()
-	group, err := m.GetUserConnectionGroupByGroupID(params.UserID, params.GroupID)
+	group, index, err := m.findGroup(params.UserID, params.GroupID)
 	if err != nil {
 		return err
 	}
-	mx.RUnlock()
 
-	mx.Lock()
-	for index, g := range m.userConnectionGroups[params.UserID] {
-		if g.GroupID == group.GroupID {
-			m.userConnectionGroups[params.UserID] = append(m.userConnectionGroups[params.UserID][:index], m.userConnectionGroups[params.UserID][index+1:]...)
-			break
-		}
+	deletedAt := time.Now()
+	m.userConnectionGroups[params.UserID] = append(m.userConnectionGroups[params.UserID][:index], m.userConnectionGroups[params.UserID][index+1:]...)
+	m.trash[params.UserID+"_"+group.GroupID] = TrashedGroup{UserID: params.UserID, Group: group, DeletedAt: deletedAt}
+	m.tombstones[params.UserID+"_"+group.GroupID] = GroupTombstone{UserID: params.UserID, GroupID: group.GroupID, DeletedAt: deletedAt}
+
+	if err := m.writeOutbox(params.UserID, params.GroupID, []events.Event{events.GroupDeleted{GroupName: group.GroupName}}); err != nil {
+		return err
 	}
-	mx.Unlock()
+	document := NewGroupDocument(group)
+	_, err = m.appendGroupHistory(NewGroupHistoryEntry(params.UserID, params.GroupID, GroupDeleted, principal, document, document))
+	return err
+}
 
-	return nil
+// SetUserConnectionGroupPic - function
+func (m *MockConnection) SetUserConnectionGroupPic(userID string, groupID string, groupPic string, principal map[string]interface{}) (RecordedChange, error) {
+
+	m.groupsMx.Lock()
+	defer m.groupsMx.Unlock()
+
+	group, index, err := m.findGroup(userID, groupID)
+	if err != nil {
+		return RecordedChange{}, err
+	}
+
+	if err := m.swapGroupPicRefs(group.GroupPic, groupPic); err != nil {
+		return RecordedChange{}, err
+	}
+
+	m.userConnectionGroups[userID][index].GroupPic = groupPic
+	m.userConnectionGroups[userID][index].UpdatedAt = time.Now()
+
+	before := NewGroupDocument(group)
+	after := before
+	after.GroupPic = groupPic
+	if before.GroupPic == after.GroupPic {
+		return RecordedChange{}, nil
+	}
+	if err := m.writeOutbox(userID, groupID, GroupChangeEvents(before, after)); err != nil {
+		return RecordedChange{}, err
+	}
+
+	entry := NewGroupHistoryEntry(userID, groupID, GroupUpdated, principal, before, after)
+	if entry.EntryID, err = m.appendGroupHistory(entry); err != nil {
+		return RecordedChange{}, err
+	}
+	return RecordedChange{Before: before, After: after, Entry: entry}, nil
+}
+
+// Ping - Memory storage is always reachable.
+func (m *MockConnection) Ping(ctx context.Context) error {
+	return ctx.Err()
+}
+
+// ModifyUserConnectionGroup - function
+func (m *MockConnection) ModifyUserConnectionGroup(userID string, groupID string, record ChangeRecord, modify func(group *GroupDocument) error) (RecordedChange, error) {
+
+	m.groupsMx.Lock()
+	defer m.groupsMx.Unlock()
+
+	group, index, err := m.findGroup(userID, groupID)
+	if err != nil {
+		return RecordedChange{}, err
+	}
+
+	modified := NewGroupDocument(group)
+	if err := modify(&modified); err != nil {
+		return RecordedChange{}, err
+	}
+	if modified.Equal(NewGroupDocument(group)) {
+		return RecordedChange{}, nil
+	}
+	if err := m.checkGroupName(userID, groupID, modified.GroupName); err != nil {
+		return RecordedChange{}, err
+	}
+
+	current := NewGroupDocument(group)
+	group.GroupName = modified.GroupName
+	group.GroupNameKey = groupNameKey(modified.GroupName)
+	group.GroupPic = modified.GroupPic
+	group.ConnectionUserIds = modified.connectionUserIds()
+	group.UpdatedAt = time.Now()
+	if isInteraction(current, modified) {
+		group.LatestInteractionTime = group.UpdatedAt
+	}
+
+	if err := m.swapGroupPicRefs(current.GroupPic, group.GroupPic); err != nil {
+		return RecordedChange{}, err
+	}
+
+	m.userConnectionGroups[userID][index] = group
+
+	if err := m.writeOutbox(userID, groupID, GroupChangeEvents(current, modified)); err != nil {
+		return RecordedChange{}, err
+	}
+
+	entry := record.entry(userID, groupID, current, modified)
+	if entry.EntryID, err = m.appendGroupHistory(entry); err != nil {
+		return RecordedChange{}, err
+	}
+	return RecordedChange{Before: current, After: modified, Entry: entry}, nil
 }
@@ -0,0 +1,124 @@
+package database
+
+import (
+	"context"
+	"sort"
+	"time"
+)
+
+// historyWatchBuffer - changes a watcher of the mock may lag behind before it is disconnected.
+const historyWatchBuffer = 64
+
+// historyWatcher - Subscriber of the group changes of a user.
+type historyWatcher struct {
+	userID  string
+	entries chan GroupHistoryEntry
+}
+
+// appendGroupHistory - Record a change of a group, returning its entry ID. The caller holds groupsMx, so that the
+// entry is written with the change.
+func (m *MockConnection) appendGroupHistory(entry GroupHistoryEntry) (string, error) {
+	m.historyMx.Lock()
+	defer m.historyMx.Unlock()
+
+	entry.EntryID = GenerateUUID()
+	m.groupHistory = append(m.groupHistory, entry)
+
+	for watcher := range m.historyWatchers {
+		if watcher.userID != entry.UserID {
+			continue
+		}
+		select {
+		case watcher.entries <- entry:
+		default:
+			// Too slow, the watcher resumes from the last change it received.
+			m.stopWatching(watcher)
+		}
+	}
+
+	return entry.EntryID, nil
+}
+
+// ListGroupHistory - function
+func (m *MockConnection) ListGroupHistory(userID string, groupID string, offset int, limit int) ([]GroupHistoryEntry, int, error) {
+	m.historyMx.Lock()
+	defer m.historyMx.Unlock()
+
+	// Most recent first, entries appended in the same instant newest first.
+	entries := []GroupHistoryEntry{}
+	for i := len(m.groupHistory) - 1; i >= 0; i-- {
+		if entry := m.groupHistory[i]; entry.UserID == userID && entry.GroupID == groupID {
+			entries = append(entries, entry)
+		}
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].ChangedAt.After(entries[j].ChangedAt)
+	})
+
+	total := len(entries)
+	if offset > total {
+		offset = total
+	}
+	end := offset + limit
+	if end > total {
+		end = total
+	}
+
+	return entries[offset:end], total, nil
+}
+
+// GetGroupHistoryEntry - function
+func (m *MockConnection) GetGroupHistoryEntry(userID string, groupID string, entryID string) (GroupHistoryEntry, error) {
+	m.historyMx.Lock()
+	defer m.historyMx.Unlock()
+
+	for _, entry := range m.groupHistory {
+		if entry.EntryID == entryID && entry.UserID == userID && entry.GroupID == groupID {
+			return entry, nil
+		}
+	}
+
+	return GroupHistoryEntry{}, errHistoryEntryNotFound
+}
+
+// WatchGroupChanges - function
+func (m *MockConnection) WatchGroupChanges(ctx context.Context, userID string, since time.Time, afterEntryID string) (<-chan GroupHistoryEntry, error) {
+	m.historyMx.Lock()
+	defer m.historyMx.Unlock()
+
+	backlog := []GroupHistoryEntry{}
+	for _, entry := range m.groupHistory {
+		if entry.UserID == userID && !entry.ChangedAt.Before(since) && entry.EntryID != afterEntryID {
+			backlog = append(backlog, entry)
+		}
+	}
+	sort.SliceStable(backlog, func(i, j int) bool {
+		return backlog[i].ChangedAt.Before(backlog[j].ChangedAt)
+	})
+
+	watcher := &historyWatcher{userID: userID, entries: make(chan GroupHistoryEntry, len(backlog)+historyWatchBuffer)}
+	for _, entry := range backlog {
+		watcher.entries <- entry
+	}
+	if m.historyWatchers == nil {
+		m.historyWatchers = map[*historyWatcher]bool{}
+	}
+	m.historyWatchers[watcher] = true
+
+	go func() {
+		<-ctx.Done()
+		m.historyMx.Lock()
+		defer m.historyMx.Unlock()
+		m.stopWatching(watcher)
+	}()
+
+	return watcher.entries, nil
+}
+
+// stopWatching - Close the channel of a watcher once, historyMx must be held.
+func (m *MockConnection) stopWatching(watcher *historyWatcher) {
+	if m.historyWatchers[watcher] {
+		delete(m.historyWatchers, watcher)
+		close(watcher.entries)
+	}
+}
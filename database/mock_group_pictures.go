@@ -0,0 +1,105 @@
+package database
+
+import (
+	"sort"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// FindGroupPicBySource - function
+func (m *MockConnection) FindGroupPicBySource(sourceHash string) (string, error) {
+	m.picsMx.Lock()
+	defer m.picsMx.Unlock()
+
+	for _, picture := range m.groupPics {
+		if picture.SourceHash == sourceHash {
+			return picture.GroupPic, nil
+		}
+	}
+
+	return "", status.Error(codes.NotFound, "row does not found")
+}
+
+// SetGroupPicSource - function
+func (m *MockConnection) SetGroupPicSource(groupPic string, sourceHash string) error {
+	m.picsMx.Lock()
+	defer m.picsMx.Unlock()
+
+	if picture, ok := m.groupPics[groupPic]; ok {
+		picture.SourceHash = sourceHash
+	}
+	return nil
+}
+
+// ClaimUnreferencedGroupPics - function
+func (m *MockConnection) ClaimUnreferencedGroupPics(limit int) ([]string, error) {
+	m.picsMx.Lock()
+	defer m.picsMx.Unlock()
+
+	now := time.Now()
+	groupPics := []string{}
+	for groupPic, picture := range m.groupPics {
+		if picture.claimable(now) {
+			groupPics = append(groupPics, groupPic)
+		}
+	}
+	sort.Strings(groupPics)
+	if len(groupPics) > limit {
+		groupPics = groupPics[:limit]
+	}
+
+	for _, groupPic := range groupPics {
+		m.groupPics[groupPic].Freeing = true
+		m.groupPics[groupPic].ClaimedAt = now
+	}
+
+	return groupPics, nil
+}
+
+// ForgetFreedGroupPic - function
+func (m *MockConnection) ForgetFreedGroupPic(groupPic string) error {
+	m.picsMx.Lock()
+	defer m.picsMx.Unlock()
+
+	if picture, ok := m.groupPics[groupPic]; ok && picture.Freeing {
+		delete(m.groupPics, groupPic)
+	}
+	return nil
+}
+
+// GroupPicRefCount - Number of groups using a picture, 0 for unknown pictures.
+func (m *MockConnection) GroupPicRefCount(groupPic string) int {
+	m.picsMx.Lock()
+	defer m.picsMx.Unlock()
+
+	if picture, ok := m.groupPics[groupPic]; ok {
+		return picture.RefCount
+	}
+	return 0
+}
+
+func (m *MockConnection) swapGroupPicRefs(oldPic string, newPic string) error {
+	if oldPic == newPic {
+		return nil
+	}
+
+	m.picsMx.Lock()
+	defer m.picsMx.Unlock()
+
+	if picture, ok := m.groupPics[newPic]; ok && picture.Freeing {
+		return ErrGroupPicFreeing
+	}
+
+	if picture, ok := m.groupPics[oldPic]; ok && oldPic != "" {
+		picture.RefCount--
+	}
+	if newPic != "" {
+		if _, ok := m.groupPics[newPic]; !ok {
+			m.groupPics[newPic] = &GroupPictureRef{GroupPic: newPic}
+		}
+		m.groupPics[newPic].RefCount++
+	}
+	return nil
+}
@@ -0,0 +1,48 @@
+package database
+
+import (
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// ReserveIdempotencyKey - function
+func (m *MockConnection) ReserveIdempotencyKey(record IdempotencyRecord) (IdempotencyRecord, bool, error) {
+	m.keysMx.Lock()
+	defer m.keysMx.Unlock()
+
+	id := idempotencyDocID(record.UserID, record.Key)
+	if existing, ok := m.idempotencyKeys[id]; ok && existing.ExpiresAt.After(record.CreatedAt) {
+		return existing, false, nil
+	}
+
+	m.idempotencyKeys[id] = record
+	return record, true, nil
+}
+
+// CompleteIdempotencyKey - function
+func (m *MockConnection) CompleteIdempotencyKey(userID string, key string, statusCode int, contentType string, response []byte) error {
+	m.keysMx.Lock()
+	defer m.keysMx.Unlock()
+
+	id := idempotencyDocID(userID, key)
+	record, ok := m.idempotencyKeys[id]
+	if !ok {
+		return status.Error(codes.NotFound, "row does not found")
+	}
+
+	record.Completed = true
+	record.StatusCode = statusCode
+	record.ContentType = contentType
+	record.Response = response
+	m.idempotencyKeys[id] = record
+	return nil
+}
+
+// ReleaseIdempotencyKey - function
+func (m *MockConnection) ReleaseIdempotencyKey(userID string, key string) error {
+	m.keysMx.Lock()
+	defer m.keysMx.Unlock()
+
+	delete(m.idempotencyKeys, idempotencyDocID(userID, key))
+	return nil
+}
@@ -0,0 +1,25 @@
+package database
+
+import (
+	"time"
+)
+
+// RecordUserConnectionGroupInteraction - function
+func (m *MockConnection) RecordUserConnectionGroupInteraction(userID string, groupID string, at time.Time) error {
+	m.groupsMx.Lock()
+	defer m.groupsMx.Unlock()
+
+	group, index, err := m.findGroup(userID, groupID)
+	if err != nil {
+		return err
+	}
+
+	if !at.After(group.LatestInteractionTime) {
+		return nil
+	}
+
+	m.userConnectionGroups[userID][index].LatestInteractionTime = at
+	m.userConnectionGroups[userID][index].UpdatedAt = time.Now()
+
+	return nil
+}
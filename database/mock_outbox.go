@@ -0,0 +1,112 @@
+package database
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"learning/unit-testing/events"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// writeOutbox - Add the events of a change of a group to the outbox, the caller holds groupsMx so that the
+// events are written with the change.
+func (m *MockConnection) writeOutbox(userID string, groupID string, changes []events.Event) error {
+	outboxEvents, err := newOutboxEvents(userID, groupID, time.Now(), changes)
+	if err != nil {
+		return err
+	}
+
+	m.outboxMx.Lock()
+	defer m.outboxMx.Unlock()
+
+	for _, event := range outboxEvents {
+		m.outboxCount++
+		event.EventID = fmt.Sprintf("event_%d", m.outboxCount)
+		m.outbox = append(m.outbox, event)
+	}
+	return nil
+}
+
+// ClaimOutboxEvents - function
+func (m *MockConnection) ClaimOutboxEvents(now time.Time, lease time.Duration, limit int) ([]OutboxEvent, error) {
+	m.outboxMx.Lock()
+	defer m.outboxMx.Unlock()
+
+	available := []int{}
+	for index, event := range m.outbox {
+		if event.Status == OutboxEventPending && !event.AvailableAt.After(now) {
+			available = append(available, index)
+		}
+	}
+	sort.SliceStable(available, func(i, j int) bool {
+		return m.outbox[available[i]].AvailableAt.Before(m.outbox[available[j]].AvailableAt)
+	})
+	if len(available) > limit {
+		available = available[:limit]
+	}
+
+	claimed := []OutboxEvent{}
+	for _, index := range available {
+		m.outbox[index].Attempts++
+		m.outbox[index].AvailableAt = now.Add(lease)
+		claimed = append(claimed, m.outbox[index])
+	}
+
+	return claimed, nil
+}
+
+// RetryOutboxEvent - function
+func (m *MockConnection) RetryOutboxEvent(eventID string, availableAt time.Time, lastError string) error {
+	return m.updateOutboxEvent(eventID, func(event *OutboxEvent) {
+		event.AvailableAt = availableAt
+		event.LastError = lastError
+	})
+}
+
+// FailOutboxEvent - function
+func (m *MockConnection) FailOutboxEvent(eventID string, lastError string) error {
+	return m.updateOutboxEvent(eventID, func(event *OutboxEvent) {
+		event.Status = OutboxEventFailed
+		event.LastError = lastError
+	})
+}
+
+// CompleteOutboxEvent - function
+func (m *MockConnection) CompleteOutboxEvent(eventID string) error {
+	m.outboxMx.Lock()
+	defer m.outboxMx.Unlock()
+
+	for index, event := range m.outbox {
+		if event.EventID == eventID {
+			m.outbox = append(m.outbox[:index], m.outbox[index+1:]...)
+			return nil
+		}
+	}
+
+	return status.Error(codes.NotFound, "row does not found")
+}
+
+// OutboxEvents - Snapshot of the pending and failed outbox events.
+func (m *MockConnection) OutboxEvents() []OutboxEvent {
+	m.outboxMx.Lock()
+	defer m.outboxMx.Unlock()
+
+	return append([]OutboxEvent(nil), m.outbox...)
+}
+
+func (m *MockConnection) updateOutboxEvent(eventID string, update func(event *OutboxEvent)) error {
+	m.outboxMx.Lock()
+	defer m.outboxMx.Unlock()
+
+	for index := range m.outbox {
+		if m.outbox[index].EventID == eventID {
+			update(&m.outbox[index])
+			return nil
+		}
+	}
+
+	return status.Error(codes.NotFound, "row does not found")
+}
@@ -1,16 +1,18 @@
 package database
 
 import (
-	"errors"
 	"math"
 	"sort"
-	"time"
 
+	"learning/unit-testing/config"
 	"learning/unit-testing/models"
 
-	"github.com/go-openapi/strfmt"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
+var errNegativeOffset = status.Error(codes.InvalidArgument, "offset must not be negative")
+
 // PaginatedQuery - that holds all the necessary info to make a paginated query.
 type PaginatedQuery struct {
 	CollectionName       string
@@ -66,29 +68,19 @@ func (pq *PaginatedQuery) SortPaginatedQuery() {
 	}
 }
 
-// AddTimeSetFilterToQuery - Adds time sets query parameters to a query. Checks for an invalid time range.
-func (pq *PaginatedQuery) AddTimeSetFilterToQuery(fieldName string, afterTime *strfmt.DateTime, beforeTime *strfmt.DateTime) error {
-
-	if !internal.IsZeroOfUnderlyingType(afterTime) {
-		if !internal.IsZeroOfUnderlyingType(beforeTime) {
-			if time.Time(*afterTime).After(time.Time(*beforeTime)) {
-				return errors.New("invalid time range: after time can't come after before time")
-			}
+// AddTimeSetFilterToQuery - Keep the rows within a time range.
+func (pq *PaginatedQuery) AddTimeSetFilterToQuery(timeRange TimeRange) {
 
-			switch pq.CollectionName {
-			case "users_connections_groups":
-				var groups []internal.UserConnectionGroupInfo
-				for _, row := range pq.UserConnectionGroups {
-					if time.Time(row.LatestInteractionTime).After(time.Time(*afterTime)) && time.Time(row.LatestInteractionTime).Before(time.Time(*beforeTime)) {
-						groups = append(groups, row)
-					}
-				}
-				pq.UserConnectionGroups = groups
+	switch pq.CollectionName {
+	case "users_connections_groups":
+		var groups []internal.UserConnectionGroupInfo
+		for _, row := range pq.UserConnectionGroups {
+			if timeRange.Contains(groupTime(row, timeRange.Field)) {
+				groups = append(groups, row)
 			}
 		}
+		pq.UserConnectionGroups = groups
 	}
-
-	return nil
 }
 
 // LimitPaginatedQuery -
@@ -113,33 +105,43 @@ func (pq *PaginatedQuery) LimitPaginatedQuery() {
 
 }
 
-// GetPaginatedQueryMetadata - Get the count of the query as filtered.
+// ValidatePage - Reject pages no listing serves: negative offsets, and limits outside 1 to the configured maximum.
+func (pq *PaginatedQuery) ValidatePage() error {
+	if pq.Offset < 0 {
+		return errNegativeOffset
+	}
+	if maxLimit := int(config.Get().Pagination.MaxLimit); pq.Limit < 1 || pq.Limit > maxLimit {
+		return status.Errorf(codes.InvalidArgument, "limit must be between 1 and %d", maxLimit)
+	}
+	return nil
+}
+
+// GetPaginatedQueryMetadata - Get the count of the query as filtered, and whether pages come before and after
+// this one. Without a positive limit there are no pages.
 func (pq *PaginatedQuery) GetPaginatedQueryMetadata() *models.PaginationData {
 
-	// Get the total count.
-	limit := pq.Limit
-	offset := pq.Offset
+	limit := int32(pq.Limit)
 	resultCount := int32(pq.ResultCount)
-
-	// Calculate the pages.
-	pageCount := int32(math.Ceil(float64(resultCount) / float64(limit)))
-
+	pageCount := int32(0)
 	currentPage := int32(1)
 
-	if offset == 0 {
-		currentPage = 1
-	} else {
-		currentPage = int32(math.Ceil((float64(offset) + 1) / float64(pq.Limit)))
+	// Calculate the pages.
+	if pq.Limit > 0 {
+		pageCount = int32(math.Ceil(float64(pq.ResultCount) / float64(pq.Limit)))
+		currentPage = int32(pq.Offset/pq.Limit) + 1
 	}
 
-	limit32 := int32(limit)
+	hasNext := pq.Limit > 0 && pq.Offset+pq.Limit < pq.ResultCount
+	hasPrev := pq.Offset > 0
 
 	// Create the pagination data.
 	var paginationInfo = models.PaginationData{
 		ResultCount: &resultCount,
-		PageLimit:   &limit32,
+		PageLimit:   &limit,
 		PageCount:   &pageCount,
 		CurrentPage: &currentPage,
+		HasNext:     &hasNext,
+		HasPrev:     &hasPrev,
 	}
 
 	return &paginationInfo
@@ -0,0 +1,124 @@
+package database
+
+import (
+	"sort"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// EnqueuePictureJob - function
+func (m *MockConnection) EnqueuePictureJob(job PictureJob) (string, error) {
+	m.jobsMx.Lock()
+	defer m.jobsMx.Unlock()
+
+	job.JobID = GenerateUUID()
+	job.Status = PictureJobQueued
+	job.CreatedAt = time.Now()
+	if job.AvailableAt.IsZero() {
+		job.AvailableAt = job.CreatedAt
+	}
+	m.pictureJobs = append(m.pictureJobs, job)
+
+	return job.JobID, nil
+}
+
+// ClaimPictureJobs - function
+func (m *MockConnection) ClaimPictureJobs(now time.Time, lease time.Duration, limit int) ([]PictureJob, error) {
+	m.jobsMx.Lock()
+	defer m.jobsMx.Unlock()
+
+	available := []int{}
+	for index, job := range m.pictureJobs {
+		if job.Status == PictureJobQueued && !job.AvailableAt.After(now) {
+			available = append(available, index)
+		}
+	}
+	sort.SliceStable(available, func(i, j int) bool {
+		return m.pictureJobs[available[i]].AvailableAt.Before(m.pictureJobs[available[j]].AvailableAt)
+	})
+	if len(available) > limit {
+		available = available[:limit]
+	}
+
+	jobs := []PictureJob{}
+	for _, index := range available {
+		m.pictureJobs[index].Attempts++
+		m.pictureJobs[index].AvailableAt = now.Add(lease)
+		jobs = append(jobs, m.pictureJobs[index])
+	}
+
+	return jobs, nil
+}
+
+// RetryPictureJob - function
+func (m *MockConnection) RetryPictureJob(jobID string, availableAt time.Time, lastError string) error {
+	return m.updatePictureJob(jobID, func(job *PictureJob) {
+		job.AvailableAt = availableAt
+		job.LastError = lastError
+	})
+}
+
+// FailPictureJob - function
+func (m *MockConnection) FailPictureJob(jobID string, lastError string) error {
+	return m.updatePictureJob(jobID, func(job *PictureJob) {
+		job.Status = PictureJobFailed
+		job.LastError = lastError
+	})
+}
+
+// CompletePictureJob - function
+func (m *MockConnection) CompletePictureJob(jobID string) error {
+	m.jobsMx.Lock()
+	defer m.jobsMx.Unlock()
+
+	for index, job := range m.pictureJobs {
+		if job.JobID == jobID {
+			m.pictureJobs = append(m.pictureJobs[:index], m.pictureJobs[index+1:]...)
+			return nil
+		}
+	}
+
+	return status.Error(codes.NotFound, "row does not found")
+}
+
+// PictureJobs - Snapshot of the queued and failed picture jobs.
+func (m *MockConnection) PictureJobs() []PictureJob {
+	m.jobsMx.Lock()
+	defer m.jobsMx.Unlock()
+
+	return append([]PictureJob(nil), m.pictureJobs...)
+}
+
+// SetUserConnectionGroupPicStatus - function
+func (m *MockConnection) SetUserConnectionGroupPicStatus(userID string, groupID string, pictureStatus string, pictureError string) error {
+
+	m.groupsMx.Lock()
+	defer m.groupsMx.Unlock()
+
+	_, index, err := m.findGroup(userID, groupID)
+	if err != nil {
+		return err
+	}
+
+	m.userConnectionGroups[userID][index].PictureStatus = pictureStatus
+	m.userConnectionGroups[userID][index].PictureError = pictureError
+	m.userConnectionGroups[userID][index].UpdatedAt = time.Now()
+
+	return nil
+}
+
+func (m *MockConnection) updatePictureJob(jobID string, update func(job *PictureJob)) error {
+	m.jobsMx.Lock()
+	defer m.jobsMx.Unlock()
+
+	for index := range m.pictureJobs {
+		if m.pictureJobs[index].JobID == jobID {
+			update(&m.pictureJobs[index])
+			return nil
+		}
+	}
+
+	return status.Error(codes.NotFound, "row does not found")
+}
@@ -0,0 +1,33 @@
+package database
+
+import (
+	"time"
+)
+
+// SyncUserConnectionGroups - function
+func (m *MockConnection) SyncUserConnectionGroups(userID string, after SyncCursor, until time.Time, limit int) ([]GroupSyncChange, error) {
+	m.groupsMx.Lock()
+	defer m.groupsMx.Unlock()
+
+	if after.IsZero() {
+		for index, group := range m.userConnectionGroups[userID] {
+			if group.UpdatedAt.IsZero() {
+				m.userConnectionGroups[userID][index].UpdatedAt = until
+			}
+		}
+	}
+
+	changes := []GroupSyncChange{}
+	for _, group := range m.userConnectionGroups[userID] {
+		if after.precedes(group.UpdatedAt, group.GroupID) && !group.UpdatedAt.After(until) {
+			changes = append(changes, GroupSyncChange{GroupID: group.GroupID, ChangedAt: group.UpdatedAt})
+		}
+	}
+	for _, tombstone := range m.tombstones {
+		if tombstone.UserID == userID && after.precedes(tombstone.DeletedAt, tombstone.GroupID) && !tombstone.DeletedAt.After(until) {
+			changes = append(changes, GroupSyncChange{GroupID: tombstone.GroupID, ChangedAt: tombstone.DeletedAt, Deleted: true})
+		}
+	}
+
+	return firstSyncChanges(changes, limit), nil
+}
@@ -0,0 +1,110 @@
+package database
+
+import (
+	"sort"
+	"time"
+
+	"learning/unit-testing/events"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// ListTrashedUserConnectionGroups - function
+func (m *MockConnection) ListTrashedUserConnectionGroups(userID string) ([]TrashedGroup, error) {
+	m.groupsMx.RLock()
+	defer m.groupsMx.RUnlock()
+
+	trashed := []TrashedGroup{}
+	for _, group := range m.trash {
+		if group.UserID == userID {
+			trashed = append(trashed, group)
+		}
+	}
+	sort.SliceStable(trashed, func(i, j int) bool {
+		return trashed[i].DeletedAt.After(trashed[j].DeletedAt)
+	})
+
+	return trashed, nil
+}
+
+// RestoreUserConnectionGroup - function
+func (m *MockConnection) RestoreUserConnectionGroup(userID string, groupID string, principal map[string]interface{}) error {
+	m.groupsMx.Lock()
+	defer m.groupsMx.Unlock()
+
+	key := userID + "_" + groupID
+	trashed, ok := m.trash[key]
+	if !ok {
+		return status.Error(codes.NotFound, "row does not found")
+	}
+
+	if err := m.checkGroupName(userID, groupID, trashed.Group.GroupName); err != nil {
+		return err
+	}
+
+	trashed.Group.UpdatedAt = time.Now()
+	m.userConnectionGroups[userID] = append(m.userConnectionGroups[userID], trashed.Group)
+	delete(m.trash, key)
+	delete(m.tombstones, key)
+
+	if err := m.writeOutbox(userID, groupID, []events.Event{events.GroupRestored{GroupName: trashed.Group.GroupName}}); err != nil {
+		return err
+	}
+	document := NewGroupDocument(trashed.Group)
+	_, err := m.appendGroupHistory(NewGroupHistoryEntry(userID, groupID, GroupRestored, principal, document, document))
+	return err
+}
+
+// PurgeUserConnectionGroup - function
+func (m *MockConnection) PurgeUserConnectionGroup(userID string, groupID string, principal map[string]interface{}) error {
+	m.groupsMx.Lock()
+	defer m.groupsMx.Unlock()
+
+	key := userID + "_" + groupID
+	trashed, ok := m.trash[key]
+	if !ok {
+		return status.Error(codes.NotFound, "row does not found")
+	}
+
+	delete(m.trash, key)
+	m.swapGroupPicRefs(trashed.Group.GroupPic, "")
+
+	return m.recordPurge(trashed, principal)
+}
+
+// PurgeTrashedUserConnectionGroups - function
+func (m *MockConnection) PurgeTrashedUserConnectionGroups(deletedBefore time.Time, limit int) ([]TrashedGroup, error) {
+	m.groupsMx.Lock()
+	defer m.groupsMx.Unlock()
+
+	purged := []TrashedGroup{}
+	for _, trashed := range m.trash {
+		if trashed.DeletedAt.Before(deletedBefore) {
+			purged = append(purged, trashed)
+		}
+	}
+	sort.SliceStable(purged, func(i, j int) bool {
+		return purged[i].DeletedAt.Before(purged[j].DeletedAt)
+	})
+	if len(purged) > limit {
+		purged = purged[:limit]
+	}
+
+	for _, trashed := range purged {
+		delete(m.trash, trashed.UserID+"_"+trashed.Group.GroupID)
+		m.swapGroupPicRefs(trashed.Group.GroupPic, "")
+		if err := m.recordPurge(trashed, nil); err != nil {
+			return purged, err
+		}
+	}
+
+	return purged, nil
+}
+
+// recordPurge - Append the purge of a trashed group to its history, the caller holds groupsMx.
+func (m *MockConnection) recordPurge(trashed TrashedGroup, principal map[string]interface{}) error {
+	document := NewGroupDocument(trashed.Group)
+	_, err := m.appendGroupHistory(NewGroupHistoryEntry(trashed.UserID, trashed.Group.GroupID, GroupPurged, principal, document, document))
+	return err
+}
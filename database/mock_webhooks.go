@@ -0,0 +1,185 @@
+package database
+
+import (
+	"sort"
+	"time"
+)
+
+// CreateWebhookSubscription - function
+func (m *MockConnection) CreateWebhookSubscription(subscription WebhookSubscription) (string, error) {
+	m.webhooksMx.Lock()
+	defer m.webhooksMx.Unlock()
+
+	subscription.SubscriptionID = GenerateUUID()
+	m.webhookSubscriptions = append(m.webhookSubscriptions, subscription)
+
+	return subscription.SubscriptionID, nil
+}
+
+// ListWebhookSubscriptions - function
+func (m *MockConnection) ListWebhookSubscriptions(userID string) ([]WebhookSubscription, error) {
+	m.webhooksMx.Lock()
+	defer m.webhooksMx.Unlock()
+
+	subscriptions := []WebhookSubscription{}
+	for _, subscription := range m.webhookSubscriptions {
+		if subscription.UserID == userID {
+			subscriptions = append(subscriptions, subscription)
+		}
+	}
+	return subscriptions, nil
+}
+
+// GetWebhookSubscription - function
+func (m *MockConnection) GetWebhookSubscription(userID string, subscriptionID string) (WebhookSubscription, error) {
+	m.webhooksMx.Lock()
+	defer m.webhooksMx.Unlock()
+
+	for _, subscription := range m.webhookSubscriptions {
+		if subscription.UserID == userID && subscription.SubscriptionID == subscriptionID {
+			return subscription, nil
+		}
+	}
+	return WebhookSubscription{}, errWebhookNotFound
+}
+
+// DeleteWebhookSubscription - function
+func (m *MockConnection) DeleteWebhookSubscription(userID string, subscriptionID string) error {
+	m.webhooksMx.Lock()
+	defer m.webhooksMx.Unlock()
+
+	for index, subscription := range m.webhookSubscriptions {
+		if subscription.UserID == userID && subscription.SubscriptionID == subscriptionID {
+			m.webhookSubscriptions = append(m.webhookSubscriptions[:index], m.webhookSubscriptions[index+1:]...)
+			return nil
+		}
+	}
+	return errWebhookNotFound
+}
+
+// EnqueueWebhookDeliveries - function
+func (m *MockConnection) EnqueueWebhookDeliveries(deliveries []WebhookDelivery) error {
+	m.webhooksMx.Lock()
+	defer m.webhooksMx.Unlock()
+
+	queued := map[string]bool{}
+	for _, delivery := range m.webhookDeliveries {
+		queued[delivery.DeliveryID] = true
+	}
+	for _, delivery := range deliveries {
+		deliveryID := delivery.DeliveryID
+		if deliveryID == "" {
+			deliveryID = GenerateUUID()
+		}
+		if queued[deliveryID] {
+			continue
+		}
+		queued[deliveryID] = true
+		m.webhookDeliveries = append(m.webhookDeliveries, newWebhookDelivery(deliveryID, delivery))
+	}
+	return nil
+}
+
+// ClaimWebhookDeliveries - function
+func (m *MockConnection) ClaimWebhookDeliveries(now time.Time, lease time.Duration, limit int) ([]WebhookDelivery, error) {
+	m.webhooksMx.Lock()
+	defer m.webhooksMx.Unlock()
+
+	available := []int{}
+	for index, delivery := range m.webhookDeliveries {
+		if delivery.Status == WebhookDeliveryPending && !delivery.AvailableAt.After(now) {
+			available = append(available, index)
+		}
+	}
+	sort.SliceStable(available, func(i, j int) bool {
+		return m.webhookDeliveries[available[i]].AvailableAt.Before(m.webhookDeliveries[available[j]].AvailableAt)
+	})
+	if len(available) > limit {
+		available = available[:limit]
+	}
+
+	claimed := []WebhookDelivery{}
+	for _, index := range available {
+		m.webhookDeliveries[index].AvailableAt = now.Add(lease)
+		claimed = append(claimed, m.webhookDeliveries[index].copy())
+	}
+	return claimed, nil
+}
+
+// RecordWebhookAttempt - function
+func (m *MockConnection) RecordWebhookAttempt(deliveryID string, attempt WebhookAttempt, deliveryStatus string, availableAt time.Time) error {
+	m.webhooksMx.Lock()
+	defer m.webhooksMx.Unlock()
+
+	delivery := m.findWebhookDelivery(deliveryID)
+	if delivery == nil {
+		return errWebhookNotFound
+	}
+	delivery.Attempts = append(delivery.Attempts, attempt)
+	delivery.Status = deliveryStatus
+	delivery.AvailableAt = availableAt
+	return nil
+}
+
+// ListWebhookDeliveries - function
+func (m *MockConnection) ListWebhookDeliveries(userID string, subscriptionID string, deliveryStatus string, offset int, limit int) ([]WebhookDelivery, int, error) {
+	m.webhooksMx.Lock()
+	defer m.webhooksMx.Unlock()
+
+	// Most recent first, deliveries queued in the same instant newest first.
+	deliveries := []WebhookDelivery{}
+	for i := len(m.webhookDeliveries) - 1; i >= 0; i-- {
+		delivery := m.webhookDeliveries[i]
+		if delivery.UserID == userID && delivery.SubscriptionID == subscriptionID && (deliveryStatus == "" || delivery.Status == deliveryStatus) {
+			deliveries = append(deliveries, delivery.copy())
+		}
+	}
+	sort.SliceStable(deliveries, func(i, j int) bool {
+		return deliveries[i].CreatedAt.After(deliveries[j].CreatedAt)
+	})
+
+	total := len(deliveries)
+	if offset > total {
+		offset = total
+	}
+	end := offset + limit
+	if end > total {
+		end = total
+	}
+
+	return deliveries[offset:end], total, nil
+}
+
+// RedeliverWebhookDelivery - function
+func (m *MockConnection) RedeliverWebhookDelivery(userID string, subscriptionID string, deliveryID string, availableAt time.Time) error {
+	m.webhooksMx.Lock()
+	defer m.webhooksMx.Unlock()
+
+	delivery := m.findWebhookDelivery(deliveryID)
+	if delivery == nil || delivery.UserID != userID || delivery.SubscriptionID != subscriptionID {
+		return errWebhookNotFound
+	}
+	if delivery.Status != WebhookDeliveryDead {
+		return ErrDeliveryNotDead
+	}
+
+	delivery.Status = WebhookDeliveryPending
+	delivery.AvailableAt = availableAt
+	delivery.AttemptsBeforeRedelivery = len(delivery.Attempts)
+	return nil
+}
+
+func (m *MockConnection) findWebhookDelivery(deliveryID string) *WebhookDelivery {
+	for index := range m.webhookDeliveries {
+		if m.webhookDeliveries[index].DeliveryID == deliveryID {
+			return &m.webhookDeliveries[index]
+		}
+	}
+	return nil
+}
+
+// copy - Delivery that does not share its log with the stored one.
+func (d WebhookDelivery) copy() WebhookDelivery {
+	d.Attempts = append([]WebhookAttempt{}, d.Attempts...)
+	return d
+}
@@ -0,0 +1,191 @@
+package database
+
+import (
+	"errors"
+	"time"
+
+	"learning/unit-testing/events"
+
+	"golang.org/x/net/context"
+
+	"cloud.google.com/go/firestore"
+)
+
+// Outbox event states. Claimed events stay pending, hidden until their lease expires.
+const (
+	OutboxEventPending = "pending"
+	OutboxEventFailed  = "failed"
+)
+
+// outboxCollection - Firestore collection of the domain events waiting to be dispatched, written in the
+// transaction of the group change they describe.
+const outboxCollection = "outbox_events"
+
+// errEventTaken - a candidate event was claimed by another dispatcher in the meantime.
+var errEventTaken = errors.New("outbox event already claimed")
+
+// OutboxEvent - A domain event in the outbox.
+type OutboxEvent struct {
+	EventID    string    `firestore:"event_id"`
+	Type       string    `firestore:"type"`
+	UserID     string    `firestore:"user_id"`
+	GroupID    string    `firestore:"group_id"`
+	OccurredAt time.Time `firestore:"occurred_at"`
+	// Data - the event as JSON.
+	Data     []byte `firestore:"data"`
+	Status   string `firestore:"status"`
+	Attempts int    `firestore:"attempts"`
+	// AvailableAt - when the event can next be claimed, either its retry time or the end of its current lease.
+	AvailableAt time.Time `firestore:"available_at"`
+	LastError   string    `firestore:"last_error"`
+}
+
+// Envelope - The event as published to sinks.
+func (e OutboxEvent) Envelope() events.Envelope {
+	return events.Envelope{
+		EventID:    e.EventID,
+		Type:       e.Type,
+		UserID:     e.UserID,
+		GroupID:    e.GroupID,
+		OccurredAt: e.OccurredAt,
+		Data:       e.Data,
+	}
+}
+
+// newOutboxEvents - Pending outbox events of a change of a group, EventID is left to the backend.
+func newOutboxEvents(userID string, groupID string, occurredAt time.Time, changes []events.Event) ([]OutboxEvent, error) {
+	outboxEvents := []OutboxEvent{}
+	for _, change := range changes {
+		envelope, err := events.NewEnvelope(userID, groupID, occurredAt, change)
+		if err != nil {
+			return nil, err
+		}
+		outboxEvents = append(outboxEvents, OutboxEvent{
+			Type:        envelope.Type,
+			UserID:      userID,
+			GroupID:     groupID,
+			OccurredAt:  occurredAt,
+			Data:        envelope.Data,
+			Status:      OutboxEventPending,
+			AvailableAt: occurredAt,
+		})
+	}
+	return outboxEvents, nil
+}
+
+// GroupChangeEvents - Domain events of a group going from before to after.
+func GroupChangeEvents(before GroupDocument, after GroupDocument) []events.Event {
+	changes := []events.Event{}
+
+	if before.GroupName != after.GroupName {
+		changes = append(changes, events.GroupRenamed{OldName: before.GroupName, NewName: after.GroupName})
+	}
+	for _, userID := range missingFrom(after.ConnectionUserIds, before.ConnectionUserIds) {
+		changes = append(changes, events.MemberAdded{MemberUserID: userID})
+	}
+	for _, userID := range missingFrom(before.ConnectionUserIds, after.ConnectionUserIds) {
+		changes = append(changes, events.MemberRemoved{MemberUserID: userID})
+	}
+	if before.GroupPic != after.GroupPic {
+		changes = append(changes, events.PictureChanged{OldGroupPic: before.GroupPic, NewGroupPic: after.GroupPic})
+	}
+
+	return changes
+}
+
+// GroupCreatedEvent - Domain event of the creation of group.
+func GroupCreatedEvent(group GroupDocument) events.Event {
+	return events.GroupCreated{GroupName: group.GroupName, GroupPic: group.GroupPic, ConnectionUserIDs: group.ConnectionUserIds}
+}
+
+// writeOutbox - Within tx, add the events of a change of a group to the outbox.
+func (c *Connection) writeOutbox(tx *firestore.Transaction, userID string, groupID string, changes []events.Event) error {
+	outboxEvents, err := newOutboxEvents(userID, groupID, time.Now(), changes)
+	if err != nil {
+		return err
+	}
+
+	for _, event := range outboxEvents {
+		eventRef := c.Client.Collection(outboxCollection).NewDoc()
+		event.EventID = eventRef.ID
+		if err := tx.Create(eventRef, event); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ClaimOutboxEvents - Lease up to limit available events, oldest first, counting an attempt for each.
+// Each event is leased in its own transaction so that concurrent dispatchers never claim the same event.
+func (c *Connection) ClaimOutboxEvents(now time.Time, lease time.Duration, limit int) ([]OutboxEvent, error) {
+
+	candidates, err := c.Client.Collection(outboxCollection).
+		Where("status", "==", OutboxEventPending).
+		Where("available_at", "<=", now).
+		OrderBy("available_at", firestore.Asc).
+		OrderBy("occurred_at", firestore.Asc).
+		Limit(limit).
+		Documents(c.Context).GetAll()
+	if err != nil {
+		return nil, err
+	}
+
+	claimed := []OutboxEvent{}
+	for _, candidate := range candidates {
+		var event OutboxEvent
+
+		err := c.Client.RunTransaction(c.Context, func(ctx context.Context, tx *firestore.Transaction) error {
+			doc, err := tx.Get(candidate.Ref)
+			if err != nil {
+				return err
+			}
+			if err := doc.DataTo(&event); err != nil {
+				return err
+			}
+			if event.Status != OutboxEventPending || event.AvailableAt.After(now) {
+				return errEventTaken
+			}
+
+			event.Attempts++
+			event.AvailableAt = now.Add(lease)
+			return tx.Update(candidate.Ref, []firestore.Update{
+				{Path: "attempts", Value: event.Attempts},
+				{Path: "available_at", Value: event.AvailableAt},
+			})
+		})
+		if err == errEventTaken {
+			continue
+		}
+		if err != nil {
+			return claimed, err
+		}
+
+		claimed = append(claimed, event)
+	}
+
+	return claimed, nil
+}
+
+// RetryOutboxEvent - Release a claimed event for another attempt at availableAt.
+func (c *Connection) RetryOutboxEvent(eventID string, availableAt time.Time, lastError string) error {
+	_, err := c.Client.Collection(outboxCollection).Doc(eventID).Update(c.Context, []firestore.Update{
+		{Path: "available_at", Value: availableAt},
+		{Path: "last_error", Value: lastError},
+	})
+	return err
+}
+
+// FailOutboxEvent - Give up on an event, keeping it for inspection.
+func (c *Connection) FailOutboxEvent(eventID string, lastError string) error {
+	_, err := c.Client.Collection(outboxCollection).Doc(eventID).Update(c.Context, []firestore.Update{
+		{Path: "status", Value: OutboxEventFailed},
+		{Path: "last_error", Value: lastError},
+	})
+	return err
+}
+
+// CompleteOutboxEvent - Remove a dispatched event from the outbox.
+func (c *Connection) CompleteOutboxEvent(eventID string) error {
+	_, err := c.Client.Collection(outboxCollection).Doc(eventID).Delete(c.Context)
+	return err
+}
@@ -0,0 +1,168 @@
+package database
+
+import (
+	"errors"
+	"time"
+
+	"learning/unit-testing/internal"
+
+	"golang.org/x/net/context"
+
+	"cloud.google.com/go/firestore"
+)
+
+// Group picture processing states.
+const (
+	PictureStatusProcessing = "processing"
+	PictureStatusReady      = "ready"
+	PictureStatusFailed     = "failed"
+)
+
+// Picture job states. Claimed jobs stay queued, hidden until their lease expires.
+const (
+	PictureJobQueued = "queued"
+	PictureJobFailed = "failed"
+)
+
+// pictureJobsCollection - Firestore collection of the picture processing queue.
+const pictureJobsCollection = "picture_jobs"
+
+// errJobTaken - a candidate job was claimed by another worker in the meantime.
+var errJobTaken = errors.New("picture job already claimed")
+
+// PictureJob - Queued reduction of an uploaded group picture.
+type PictureJob struct {
+	JobID   string `firestore:"job_id"`
+	UserID  string `firestore:"user_id"`
+	GroupID string `firestore:"group_id"`
+	// UploadKey - blob key of the sanitized upload waiting to be reduced.
+	UploadKey string `firestore:"upload_key"`
+	// Principal - claims of the caller who uploaded the picture, recorded in the group history with the change.
+	Principal map[string]interface{} `firestore:"principal"`
+	Status    string                 `firestore:"status"`
+	Attempts  int                    `firestore:"attempts"`
+	// AvailableAt - when the job can next be claimed, either its retry time or the end of its current lease.
+	AvailableAt time.Time `firestore:"available_at"`
+	LastError   string    `firestore:"last_error"`
+	CreatedAt   time.Time `firestore:"created_at"`
+}
+
+// EnqueuePictureJob - Persist a new picture job, available immediately.
+func (c *Connection) EnqueuePictureJob(job PictureJob) (string, error) {
+	jobRef := c.Client.Collection(pictureJobsCollection).NewDoc()
+	job.JobID = jobRef.ID
+	job.Status = PictureJobQueued
+	job.CreatedAt = time.Now()
+	if job.AvailableAt.IsZero() {
+		job.AvailableAt = job.CreatedAt
+	}
+
+	if _, err := jobRef.Set(c.Context, job); err != nil {
+		return "", err
+	}
+	return job.JobID, nil
+}
+
+// ClaimPictureJobs - Lease up to limit available jobs, counting an attempt for each.
+// Each job is leased in its own transaction so that concurrent workers never claim the same job.
+func (c *Connection) ClaimPictureJobs(now time.Time, lease time.Duration, limit int) ([]PictureJob, error) {
+
+	candidates, err := c.Client.Collection(pictureJobsCollection).
+		Where("status", "==", PictureJobQueued).
+		Where("available_at", "<=", now).
+		OrderBy("available_at", firestore.Asc).
+		Limit(limit).
+		Documents(c.Context).GetAll()
+	if err != nil {
+		return nil, err
+	}
+
+	jobs := []PictureJob{}
+	for _, candidate := range candidates {
+		var job PictureJob
+
+		err := c.Client.RunTransaction(c.Context, func(ctx context.Context, tx *firestore.Transaction) error {
+			doc, err := tx.Get(candidate.Ref)
+			if err != nil {
+				return err
+			}
+			if err := doc.DataTo(&job); err != nil {
+				return err
+			}
+			if job.Status != PictureJobQueued || job.AvailableAt.After(now) {
+				return errJobTaken
+			}
+
+			job.Attempts++
+			job.AvailableAt = now.Add(lease)
+			return tx.Update(candidate.Ref, []firestore.Update{
+				{Path: "attempts", Value: job.Attempts},
+				{Path: "available_at", Value: job.AvailableAt},
+			})
+		})
+		if err == errJobTaken {
+			continue
+		}
+		if err != nil {
+			return jobs, err
+		}
+
+		jobs = append(jobs, job)
+	}
+
+	return jobs, nil
+}
+
+// RetryPictureJob - Release a claimed job for another attempt at availableAt.
+func (c *Connection) RetryPictureJob(jobID string, availableAt time.Time, lastError string) error {
+	_, err := c.Client.Collection(pictureJobsCollection).Doc(jobID).Update(c.Context, []firestore.Update{
+		{Path: "available_at", Value: availableAt},
+		{Path: "last_error", Value: lastError},
+	})
+	return err
+}
+
+// FailPictureJob - Give up on a job, keeping it for inspection.
+func (c *Connection) FailPictureJob(jobID string, lastError string) error {
+	_, err := c.Client.Collection(pictureJobsCollection).Doc(jobID).Update(c.Context, []firestore.Update{
+		{Path: "status", Value: PictureJobFailed},
+		{Path: "last_error", Value: lastError},
+	})
+	return err
+}
+
+// CompletePictureJob - Remove a processed job from the queue.
+func (c *Connection) CompletePictureJob(jobID string) error {
+	_, err := c.Client.Collection(pictureJobsCollection).Doc(jobID).Delete(c.Context)
+	return err
+}
+
+// SetUserConnectionGroupPicStatus - Record the picture processing state of a group. Processing states are not
+// versions of the group, the history only records the picture the worker eventually sets.
+func (c *Connection) SetUserConnectionGroupPicStatus(userID string, groupID string, pictureStatus string, pictureError string) error {
+
+	// Check Group exists before update.
+	if _, err := c.GetUserConnectionGroupByGroupID(userID, groupID); err != nil {
+		return err
+	}
+
+	updates := []firestore.Update{
+		{
+			Path:  "picture_status",
+			Value: pictureStatus,
+		},
+		{
+			Path:  "picture_error",
+			Value: pictureError,
+		},
+		{
+			Path:  "updated_at",
+			Value: time.Now(),
+		},
+	}
+	if _, err := c.Client.Doc(internal.GetGroupDocPath(userID, groupID)).Update(c.Context, updates); err != nil {
+		return err
+	}
+
+	return nil
+}
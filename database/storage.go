@@ -1,6 +1,9 @@
 package database
 
 import (
+	"context"
+	"time"
+
 	"learning/unit-testing/connections"
 	"learning/unit-testing/models"
 )
@@ -9,8 +12,53 @@ import (
 type Storage interface {
 	GetUserConnectionGroupByName(userID, groupName string) (internal.UserConnectionGroupInfo, error)
 	GetUserConnectionGroupByGroupID(userID, groupID string) (internal.UserConnectionGroupInfo, error)
-	CreateUserConnectionGroup(userID string, group internal.UserConnectionGroupInfo) (string, error)
+	CreateUserConnectionGroup(userID string, group internal.UserConnectionGroupInfo, principal map[string]interface{}) (string, error)
 	GetPaginatedUserConnectionGroup(params connections.UsersConnectionsGroupsByUserIDGetParams) (groupsList []*models.Group, paginationMeta *models.PaginationData, err error)
-	UpdateUserConnectionGroup(params connections.UsersConnectionsGroupsByUserIDAndGroupIDPatchParams) error
-	DeleteUserConnectionGroup(params connections.UsersConnectionsGroupsByUserIDAndGroupIDDeleteParams) error
+	UpdateUserConnectionGroup(userID, groupID string, patch GroupPatch, principal map[string]interface{}) (RecordedChange, error)
+	ModifyUserConnectionGroup(userID, groupID string, record ChangeRecord, modify func(group *GroupDocument) error) (RecordedChange, error)
+	DeleteUserConnectionGroup(params connections.UsersConnectionsGroupsByUserIDAndGroupIDDeleteParams, principal map[string]interface{}) error
+	SetUserConnectionGroupPic(userID, groupID, groupPic string, principal map[string]interface{}) (RecordedChange, error)
+	SetUserConnectionGroupPicStatus(userID, groupID, pictureStatus, pictureError string) error
+	RecordUserConnectionGroupInteraction(userID, groupID string, at time.Time) error
+	Ping(ctx context.Context) error
+
+	ListTrashedUserConnectionGroups(userID string) ([]TrashedGroup, error)
+	RestoreUserConnectionGroup(userID, groupID string, principal map[string]interface{}) error
+	PurgeUserConnectionGroup(userID, groupID string, principal map[string]interface{}) error
+	PurgeTrashedUserConnectionGroups(deletedBefore time.Time, limit int) ([]TrashedGroup, error)
+	SyncUserConnectionGroups(userID string, after SyncCursor, until time.Time, limit int) ([]GroupSyncChange, error)
+
+	ListGroupHistory(userID, groupID string, offset, limit int) ([]GroupHistoryEntry, int, error)
+	GetGroupHistoryEntry(userID, groupID, entryID string) (GroupHistoryEntry, error)
+	WatchGroupChanges(ctx context.Context, userID string, since time.Time, afterEntryID string) (<-chan GroupHistoryEntry, error)
+
+	FindGroupPicBySource(sourceHash string) (string, error)
+	SetGroupPicSource(groupPic, sourceHash string) error
+	ClaimUnreferencedGroupPics(limit int) ([]string, error)
+	ForgetFreedGroupPic(groupPic string) error
+
+	ReserveIdempotencyKey(record IdempotencyRecord) (IdempotencyRecord, bool, error)
+	CompleteIdempotencyKey(userID, key string, statusCode int, contentType string, response []byte) error
+	ReleaseIdempotencyKey(userID, key string) error
+
+	CreateWebhookSubscription(subscription WebhookSubscription) (string, error)
+	ListWebhookSubscriptions(userID string) ([]WebhookSubscription, error)
+	GetWebhookSubscription(userID, subscriptionID string) (WebhookSubscription, error)
+	DeleteWebhookSubscription(userID, subscriptionID string) error
+	EnqueueWebhookDeliveries(deliveries []WebhookDelivery) error
+	ClaimWebhookDeliveries(now time.Time, lease time.Duration, limit int) ([]WebhookDelivery, error)
+	RecordWebhookAttempt(deliveryID string, attempt WebhookAttempt, deliveryStatus string, availableAt time.Time) error
+	ListWebhookDeliveries(userID, subscriptionID, deliveryStatus string, offset, limit int) ([]WebhookDelivery, int, error)
+	RedeliverWebhookDelivery(userID, subscriptionID, deliveryID string, availableAt time.Time) error
+
+	ClaimOutboxEvents(now time.Time, lease time.Duration, limit int) ([]OutboxEvent, error)
+	RetryOutboxEvent(eventID string, availableAt time.Time, lastError string) error
+	FailOutboxEvent(eventID string, lastError string) error
+	CompleteOutboxEvent(eventID string) error
+
+	EnqueuePictureJob(job PictureJob) (string, error)
+	ClaimPictureJobs(now time.Time, lease time.Duration, limit int) ([]PictureJob, error)
+	RetryPictureJob(jobID string, availableAt time.Time, lastError string) error
+	FailPictureJob(jobID string, lastError string) error
+	CompletePictureJob(jobID string) error
 }
@@ -0,0 +1,173 @@
+package database
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"learning/unit-testing/internal"
+
+	"google.golang.org/api/iterator"
+
+	"cloud.google.com/go/firestore"
+)
+
+// tombstonesCollection - Firestore collection of deleted groups, kept after they are purged so that clients
+// syncing later still learn about the deletion.
+const tombstonesCollection = "users_connections_groups_tombstones"
+
+// GroupTombstone - Deletion of a group, removed when the group is restored.
+type GroupTombstone struct {
+	UserID    string    `firestore:"user_id"`
+	GroupID   string    `firestore:"group_id"`
+	DeletedAt time.Time `firestore:"deleted_at"`
+}
+
+// SyncCursor - Position in the changes of the groups of a user, which are ordered by time then group ID.
+// The zero cursor is before every change.
+type SyncCursor struct {
+	ChangedAt time.Time
+	GroupID   string
+}
+
+// GroupSyncChange - Latest change of a group: its last update, or its deletion.
+type GroupSyncChange struct {
+	GroupID   string
+	ChangedAt time.Time
+	Deleted   bool
+}
+
+// Cursor - Position right after the change.
+func (c GroupSyncChange) Cursor() SyncCursor {
+	return SyncCursor{ChangedAt: c.ChangedAt, GroupID: c.GroupID}
+}
+
+// IsZero - Whether the cursor is before every change.
+func (c SyncCursor) IsZero() bool {
+	return c.ChangedAt.IsZero() && c.GroupID == ""
+}
+
+// precedes - Whether the cursor comes before a change of groupID at changedAt.
+func (c SyncCursor) precedes(changedAt time.Time, groupID string) bool {
+	if !changedAt.Equal(c.ChangedAt) {
+		return changedAt.After(c.ChangedAt)
+	}
+	return groupID > c.GroupID
+}
+
+// firstSyncChanges - The first limit changes in sync order.
+func firstSyncChanges(changes []GroupSyncChange, limit int) []GroupSyncChange {
+	sort.SliceStable(changes, func(i, j int) bool {
+		return changes[i].Cursor().precedes(changes[j].ChangedAt, changes[j].GroupID)
+	})
+	if len(changes) > limit {
+		changes = changes[:limit]
+	}
+	return changes
+}
+
+func (c *Connection) tombstoneRef(userID string, groupID string) *firestore.DocumentRef {
+	return c.Client.Collection(tombstonesCollection).Doc(userID + "_" + groupID)
+}
+
+// backfillGroupUpdatedAt - Stamp the groups of a user stored before they had an updated_at with until, which
+// queries on updated_at leave out otherwise. until is after the cursor of every earlier sync, so clients already
+// in sync get them on their next sync too.
+func (c *Connection) backfillGroupUpdatedAt(userID string, until time.Time) error {
+
+	groupDocs := c.Client.Collection(internal.GetGroupCollectionPath(userID)).Documents(c.Context)
+	defer groupDocs.Stop()
+	for {
+		doc, err := groupDocs.Next()
+		if err == iterator.Done {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if _, ok := doc.Data()["updated_at"]; ok {
+			continue
+		}
+
+		err = c.Client.RunTransaction(c.Context, func(ctx context.Context, tx *firestore.Transaction) error {
+			groupDoc, err := tx.Get(doc.Ref)
+			if err != nil {
+				return err
+			}
+			if _, ok := groupDoc.Data()["updated_at"]; ok {
+				return nil
+			}
+			return tx.Update(doc.Ref, []firestore.Update{{Path: "updated_at", Value: until}})
+		})
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// SyncUserConnectionGroups - Up to limit groups of a user updated or deleted after the cursor and no later than
+// until, in sync order. Changes are ordered by the time they were made, which clients of delta sync must leave
+// enough time to commit before reading up to it. A sync without cursor first backfills the updated_at of legacy
+// groups.
+func (c *Connection) SyncUserConnectionGroups(userID string, after SyncCursor, until time.Time, limit int) ([]GroupSyncChange, error) {
+
+	if after.IsZero() {
+		if err := c.backfillGroupUpdatedAt(userID, until); err != nil {
+			return nil, err
+		}
+	}
+
+	groups := c.Client.Collection(internal.GetGroupCollectionPath(userID)).
+		Where("updated_at", "<=", until).
+		OrderBy("updated_at", firestore.Asc).
+		OrderBy(firestore.DocumentID, firestore.Asc)
+	tombstones := c.Client.Collection(tombstonesCollection).
+		Where("user_id", "==", userID).
+		Where("deleted_at", "<=", until).
+		OrderBy("deleted_at", firestore.Asc).
+		OrderBy("group_id", firestore.Asc)
+	if !after.IsZero() {
+		groups = groups.StartAfter(after.ChangedAt, after.GroupID)
+		tombstones = tombstones.StartAfter(after.ChangedAt, after.GroupID)
+	}
+
+	changes := []GroupSyncChange{}
+
+	groupDocs := groups.Limit(limit).Documents(c.Context)
+	defer groupDocs.Stop()
+	for {
+		doc, err := groupDocs.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		var group internal.UserConnectionGroupInfo
+		if err := doc.DataTo(&group); err != nil {
+			return nil, err
+		}
+		changes = append(changes, GroupSyncChange{GroupID: doc.Ref.ID, ChangedAt: group.UpdatedAt})
+	}
+
+	tombstoneDocs := tombstones.Limit(limit).Documents(c.Context)
+	defer tombstoneDocs.Stop()
+	for {
+		doc, err := tombstoneDocs.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		var tombstone GroupTombstone
+		if err := doc.DataTo(&tombstone); err != nil {
+			return nil, err
+		}
+		changes = append(changes, GroupSyncChange{GroupID: tombstone.GroupID, ChangedAt: tombstone.DeletedAt, Deleted: true})
+	}
+
+	return firstSyncChanges(changes, limit), nil
+}
@@ -0,0 +1,66 @@
+package database
+
+import (
+	"testing"
+	"time"
+
+	"learning/unit-testing/internal"
+)
+
+type TestCaseLegacyGroupSync struct {
+	name     string
+	after    SyncCursor
+	expected []GroupSyncChange
+}
+
+func TestSyncLegacyGroups(t *testing.T) {
+
+	mock := NewMockConnection().(*MockConnection)
+	userID := "dc9dbe3e-60d5-4a07-8c9c-42027b555bb2"
+
+	syncedID, _ := mock.CreateUserConnectionGroup(userID, internal.UserConnectionGroupInfo{GroupName: "Synced Group"}, nil)
+	legacyID, _ := mock.CreateUserConnectionGroup(userID, internal.UserConnectionGroupInfo{GroupName: "Legacy Group"}, nil)
+
+	// Groups stored before updated_at was introduced have none.
+	mock.userConnectionGroups[userID][1].UpdatedAt = time.Time{}
+	synced := mock.userConnectionGroups[userID][0]
+	syncedCursor := SyncCursor{ChangedAt: synced.UpdatedAt, GroupID: syncedID}
+
+	until := time.Now()
+
+	testCases := []TestCaseLegacyGroupSync{
+		{
+			name:  "Initial",
+			after: SyncCursor{},
+			expected: []GroupSyncChange{
+				{GroupID: syncedID, ChangedAt: synced.UpdatedAt},
+				{GroupID: legacyID, ChangedAt: until},
+			},
+		},
+		{
+			name:  "AlreadyInSync",
+			after: syncedCursor,
+			expected: []GroupSyncChange{
+				{GroupID: legacyID, ChangedAt: until},
+			},
+		},
+	}
+
+	for _, test := range testCases {
+
+		t.Run(test.name, func(t *testing.T) {
+			changes, err := mock.SyncUserConnectionGroups(userID, test.after, until, 10)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(changes) != len(test.expected) {
+				t.Fatalf("%v != %v", changes, test.expected)
+			}
+			for index, change := range changes {
+				if change.GroupID != test.expected[index].GroupID || !change.ChangedAt.Equal(test.expected[index].ChangedAt) || change.Deleted {
+					t.Fatalf("%v != %v", change, test.expected[index])
+				}
+			}
+		})
+	}
+}
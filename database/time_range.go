@@ -0,0 +1,149 @@
+package database
+
+import (
+	"time"
+
+	"learning/unit-testing/internal"
+	"learning/unit-testing/restapi/operations/connections"
+
+	"github.com/go-openapi/strfmt"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"cloud.google.com/go/firestore"
+)
+
+// Bounds of the time range filters of group listings, exclusive when not given.
+const (
+	TimeBoundsExclusive = "exclusive"
+	TimeBoundsInclusive = "inclusive"
+)
+
+// timePrecision - Firestore keeps times to the microsecond, both backends compare times at that precision.
+const timePrecision = time.Microsecond
+
+var (
+	errInvalidTimeRange  = status.Error(codes.InvalidArgument, "invalid time range: after time can't come after before time")
+	errInvalidTimeBounds = status.Error(codes.InvalidArgument, "time_bounds must be inclusive or exclusive")
+)
+
+// TimeRange - Filter of groups on one of their times. A nil bound leaves the range open on that side, bounds are
+// excluded unless Inclusive.
+type TimeRange struct {
+	Field     string
+	After     *time.Time
+	Before    *time.Time
+	Inclusive bool
+}
+
+// timeCondition - Comparison of the field of a time range with one of its bounds, as written in Firestore queries.
+type timeCondition struct {
+	Op    string
+	Value time.Time
+}
+
+// newTimeRange - Range of field between after and before, either of which may be nil.
+func newTimeRange(field string, after *strfmt.DateTime, before *strfmt.DateTime, inclusive bool) (TimeRange, error) {
+	timeRange := TimeRange{Field: field, Inclusive: inclusive}
+
+	if after != nil {
+		afterTime := time.Time(*after).Truncate(timePrecision)
+		timeRange.After = &afterTime
+	}
+	if before != nil {
+		beforeTime := time.Time(*before).Truncate(timePrecision)
+		timeRange.Before = &beforeTime
+	}
+
+	if timeRange.After != nil && timeRange.Before != nil && timeRange.After.After(*timeRange.Before) {
+		return timeRange, errInvalidTimeRange
+	}
+	return timeRange, nil
+}
+
+// groupTimeRanges - Time range filters of a group listing, one per time with at least one bound.
+func groupTimeRanges(params connections.UsersConnectionsGroupsByUserIDGetParams) ([]TimeRange, error) {
+
+	inclusive := false
+	if params.TimeBounds != nil {
+		switch *params.TimeBounds {
+		case TimeBoundsInclusive:
+			inclusive = true
+		case TimeBoundsExclusive:
+		default:
+			return nil, errInvalidTimeBounds
+		}
+	}
+
+	bounds := []struct {
+		field  string
+		after  *strfmt.DateTime
+		before *strfmt.DateTime
+	}{
+		{"latest_interaction_time", params.LatestInteractionTimeAfter, params.LatestInteractionTimeBefore},
+		{"created_at", params.CreatedAtAfter, params.CreatedAtBefore},
+		{"updated_at", params.UpdatedAtAfter, params.UpdatedAtBefore},
+	}
+
+	timeRanges := []TimeRange{}
+	for _, b := range bounds {
+		if b.after == nil && b.before == nil {
+			continue
+		}
+		timeRange, err := newTimeRange(b.field, b.after, b.before, inclusive)
+		if err != nil {
+			return nil, err
+		}
+		timeRanges = append(timeRanges, timeRange)
+	}
+	return timeRanges, nil
+}
+
+// Contains - Whether t is within the range.
+func (r TimeRange) Contains(t time.Time) bool {
+	t = t.Truncate(timePrecision)
+
+	if r.After != nil && (t.Before(*r.After) || !r.Inclusive && t.Equal(*r.After)) {
+		return false
+	}
+	if r.Before != nil && (t.After(*r.Before) || !r.Inclusive && t.Equal(*r.Before)) {
+		return false
+	}
+	return true
+}
+
+// conditions - Comparisons a time must pass to be within the range.
+func (r TimeRange) conditions() []timeCondition {
+	afterOp, beforeOp := ">", "<"
+	if r.Inclusive {
+		afterOp, beforeOp = ">=", "<="
+	}
+
+	conditions := []timeCondition{}
+	if r.After != nil {
+		conditions = append(conditions, timeCondition{Op: afterOp, Value: *r.After})
+	}
+	if r.Before != nil {
+		conditions = append(conditions, timeCondition{Op: beforeOp, Value: *r.Before})
+	}
+	return conditions
+}
+
+// applyTo - Query restricted to the documents within the range.
+func (r TimeRange) applyTo(query firestore.Query) firestore.Query {
+	for _, condition := range r.conditions() {
+		query = query.Where(r.Field, condition.Op, condition.Value)
+	}
+	return query
+}
+
+// groupTime - Time of a group a range filters on.
+func groupTime(group internal.UserConnectionGroupInfo, field string) time.Time {
+	switch field {
+	case "created_at":
+		return group.CreatedAt
+	case "updated_at":
+		return group.UpdatedAt
+	}
+	return group.LatestInteractionTime
+}
@@ -0,0 +1,220 @@
+package database
+
+import (
+	"testing"
+	"time"
+
+	"learning/unit-testing/restapi/operations/connections"
+
+	"github.com/go-openapi/strfmt"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// matches - Whether t passes a condition, the way Firestore evaluates it on a stored time.
+func (c timeCondition) matches(t time.Time) bool {
+	t = t.Truncate(timePrecision)
+	switch c.Op {
+	case ">":
+		return t.After(c.Value)
+	case ">=":
+		return !t.Before(c.Value)
+	case "<":
+		return t.Before(c.Value)
+	case "<=":
+		return !t.After(c.Value)
+	}
+	return false
+}
+
+func dateTime(t time.Time) *strfmt.DateTime {
+	d := strfmt.DateTime(t)
+	return &d
+}
+
+type TestCaseTimeRange struct {
+	name      string
+	after     *strfmt.DateTime
+	before    *strfmt.DateTime
+	inclusive bool
+	expected  []bool
+}
+
+func TestTimeRangeContains(t *testing.T) {
+
+	start := time.Date(2021, 10, 18, 12, 0, 0, 0, time.UTC)
+	end := start.Add(time.Hour)
+	// Before the range, on its bounds, within it and after it.
+	times := []time.Time{start.Add(-time.Minute), start, start.Add(time.Minute), end, end.Add(time.Minute)}
+
+	testCases := []TestCaseTimeRange{
+		{
+			name:     "Exclusive",
+			after:    dateTime(start),
+			before:   dateTime(end),
+			expected: []bool{false, false, true, false, false},
+		},
+		{
+			name:      "Inclusive",
+			after:     dateTime(start),
+			before:    dateTime(end),
+			inclusive: true,
+			expected:  []bool{false, true, true, true, false},
+		},
+		{
+			name:     "AfterOnly",
+			after:    dateTime(start),
+			expected: []bool{false, false, true, true, true},
+		},
+		{
+			name:      "BeforeOnly",
+			before:    dateTime(end),
+			inclusive: true,
+			expected:  []bool{true, true, true, true, false},
+		},
+		{
+			name:     "SameBoundsExclusive",
+			after:    dateTime(start),
+			before:   dateTime(start),
+			expected: []bool{false, false, false, false, false},
+		},
+		{
+			name:      "SameBoundsInclusive",
+			after:     dateTime(start),
+			before:    dateTime(start),
+			inclusive: true,
+			expected:  []bool{false, true, false, false, false},
+		},
+		{
+			name:      "SubMicrosecond",
+			after:     dateTime(start.Add(time.Nanosecond)),
+			before:    dateTime(end.Add(-time.Nanosecond)),
+			inclusive: true,
+			expected:  []bool{false, true, true, false, false},
+		},
+	}
+
+	for _, test := range testCases {
+
+		t.Run(test.name, func(t *testing.T) {
+			timeRange, err := newTimeRange("created_at", test.after, test.before, test.inclusive)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i, tm := range times {
+				if timeRange.Contains(tm) != test.expected[i] {
+					t.Fatalf("Contains(%s) = %t", tm, !test.expected[i])
+				}
+			}
+		})
+	}
+}
+
+type TestCaseGroupTimeRanges struct {
+	name           string
+	params         connections.UsersConnectionsGroupsByUserIDGetParams
+	expectedFields []string
+	expectedErr    error
+}
+
+func TestGroupTimeRanges(t *testing.T) {
+
+	start := dateTime(time.Date(2021, 10, 18, 12, 0, 0, 0, time.UTC))
+	end := dateTime(time.Date(2021, 10, 18, 13, 0, 0, 0, time.UTC))
+	inclusive, unknown := TimeBoundsInclusive, "closed"
+
+	testCases := []TestCaseGroupTimeRanges{
+		{
+			name:           "Unfiltered",
+			expectedFields: []string{},
+		},
+		{
+			name: "EveryTime",
+			params: connections.UsersConnectionsGroupsByUserIDGetParams{
+				LatestInteractionTimeAfter: start,
+				CreatedAtBefore:            end,
+				UpdatedAtAfter:             start,
+				UpdatedAtBefore:            end,
+				TimeBounds:                 &inclusive,
+			},
+			expectedFields: []string{"latest_interaction_time", "created_at", "updated_at"},
+		},
+		{
+			name:        "Reversed",
+			params:      connections.UsersConnectionsGroupsByUserIDGetParams{UpdatedAtAfter: end, UpdatedAtBefore: start},
+			expectedErr: status.Error(codes.InvalidArgument, "invalid time range: after time can't come after before time"),
+		},
+		{
+			name:        "UnknownBounds",
+			params:      connections.UsersConnectionsGroupsByUserIDGetParams{CreatedAtAfter: start, TimeBounds: &unknown},
+			expectedErr: status.Error(codes.InvalidArgument, "time_bounds must be inclusive or exclusive"),
+		},
+	}
+
+	for _, test := range testCases {
+
+		t.Run(test.name, func(t *testing.T) {
+			timeRanges, err := groupTimeRanges(test.params)
+			if status.Code(err) != status.Code(test.expectedErr) || err != nil && err.Error() != test.expectedErr.Error() {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if err != nil {
+				return
+			}
+
+			fields := []string{}
+			for _, timeRange := range timeRanges {
+				fields = append(fields, timeRange.Field)
+				if timeRange.Inclusive != (test.params.TimeBounds != nil) {
+					t.Fatalf("unexpected bounds of %s", timeRange.Field)
+				}
+			}
+			if len(fields) != len(test.expectedFields) {
+				t.Fatalf("%v != %v", fields, test.expectedFields)
+			}
+			for i := range fields {
+				if fields[i] != test.expectedFields[i] {
+					t.Fatalf("%v != %v", fields, test.expectedFields)
+				}
+			}
+		})
+	}
+}
+
+// FuzzTimeRange - The memory storage and the Firestore conditions of a range keep the same times.
+func FuzzTimeRange(f *testing.F) {
+
+	base := time.Date(2021, 10, 18, 12, 0, 0, 0, time.UTC).UnixNano()
+	f.Add(base, base+int64(time.Hour), base+1, true, true, false)
+	f.Add(base, base, base, true, true, true)
+	f.Add(base+999, base+1001, base+1000, true, false, false)
+	f.Add(base, base, base-1, false, true, true)
+
+	f.Fuzz(func(t *testing.T, after int64, before int64, at int64, hasAfter bool, hasBefore bool, inclusive bool) {
+		var afterTime, beforeTime *strfmt.DateTime
+		if hasAfter {
+			afterTime = dateTime(time.Unix(0, after).UTC())
+		}
+		if hasBefore {
+			beforeTime = dateTime(time.Unix(0, before).UTC())
+		}
+
+		timeRange, err := newTimeRange("updated_at", afterTime, beforeTime, inclusive)
+		reversed := hasAfter && hasBefore && time.Unix(0, after).Truncate(timePrecision).After(time.Unix(0, before).Truncate(timePrecision))
+		if reversed != (err != nil) {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if err != nil {
+			return
+		}
+
+		tm := time.Unix(0, at).UTC()
+		matched := true
+		for _, condition := range timeRange.conditions() {
+			matched = matched && condition.matches(tm)
+		}
+		if timeRange.Contains(tm) != matched {
+			t.Fatalf("Contains(%s) = %t, conditions matched = %t", tm, !matched, matched)
+		}
+	})
+}
@@ -0,0 +1,363 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"learning/unit-testing/internal"
+	"learning/unit-testing/models"
+	"learning/unit-testing/restapi/operations/connections"
+	"learning/unit-testing/tracing"
+
+	"go.opentelemetry.io/otel/attribute"
+	otelcodes "go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc/status"
+)
+
+// TracingStorage - Storage decorator starting a span for every call as a child of Context.
+type TracingStorage struct {
+	Storage Storage
+	Context context.Context
+}
+
+// contextBinder - implemented by storages that can run their queries under a request context.
+type contextBinder interface {
+	WithContext(ctx context.Context) Storage
+}
+
+// NewTracingStorage - Wrap a Storage so that every call is traced under the span carried by ctx.
+// Storages able to bind a context run their own queries under ctx as well.
+func NewTracingStorage(ctx context.Context, storage Storage) Storage {
+	if binder, ok := storage.(contextBinder); ok {
+		storage = binder.WithContext(ctx)
+	}
+	return &TracingStorage{Storage: storage, Context: ctx}
+}
+
+// startSpan - Start a client span for a storage method.
+func (t *TracingStorage) startSpan(method string, attrs ...attribute.KeyValue) trace.Span {
+	_, span := tracing.Tracer().Start(t.Context, "Storage."+method,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attrs...),
+	)
+	return span
+}
+
+// endSpan - Record the outcome of a storage call and end its span.
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetAttributes(attribute.String("rpc.grpc.status_code", status.Code(err).String()))
+		span.SetStatus(otelcodes.Error, err.Error())
+	}
+	span.End()
+}
+
+// GetUserConnectionGroupByName - function
+func (t *TracingStorage) GetUserConnectionGroupByName(userID string, groupName string) (group internal.UserConnectionGroupInfo, err error) {
+	span := t.startSpan("GetUserConnectionGroupByName", attribute.String("user.id", userID))
+	defer func() { endSpan(span, err) }()
+	return t.Storage.GetUserConnectionGroupByName(userID, groupName)
+}
+
+// GetUserConnectionGroupByGroupID - function
+func (t *TracingStorage) GetUserConnectionGroupByGroupID(userID string, groupID string) (group internal.UserConnectionGroupInfo, err error) {
+	span := t.startSpan("GetUserConnectionGroupByGroupID", attribute.String("user.id", userID), attribute.String("group.id", groupID))
+	defer func() { endSpan(span, err) }()
+	return t.Storage.GetUserConnectionGroupByGroupID(userID, groupID)
+}
+
+// CreateUserConnectionGroup - function
+func (t *TracingStorage) CreateUserConnectionGroup(userID string, group internal.UserConnectionGroupInfo, principal map[string]interface{}) (groupID string, err error) {
+	span := t.startSpan("CreateUserConnectionGroup", attribute.String("user.id", userID))
+	defer func() { endSpan(span, err) }()
+	return t.Storage.CreateUserConnectionGroup(userID, group, principal)
+}
+
+// GetPaginatedUserConnectionGroup - function
+func (t *TracingStorage) GetPaginatedUserConnectionGroup(params connections.UsersConnectionsGroupsByUserIDGetParams) (groupsList []*models.Group, paginationMeta *models.PaginationData, err error) {
+	span := t.startSpan("GetPaginatedUserConnectionGroup", attribute.String("user.id", params.UserID))
+	defer func() { endSpan(span, err) }()
+	return t.Storage.GetPaginatedUserConnectionGroup(params)
+}
+
+// UpdateUserConnectionGroup - function
+func (t *TracingStorage) UpdateUserConnectionGroup(userID string, groupID string, patch GroupPatch, principal map[string]interface{}) (change RecordedChange, err error) {
+	span := t.startSpan("UpdateUserConnectionGroup", attribute.String("user.id", userID), attribute.String("group.id", groupID))
+	defer func() { endSpan(span, err) }()
+	return t.Storage.UpdateUserConnectionGroup(userID, groupID, patch, principal)
+}
+
+// ModifyUserConnectionGroup - function
+func (t *TracingStorage) ModifyUserConnectionGroup(userID string, groupID string, record ChangeRecord, modify func(group *GroupDocument) error) (change RecordedChange, err error) {
+	span := t.startSpan("ModifyUserConnectionGroup", attribute.String("user.id", userID), attribute.String("group.id", groupID))
+	defer func() { endSpan(span, err) }()
+	return t.Storage.ModifyUserConnectionGroup(userID, groupID, record, modify)
+}
+
+// DeleteUserConnectionGroup - function
+func (t *TracingStorage) DeleteUserConnectionGroup(params connections.UsersConnectionsGroupsByUserIDAndGroupIDDeleteParams, principal map[string]interface{}) (err error) {
+	span := t.startSpan("DeleteUserConnectionGroup", attribute.String("user.id", params.UserID), attribute.String("group.id", params.GroupID))
+	defer func() { endSpan(span, err) }()
+	return t.Storage.DeleteUserConnectionGroup(params, principal)
+}
+
+// SetUserConnectionGroupPic - function
+func (t *TracingStorage) SetUserConnectionGroupPic(userID string, groupID string, groupPic string, principal map[string]interface{}) (change RecordedChange, err error) {
+	span := t.startSpan("SetUserConnectionGroupPic", attribute.String("user.id", userID), attribute.String("group.id", groupID))
+	defer func() { endSpan(span, err) }()
+	return t.Storage.SetUserConnectionGroupPic(userID, groupID, groupPic, principal)
+}
+
+// Ping - function
+func (t *TracingStorage) Ping(ctx context.Context) (err error) {
+	ctx, span := tracing.Tracer().Start(ctx, "Storage.Ping", trace.WithSpanKind(trace.SpanKindClient))
+	defer func() { endSpan(span, err) }()
+	return t.Storage.Ping(ctx)
+}
+
+// SetUserConnectionGroupPicStatus - function
+func (t *TracingStorage) SetUserConnectionGroupPicStatus(userID string, groupID string, pictureStatus string, pictureError string) (err error) {
+	span := t.startSpan("SetUserConnectionGroupPicStatus", attribute.String("user.id", userID), attribute.String("group.id", groupID))
+	defer func() { endSpan(span, err) }()
+	return t.Storage.SetUserConnectionGroupPicStatus(userID, groupID, pictureStatus, pictureError)
+}
+
+// RecordUserConnectionGroupInteraction - function
+func (t *TracingStorage) RecordUserConnectionGroupInteraction(userID string, groupID string, at time.Time) (err error) {
+	span := t.startSpan("RecordUserConnectionGroupInteraction", attribute.String("user.id", userID), attribute.String("group.id", groupID))
+	defer func() { endSpan(span, err) }()
+	return t.Storage.RecordUserConnectionGroupInteraction(userID, groupID, at)
+}
+
+// EnqueuePictureJob - function
+func (t *TracingStorage) EnqueuePictureJob(job PictureJob) (jobID string, err error) {
+	span := t.startSpan("EnqueuePictureJob", attribute.String("user.id", job.UserID), attribute.String("group.id", job.GroupID))
+	defer func() { endSpan(span, err) }()
+	return t.Storage.EnqueuePictureJob(job)
+}
+
+// ClaimPictureJobs - function
+func (t *TracingStorage) ClaimPictureJobs(now time.Time, lease time.Duration, limit int) (jobs []PictureJob, err error) {
+	span := t.startSpan("ClaimPictureJobs", attribute.Int("jobs.limit", limit))
+	defer func() { endSpan(span, err) }()
+	return t.Storage.ClaimPictureJobs(now, lease, limit)
+}
+
+// RetryPictureJob - function
+func (t *TracingStorage) RetryPictureJob(jobID string, availableAt time.Time, lastError string) (err error) {
+	span := t.startSpan("RetryPictureJob", attribute.String("job.id", jobID))
+	defer func() { endSpan(span, err) }()
+	return t.Storage.RetryPictureJob(jobID, availableAt, lastError)
+}
+
+// FailPictureJob - function
+func (t *TracingStorage) FailPictureJob(jobID string, lastError string) (err error) {
+	span := t.startSpan("FailPictureJob", attribute.String("job.id", jobID))
+	defer func() { endSpan(span, err) }()
+	return t.Storage.FailPictureJob(jobID, lastError)
+}
+
+// CompletePictureJob - function
+func (t *TracingStorage) CompletePictureJob(jobID string) (err error) {
+	span := t.startSpan("CompletePictureJob", attribute.String("job.id", jobID))
+	defer func() { endSpan(span, err) }()
+	return t.Storage.CompletePictureJob(jobID)
+}
+
+// FindGroupPicBySource - function
+func (t *TracingStorage) FindGroupPicBySource(sourceHash string) (groupPic string, err error) {
+	span := t.startSpan("FindGroupPicBySource")
+	defer func() { endSpan(span, err) }()
+	return t.Storage.FindGroupPicBySource(sourceHash)
+}
+
+// SetGroupPicSource - function
+func (t *TracingStorage) SetGroupPicSource(groupPic string, sourceHash string) (err error) {
+	span := t.startSpan("SetGroupPicSource", attribute.String("group.pic", groupPic))
+	defer func() { endSpan(span, err) }()
+	return t.Storage.SetGroupPicSource(groupPic, sourceHash)
+}
+
+// ClaimUnreferencedGroupPics - function
+func (t *TracingStorage) ClaimUnreferencedGroupPics(limit int) (groupPics []string, err error) {
+	span := t.startSpan("ClaimUnreferencedGroupPics", attribute.Int("pics.limit", limit))
+	defer func() { endSpan(span, err) }()
+	return t.Storage.ClaimUnreferencedGroupPics(limit)
+}
+
+// ForgetFreedGroupPic - function
+func (t *TracingStorage) ForgetFreedGroupPic(groupPic string) (err error) {
+	span := t.startSpan("ForgetFreedGroupPic", attribute.String("group.pic", groupPic))
+	defer func() { endSpan(span, err) }()
+	return t.Storage.ForgetFreedGroupPic(groupPic)
+}
+
+// ReserveIdempotencyKey - function
+func (t *TracingStorage) ReserveIdempotencyKey(record IdempotencyRecord) (existing IdempotencyRecord, reserved bool, err error) {
+	span := t.startSpan("ReserveIdempotencyKey", attribute.String("user.id", record.UserID))
+	defer func() { endSpan(span, err) }()
+	return t.Storage.ReserveIdempotencyKey(record)
+}
+
+// CompleteIdempotencyKey - function
+func (t *TracingStorage) CompleteIdempotencyKey(userID string, key string, statusCode int, contentType string, response []byte) (err error) {
+	span := t.startSpan("CompleteIdempotencyKey", attribute.String("user.id", userID))
+	defer func() { endSpan(span, err) }()
+	return t.Storage.CompleteIdempotencyKey(userID, key, statusCode, contentType, response)
+}
+
+// ReleaseIdempotencyKey - function
+func (t *TracingStorage) ReleaseIdempotencyKey(userID string, key string) (err error) {
+	span := t.startSpan("ReleaseIdempotencyKey", attribute.String("user.id", userID))
+	defer func() { endSpan(span, err) }()
+	return t.Storage.ReleaseIdempotencyKey(userID, key)
+}
+
+// ListTrashedUserConnectionGroups - function
+func (t *TracingStorage) ListTrashedUserConnectionGroups(userID string) (trashed []TrashedGroup, err error) {
+	span := t.startSpan("ListTrashedUserConnectionGroups", attribute.String("user.id", userID))
+	defer func() { endSpan(span, err) }()
+	return t.Storage.ListTrashedUserConnectionGroups(userID)
+}
+
+// RestoreUserConnectionGroup - function
+func (t *TracingStorage) RestoreUserConnectionGroup(userID string, groupID string, principal map[string]interface{}) (err error) {
+	span := t.startSpan("RestoreUserConnectionGroup", attribute.String("user.id", userID), attribute.String("group.id", groupID))
+	defer func() { endSpan(span, err) }()
+	return t.Storage.RestoreUserConnectionGroup(userID, groupID, principal)
+}
+
+// PurgeUserConnectionGroup - function
+func (t *TracingStorage) PurgeUserConnectionGroup(userID string, groupID string, principal map[string]interface{}) (err error) {
+	span := t.startSpan("PurgeUserConnectionGroup", attribute.String("user.id", userID), attribute.String("group.id", groupID))
+	defer func() { endSpan(span, err) }()
+	return t.Storage.PurgeUserConnectionGroup(userID, groupID, principal)
+}
+
+// PurgeTrashedUserConnectionGroups - function
+func (t *TracingStorage) PurgeTrashedUserConnectionGroups(deletedBefore time.Time, limit int) (purged []TrashedGroup, err error) {
+	span := t.startSpan("PurgeTrashedUserConnectionGroups", attribute.Int("limit", limit))
+	defer func() { endSpan(span, err) }()
+	return t.Storage.PurgeTrashedUserConnectionGroups(deletedBefore, limit)
+}
+
+// SyncUserConnectionGroups - function
+func (t *TracingStorage) SyncUserConnectionGroups(userID string, after SyncCursor, until time.Time, limit int) (changes []GroupSyncChange, err error) {
+	span := t.startSpan("SyncUserConnectionGroups", attribute.String("user.id", userID), attribute.Int("limit", limit))
+	defer func() { endSpan(span, err) }()
+	return t.Storage.SyncUserConnectionGroups(userID, after, until, limit)
+}
+
+// ListGroupHistory - function
+func (t *TracingStorage) ListGroupHistory(userID string, groupID string, offset int, limit int) (entries []GroupHistoryEntry, total int, err error) {
+	span := t.startSpan("ListGroupHistory", attribute.String("user.id", userID), attribute.String("group.id", groupID))
+	defer func() { endSpan(span, err) }()
+	return t.Storage.ListGroupHistory(userID, groupID, offset, limit)
+}
+
+// GetGroupHistoryEntry - function
+func (t *TracingStorage) GetGroupHistoryEntry(userID string, groupID string, entryID string) (entry GroupHistoryEntry, err error) {
+	span := t.startSpan("GetGroupHistoryEntry", attribute.String("user.id", userID), attribute.String("group.id", groupID))
+	defer func() { endSpan(span, err) }()
+	return t.Storage.GetGroupHistoryEntry(userID, groupID, entryID)
+}
+
+// WatchGroupChanges - function
+func (t *TracingStorage) WatchGroupChanges(ctx context.Context, userID string, since time.Time, afterEntryID string) (changes <-chan GroupHistoryEntry, err error) {
+	span := t.startSpan("WatchGroupChanges", attribute.String("user.id", userID))
+	defer func() { endSpan(span, err) }()
+	return t.Storage.WatchGroupChanges(ctx, userID, since, afterEntryID)
+}
+
+// ClaimOutboxEvents - function
+func (t *TracingStorage) ClaimOutboxEvents(now time.Time, lease time.Duration, limit int) (claimed []OutboxEvent, err error) {
+	span := t.startSpan("ClaimOutboxEvents", attribute.Int("events.limit", limit))
+	defer func() { endSpan(span, err) }()
+	return t.Storage.ClaimOutboxEvents(now, lease, limit)
+}
+
+// RetryOutboxEvent - function
+func (t *TracingStorage) RetryOutboxEvent(eventID string, availableAt time.Time, lastError string) (err error) {
+	span := t.startSpan("RetryOutboxEvent", attribute.String("event.id", eventID))
+	defer func() { endSpan(span, err) }()
+	return t.Storage.RetryOutboxEvent(eventID, availableAt, lastError)
+}
+
+// FailOutboxEvent - function
+func (t *TracingStorage) FailOutboxEvent(eventID string, lastError string) (err error) {
+	span := t.startSpan("FailOutboxEvent", attribute.String("event.id", eventID))
+	defer func() { endSpan(span, err) }()
+	return t.Storage.FailOutboxEvent(eventID, lastError)
+}
+
+// CompleteOutboxEvent - function
+func (t *TracingStorage) CompleteOutboxEvent(eventID string) (err error) {
+	span := t.startSpan("CompleteOutboxEvent", attribute.String("event.id", eventID))
+	defer func() { endSpan(span, err) }()
+	return t.Storage.CompleteOutboxEvent(eventID)
+}
+
+// CreateWebhookSubscription - function
+func (t *TracingStorage) CreateWebhookSubscription(subscription WebhookSubscription) (subscriptionID string, err error) {
+	span := t.startSpan("CreateWebhookSubscription", attribute.String("user.id", subscription.UserID))
+	defer func() { endSpan(span, err) }()
+	return t.Storage.CreateWebhookSubscription(subscription)
+}
+
+// ListWebhookSubscriptions - function
+func (t *TracingStorage) ListWebhookSubscriptions(userID string) (subscriptions []WebhookSubscription, err error) {
+	span := t.startSpan("ListWebhookSubscriptions", attribute.String("user.id", userID))
+	defer func() { endSpan(span, err) }()
+	return t.Storage.ListWebhookSubscriptions(userID)
+}
+
+// GetWebhookSubscription - function
+func (t *TracingStorage) GetWebhookSubscription(userID string, subscriptionID string) (subscription WebhookSubscription, err error) {
+	span := t.startSpan("GetWebhookSubscription", attribute.String("user.id", userID), attribute.String("subscription.id", subscriptionID))
+	defer func() { endSpan(span, err) }()
+	return t.Storage.GetWebhookSubscription(userID, subscriptionID)
+}
+
+// DeleteWebhookSubscription - function
+func (t *TracingStorage) DeleteWebhookSubscription(userID string, subscriptionID string) (err error) {
+	span := t.startSpan("DeleteWebhookSubscription", attribute.String("user.id", userID), attribute.String("subscription.id", subscriptionID))
+	defer func() { endSpan(span, err) }()
+	return t.Storage.DeleteWebhookSubscription(userID, subscriptionID)
+}
+
+// EnqueueWebhookDeliveries - function
+func (t *TracingStorage) EnqueueWebhookDeliveries(deliveries []WebhookDelivery) (err error) {
+	span := t.startSpan("EnqueueWebhookDeliveries", attribute.Int("deliveries.count", len(deliveries)))
+	defer func() { endSpan(span, err) }()
+	return t.Storage.EnqueueWebhookDeliveries(deliveries)
+}
+
+// ClaimWebhookDeliveries - function
+func (t *TracingStorage) ClaimWebhookDeliveries(now time.Time, lease time.Duration, limit int) (claimed []WebhookDelivery, err error) {
+	span := t.startSpan("ClaimWebhookDeliveries", attribute.Int("deliveries.limit", limit))
+	defer func() { endSpan(span, err) }()
+	return t.Storage.ClaimWebhookDeliveries(now, lease, limit)
+}
+
+// RecordWebhookAttempt - function
+func (t *TracingStorage) RecordWebhookAttempt(deliveryID string, attempt WebhookAttempt, deliveryStatus string, availableAt time.Time) (err error) {
+	span := t.startSpan("RecordWebhookAttempt", attribute.String("delivery.id", deliveryID), attribute.String("delivery.status", deliveryStatus))
+	defer func() { endSpan(span, err) }()
+	return t.Storage.RecordWebhookAttempt(deliveryID, attempt, deliveryStatus, availableAt)
+}
+
+// ListWebhookDeliveries - function
+func (t *TracingStorage) ListWebhookDeliveries(userID string, subscriptionID string, deliveryStatus string, offset int, limit int) (deliveries []WebhookDelivery, total int, err error) {
+	span := t.startSpan("ListWebhookDeliveries", attribute.String("user.id", userID), attribute.String("subscription.id", subscriptionID))
+	defer func() { endSpan(span, err) }()
+	return t.Storage.ListWebhookDeliveries(userID, subscriptionID, deliveryStatus, offset, limit)
+}
+
+// RedeliverWebhookDelivery - function
+func (t *TracingStorage) RedeliverWebhookDelivery(userID string, subscriptionID string, deliveryID string, availableAt time.Time) (err error) {
+	span := t.startSpan("RedeliverWebhookDelivery", attribute.String("user.id", userID), attribute.String("delivery.id", deliveryID))
+	defer func() { endSpan(span, err) }()
+	return t.Storage.RedeliverWebhookDelivery(userID, subscriptionID, deliveryID, availableAt)
+}
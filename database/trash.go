@@ -0,0 +1,175 @@
+package database
+
+import (
+	"time"
+
+	"learning/unit-testing/events"
+	"learning/unit-testing/internal"
+
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"cloud.google.com/go/firestore"
+)
+
+// trashCollection - Firestore collection of deleted groups. Moving a deleted group out of the collection of its user
+// keeps it out of listings and name checks without filtering every query on deleted_at.
+const trashCollection = "users_connections_groups_trash"
+
+// TrashedGroup - A deleted group, kept until it is restored or purged.
+type TrashedGroup struct {
+	UserID    string                           `firestore:"user_id"`
+	Group     internal.UserConnectionGroupInfo `firestore:"group"`
+	DeletedAt time.Time                        `firestore:"deleted_at"`
+}
+
+func (c *Connection) trashRef(userID string, groupID string) *firestore.DocumentRef {
+	return c.Client.Collection(trashCollection).Doc(userID + "_" + groupID)
+}
+
+// trashUserConnectionGroup - Within tx, move a group to the trash, release its name and leave a tombstone for delta
+// sync. The group keeps its picture, which is only released when the group is purged.
+func (c *Connection) trashUserConnectionGroup(tx *firestore.Transaction, userID string, group internal.UserConnectionGroupInfo, deletedAt time.Time) error {
+	if err := c.moveGroupName(tx, userID, group.GroupID, group.GroupName, ""); err != nil {
+		return err
+	}
+	if err := tx.Set(c.trashRef(userID, group.GroupID), TrashedGroup{UserID: userID, Group: group, DeletedAt: deletedAt}); err != nil {
+		return err
+	}
+	if err := tx.Set(c.tombstoneRef(userID, group.GroupID), GroupTombstone{UserID: userID, GroupID: group.GroupID, DeletedAt: deletedAt}); err != nil {
+		return err
+	}
+	return tx.Delete(c.Client.Doc(internal.GetGroupDocPath(userID, group.GroupID)))
+}
+
+// ListTrashedUserConnectionGroups - Deleted groups of a user, most recently deleted first.
+func (c *Connection) ListTrashedUserConnectionGroups(userID string) ([]TrashedGroup, error) {
+	docs, err := c.Client.Collection(trashCollection).Where("user_id", "==", userID).OrderBy("deleted_at", firestore.Desc).Documents(c.Context).GetAll()
+	if err != nil {
+		return nil, err
+	}
+
+	trashed := []TrashedGroup{}
+	for _, doc := range docs {
+		var group TrashedGroup
+		if err := doc.DataTo(&group); err != nil {
+			return nil, err
+		}
+		trashed = append(trashed, group)
+	}
+
+	return trashed, nil
+}
+
+// RestoreUserConnectionGroup - Move a deleted group back on behalf of the caller with principal, taking its name
+// again and recording the restoration in the history.
+// Fails with a *GroupNameConflictError when another group took the name in the meantime.
+func (c *Connection) RestoreUserConnectionGroup(userID string, groupID string, principal map[string]interface{}) error {
+
+	trashRef := c.trashRef(userID, groupID)
+	groupRef := c.Client.Doc(internal.GetGroupDocPath(userID, groupID))
+
+	return c.Client.RunTransaction(c.Context, func(ctx context.Context, tx *firestore.Transaction) error {
+
+		trashDoc, err := tx.Get(trashRef)
+		if err != nil {
+			return err
+		}
+
+		var trashed TrashedGroup
+		if err := trashDoc.DataTo(&trashed); err != nil {
+			return err
+		}
+
+		if err := c.checkGroupName(tx, userID, groupID, trashed.Group.GroupName); err != nil {
+			return err
+		}
+		if err := c.moveGroupName(tx, userID, groupID, "", trashed.Group.GroupName); err != nil {
+			return err
+		}
+		// Synced as an update of the group, which is no longer deleted.
+		trashed.Group.UpdatedAt = time.Now()
+		if err := tx.Create(groupRef, trashed.Group); err != nil {
+			return err
+		}
+		if err := tx.Delete(c.tombstoneRef(userID, groupID)); err != nil {
+			return err
+		}
+		if err := c.writeOutbox(tx, userID, groupID, []events.Event{events.GroupRestored{GroupName: trashed.Group.GroupName}}); err != nil {
+			return err
+		}
+		document := NewGroupDocument(trashed.Group)
+		if _, err := c.appendGroupHistory(tx, NewGroupHistoryEntry(userID, groupID, GroupRestored, principal, document, document)); err != nil {
+			return err
+		}
+		return tx.Delete(trashRef)
+	})
+}
+
+// PurgeUserConnectionGroup - Permanently remove a deleted group on behalf of the caller with principal, releasing
+// its reference to its picture.
+func (c *Connection) PurgeUserConnectionGroup(userID string, groupID string, principal map[string]interface{}) error {
+	_, err := c.purgeTrashedGroup(c.trashRef(userID, groupID), time.Time{}, principal)
+	return err
+}
+
+// PurgeTrashedUserConnectionGroups - Permanently remove up to limit groups deleted before deletedBefore, returning them.
+// The purges are background work, recorded without a principal.
+func (c *Connection) PurgeTrashedUserConnectionGroups(deletedBefore time.Time, limit int) ([]TrashedGroup, error) {
+	docs, err := c.Client.Collection(trashCollection).Where("deleted_at", "<", deletedBefore).OrderBy("deleted_at", firestore.Asc).Limit(limit).Documents(c.Context).GetAll()
+	if err != nil {
+		return nil, err
+	}
+
+	purged := []TrashedGroup{}
+	for _, doc := range docs {
+		trashed, err := c.purgeTrashedGroup(doc.Ref, deletedBefore, nil)
+		if status.Code(err) == codes.NotFound {
+			// Restored or purged since the query.
+			continue
+		}
+		if err != nil {
+			return purged, err
+		}
+		if trashed != nil {
+			purged = append(purged, *trashed)
+		}
+	}
+
+	return purged, nil
+}
+
+// purgeTrashedGroup - Delete a trash document, release its picture and record the purge by the caller with
+// principal in one transaction. A non-zero deletedBefore leaves groups deleted again since then alone, returning nil.
+func (c *Connection) purgeTrashedGroup(trashRef *firestore.DocumentRef, deletedBefore time.Time, principal map[string]interface{}) (*TrashedGroup, error) {
+	var purged *TrashedGroup
+	err := c.Client.RunTransaction(c.Context, func(ctx context.Context, tx *firestore.Transaction) error {
+		purged = nil
+
+		trashDoc, err := tx.Get(trashRef)
+		if err != nil {
+			return err
+		}
+
+		var trashed TrashedGroup
+		if err := trashDoc.DataTo(&trashed); err != nil {
+			return err
+		}
+		if !deletedBefore.IsZero() && !trashed.DeletedAt.Before(deletedBefore) {
+			return nil
+		}
+
+		if err := c.swapGroupPicRefs(tx, trashed.Group.GroupPic, ""); err != nil {
+			return err
+		}
+		document := NewGroupDocument(trashed.Group)
+		if _, err := c.appendGroupHistory(tx, NewGroupHistoryEntry(trashed.UserID, trashed.Group.GroupID, GroupPurged, principal, document, document)); err != nil {
+			return err
+		}
+
+		purged = &trashed
+		return tx.Delete(trashRef)
+	})
+	return purged, err
+}
@@ -0,0 +1,322 @@
+package database
+
+import (
+	"errors"
+	"time"
+
+	"golang.org/x/net/context"
+	"google.golang.org/api/iterator"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"cloud.google.com/go/firestore"
+)
+
+// Webhook delivery states. Claimed deliveries stay pending, hidden until their lease expires.
+const (
+	WebhookDeliveryPending   = "pending"
+	WebhookDeliveryDelivered = "delivered"
+	// WebhookDeliveryDead - gave up after the last attempt, listed as a dead letter until redelivered.
+	WebhookDeliveryDead = "dead"
+)
+
+// Firestore collections of webhooks.
+const (
+	webhookSubscriptionsCollection = "webhook_subscriptions"
+	webhookDeliveriesCollection    = "webhook_deliveries"
+)
+
+var (
+	errWebhookNotFound = status.Error(codes.NotFound, "row does not found")
+	// errDeliveryTaken - a candidate delivery was claimed by another worker in the meantime.
+	errDeliveryTaken = errors.New("webhook delivery already claimed")
+	// ErrDeliveryNotDead - only dead letters can be redelivered.
+	ErrDeliveryNotDead = status.Error(codes.FailedPrecondition, "only dead deliveries can be redelivered")
+)
+
+// WebhookSubscription - Endpoint of a partner called when the groups of a user change.
+type WebhookSubscription struct {
+	SubscriptionID string `firestore:"subscription_id" json:"subscription_id"`
+	UserID         string `firestore:"user_id" json:"user_id"`
+	URL            string `firestore:"url" json:"url"`
+	// Secret - key of the HMAC signature of the deliveries, only shown when the subscription is created.
+	Secret string `firestore:"secret" json:"secret,omitempty"`
+	// EventTypes - events delivered, every event when empty.
+	EventTypes []string  `firestore:"event_types" json:"event_types"`
+	CreatedAt  time.Time `firestore:"created_at" json:"created_at"`
+}
+
+// Wants - Whether events of eventType are delivered to the subscription.
+func (s WebhookSubscription) Wants(eventType string) bool {
+	if len(s.EventTypes) == 0 {
+		return true
+	}
+	for _, wanted := range s.EventTypes {
+		if wanted == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// WebhookAttempt - One try of a delivery, as shown in the delivery log.
+type WebhookAttempt struct {
+	At time.Time `firestore:"at" json:"at"`
+	// StatusCode - answer of the endpoint, 0 when it could not be reached.
+	StatusCode int           `firestore:"status_code" json:"status_code"`
+	Error      string        `firestore:"error" json:"error"`
+	Duration   time.Duration `firestore:"duration" json:"duration_ns"`
+}
+
+// WebhookDelivery - An event to deliver to a subscription, with the log of its attempts.
+type WebhookDelivery struct {
+	DeliveryID     string `firestore:"delivery_id" json:"delivery_id"`
+	SubscriptionID string `firestore:"subscription_id" json:"subscription_id"`
+	UserID         string `firestore:"user_id" json:"user_id"`
+	EventID        string `firestore:"event_id" json:"event_id"`
+	EventType      string `firestore:"event_type" json:"event_type"`
+	// Payload - the event envelope as JSON, the body of every attempt.
+	Payload  []byte           `firestore:"payload" json:"-"`
+	Status   string           `firestore:"status" json:"status"`
+	Attempts []WebhookAttempt `firestore:"attempts" json:"attempts"`
+	// AttemptsBeforeRedelivery - attempts logged before the latest manual redelivery, which starts a new series
+	// of retries.
+	AttemptsBeforeRedelivery int `firestore:"attempts_before_redelivery" json:"attempts_before_redelivery"`
+	// AvailableAt - when the delivery can next be claimed, either its retry time or the end of its current lease.
+	AvailableAt time.Time `firestore:"available_at" json:"available_at"`
+	CreatedAt   time.Time `firestore:"created_at" json:"created_at"`
+}
+
+// CreateWebhookSubscription - Persist a new subscription, returning its ID.
+func (c *Connection) CreateWebhookSubscription(subscription WebhookSubscription) (string, error) {
+	subscriptionRef := c.Client.Collection(webhookSubscriptionsCollection).NewDoc()
+	subscription.SubscriptionID = subscriptionRef.ID
+
+	if _, err := subscriptionRef.Create(c.Context, subscription); err != nil {
+		return "", err
+	}
+	return subscription.SubscriptionID, nil
+}
+
+// ListWebhookSubscriptions - Subscriptions of a user, oldest first.
+func (c *Connection) ListWebhookSubscriptions(userID string) ([]WebhookSubscription, error) {
+	docs, err := c.Client.Collection(webhookSubscriptionsCollection).Where("user_id", "==", userID).OrderBy("created_at", firestore.Asc).Documents(c.Context).GetAll()
+	if err != nil {
+		return nil, err
+	}
+
+	subscriptions := []WebhookSubscription{}
+	for _, doc := range docs {
+		var subscription WebhookSubscription
+		if err := doc.DataTo(&subscription); err != nil {
+			return nil, err
+		}
+		subscriptions = append(subscriptions, subscription)
+	}
+	return subscriptions, nil
+}
+
+// GetWebhookSubscription - function
+func (c *Connection) GetWebhookSubscription(userID string, subscriptionID string) (WebhookSubscription, error) {
+	var subscription WebhookSubscription
+
+	doc, err := c.Client.Collection(webhookSubscriptionsCollection).Doc(subscriptionID).Get(c.Context)
+	if err != nil {
+		return subscription, err
+	}
+	if err := doc.DataTo(&subscription); err != nil {
+		return subscription, err
+	}
+
+	// Subscriptions of other users do not exist for this one.
+	if subscription.UserID != userID {
+		return WebhookSubscription{}, errWebhookNotFound
+	}
+	return subscription, nil
+}
+
+// DeleteWebhookSubscription - Remove a subscription. Its pending deliveries become dead letters when attempted,
+// its delivery log is kept.
+func (c *Connection) DeleteWebhookSubscription(userID string, subscriptionID string) error {
+	subscriptionRef := c.Client.Collection(webhookSubscriptionsCollection).Doc(subscriptionID)
+
+	return c.Client.RunTransaction(c.Context, func(ctx context.Context, tx *firestore.Transaction) error {
+		doc, err := tx.Get(subscriptionRef)
+		if err != nil {
+			return err
+		}
+		var subscription WebhookSubscription
+		if err := doc.DataTo(&subscription); err != nil {
+			return err
+		}
+		if subscription.UserID != userID {
+			return errWebhookNotFound
+		}
+		return tx.Delete(subscriptionRef)
+	})
+}
+
+// WebhookDeliveryID - ID of the delivery of an event to a subscription, so that queueing it again is a no-op.
+func WebhookDeliveryID(eventID string, subscriptionID string) string {
+	return eventID + "_" + subscriptionID
+}
+
+// EnqueueWebhookDeliveries - Persist new deliveries, available immediately. A delivery keeps the DeliveryID it
+// is given, and is skipped when a delivery with that ID already exists.
+func (c *Connection) EnqueueWebhookDeliveries(deliveries []WebhookDelivery) error {
+	for _, delivery := range deliveries {
+		deliveryRef := c.Client.Collection(webhookDeliveriesCollection).NewDoc()
+		if delivery.DeliveryID != "" {
+			deliveryRef = c.Client.Collection(webhookDeliveriesCollection).Doc(delivery.DeliveryID)
+		}
+		_, err := deliveryRef.Create(c.Context, newWebhookDelivery(deliveryRef.ID, delivery))
+		if err != nil && status.Code(err) != codes.AlreadyExists {
+			return err
+		}
+	}
+	return nil
+}
+
+// newWebhookDelivery - Pending delivery with ID and without attempts yet.
+func newWebhookDelivery(deliveryID string, delivery WebhookDelivery) WebhookDelivery {
+	delivery.DeliveryID = deliveryID
+	delivery.Status = WebhookDeliveryPending
+	delivery.Attempts = []WebhookAttempt{}
+	delivery.CreatedAt = time.Now()
+	if delivery.AvailableAt.IsZero() {
+		delivery.AvailableAt = delivery.CreatedAt
+	}
+	return delivery
+}
+
+// ClaimWebhookDeliveries - Lease up to limit available deliveries, oldest first.
+// Each delivery is leased in its own transaction so that concurrent workers never claim the same delivery.
+func (c *Connection) ClaimWebhookDeliveries(now time.Time, lease time.Duration, limit int) ([]WebhookDelivery, error) {
+
+	candidates, err := c.Client.Collection(webhookDeliveriesCollection).
+		Where("status", "==", WebhookDeliveryPending).
+		Where("available_at", "<=", now).
+		OrderBy("available_at", firestore.Asc).
+		Limit(limit).
+		Documents(c.Context).GetAll()
+	if err != nil {
+		return nil, err
+	}
+
+	claimed := []WebhookDelivery{}
+	for _, candidate := range candidates {
+		var delivery WebhookDelivery
+
+		err := c.Client.RunTransaction(c.Context, func(ctx context.Context, tx *firestore.Transaction) error {
+			doc, err := tx.Get(candidate.Ref)
+			if err != nil {
+				return err
+			}
+			if err := doc.DataTo(&delivery); err != nil {
+				return err
+			}
+			if delivery.Status != WebhookDeliveryPending || delivery.AvailableAt.After(now) {
+				return errDeliveryTaken
+			}
+
+			delivery.AvailableAt = now.Add(lease)
+			return tx.Update(candidate.Ref, []firestore.Update{{Path: "available_at", Value: delivery.AvailableAt}})
+		})
+		if err == errDeliveryTaken {
+			continue
+		}
+		if err != nil {
+			return claimed, err
+		}
+
+		claimed = append(claimed, delivery)
+	}
+
+	return claimed, nil
+}
+
+// SeriesAttempts - Attempts since the delivery was queued or last redelivered.
+func (d WebhookDelivery) SeriesAttempts() int {
+	return len(d.Attempts) - d.AttemptsBeforeRedelivery
+}
+
+// RecordWebhookAttempt - Log an attempt of a claimed delivery and move it to deliveryStatus, a pending delivery
+// being retried at availableAt.
+func (c *Connection) RecordWebhookAttempt(deliveryID string, attempt WebhookAttempt, deliveryStatus string, availableAt time.Time) error {
+	_, err := c.Client.Collection(webhookDeliveriesCollection).Doc(deliveryID).Update(c.Context, []firestore.Update{
+		{Path: "attempts", Value: firestore.ArrayUnion(attempt)},
+		{Path: "status", Value: deliveryStatus},
+		{Path: "available_at", Value: availableAt},
+	})
+	return err
+}
+
+// ListWebhookDeliveries - Deliveries of a subscription in deliveryStatus, every status when empty, most recent
+// first, skipping offset deliveries and returning at most limit, with the total number of deliveries.
+func (c *Connection) ListWebhookDeliveries(userID string, subscriptionID string, deliveryStatus string, offset int, limit int) ([]WebhookDelivery, int, error) {
+
+	query := c.Client.Collection(webhookDeliveriesCollection).Where("user_id", "==", userID).Where("subscription_id", "==", subscriptionID)
+	if deliveryStatus != "" {
+		query = query.Where("status", "==", deliveryStatus)
+	}
+
+	counts, err := query.NewAggregationQuery().WithCount("total").Get(c.Context)
+	if err != nil {
+		return nil, 0, err
+	}
+	total := 0
+	if count, ok := counts["total"].(interface{ GetIntegerValue() int64 }); ok {
+		total = int(count.GetIntegerValue())
+	}
+
+	docs := query.OrderBy("created_at", firestore.Desc).Offset(offset).Limit(limit).Documents(c.Context)
+	defer docs.Stop()
+
+	deliveries := []WebhookDelivery{}
+	for {
+		doc, err := docs.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, 0, err
+		}
+
+		var delivery WebhookDelivery
+		if err := doc.DataTo(&delivery); err != nil {
+			return nil, 0, err
+		}
+		deliveries = append(deliveries, delivery)
+	}
+
+	return deliveries, total, nil
+}
+
+// RedeliverWebhookDelivery - Queue a dead letter again at availableAt, keeping its log.
+// Fails with ErrDeliveryNotDead for deliveries still pending or delivered.
+func (c *Connection) RedeliverWebhookDelivery(userID string, subscriptionID string, deliveryID string, availableAt time.Time) error {
+	deliveryRef := c.Client.Collection(webhookDeliveriesCollection).Doc(deliveryID)
+
+	return c.Client.RunTransaction(c.Context, func(ctx context.Context, tx *firestore.Transaction) error {
+		doc, err := tx.Get(deliveryRef)
+		if err != nil {
+			return err
+		}
+		var delivery WebhookDelivery
+		if err := doc.DataTo(&delivery); err != nil {
+			return err
+		}
+		if delivery.UserID != userID || delivery.SubscriptionID != subscriptionID {
+			return errWebhookNotFound
+		}
+		if delivery.Status != WebhookDeliveryDead {
+			return ErrDeliveryNotDead
+		}
+
+		return tx.Update(deliveryRef, []firestore.Update{
+			{Path: "status", Value: WebhookDeliveryPending},
+			{Path: "available_at", Value: availableAt},
+			{Path: "attempts_before_redelivery", Value: len(delivery.Attempts)},
+		})
+	})
+}
@@ -0,0 +1,81 @@
+package events
+
+import (
+	"context"
+	"sync"
+)
+
+// ChannelSink - In-process fan-out of events to the subscribers of this instance.
+type ChannelSink struct {
+	mx          sync.Mutex
+	subscribers map[*subscriber]bool
+}
+
+type subscriber struct {
+	events chan Envelope
+	done   chan struct{}
+}
+
+// NewChannelSink - Sink without subscribers, events published before the first subscription are dropped.
+func NewChannelSink() *ChannelSink {
+	return &ChannelSink{subscribers: map[*subscriber]bool{}}
+}
+
+// Name - function
+func (s *ChannelSink) Name() string {
+	return "channel"
+}
+
+// Subscribe - Receive the events published from now on until cancel is called. Publish waits for a subscriber
+// whose buffer is full, so subscribers must keep reading.
+func (s *ChannelSink) Subscribe(buffer int) (<-chan Envelope, func()) {
+	sub := &subscriber{events: make(chan Envelope, buffer), done: make(chan struct{})}
+
+	s.mx.Lock()
+	s.subscribers[sub] = true
+	s.mx.Unlock()
+
+	var once sync.Once
+	cancel := func() {
+		once.Do(func() {
+			s.mx.Lock()
+			delete(s.subscribers, sub)
+			s.mx.Unlock()
+			close(sub.done)
+		})
+	}
+	return sub.events, cancel
+}
+
+// Publish - Hand event to every subscriber.
+func (s *ChannelSink) Publish(ctx context.Context, event Envelope) error {
+	s.mx.Lock()
+	subscribers := make([]*subscriber, 0, len(s.subscribers))
+	for sub := range s.subscribers {
+		subscribers = append(subscribers, sub)
+	}
+	s.mx.Unlock()
+
+	for _, sub := range subscribers {
+		select {
+		case sub.events <- event:
+		case <-sub.done:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+// Close - Stop waiting for the current subscribers.
+func (s *ChannelSink) Close() error {
+	s.mx.Lock()
+	subscribers := s.subscribers
+	s.subscribers = map[*subscriber]bool{}
+	s.mx.Unlock()
+
+	for sub := range subscribers {
+		close(sub.done)
+	}
+	return nil
+}
@@ -0,0 +1,153 @@
+// Package events - Domain events of connection groups, delivered to other services through the outbox.
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// Event types.
+const (
+	TypeGroupCreated   = "GroupCreated"
+	TypeGroupRenamed   = "GroupRenamed"
+	TypeMemberAdded    = "MemberAdded"
+	TypeMemberRemoved  = "MemberRemoved"
+	TypeGroupDeleted   = "GroupDeleted"
+	TypeGroupRestored  = "GroupRestored"
+	TypePictureChanged = "PictureChanged"
+)
+
+// Types - Every event type.
+var Types = []string{
+	TypeGroupCreated, TypeGroupRenamed, TypeMemberAdded, TypeMemberRemoved, TypeGroupDeleted, TypeGroupRestored,
+	TypePictureChanged,
+}
+
+// Event - Change of a group, the data of an Envelope.
+type Event interface {
+	EventType() string
+}
+
+// GroupCreated - A group was created.
+type GroupCreated struct {
+	GroupName         string   `json:"group_name"`
+	GroupPic          string   `json:"group_pic,omitempty"`
+	ConnectionUserIDs []string `json:"connection_user_ids"`
+}
+
+// GroupRenamed - The name of a group changed.
+type GroupRenamed struct {
+	OldName string `json:"old_name"`
+	NewName string `json:"new_name"`
+}
+
+// MemberAdded - A connection joined a group.
+type MemberAdded struct {
+	MemberUserID string `json:"member_user_id"`
+}
+
+// MemberRemoved - A connection left a group.
+type MemberRemoved struct {
+	MemberUserID string `json:"member_user_id"`
+}
+
+// GroupDeleted - A group was moved to the trash.
+type GroupDeleted struct {
+	GroupName string `json:"group_name"`
+}
+
+// GroupRestored - A deleted group was restored from the trash.
+type GroupRestored struct {
+	GroupName string `json:"group_name"`
+}
+
+// PictureChanged - The picture of a group was set, replaced or removed. Picture IDs are empty without a picture.
+type PictureChanged struct {
+	OldGroupPic string `json:"old_group_pic"`
+	NewGroupPic string `json:"new_group_pic"`
+}
+
+// EventType - function
+func (GroupCreated) EventType() string { return TypeGroupCreated }
+
+// EventType - function
+func (GroupRenamed) EventType() string { return TypeGroupRenamed }
+
+// EventType - function
+func (MemberAdded) EventType() string { return TypeMemberAdded }
+
+// EventType - function
+func (MemberRemoved) EventType() string { return TypeMemberRemoved }
+
+// EventType - function
+func (GroupDeleted) EventType() string { return TypeGroupDeleted }
+
+// EventType - function
+func (GroupRestored) EventType() string { return TypeGroupRestored }
+
+// EventType - function
+func (PictureChanged) EventType() string { return TypePictureChanged }
+
+// Envelope - An event with the group it is about, as published to sinks. Events are delivered at least once,
+// consumers deduplicate on EventID.
+type Envelope struct {
+	EventID    string          `json:"event_id"`
+	Type       string          `json:"type"`
+	UserID     string          `json:"user_id"`
+	GroupID    string          `json:"group_id"`
+	OccurredAt time.Time       `json:"occurred_at"`
+	Data       json.RawMessage `json:"data"`
+}
+
+// NewEnvelope - Envelope of event, EventID is left to the outbox.
+func NewEnvelope(userID string, groupID string, occurredAt time.Time, event Event) (Envelope, error) {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return Envelope{}, err
+	}
+	return Envelope{Type: event.EventType(), UserID: userID, GroupID: groupID, OccurredAt: occurredAt, Data: data}, nil
+}
+
+// Decode - Typed event of the envelope, e.g. a GroupRenamed value for TypeGroupRenamed.
+func (e Envelope) Decode() (Event, error) {
+	switch e.Type {
+	case TypeGroupCreated:
+		var event GroupCreated
+		err := json.Unmarshal(e.Data, &event)
+		return event, err
+	case TypeGroupRenamed:
+		var event GroupRenamed
+		err := json.Unmarshal(e.Data, &event)
+		return event, err
+	case TypeMemberAdded:
+		var event MemberAdded
+		err := json.Unmarshal(e.Data, &event)
+		return event, err
+	case TypeMemberRemoved:
+		var event MemberRemoved
+		err := json.Unmarshal(e.Data, &event)
+		return event, err
+	case TypeGroupDeleted:
+		var event GroupDeleted
+		err := json.Unmarshal(e.Data, &event)
+		return event, err
+	case TypeGroupRestored:
+		var event GroupRestored
+		err := json.Unmarshal(e.Data, &event)
+		return event, err
+	case TypePictureChanged:
+		var event PictureChanged
+		err := json.Unmarshal(e.Data, &event)
+		return event, err
+	}
+	return nil, fmt.Errorf("unknown event type %q", e.Type)
+}
+
+// Sink - Destination of dispatched events. Publish returns once the event is accepted, an error has it retried.
+type Sink interface {
+	Name() string
+	Publish(ctx context.Context, event Envelope) error
+	Close() error
+}
@@ -0,0 +1,263 @@
+package events
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testEnvelope(t *testing.T, event Event) Envelope {
+	envelope, err := NewEnvelope("user_1", "group_1", time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC), event)
+	if err != nil {
+		t.Fatal(err)
+	}
+	envelope.EventID = "event_1"
+	return envelope
+}
+
+func TestEnvelopeDecode(t *testing.T) {
+
+	testCases := []Event{
+		GroupCreated{GroupName: "Family", ConnectionUserIDs: []string{"user_2"}},
+		GroupRenamed{OldName: "Family", NewName: "Relatives"},
+		MemberAdded{MemberUserID: "user_3"},
+		MemberRemoved{MemberUserID: "user_2"},
+		GroupDeleted{GroupName: "Relatives"},
+		GroupRestored{GroupName: "Relatives"},
+		PictureChanged{OldGroupPic: "", NewGroupPic: "pic_1"},
+	}
+
+	for _, event := range testCases {
+
+		t.Run(event.EventType(), func(t *testing.T) {
+			envelope := testEnvelope(t, event)
+			if envelope.Type != event.EventType() {
+				t.Fatalf("%s != %s", envelope.Type, event.EventType())
+			}
+
+			decoded, err := envelope.Decode()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(decoded, event) {
+				t.Fatalf("%#v != %#v", decoded, event)
+			}
+		})
+	}
+
+	if _, err := (Envelope{Type: "GroupExploded", Data: json.RawMessage(`{}`)}).Decode(); err == nil {
+		t.Fatal("unknown event type decoded")
+	}
+}
+
+func TestChannelSink(t *testing.T) {
+	sink := NewChannelSink()
+	envelope := testEnvelope(t, MemberAdded{MemberUserID: "user_3"})
+
+	// No subscriber, nothing to wait for.
+	if err := sink.Publish(context.Background(), envelope); err != nil {
+		t.Fatal(err)
+	}
+
+	first, cancelFirst := sink.Subscribe(1)
+	second, cancelSecond := sink.Subscribe(1)
+	if err := sink.Publish(context.Background(), envelope); err != nil {
+		t.Fatal(err)
+	}
+	for _, events := range []<-chan Envelope{first, second} {
+		if got := <-events; got.EventID != envelope.EventID {
+			t.Fatalf("%s != %s", got.EventID, envelope.EventID)
+		}
+	}
+
+	// A full subscriber holds publishing back until it cancels.
+	cancelSecond()
+	sink.Publish(context.Background(), envelope)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := sink.Publish(ctx, envelope); err != context.DeadlineExceeded {
+		t.Fatalf("%v != %v", err, context.DeadlineExceeded)
+	}
+	cancelFirst()
+	if err := sink.Publish(context.Background(), envelope); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFileSink(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.jsonl")
+	sink, err := NewFileSink(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	published := []Envelope{testEnvelope(t, GroupCreated{GroupName: "Family"}), testEnvelope(t, GroupDeleted{GroupName: "Family"})}
+	for _, envelope := range published {
+		if err := sink.Publish(context.Background(), envelope); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := sink.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	written := []Envelope{}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var envelope Envelope
+		if err := json.Unmarshal(scanner.Bytes(), &envelope); err != nil {
+			t.Fatal(err)
+		}
+		written = append(written, envelope)
+	}
+	if !reflect.DeepEqual(written, published) {
+		t.Fatalf("%+v != %+v", written, published)
+	}
+}
+
+func TestWebhookSink(t *testing.T) {
+	status := http.StatusNoContent
+	var received Envelope
+	var eventType string
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		eventType = r.Header.Get(HeaderEventType)
+		json.NewDecoder(r.Body).Decode(&received)
+		rw.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	sink := NewWebhookSink(server.URL, nil)
+	envelope := testEnvelope(t, GroupRenamed{OldName: "Family", NewName: "Relatives"})
+
+	if err := sink.Publish(context.Background(), envelope); err != nil {
+		t.Fatal(err)
+	}
+	if eventType != TypeGroupRenamed || !reflect.DeepEqual(received, envelope) {
+		t.Fatalf("unexpected delivery %s %+v", eventType, received)
+	}
+
+	status = http.StatusServiceUnavailable
+	if err := sink.Publish(context.Background(), envelope); err == nil {
+		t.Fatal("failed delivery accepted")
+	}
+}
+
+// fakeNATSServer - Broker accepting one connection, answering every PUB with reply, and recording the
+// subjects and payloads published.
+func fakeNATSServer(t *testing.T, reply string) (string, <-chan string) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	published := make(chan string, 10)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		reader := bufio.NewReader(conn)
+
+		io.WriteString(conn, "INFO {\"server_id\":\"fake\"}\r\n")
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				return
+			}
+			switch fields := strings.Fields(line); fields[0] {
+			case "PUB":
+				payload, _ := reader.ReadString('\n')
+				published <- fields[1] + " " + strings.TrimRight(payload, "\r\n")
+				io.WriteString(conn, reply)
+			case "PING":
+				io.WriteString(conn, "PONG\r\n")
+			}
+		}
+	}()
+
+	return "nats://" + listener.Addr().String(), published
+}
+
+func TestNATSSink(t *testing.T) {
+	envelope := testEnvelope(t, MemberRemoved{MemberUserID: "user_2"})
+	payload, _ := json.Marshal(envelope)
+
+	url, published := fakeNATSServer(t, "")
+	sink, err := NewNATSSink(url, "connections.groups")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sink.Close()
+
+	if err := sink.Publish(context.Background(), envelope); err != nil {
+		t.Fatal(err)
+	}
+	if got, expected := <-published, "connections.groups.MemberRemoved "+string(payload); got != expected {
+		t.Fatalf("%s != %s", got, expected)
+	}
+
+	url, _ = fakeNATSServer(t, "-ERR 'Permissions Violation'\r\n")
+	rejecting, err := NewNATSSink(url, "connections.groups")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rejecting.Close()
+	if err := rejecting.Publish(context.Background(), envelope); err == nil {
+		t.Fatal("rejected publish accepted")
+	}
+
+	if _, err := NewNATSSink("http://localhost", "connections.groups"); err == nil {
+		t.Fatal("non nats url accepted")
+	}
+}
+
+type TestCaseSignature struct {
+	name    string
+	secret  string
+	header  string
+	body    []byte
+	now     time.Time
+	isValid bool
+}
+
+func TestSignature(t *testing.T) {
+	sentAt := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	body := []byte(`{"type":"GroupCreated"}`)
+	header := Sign("whsec_test", sentAt, body)
+
+	testCases := []TestCaseSignature{
+		{name: "Valid", secret: "whsec_test", header: header, body: body, now: sentAt.Add(time.Minute), isValid: true},
+		{name: "OtherSecret", secret: "whsec_other", header: header, body: body, now: sentAt, isValid: false},
+		{name: "AlteredBody", secret: "whsec_test", header: header, body: []byte(`{"type":"GroupDeleted"}`), now: sentAt, isValid: false},
+		{name: "Replayed", secret: "whsec_test", header: header, body: body, now: sentAt.Add(time.Hour), isValid: false},
+		{name: "Malformed", secret: "whsec_test", header: "v1=abc", body: body, now: sentAt, isValid: false},
+	}
+
+	for _, test := range testCases {
+
+		t.Run(test.name, func(t *testing.T) {
+			err := VerifySignature(test.secret, test.header, test.body, test.now, 5*time.Minute)
+			if (err == nil) != test.isValid {
+				t.Fatalf("unexpected verification result %v", err)
+			}
+		})
+	}
+}
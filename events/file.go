@@ -0,0 +1,52 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"sync"
+)
+
+// FileSink - Append events to a file as JSON lines.
+type FileSink struct {
+	mx   sync.Mutex
+	file *os.File
+}
+
+// NewFileSink - Sink appending to the file at path, created when missing.
+func NewFileSink(path string) (*FileSink, error) {
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	return &FileSink{file: file}, nil
+}
+
+// Name - function
+func (s *FileSink) Name() string {
+	return "file"
+}
+
+// Publish - Write event on its own line, synced to disk before returning.
+func (s *FileSink) Publish(ctx context.Context, event Envelope) error {
+	line, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	if _, err := s.file.Write(line); err != nil {
+		return err
+	}
+	return s.file.Sync()
+}
+
+// Close - function
+func (s *FileSink) Close() error {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	return s.file.Close()
+}
@@ -0,0 +1,179 @@
+package events
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// natsDefaultPort - client port of NATS servers.
+const natsDefaultPort = "4222"
+
+// natsTimeout - deadline of a publish when ctx has none.
+const natsTimeout = 10 * time.Second
+
+// NATSSink - Publish events to a NATS-compatible broker on <subject>.<event type>, speaking the plain text
+// protocol. Every publish is confirmed by a PING round trip, so an accepted event has reached the broker.
+type NATSSink struct {
+	addr     string
+	user     string
+	password string
+	subject  string
+	dialer   net.Dialer
+
+	mx     sync.Mutex
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+// natsConnect - CONNECT options sent after the INFO of the server.
+type natsConnect struct {
+	Verbose  bool   `json:"verbose"`
+	Pedantic bool   `json:"pedantic"`
+	Name     string `json:"name"`
+	User     string `json:"user,omitempty"`
+	Pass     string `json:"pass,omitempty"`
+}
+
+// NewNATSSink - Sink publishing to the broker of a nats://[user:password@]host[:port] URL. The connection is
+// opened on the first publish and again after any failure.
+func NewNATSSink(rawURL string, subject string) (*NATSSink, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Scheme != "nats" || u.Hostname() == "" {
+		return nil, fmt.Errorf("nats url must look like nats://host[:port], got %q", rawURL)
+	}
+	if subject == "" || strings.ContainsAny(subject, " \t\r\n*>") {
+		return nil, fmt.Errorf("invalid nats subject %q", subject)
+	}
+
+	port := u.Port()
+	if port == "" {
+		port = natsDefaultPort
+	}
+	sink := &NATSSink{addr: net.JoinHostPort(u.Hostname(), port), subject: subject}
+	if u.User != nil {
+		sink.user = u.User.Username()
+		sink.password, _ = u.User.Password()
+	}
+	return sink, nil
+}
+
+// Name - function
+func (s *NATSSink) Name() string {
+	return "nats"
+}
+
+// Publish - Publish event and wait for the broker to confirm it.
+func (s *NATSSink) Publish(ctx context.Context, event Envelope) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	if err := s.publish(ctx, s.subject+"."+event.Type, payload); err != nil {
+		s.disconnect()
+		return err
+	}
+	return nil
+}
+
+func (s *NATSSink) publish(ctx context.Context, subject string, payload []byte) error {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(natsTimeout)
+	}
+
+	if s.conn == nil {
+		if err := s.connect(ctx, deadline); err != nil {
+			return err
+		}
+	}
+	if err := s.conn.SetDeadline(deadline); err != nil {
+		return err
+	}
+
+	message := fmt.Sprintf("PUB %s %d\r\n%s\r\nPING\r\n", subject, len(payload), payload)
+	if _, err := s.conn.Write([]byte(message)); err != nil {
+		return err
+	}
+
+	// The server handles commands in order, its PONG means the message was processed.
+	for {
+		line, err := s.readLine()
+		if err != nil {
+			return err
+		}
+		switch {
+		case line == "PONG":
+			return nil
+		case line == "PING":
+			if _, err := s.conn.Write([]byte("PONG\r\n")); err != nil {
+				return err
+			}
+		case strings.HasPrefix(line, "-ERR"):
+			return fmt.Errorf("nats: %s", strings.TrimSpace(strings.TrimPrefix(line, "-ERR")))
+		}
+	}
+}
+
+// connect - Open the connection: read the INFO of the server and answer with CONNECT.
+func (s *NATSSink) connect(ctx context.Context, deadline time.Time) error {
+	conn, err := s.dialer.DialContext(ctx, "tcp", s.addr)
+	if err != nil {
+		return err
+	}
+	s.conn = conn
+	s.reader = bufio.NewReader(conn)
+	if err := conn.SetDeadline(deadline); err != nil {
+		return err
+	}
+
+	line, err := s.readLine()
+	if err != nil {
+		return err
+	}
+	if !strings.HasPrefix(line, "INFO") {
+		return errors.New("nats: server did not send INFO")
+	}
+
+	options, err := json.Marshal(natsConnect{Name: "connections-events", User: s.user, Pass: s.password})
+	if err != nil {
+		return err
+	}
+	_, err = conn.Write([]byte("CONNECT " + string(options) + "\r\n"))
+	return err
+}
+
+func (s *NATSSink) readLine() (string, error) {
+	line, err := s.reader.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+func (s *NATSSink) disconnect() {
+	if s.conn != nil {
+		s.conn.Close()
+		s.conn = nil
+		s.reader = nil
+	}
+}
+
+// Close - function
+func (s *NATSSink) Close() error {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	s.disconnect()
+	return nil
+}
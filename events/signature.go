@@ -0,0 +1,62 @@
+package events
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SignatureHeader - header of webhook deliveries carrying their HMAC signature.
+const SignatureHeader = "X-Webhook-Signature"
+
+var (
+	errMalformedSignature = errors.New("malformed webhook signature")
+	errSignatureMismatch  = errors.New("webhook signature does not match")
+	errSignatureExpired   = errors.New("webhook signature is too old")
+)
+
+// Sign - Signature header of body sent at timestamp: t=<unix seconds>,v1=<hex HMAC-SHA256 of "<t>.<body>" keyed
+// with secret>. Signing the timestamp lets receivers reject replayed deliveries.
+func Sign(secret string, timestamp time.Time, body []byte) string {
+	t := strconv.FormatInt(timestamp.Unix(), 10)
+	return "t=" + t + ",v1=" + signature(secret, t, body)
+}
+
+// VerifySignature - Check the signature header of a delivery of body, rejecting signatures older than tolerance.
+func VerifySignature(secret string, header string, body []byte, now time.Time, tolerance time.Duration) error {
+	var t, v1 string
+	for _, part := range strings.Split(header, ",") {
+		key, value, _ := strings.Cut(strings.TrimSpace(part), "=")
+		switch key {
+		case "t":
+			t = value
+		case "v1":
+			v1 = value
+		}
+	}
+
+	unix, err := strconv.ParseInt(t, 10, 64)
+	if err != nil || v1 == "" {
+		return errMalformedSignature
+	}
+	if !hmac.Equal([]byte(v1), []byte(signature(secret, t, body))) {
+		return errSignatureMismatch
+	}
+	if age := now.Sub(time.Unix(unix, 0)); age > tolerance || age < -tolerance {
+		return fmt.Errorf("%w (%s)", errSignatureExpired, age)
+	}
+	return nil
+}
+
+func signature(secret string, t string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(t))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,109 @@
+// Package groupname normalizes and validates the names users give their groups.
+package groupname
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/rivo/uniseg"
+	"golang.org/x/text/cases"
+	"golang.org/x/text/unicode/norm"
+)
+
+// Reason - Why a group name was rejected.
+type Reason string
+
+// Rejection reasons.
+const (
+	ReasonEmpty            Reason = "empty"
+	ReasonTooLong          Reason = "too_long"
+	ReasonControlCharacter Reason = "control_character"
+	ReasonBlocked          Reason = "blocked"
+)
+
+// ViolationError - A group name breaking the policy.
+type ViolationError struct {
+	Reason Reason
+	Detail string
+}
+
+func (e *ViolationError) Error() string {
+	return e.Detail
+}
+
+func violation(reason Reason, format string, args ...interface{}) error {
+	return &ViolationError{Reason: reason, Detail: fmt.Sprintf(format, args...)}
+}
+
+// Policy - Rules group names follow.
+type Policy struct {
+	// MaxGraphemes - longest name in user-perceived characters, so that an emoji or an accented letter counts once.
+	MaxGraphemes int
+	// Blocked - reserved or offensive words, rejected as the whole name or as one of its words, ignoring case.
+	Blocked []string
+}
+
+// Normalize - Name in NFC, with surrounding whitespace trimmed and inner runs of whitespace collapsed to a space.
+func Normalize(name string) string {
+	return strings.Join(strings.FieldsFunc(norm.NFC.String(name), unicode.IsSpace), " ")
+}
+
+// Key - Uniqueness key of a name: normalized and case folded, so that "Family" and "family " share it.
+func Key(name string) string {
+	return norm.NFC.String(cases.Fold().String(Normalize(name)))
+}
+
+// Apply - Normalized form of name, or a *ViolationError when the policy rejects it.
+func (p Policy) Apply(name string) (string, error) {
+
+	normalized := Normalize(name)
+	if normalized == "" {
+		return "", violation(ReasonEmpty, "group_name is required")
+	}
+
+	for _, r := range normalized {
+		if disallowed(r) {
+			return "", violation(ReasonControlCharacter, "group_name cannot contain control character %U", r)
+		}
+	}
+
+	if p.MaxGraphemes > 0 && uniseg.GraphemeClusterCount(normalized) > p.MaxGraphemes {
+		return "", violation(ReasonTooLong, "group_name cannot be longer than %d characters", p.MaxGraphemes)
+	}
+
+	if p.blocked(Key(normalized)) {
+		return "", violation(ReasonBlocked, "group_name is not allowed")
+	}
+
+	return normalized, nil
+}
+
+// disallowed - Control and invisible formatting characters, except the joiners emoji and some scripts rely on.
+func disallowed(r rune) bool {
+	switch r {
+	case '\u200c', '\u200d':
+		return false
+	}
+	return unicode.IsControl(r) || unicode.Is(unicode.Cf, r) || r == unicode.ReplacementChar
+}
+
+// blocked - Whether key is a blocked word, or has one among its words.
+func (p Policy) blocked(key string) bool {
+	words := strings.Fields(key)
+	for _, entry := range p.Blocked {
+		entryKey := Key(entry)
+		if entryKey == "" {
+			continue
+		}
+		if key == entryKey {
+			return true
+		}
+		for _, word := range words {
+			if word == entryKey {
+				return true
+			}
+		}
+	}
+	return false
+}
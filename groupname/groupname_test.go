@@ -0,0 +1,73 @@
+package groupname
+
+import (
+	"errors"
+	"testing"
+)
+
+type TestCaseApply struct {
+	name           string
+	input          string
+	expectedName   string
+	expectedReason Reason
+}
+
+func TestApply(t *testing.T) {
+
+	policy := Policy{MaxGraphemes: 7, Blocked: []string{"Admin", "darn"}}
+
+	testCases := []TestCaseApply{
+		{name: "Unchanged", input: "Home", expectedName: "Home"},
+		{name: "TrimmedAndCollapsed", input: "  My \t  Home\n", expectedName: "My Home"},
+		{name: "ComposedToNFC", input: "Famíl", expectedName: "Famíl"},
+		{name: "GraphemesCountOnce", input: "\U0001F468\u200d\U0001F469\u200d\U0001F467é\U0001F1EB\U0001F1F7ab", expectedName: "\U0001F468\u200d\U0001F469\u200d\U0001F467é\U0001F1EB\U0001F1F7ab"},
+		{name: "Empty", input: " \t ", expectedReason: ReasonEmpty},
+		{name: "TooLong", input: "Families", expectedReason: ReasonTooLong},
+		{name: "ControlCharacter", input: "Ho\x07me", expectedReason: ReasonControlCharacter},
+		{name: "BidiOverride", input: "Ho\u202eme", expectedReason: ReasonControlCharacter},
+		{name: "BlockedName", input: "ADMIN", expectedReason: ReasonBlocked},
+		{name: "BlockedWord", input: "Darn X", expectedReason: ReasonBlocked},
+		{name: "BlockedWordInsideWord", input: "Darny", expectedName: "Darny"},
+	}
+
+	for _, test := range testCases {
+
+		t.Run(test.name, func(t *testing.T) {
+			name, err := policy.Apply(test.input)
+
+			var violation *ViolationError
+			if test.expectedReason != "" {
+				if !errors.As(err, &violation) || violation.Reason != test.expectedReason {
+					t.Fatalf("expected %s violation, got %v", test.expectedReason, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if name != test.expectedName {
+				t.Fatalf("expected %q, got %q", test.expectedName, name)
+			}
+		})
+	}
+}
+
+func TestKey(t *testing.T) {
+
+	family := Key("Family")
+	for _, name := range []string{"family ", " FAMILY", "family"} {
+		if Key(name) != family {
+			t.Fatalf("expected %q to share the key of Family, got %q", name, Key(name))
+		}
+	}
+
+	if Key("Famílie") != Key("FAMÍLIE") {
+		t.Fatal("expected composed and decomposed names to share a key")
+	}
+	if Key("Straße") != Key("STRASSE") {
+		t.Fatal("expected full case folding")
+	}
+	if Key("Family") == Key("Families") {
+		t.Fatal("expected distinct names to have distinct keys")
+	}
+}
@@ -0,0 +1,139 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Status values reported for the service and each dependency.
+const (
+	StatusUp   = "up"
+	StatusDown = "down"
+)
+
+// DefaultTimeout - time given to each dependency check when Checker.Timeout is unset.
+const DefaultTimeout = 2 * time.Second
+
+// CheckFunc - Probe a dependency, returning nil when it is reachable.
+type CheckFunc func(ctx context.Context) error
+
+// DependencyStatus - Result of a single dependency check.
+type DependencyStatus struct {
+	Name       string `json:"name"`
+	Status     string `json:"status"`
+	DurationMs int64  `json:"duration_ms"`
+	Error      string `json:"error,omitempty"`
+}
+
+// Report - Body served by the health endpoints.
+type Report struct {
+	Status       string             `json:"status"`
+	Dependencies []DependencyStatus `json:"dependencies"`
+}
+
+// Checker - Runs the registered dependency checks.
+type Checker struct {
+	Timeout time.Duration
+	checks  map[string]CheckFunc
+}
+
+// NewChecker - Checker with a per-check timeout.
+func NewChecker(timeout time.Duration) *Checker {
+	return &Checker{Timeout: timeout, checks: make(map[string]CheckFunc)}
+}
+
+// Register - Add a named dependency check.
+func (c *Checker) Register(name string, check CheckFunc) {
+	c.checks[name] = check
+}
+
+// Check - Run every dependency check concurrently, each bounded by the timeout.
+func (c *Checker) Check(ctx context.Context) Report {
+
+	timeout := c.Timeout
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+
+	report := Report{Status: StatusUp, Dependencies: []DependencyStatus{}}
+
+	var mx sync.Mutex
+	var wg sync.WaitGroup
+
+	for name, check := range c.checks {
+		wg.Add(1)
+		go func(name string, check CheckFunc) {
+			defer wg.Done()
+
+			checkCtx, cancel := context.WithTimeout(ctx, timeout)
+			defer cancel()
+
+			start := time.Now()
+			err := runCheck(checkCtx, check)
+
+			dependency := DependencyStatus{Name: name, Status: StatusUp, DurationMs: time.Since(start).Milliseconds()}
+			if err != nil {
+				dependency.Status = StatusDown
+				dependency.Error = err.Error()
+			}
+
+			mx.Lock()
+			report.Dependencies = append(report.Dependencies, dependency)
+			if err != nil {
+				report.Status = StatusDown
+			}
+			mx.Unlock()
+		}(name, check)
+	}
+
+	wg.Wait()
+
+	sort.Slice(report.Dependencies, func(i, j int) bool {
+		return report.Dependencies[i].Name < report.Dependencies[j].Name
+	})
+
+	return report
+}
+
+// runCheck - Run check, giving up once ctx is done even if the check ignores its context.
+func runCheck(ctx context.Context, check CheckFunc) error {
+	done := make(chan error, 1)
+	go func() { done <- check(ctx) }()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// LivenessHandler - Report the process as alive without probing dependencies.
+func LivenessHandler() http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		writeReport(rw, Report{Status: StatusUp, Dependencies: []DependencyStatus{}})
+	})
+}
+
+// ReadinessHandler - Probe the dependencies, answering 503 when any of them is down.
+func (c *Checker) ReadinessHandler() http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		writeReport(rw, c.Check(r.Context()))
+	})
+}
+
+func writeReport(rw http.ResponseWriter, report Report) {
+	code := http.StatusOK
+	if report.Status != StatusUp {
+		code = http.StatusServiceUnavailable
+	}
+
+	rw.Header().Set("Content-Type", "application/json")
+	rw.Header().Set("Cache-Control", "no-store")
+	rw.WriteHeader(code)
+	_ = json.NewEncoder(rw).Encode(report)
+}
@@ -0,0 +1,89 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+type TestCaseReadiness struct {
+	name           string
+	checks         map[string]CheckFunc
+	expectedCode   int
+	expectedStatus string
+}
+
+func TestReadinessHandler(t *testing.T) {
+
+	up := func(ctx context.Context) error { return nil }
+	down := func(ctx context.Context) error { return errors.New("connection refused") }
+	hang := func(ctx context.Context) error {
+		time.Sleep(time.Second)
+		return nil
+	}
+
+	testCases := []TestCaseReadiness{
+		{
+			name:           "NoDependencies",
+			checks:         map[string]CheckFunc{},
+			expectedCode:   http.StatusOK,
+			expectedStatus: StatusUp,
+		},
+		{
+			name:           "AllUp",
+			checks:         map[string]CheckFunc{"storage": up},
+			expectedCode:   http.StatusOK,
+			expectedStatus: StatusUp,
+		},
+		{
+			name:           "OneDown",
+			checks:         map[string]CheckFunc{"storage": down, "blobs": up},
+			expectedCode:   http.StatusServiceUnavailable,
+			expectedStatus: StatusDown,
+		},
+		{
+			name:           "TimedOut",
+			checks:         map[string]CheckFunc{"storage": hang},
+			expectedCode:   http.StatusServiceUnavailable,
+			expectedStatus: StatusDown,
+		},
+	}
+
+	for _, test := range testCases {
+
+		t.Run(test.name, func(t *testing.T) {
+			checker := NewChecker(50 * time.Millisecond)
+			for name, check := range test.checks {
+				checker.Register(name, check)
+			}
+
+			rec := httptest.NewRecorder()
+			checker.ReadinessHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+
+			if rec.Code != test.expectedCode {
+				t.Fatalf("status %d != %d", rec.Code, test.expectedCode)
+			}
+
+			var report Report
+			if err := json.NewDecoder(rec.Body).Decode(&report); err != nil {
+				t.Fatalf("failed to decode report: %s", err.Error())
+			}
+			if report.Status != test.expectedStatus || len(report.Dependencies) != len(test.checks) {
+				t.Fatalf("unexpected report: %+v", report)
+			}
+		})
+	}
+}
+
+func TestLivenessHandler(t *testing.T) {
+	rec := httptest.NewRecorder()
+	LivenessHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d != %d", rec.Code, http.StatusOK)
+	}
+}
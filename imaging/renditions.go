@@ -0,0 +1,143 @@
+package imaging
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/draw"
+	_ "image/gif" // register the GIF decoder
+	"image/jpeg"
+	"image/png"
+
+	xdraw "golang.org/x/image/draw"
+	_ "golang.org/x/image/webp" // register the WebP decoder
+)
+
+// jpegQuality - quality of JPEG encoded renditions.
+const jpegQuality = 85
+
+// Spec - A rendition to produce.
+type Spec struct {
+	Name string
+	// Size - bounding box of the rendition in pixels. Pictures are never upscaled.
+	Size int
+	// Square - crop the picture to its centered square before scaling.
+	Square bool
+}
+
+// Rendition - A produced rendition.
+type Rendition struct {
+	Name        string
+	Width       int
+	Height      int
+	ContentType string
+	Data        []byte
+}
+
+// ErrInvalidSpec - returned for specs without a name or a positive size.
+var ErrInvalidSpec = errors.New("invalid rendition spec")
+
+// Renditions - Decode a picture and produce one rendition per spec.
+func Renditions(data []byte, specs []Spec) ([]Rendition, error) {
+
+	src, format, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+
+	renditions := make([]Rendition, 0, len(specs))
+	for _, spec := range specs {
+		if spec.Name == "" || spec.Size <= 0 {
+			return nil, ErrInvalidSpec
+		}
+
+		img := src
+		if spec.Square {
+			img = cropSquare(img)
+		}
+		img = fit(img, spec.Size)
+
+		rendition, err := encode(img, format)
+		if err != nil {
+			return nil, err
+		}
+		rendition.Name = spec.Name
+		renditions = append(renditions, rendition)
+	}
+
+	return renditions, nil
+}
+
+// cropSquare - Centered square of the picture.
+func cropSquare(img image.Image) image.Image {
+	b := img.Bounds()
+	side := b.Dx()
+	if b.Dy() < side {
+		side = b.Dy()
+	}
+
+	x0 := b.Min.X + (b.Dx()-side)/2
+	y0 := b.Min.Y + (b.Dy()-side)/2
+	square := image.Rect(0, 0, side, side)
+
+	dst := image.NewRGBA(square)
+	draw.Draw(dst, square, img, image.Pt(x0, y0), draw.Src)
+	return dst
+}
+
+// fit - Scale the picture down so that it fits in a size x size box, keeping its aspect ratio.
+func fit(img image.Image, size int) image.Image {
+	b := img.Bounds()
+	if b.Dx() <= size && b.Dy() <= size {
+		return img
+	}
+
+	width, height := size, size
+	if b.Dx() > b.Dy() {
+		height = max(1, b.Dy()*size/b.Dx())
+	} else {
+		width = max(1, b.Dx()*size/b.Dy())
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	xdraw.CatmullRom.Scale(dst, dst.Bounds(), img, b, xdraw.Src, nil)
+	return dst
+}
+
+// encode - PNG for sources that may carry transparency, JPEG otherwise.
+func encode(img image.Image, format string) (Rendition, error) {
+	var buf bytes.Buffer
+	rendition := Rendition{Width: img.Bounds().Dx(), Height: img.Bounds().Dy()}
+
+	switch {
+	case format == "png" || format == "gif" || format == "webp" && !opaque(img):
+		rendition.ContentType = "image/png"
+		if err := png.Encode(&buf, img); err != nil {
+			return rendition, err
+		}
+	default:
+		rendition.ContentType = "image/jpeg"
+		if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: jpegQuality}); err != nil {
+			return rendition, err
+		}
+	}
+
+	rendition.Data = buf.Bytes()
+	return rendition, nil
+}
+
+// opaque - Whether every pixel of the picture is fully opaque.
+func opaque(img image.Image) bool {
+	if o, ok := img.(interface{ Opaque() bool }); ok {
+		return o.Opaque()
+	}
+	b := img.Bounds()
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			if _, _, _, a := img.At(x, y).RGBA(); a != 0xffff {
+				return false
+			}
+		}
+	}
+	return true
+}
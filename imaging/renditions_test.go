@@ -0,0 +1,94 @@
+package imaging
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+func encodePNG(t *testing.T, width, height int) []byte {
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.Set(x, y, color.NRGBA{R: uint8(x), G: uint8(y), B: 128, A: 255})
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+type TestCaseRenditions struct {
+	name           string
+	width          int
+	height         int
+	spec           Spec
+	expectedWidth  int
+	expectedHeight int
+}
+
+func TestRenditions(t *testing.T) {
+
+	testCases := []TestCaseRenditions{
+		{name: "Landscape", width: 400, height: 200, spec: Spec{Name: "medium", Size: 100}, expectedWidth: 100, expectedHeight: 50},
+		{name: "Portrait", width: 200, height: 400, spec: Spec{Name: "medium", Size: 100}, expectedWidth: 50, expectedHeight: 100},
+		{name: "SquareCrop", width: 400, height: 200, spec: Spec{Name: "thumbnail", Size: 64, Square: true}, expectedWidth: 64, expectedHeight: 64},
+		{name: "NoUpscale", width: 40, height: 30, spec: Spec{Name: "large", Size: 1024}, expectedWidth: 40, expectedHeight: 30},
+		{name: "SmallSquareCrop", width: 40, height: 30, spec: Spec{Name: "thumbnail", Size: 64, Square: true}, expectedWidth: 30, expectedHeight: 30},
+	}
+
+	for _, test := range testCases {
+
+		t.Run(test.name, func(t *testing.T) {
+			renditions, err := Renditions(encodePNG(t, test.width, test.height), []Spec{test.spec})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(renditions) != 1 {
+				t.Fatalf("%d renditions != 1", len(renditions))
+			}
+
+			r := renditions[0]
+			if r.Name != test.spec.Name || r.Width != test.expectedWidth || r.Height != test.expectedHeight || r.ContentType != "image/png" {
+				t.Fatalf("unexpected rendition: %s %dx%d %s", r.Name, r.Width, r.Height, r.ContentType)
+			}
+
+			decoded, _, err := image.Decode(bytes.NewReader(r.Data))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if decoded.Bounds().Dx() != test.expectedWidth || decoded.Bounds().Dy() != test.expectedHeight {
+				t.Fatalf("encoded size %v does not match", decoded.Bounds())
+			}
+		})
+	}
+}
+
+func TestRenditionsJPEG(t *testing.T) {
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 300, 300)), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	renditions, err := Renditions(buf.Bytes(), []Spec{{Name: "thumbnail", Size: 64}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if renditions[0].ContentType != "image/jpeg" {
+		t.Fatalf("content type %s != image/jpeg", renditions[0].ContentType)
+	}
+}
+
+func TestRenditionsErrors(t *testing.T) {
+	if _, err := Renditions([]byte("fake_image"), []Spec{{Name: "thumbnail", Size: 64}}); err == nil {
+		t.Fatal("expected a decode error")
+	}
+	if _, err := Renditions(encodePNG(t, 10, 10), []Spec{{Name: "thumbnail"}}); err != ErrInvalidSpec {
+		t.Fatalf("%v != %v", err, ErrInvalidSpec)
+	}
+}
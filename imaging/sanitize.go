@@ -0,0 +1,245 @@
+package imaging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+)
+
+// Format - Picture format recognized from its magic bytes.
+type Format string
+
+// Accepted picture formats.
+const (
+	FormatJPEG Format = "jpeg"
+	FormatPNG  Format = "png"
+	FormatGIF  Format = "gif"
+	FormatWebP Format = "webp"
+)
+
+// Reason - Why a picture was rejected.
+type Reason string
+
+// Rejection reasons.
+const (
+	ReasonEmpty             Reason = "empty"
+	ReasonUnsupportedFormat Reason = "unsupported_format"
+	ReasonTooLarge          Reason = "too_large"
+	ReasonTooManyPixels     Reason = "too_many_pixels"
+	ReasonCorrupt           Reason = "corrupt"
+)
+
+// RejectionError - A picture that failed validation.
+type RejectionError struct {
+	Reason Reason
+	Detail string
+}
+
+func (e *RejectionError) Error() string {
+	return fmt.Sprintf("picture rejected (%s): %s", e.Reason, e.Detail)
+}
+
+func reject(reason Reason, format string, args ...interface{}) error {
+	return &RejectionError{Reason: reason, Detail: fmt.Sprintf(format, args...)}
+}
+
+// Limits - Bounds a picture must respect to be accepted.
+type Limits struct {
+	MaxBytes int
+	// MaxDimension - largest width or height in pixels.
+	MaxDimension int
+	// MaxPixels - largest width x height, guarding against decompression bombs.
+	MaxPixels int
+}
+
+// Sanitized - A validated picture, re-encoded without metadata and in its natural orientation.
+type Sanitized struct {
+	Format      Format
+	ContentType string
+	Width       int
+	Height      int
+	Data        []byte
+}
+
+// Sniff - Picture format from the leading magic bytes, ignoring any declared content type.
+func Sniff(data []byte) (Format, bool) {
+	switch {
+	case bytes.HasPrefix(data, []byte{0xff, 0xd8, 0xff}):
+		return FormatJPEG, true
+	case bytes.HasPrefix(data, []byte("\x89PNG\r\n\x1a\n")):
+		return FormatPNG, true
+	case bytes.HasPrefix(data, []byte("GIF87a")), bytes.HasPrefix(data, []byte("GIF89a")):
+		return FormatGIF, true
+	case len(data) >= 12 && bytes.Equal(data[:4], []byte("RIFF")) && bytes.Equal(data[8:12], []byte("WEBP")):
+		return FormatWebP, true
+	}
+	return "", false
+}
+
+// Sanitize - Validate a picture and re-encode it. Re-encoding drops every metadata block (EXIF, GPS, comments);
+// the EXIF orientation of JPEG pictures is applied to the pixels first. JPEG pictures stay JPEG, the other
+// formats become PNG (animated GIFs keep their first frame).
+func Sanitize(data []byte, limits Limits) (*Sanitized, error) {
+
+	if len(data) == 0 {
+		return nil, reject(ReasonEmpty, "no picture data")
+	}
+	if limits.MaxBytes > 0 && len(data) > limits.MaxBytes {
+		return nil, reject(ReasonTooLarge, "picture is %d bytes, the limit is %d", len(data), limits.MaxBytes)
+	}
+
+	format, ok := Sniff(data)
+	if !ok {
+		return nil, reject(ReasonUnsupportedFormat, "only JPEG, PNG, GIF and WebP pictures are accepted")
+	}
+
+	// Check the dimensions from the header before decoding any pixel.
+	cfg, decodedFormat, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil || Format(decodedFormat) != format {
+		return nil, reject(ReasonCorrupt, "picture header could not be read")
+	}
+	if cfg.Width <= 0 || cfg.Height <= 0 {
+		return nil, reject(ReasonCorrupt, "picture has no pixels")
+	}
+	if limits.MaxDimension > 0 && (cfg.Width > limits.MaxDimension || cfg.Height > limits.MaxDimension) {
+		return nil, reject(ReasonTooManyPixels, "picture is %dx%d, the limit is %d pixels per side", cfg.Width, cfg.Height, limits.MaxDimension)
+	}
+	if limits.MaxPixels > 0 && cfg.Width*cfg.Height > limits.MaxPixels {
+		return nil, reject(ReasonTooManyPixels, "picture has %d pixels, the limit is %d", cfg.Width*cfg.Height, limits.MaxPixels)
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, reject(ReasonCorrupt, "picture could not be decoded")
+	}
+
+	if format == FormatJPEG {
+		img = orient(img, jpegOrientation(data))
+	}
+
+	sanitized := &Sanitized{Format: format, Width: img.Bounds().Dx(), Height: img.Bounds().Dy()}
+
+	var buf bytes.Buffer
+	if format == FormatJPEG {
+		sanitized.ContentType = "image/jpeg"
+		err = jpeg.Encode(&buf, img, &jpeg.Options{Quality: 90})
+	} else {
+		sanitized.ContentType = "image/png"
+		err = png.Encode(&buf, img)
+	}
+	if err != nil {
+		return nil, err
+	}
+	sanitized.Data = buf.Bytes()
+
+	return sanitized, nil
+}
+
+// jpegOrientation - EXIF orientation (1 to 8) of a JPEG picture, 1 when absent or unreadable.
+func jpegOrientation(data []byte) int {
+
+	// Walk the marker segments up to the start of scan.
+	for i := 2; i+4 <= len(data); {
+		if data[i] != 0xff {
+			return 1
+		}
+		marker := data[i+1]
+		if marker == 0xda || marker == 0xd9 {
+			return 1
+		}
+		length := int(binary.BigEndian.Uint16(data[i+2:]))
+		if length < 2 || i+2+length > len(data) {
+			return 1
+		}
+		segment := data[i+4 : i+2+length]
+		if marker == 0xe1 && bytes.HasPrefix(segment, []byte("Exif\x00\x00")) {
+			return exifOrientation(segment[6:])
+		}
+		i += 2 + length
+	}
+
+	return 1
+}
+
+// exifOrientation - Orientation tag (0x0112) of the first IFD of a TIFF structure.
+func exifOrientation(tiff []byte) int {
+	if len(tiff) < 8 {
+		return 1
+	}
+
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 1
+	}
+
+	ifd := int(order.Uint32(tiff[4:]))
+	if ifd < 8 || ifd+2 > len(tiff) {
+		return 1
+	}
+
+	entries := int(order.Uint16(tiff[ifd:]))
+	for e := 0; e < entries; e++ {
+		entry := ifd + 2 + e*12
+		if entry+12 > len(tiff) {
+			return 1
+		}
+		if order.Uint16(tiff[entry:]) == 0x0112 {
+			orientation := int(order.Uint16(tiff[entry+8:]))
+			if orientation < 1 || orientation > 8 {
+				return 1
+			}
+			return orientation
+		}
+	}
+
+	return 1
+}
+
+// orient - Apply an EXIF orientation so that the picture displays upright without metadata.
+func orient(img image.Image, orientation int) image.Image {
+	if orientation <= 1 || orientation > 8 {
+		return img
+	}
+
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+
+	dw, dh := w, h
+	if orientation >= 5 {
+		dw, dh = h, w
+	}
+	dst := image.NewNRGBA(image.Rect(0, 0, dw, dh))
+
+	for y := 0; y < dh; y++ {
+		for x := 0; x < dw; x++ {
+			var sx, sy int
+			switch orientation {
+			case 2:
+				sx, sy = w-1-x, y
+			case 3:
+				sx, sy = w-1-x, h-1-y
+			case 4:
+				sx, sy = x, h-1-y
+			case 5:
+				sx, sy = y, x
+			case 6:
+				sx, sy = y, h-1-x
+			case 7:
+				sx, sy = w-1-y, h-1-x
+			case 8:
+				sx, sy = w-1-y, x
+			}
+			dst.Set(x, y, img.At(b.Min.X+sx, b.Min.Y+sy))
+		}
+	}
+
+	return dst
+}
@@ -0,0 +1,150 @@
+package imaging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+func encodeJPEG(t *testing.T, width, height int) []byte {
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, image.NewRGBA(image.Rect(0, 0, width, height)), nil); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// withExif - Insert an APP1 segment carrying an orientation tag and GPS marker text right after SOI.
+func withExif(jpegData []byte, orientation uint16) []byte {
+	tiff := []byte("MM\x00\x2a\x00\x00\x00\x08")
+	tiff = append(tiff, 0x00, 0x01)             // one IFD entry
+	tiff = append(tiff, 0x01, 0x12, 0x00, 0x03) // orientation, SHORT
+	tiff = append(tiff, 0x00, 0x00, 0x00, 0x01) // count
+	tiff = append(tiff, byte(orientation>>8), byte(orientation), 0x00, 0x00)
+	tiff = append(tiff, 0x00, 0x00, 0x00, 0x00)           // no next IFD
+	tiff = append(tiff, []byte("GPSLatitude 48.8584")...) // stand-in for location metadata
+
+	payload := append([]byte("Exif\x00\x00"), tiff...)
+	segment := []byte{0xff, 0xe1, 0, 0}
+	binary.BigEndian.PutUint16(segment[2:], uint16(len(payload)+2))
+	segment = append(segment, payload...)
+
+	out := append([]byte{}, jpegData[:2]...)
+	out = append(out, segment...)
+	return append(out, jpegData[2:]...)
+}
+
+// pngWithSize - PNG whose header claims width x height, with a valid header CRC.
+func pngWithSize(t *testing.T, width, height uint32) []byte {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewGray(image.Rect(0, 0, 1, 1))); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+	// Signature (8) + length (4) + "IHDR" (4), then width and height.
+	binary.BigEndian.PutUint32(data[16:], width)
+	binary.BigEndian.PutUint32(data[20:], height)
+	binary.BigEndian.PutUint32(data[29:], crc32.ChecksumIEEE(data[12:29]))
+	return data
+}
+
+type TestCaseSanitize struct {
+	name           string
+	data           []byte
+	limits         Limits
+	expectedReason Reason
+}
+
+func TestSanitizeRejections(t *testing.T) {
+
+	limits := Limits{MaxBytes: 1 << 20, MaxDimension: 4096, MaxPixels: 4096 * 4096}
+
+	testCases := []TestCaseSanitize{
+		{name: "Empty", data: nil, limits: limits, expectedReason: ReasonEmpty},
+		{name: "NotAnImage", data: []byte("fake_image_base64"), limits: limits, expectedReason: ReasonUnsupportedFormat},
+		{name: "BMP", data: []byte("BM\x3a\x00\x00\x00\x00\x00\x00\x00"), limits: limits, expectedReason: ReasonUnsupportedFormat},
+		{name: "TooLarge", data: encodeJPEG(t, 64, 64), limits: Limits{MaxBytes: 10}, expectedReason: ReasonTooLarge},
+		{name: "TruncatedPNG", data: []byte("\x89PNG\r\n\x1a\n\x00\x00"), limits: limits, expectedReason: ReasonCorrupt},
+		{name: "DecompressionBomb", data: pngWithSize(t, 100000, 100000), limits: limits, expectedReason: ReasonTooManyPixels},
+		{name: "TooWide", data: pngWithSize(t, 5000, 10), limits: limits, expectedReason: ReasonTooManyPixels},
+	}
+
+	for _, test := range testCases {
+
+		t.Run(test.name, func(t *testing.T) {
+			_, err := Sanitize(test.data, test.limits)
+
+			var rejection *RejectionError
+			if !errors.As(err, &rejection) {
+				t.Fatalf("expected a rejection, got %v", err)
+			}
+			if rejection.Reason != test.expectedReason {
+				t.Fatalf("reason %s != %s", rejection.Reason, test.expectedReason)
+			}
+		})
+	}
+}
+
+func TestSanitizeStripsExifAndOrients(t *testing.T) {
+
+	data := withExif(encodeJPEG(t, 40, 20), 6)
+	if jpegOrientation(data) != 6 {
+		t.Fatalf("orientation %d != 6", jpegOrientation(data))
+	}
+
+	sanitized, err := Sanitize(data, Limits{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if sanitized.Format != FormatJPEG || sanitized.ContentType != "image/jpeg" {
+		t.Fatalf("unexpected format %s %s", sanitized.Format, sanitized.ContentType)
+	}
+	if sanitized.Width != 20 || sanitized.Height != 40 {
+		t.Fatalf("picture not rotated: %dx%d", sanitized.Width, sanitized.Height)
+	}
+	if bytes.Contains(sanitized.Data, []byte("Exif")) || bytes.Contains(sanitized.Data, []byte("GPSLatitude")) {
+		t.Fatal("metadata not stripped")
+	}
+	if jpegOrientation(sanitized.Data) != 1 {
+		t.Fatal("orientation left in the output")
+	}
+}
+
+func TestOrient(t *testing.T) {
+
+	// 2x1 picture: red then blue.
+	src := image.NewNRGBA(image.Rect(0, 0, 2, 1))
+	red := color.NRGBA{R: 255, A: 255}
+	blue := color.NRGBA{B: 255, A: 255}
+	src.Set(0, 0, red)
+	src.Set(1, 0, blue)
+
+	rotated := orient(src, 6)
+	if rotated.Bounds().Dx() != 1 || rotated.Bounds().Dy() != 2 {
+		t.Fatalf("unexpected bounds %v", rotated.Bounds())
+	}
+	if rotated.At(0, 0) != red || rotated.At(0, 1) != blue {
+		t.Fatalf("rotation 6 misplaced pixels")
+	}
+
+	flipped := orient(src, 2)
+	if flipped.At(0, 0) != blue || flipped.At(1, 0) != red {
+		t.Fatalf("orientation 2 misplaced pixels")
+	}
+}
+
+func TestSniff(t *testing.T) {
+	if format, ok := Sniff([]byte("RIFF\x00\x00\x00\x00WEBPVP8 ")); !ok || format != FormatWebP {
+		t.Fatalf("WebP not recognized")
+	}
+	if format, ok := Sniff([]byte("GIF89a")); !ok || format != FormatGIF {
+		t.Fatalf("GIF not recognized")
+	}
+}
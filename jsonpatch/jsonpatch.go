@@ -0,0 +1,265 @@
+// Package jsonpatch applies JSON Patch (RFC 6902) documents made of add, remove, replace and test operations.
+// A patch is applied to a copy of the target, so that it either succeeds as a whole or leaves the target untouched.
+package jsonpatch
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// ContentType - media type of JSON Patch documents.
+const ContentType = "application/json-patch+json"
+
+// Operations supported by Apply.
+const (
+	OpAdd     = "add"
+	OpRemove  = "remove"
+	OpReplace = "replace"
+	OpTest    = "test"
+)
+
+var (
+	// ErrInvalidPatch - the patch document is malformed or uses an unsupported operation.
+	ErrInvalidPatch = errors.New("invalid JSON Patch document")
+	// ErrTestFailed - a test operation did not match the target.
+	ErrTestFailed = errors.New("JSON Patch test failed")
+	// ErrUnprocessable - an operation targets a location the document does not have.
+	ErrUnprocessable = errors.New("JSON Patch cannot be applied")
+)
+
+// Operation - Single operation of a patch.
+type Operation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+// Patch - Ordered operations of a JSON Patch document.
+type Patch []Operation
+
+// Decode - Parse and check a JSON Patch document.
+func Decode(data []byte) (Patch, error) {
+	var patch Patch
+	if err := json.Unmarshal(data, &patch); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidPatch, err.Error())
+	}
+
+	for i, operation := range patch {
+		switch operation.Op {
+		case OpAdd, OpReplace, OpTest:
+			if len(operation.Value) == 0 {
+				return nil, fmt.Errorf("%w: operation %d (%s) has no value", ErrInvalidPatch, i, operation.Op)
+			}
+		case OpRemove:
+		default:
+			return nil, fmt.Errorf("%w: operation %d has unsupported op %q", ErrInvalidPatch, i, operation.Op)
+		}
+		if _, err := parsePointer(operation.Path); err != nil {
+			return nil, fmt.Errorf("%w: operation %d: %s", ErrInvalidPatch, i, err.Error())
+		}
+	}
+
+	return patch, nil
+}
+
+// Apply - Apply the patch to the JSON document doc and return the patched document.
+func (p Patch) Apply(doc []byte) ([]byte, error) {
+	var target interface{}
+	if err := json.Unmarshal(doc, &target); err != nil {
+		return nil, err
+	}
+
+	for i, operation := range p {
+		var err error
+		target, err = operation.apply(target)
+		if err != nil {
+			return nil, fmt.Errorf("operation %d (%s %s): %w", i, operation.Op, operation.Path, err)
+		}
+	}
+
+	return json.Marshal(target)
+}
+
+func (o Operation) apply(target interface{}) (interface{}, error) {
+	tokens, err := parsePointer(o.Path)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidPatch, err.Error())
+	}
+
+	var value interface{}
+	if o.Op != OpRemove {
+		if err := json.Unmarshal(o.Value, &value); err != nil {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidPatch, err.Error())
+		}
+	}
+
+	if o.Op == OpTest {
+		current, err := get(target, tokens)
+		if err != nil {
+			return nil, err
+		}
+		if !reflect.DeepEqual(current, value) {
+			return nil, ErrTestFailed
+		}
+		return target, nil
+	}
+
+	// The whole document.
+	if len(tokens) == 0 {
+		if o.Op == OpRemove {
+			return nil, fmt.Errorf("%w: the document itself cannot be removed", ErrUnprocessable)
+		}
+		return value, nil
+	}
+
+	return update(target, tokens, func(container interface{}, token string) (interface{}, error) {
+		switch o.Op {
+		case OpAdd:
+			return add(container, token, value)
+		case OpRemove:
+			return remove(container, token)
+		}
+		return replace(container, token, value)
+	})
+}
+
+// update - Replace the container holding the last token of tokens by the result of change.
+func update(target interface{}, tokens []string, change func(container interface{}, token string) (interface{}, error)) (interface{}, error) {
+	if len(tokens) == 1 {
+		return change(target, tokens[0])
+	}
+
+	child, err := get(target, tokens[:1])
+	if err != nil {
+		return nil, err
+	}
+	child, err = update(child, tokens[1:], change)
+	if err != nil {
+		return nil, err
+	}
+	return replace(target, tokens[0], child)
+}
+
+func get(target interface{}, tokens []string) (interface{}, error) {
+	for _, token := range tokens {
+		switch container := target.(type) {
+		case map[string]interface{}:
+			value, ok := container[token]
+			if !ok {
+				return nil, fmt.Errorf("%w: member %q does not exist", ErrUnprocessable, token)
+			}
+			target = value
+		case []interface{}:
+			index, err := arrayIndex(token, len(container)-1)
+			if err != nil {
+				return nil, err
+			}
+			target = container[index]
+		default:
+			return nil, fmt.Errorf("%w: %q is not inside an object or array", ErrUnprocessable, token)
+		}
+	}
+	return target, nil
+}
+
+func add(target interface{}, token string, value interface{}) (interface{}, error) {
+	switch container := target.(type) {
+	case map[string]interface{}:
+		container[token] = value
+		return container, nil
+	case []interface{}:
+		if token == "-" {
+			return append(container, value), nil
+		}
+		index, err := arrayIndex(token, len(container))
+		if err != nil {
+			return nil, err
+		}
+		container = append(container, nil)
+		copy(container[index+1:], container[index:])
+		container[index] = value
+		return container, nil
+	}
+	return nil, fmt.Errorf("%w: %q is not inside an object or array", ErrUnprocessable, token)
+}
+
+func remove(target interface{}, token string) (interface{}, error) {
+	switch container := target.(type) {
+	case map[string]interface{}:
+		if _, ok := container[token]; !ok {
+			return nil, fmt.Errorf("%w: member %q does not exist", ErrUnprocessable, token)
+		}
+		delete(container, token)
+		return container, nil
+	case []interface{}:
+		index, err := arrayIndex(token, len(container)-1)
+		if err != nil {
+			return nil, err
+		}
+		return append(container[:index], container[index+1:]...), nil
+	}
+	return nil, fmt.Errorf("%w: %q is not inside an object or array", ErrUnprocessable, token)
+}
+
+func replace(target interface{}, token string, value interface{}) (interface{}, error) {
+	switch container := target.(type) {
+	case map[string]interface{}:
+		if _, ok := container[token]; !ok {
+			return nil, fmt.Errorf("%w: member %q does not exist", ErrUnprocessable, token)
+		}
+		container[token] = value
+		return container, nil
+	case []interface{}:
+		index, err := arrayIndex(token, len(container)-1)
+		if err != nil {
+			return nil, err
+		}
+		container[index] = value
+		return container, nil
+	}
+	return nil, fmt.Errorf("%w: %q is not inside an object or array", ErrUnprocessable, token)
+}
+
+// arrayIndex - Array index of token, at most max. RFC 6901 forbids leading zeros.
+func arrayIndex(token string, max int) (int, error) {
+	index, err := strconv.Atoi(token)
+	if err != nil || index < 0 || token != strconv.Itoa(index) {
+		return 0, fmt.Errorf("%w: %q is not an array index", ErrUnprocessable, token)
+	}
+	if index > max {
+		return 0, fmt.Errorf("%w: array index %d is out of bounds", ErrUnprocessable, index)
+	}
+	return index, nil
+}
+
+// parsePointer - Reference tokens of a JSON Pointer (RFC 6901), none for the whole document.
+func parsePointer(pointer string) ([]string, error) {
+	if pointer == "" {
+		return nil, nil
+	}
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, fmt.Errorf("path %q must start with /", pointer)
+	}
+
+	tokens := strings.Split(pointer[1:], "/")
+	for i, token := range tokens {
+		if strings.Contains(strings.ReplaceAll(strings.ReplaceAll(token, "~0", ""), "~1", ""), "~") {
+			return nil, fmt.Errorf("path %q has an invalid escape", pointer)
+		}
+		tokens[i] = strings.ReplaceAll(strings.ReplaceAll(token, "~1", "/"), "~0", "~")
+	}
+	return tokens, nil
+}
+
+// StringValue - Value of a string operation, ok is false for other values.
+func (o Operation) StringValue() (value string, ok bool) {
+	if err := json.Unmarshal(o.Value, &value); err != nil || !bytes.HasPrefix(bytes.TrimSpace(o.Value), []byte(`"`)) {
+		return "", false
+	}
+	return value, true
+}
@@ -0,0 +1,128 @@
+package jsonpatch
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+type TestCaseApply struct {
+	name        string
+	doc         string
+	patch       string
+	expectedDoc string
+	expectedErr error
+}
+
+func TestApply(t *testing.T) {
+
+	doc := `{"name": "Family", "pic": "", "members": ["a", "b"], "a/b": {"~c": 1}}`
+
+	testCases := []TestCaseApply{
+		{
+			name:        "Replace",
+			doc:         doc,
+			patch:       `[{"op": "replace", "path": "/name", "value": "Friends"}]`,
+			expectedDoc: `{"name": "Friends", "pic": "", "members": ["a", "b"], "a/b": {"~c": 1}}`,
+		},
+		{
+			name:        "AddAppendAndInsert",
+			doc:         doc,
+			patch:       `[{"op": "add", "path": "/members/-", "value": "c"}, {"op": "add", "path": "/members/0", "value": "z"}]`,
+			expectedDoc: `{"name": "Family", "pic": "", "members": ["z", "a", "b", "c"], "a/b": {"~c": 1}}`,
+		},
+		{
+			name:        "RemoveMember",
+			doc:         doc,
+			patch:       `[{"op": "remove", "path": "/members/0"}, {"op": "remove", "path": "/pic"}]`,
+			expectedDoc: `{"name": "Family", "members": ["b"], "a/b": {"~c": 1}}`,
+		},
+		{
+			name:        "EscapedPointer",
+			doc:         doc,
+			patch:       `[{"op": "test", "path": "/a~1b/~0c", "value": 1}, {"op": "replace", "path": "/a~1b/~0c", "value": 2}]`,
+			expectedDoc: `{"name": "Family", "pic": "", "members": ["a", "b"], "a/b": {"~c": 2}}`,
+		},
+		{
+			name:        "TestPassed",
+			doc:         doc,
+			patch:       `[{"op": "test", "path": "/members", "value": ["a", "b"]}, {"op": "replace", "path": "/pic", "value": "p1"}]`,
+			expectedDoc: `{"name": "Family", "pic": "p1", "members": ["a", "b"], "a/b": {"~c": 1}}`,
+		},
+		{
+			name:        "TestFailed",
+			doc:         doc,
+			patch:       `[{"op": "replace", "path": "/pic", "value": "p1"}, {"op": "test", "path": "/name", "value": "Friends"}]`,
+			expectedErr: ErrTestFailed,
+		},
+		{
+			name:        "ReplaceMissingMember",
+			doc:         doc,
+			patch:       `[{"op": "replace", "path": "/color", "value": "red"}]`,
+			expectedErr: ErrUnprocessable,
+		},
+		{
+			name:        "IndexOutOfBounds",
+			doc:         doc,
+			patch:       `[{"op": "remove", "path": "/members/2"}]`,
+			expectedErr: ErrUnprocessable,
+		},
+		{
+			name:        "LeadingZeroIndex",
+			doc:         doc,
+			patch:       `[{"op": "replace", "path": "/members/01", "value": "x"}]`,
+			expectedErr: ErrUnprocessable,
+		},
+	}
+
+	for _, test := range testCases {
+
+		t.Run(test.name, func(t *testing.T) {
+			patch, err := Decode([]byte(test.patch))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			patched, err := patch.Apply([]byte(test.doc))
+			if test.expectedErr != nil {
+				if !errors.Is(err, test.expectedErr) {
+					t.Fatalf("expected %v, got %v", test.expectedErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var got, expected interface{}
+			_ = json.Unmarshal(patched, &got)
+			_ = json.Unmarshal([]byte(test.expectedDoc), &expected)
+			if !reflect.DeepEqual(got, expected) {
+				t.Fatalf("expected %s, got %s", test.expectedDoc, patched)
+			}
+		})
+	}
+}
+
+func TestDecode(t *testing.T) {
+
+	invalid := []string{
+		`{"op": "add"}`,
+		`[{"op": "move", "from": "/a", "path": "/b"}]`,
+		`[{"op": "add", "path": "/a"}]`,
+		`[{"op": "remove", "path": "a"}]`,
+		`[{"op": "remove", "path": "/a~2"}]`,
+	}
+
+	for _, document := range invalid {
+		if _, err := Decode([]byte(document)); !errors.Is(err, ErrInvalidPatch) {
+			t.Fatalf("expected %s to be invalid, got %v", document, err)
+		}
+	}
+
+	// A null value is still a value.
+	if _, err := Decode([]byte(`[{"op": "replace", "path": "/pic", "value": null}]`)); err != nil {
+		t.Fatal(err)
+	}
+}
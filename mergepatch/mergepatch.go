@@ -0,0 +1,104 @@
+// Package mergepatch implements the optional fields of JSON Merge Patch (RFC 7396) documents, where a member
+// that is absent leaves the target untouched, null removes it and any other value replaces it.
+package mergepatch
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"mime"
+	"net/http"
+)
+
+// ContentType - media type of JSON Merge Patch documents.
+const ContentType = "application/merge-patch+json"
+
+// Field - Tri-state member of a merge patch document.
+type Field[T any] struct {
+	// Present - the member appears in the document, either as null or with a value.
+	Present bool
+	// Null - the member is null, asking for the field to be removed.
+	Null  bool
+	Value T
+}
+
+// Set - Field replacing the target value with value.
+func Set[T any](value T) Field[T] {
+	return Field[T]{Present: true, Value: value}
+}
+
+// Remove - Field removing the target value.
+func Remove[T any]() Field[T] {
+	return Field[T]{Present: true, Null: true}
+}
+
+// IsSet - Whether the field replaces the target value.
+func (f Field[T]) IsSet() bool {
+	return f.Present && !f.Null
+}
+
+// UnmarshalJSON - encoding/json only calls it for members present in the document, null included.
+func (f *Field[T]) UnmarshalJSON(data []byte) error {
+	f.Present = true
+	if bytes.Equal(bytes.TrimSpace(data), []byte("null")) {
+		f.Null = true
+		var zero T
+		f.Value = zero
+		return nil
+	}
+
+	f.Null = false
+	return json.Unmarshal(data, &f.Value)
+}
+
+// MarshalJSON - Null for removals, the value otherwise. Absent fields need omitempty on a pointer to stay absent.
+func (f Field[T]) MarshalJSON() ([]byte, error) {
+	if f.Null || !f.Present {
+		return []byte("null"), nil
+	}
+	return json.Marshal(f.Value)
+}
+
+type contextKey struct{}
+
+// Middleware - Keep the raw body of PATCH requests in their context, as binding them to generated models loses
+// the difference between absent and null members.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPatch || r.Body == nil || !isJSON(r.Header.Get("Content-Type")) {
+			next.ServeHTTP(rw, r)
+			return
+		}
+
+		raw, err := io.ReadAll(r.Body)
+		r.Body.Close()
+		if err != nil {
+			http.Error(rw, "failed to read request body", http.StatusBadRequest)
+			return
+		}
+
+		r = r.WithContext(NewContext(r.Context(), raw))
+		r.Body = io.NopCloser(bytes.NewReader(raw))
+		next.ServeHTTP(rw, r)
+	})
+}
+
+// NewContext - Copy of ctx carrying the raw patch document.
+func NewContext(ctx context.Context, raw []byte) context.Context {
+	return context.WithValue(ctx, contextKey{}, raw)
+}
+
+// FromContext - Raw patch document of the request, if it was kept by Middleware.
+func FromContext(ctx context.Context) ([]byte, bool) {
+	raw, ok := ctx.Value(contextKey{}).([]byte)
+	return raw, ok
+}
+
+func isJSON(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	return mediaType == ContentType || mediaType == "application/json"
+}
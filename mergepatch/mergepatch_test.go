@@ -0,0 +1,89 @@
+package mergepatch
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type testDocument struct {
+	Name Field[string] `json:"name"`
+	Pic  Field[string] `json:"pic"`
+}
+
+type TestCaseField struct {
+	name         string
+	document     string
+	expectedName Field[string]
+	expectedPic  Field[string]
+}
+
+func TestFieldUnmarshal(t *testing.T) {
+
+	testCases := []TestCaseField{
+		{
+			name:     "Absent",
+			document: `{}`,
+		},
+		{
+			name:        "Null",
+			document:    `{"pic": null}`,
+			expectedPic: Remove[string](),
+		},
+		{
+			name:         "Value",
+			document:     `{"name": "Family", "pic": ""}`,
+			expectedName: Set("Family"),
+			expectedPic:  Set(""),
+		},
+	}
+
+	for _, test := range testCases {
+
+		t.Run(test.name, func(t *testing.T) {
+			var document testDocument
+			if err := json.Unmarshal([]byte(test.document), &document); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(document.Name, test.expectedName) || !reflect.DeepEqual(document.Pic, test.expectedPic) {
+				t.Fatalf("unexpected document: %+v", document)
+			}
+		})
+	}
+
+	var document testDocument
+	if err := json.Unmarshal([]byte(`{"name": 42}`), &document); err == nil {
+		t.Fatalf("expected a type error")
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+
+	var raw []byte
+	var kept bool
+	var body []byte
+	handler := Middleware(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		raw, kept = FromContext(r.Context())
+		body, _ = io.ReadAll(r.Body)
+	}))
+
+	req := httptest.NewRequest(http.MethodPatch, "/groups/1", strings.NewReader(`{"pic": null}`))
+	req.Header.Set("Content-Type", ContentType)
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	if !kept || string(raw) != `{"pic": null}` || string(body) != `{"pic": null}` {
+		t.Fatalf("unexpected raw %q (kept %v) and body %q", raw, kept, body)
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/groups", strings.NewReader(`{}`))
+	req.Header.Set("Content-Type", "application/json")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	if kept {
+		t.Fatalf("unexpected raw body kept for a POST")
+	}
+}
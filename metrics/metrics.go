@@ -0,0 +1,87 @@
+package metrics
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "connections"
+
+var (
+	// HTTPRequestsTotal - Count of handled requests per go-swagger operation.
+	HTTPRequestsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "http",
+		Name:      "requests_total",
+		Help:      "Number of HTTP requests handled, partitioned by operation, method and status code.",
+	}, []string{"operation", "method", "code"})
+
+	// HTTPRequestDuration - Latency of handled requests per go-swagger operation.
+	HTTPRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "http",
+		Name:      "request_duration_seconds",
+		Help:      "Latency of HTTP requests, partitioned by operation and method.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"operation", "method"})
+
+	// PanicsTotal - Count of panics recovered while serving requests.
+	PanicsTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "http",
+		Name:      "panics_total",
+		Help:      "Number of panics recovered while serving HTTP requests.",
+	})
+
+	// StorageOperationsTotal - Count of database.Storage calls per method and result code.
+	StorageOperationsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "storage",
+		Name:      "operations_total",
+		Help:      "Number of storage calls, partitioned by method and result code.",
+	}, []string{"method", "code"})
+
+	// StorageOperationDuration - Latency of database.Storage calls per method.
+	StorageOperationDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "storage",
+		Name:      "operation_duration_seconds",
+		Help:      "Latency of storage calls, partitioned by method.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method"})
+
+	// ImageProcessingDuration - Time spent in ReduceBase64EncodedImage.
+	ImageProcessingDuration = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "image",
+		Name:      "processing_duration_seconds",
+		Help:      "Time spent reducing group pictures.",
+		Buckets:   []float64{.01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10, 30},
+	})
+
+	// ImageInputBytes - Size of the decoded pictures handed to the image reducer.
+	ImageInputBytes = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "image",
+		Name:      "input_bytes",
+		Help:      "Size of group pictures before reduction.",
+		Buckets:   prometheus.ExponentialBuckets(1024, 4, 8),
+	})
+
+	// ImageOutputBytes - Size of the pictures produced by the image reducer.
+	ImageOutputBytes = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "image",
+		Name:      "output_bytes",
+		Help:      "Size of group pictures after reduction.",
+		Buckets:   prometheus.ExponentialBuckets(1024, 4, 8),
+	})
+)
+
+// Handler - Serves the registered metrics in the Prometheus exposition format.
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
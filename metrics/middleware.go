@@ -0,0 +1,60 @@
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-openapi/runtime/middleware"
+)
+
+// unmatchedOperation - label used when go-swagger did not resolve a route.
+const unmatchedOperation = "unmatched"
+
+// statusRecorder - Captures the status code written by the wrapped handler.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(code int) {
+	r.status = code
+	r.ResponseWriter.WriteHeader(code)
+}
+
+// Unwrap - Underlying writer, letting http.ResponseController flush streamed responses.
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+// InstrumentOperations - Records request count and latency per go-swagger operation.
+// It must run after routing so that the matched route is available on the request.
+func InstrumentOperations(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+
+		operation := unmatchedOperation
+		if route := middleware.MatchedRouteFrom(r); route != nil && route.Operation != nil {
+			operation = route.Operation.ID
+		}
+
+		observeRequest(operation, next, rw, r)
+	})
+}
+
+// InstrumentHandler - Records request count and latency of a handler served outside the go-swagger API.
+func InstrumentHandler(operation string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		observeRequest(operation, next, rw, r)
+	})
+}
+
+// observeRequest - Serve the request through next, recording its latency and status under operation.
+func observeRequest(operation string, next http.Handler, rw http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	recorder := &statusRecorder{ResponseWriter: rw, status: http.StatusOK}
+
+	next.ServeHTTP(recorder, r)
+
+	HTTPRequestDuration.WithLabelValues(operation, r.Method).Observe(time.Since(start).Seconds())
+	HTTPRequestsTotal.WithLabelValues(operation, r.Method, strconv.Itoa(recorder.status)).Inc()
+}
@@ -0,0 +1,37 @@
+package problem
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// ContentType - media type of RFC 7807 problem documents.
+const ContentType = "application/problem+json"
+
+// Details - RFC 7807 problem document.
+type Details struct {
+	Type      string `json:"type,omitempty"`
+	Title     string `json:"title"`
+	Status    int    `json:"status"`
+	Detail    string `json:"detail,omitempty"`
+	Instance  string `json:"instance,omitempty"`
+	RequestID string `json:"request_id,omitempty"`
+}
+
+// New - Problem with the standard title of the status code.
+func New(status int, detail string) Details {
+	return Details{
+		Type:   "about:blank",
+		Title:  http.StatusText(status),
+		Status: status,
+		Detail: detail,
+	}
+}
+
+// Write - Write the problem document as the response.
+func Write(rw http.ResponseWriter, details Details) {
+	rw.Header().Set("Content-Type", ContentType)
+	rw.Header().Set("X-Content-Type-Options", "nosniff")
+	rw.WriteHeader(details.Status)
+	_ = json.NewEncoder(rw).Encode(details)
+}
@@ -0,0 +1,37 @@
+package requestid
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/google/uuid"
+)
+
+// Header - HTTP header carrying the request ID.
+const Header = "X-Request-ID"
+
+type contextKey struct{}
+
+// Middleware - Reuse the incoming X-Request-ID or generate one, expose it on the response and the request context.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(Header)
+		if id == "" || len(id) > 128 {
+			id = uuid.New().String()
+		}
+
+		rw.Header().Set(Header, id)
+		next.ServeHTTP(rw, r.WithContext(NewContext(r.Context(), id)))
+	})
+}
+
+// NewContext - Context carrying the request ID.
+func NewContext(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, contextKey{}, id)
+}
+
+// FromContext - Request ID carried by ctx, empty if none.
+func FromContext(ctx context.Context) string {
+	id, _ := ctx.Value(contextKey{}).(string)
+	return id
+}
@@ -0,0 +1,35 @@
+package restapi
+
+import (
+	"log"
+	"net/http"
+
+	"learning/unit-testing/auth"
+	"learning/unit-testing/config"
+	"learning/unit-testing/models"
+
+	"github.com/go-openapi/errors"
+)
+
+// bearerAuth - Authenticator of the API's bearer tokens, JWTs signed by the configured issuer for the configured
+// audience. The principal is the subject of the token. The configuration requires all of them or none, without
+// them no token can be verified, so every request is rejected.
+func bearerAuth(cfg config.AuthConfig) func(token string) (*models.Principal, error) {
+
+	if cfg.JWKSURL == "" {
+		log.Printf("auth is not configured, every bearer token will be rejected")
+		return func(token string) (*models.Principal, error) {
+			return nil, errors.New(http.StatusUnauthorized, "bearer tokens cannot be verified")
+		}
+	}
+
+	verifier := auth.NewVerifier(cfg.Issuer, cfg.Audience, auth.NewJWKS(cfg.JWKSURL, nil))
+
+	return func(token string) (*models.Principal, error) {
+		claims, err := verifier.Verify(token)
+		if err != nil {
+			return nil, errors.New(http.StatusUnauthorized, "invalid bearer token: %s", err.Error())
+		}
+		return &models.Principal{UserID: claims.Subject}, nil
+	}
+}
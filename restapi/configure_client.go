@@ -1,12 +1,80 @@
 package restapi
 
 import (
+	"context"
+	"learning/unit-testing/config"
 	"learning/unit-testing/controllers"
+	"learning/unit-testing/health"
+	"learning/unit-testing/mergepatch"
+	"learning/unit-testing/metrics"
+	"learning/unit-testing/requestid"
+	"learning/unit-testing/tracing"
+	"log"
 	"net/http"
+
+	"github.com/go-openapi/runtime"
+	"github.com/go-openapi/swag"
 )
 
+// configFlags - Configuration overrides given on the server command line.
+var configFlags config.Flags
+
+func configureFlags(api *operations.ClientAPI) {
+	api.CommandLineOptionsGroups = []swag.CommandLineOptionsGroup{
+		{
+			ShortDescription: "Service configuration",
+			LongDescription:  "Overrides of the configuration file and CONNECTIONS_* environment variables",
+			Options:          &configFlags,
+		},
+	}
+}
+
 func configureAPI(api *operations.ClientAPI) http.Handler {
 
+	cfg, err := config.Load(configFlags, nil)
+	if err != nil {
+		log.Fatalf("failed to load configuration (%s)", err.Error())
+	}
+	config.Set(cfg)
+
+	shutdownTracing, err := tracing.Init(context.Background(), tracing.Options{
+		ServiceName: "connections-groups",
+		Exporter:    cfg.Tracing.Exporter,
+		Endpoint:    cfg.Tracing.OTLPEndpoint,
+		Insecure:    cfg.Tracing.OTLPInsecure,
+	})
+	if err != nil {
+		log.Fatalf("failed to initialize tracing (%s)", err.Error())
+	}
+
+	pictureWorkers := startPictureWorkers(cfg.Pictures)
+	trashPurger := startTrashPurger(cfg.Trash)
+	eventDispatcher := startEventDispatcher(cfg.Events)
+	webhookWorkers := startWebhookWorkers(cfg.Webhooks)
+
+	api.ServerShutdown = func() {
+		if pictureWorkers != nil {
+			pictureWorkers.Stop()
+		}
+		if trashPurger != nil {
+			trashPurger.Stop()
+		}
+		if eventDispatcher != nil {
+			eventDispatcher.Stop()
+		}
+		if webhookWorkers != nil {
+			webhookWorkers.Stop()
+		}
+		if err := shutdownTracing(context.Background()); err != nil {
+			log.Printf("failed to flush traces (%s)", err.Error())
+		}
+	}
+
+	api.BearerAuth = bearerAuth(cfg.Auth)
+
+	// Group PATCH bodies are JSON Merge Patch documents.
+	api.RegisterConsumer(mergepatch.ContentType, runtime.JSONConsumer())
+
 	api.ConnectionsUsersConnectionsGroupsByUserIDAndGroupIDDeleteHandler = connections.UsersConnectionsGroupsByUserIDAndGroupIDDeleteHandlerFunc(controllers.UsersConnectionsGroupsByUserIDAndGroupIDDeleteController)
 
 	api.ConnectionsUsersConnectionsGroupsByUserIDAndGroupIDGetHandler = connections.UsersConnectionsGroupsByUserIDAndGroupIDGetHandlerFunc(controllers.UsersConnectionsGroupsByUserIDAndGroupIDGetController)
@@ -18,17 +86,104 @@ func configureAPI(api *operations.ClientAPI) http.Handler {
 	// Create a User's Connection Group.
 	api.ConnectionsUsersConnectionsGroupsByUserIDPostHandler = connections.UsersConnectionsGroupsByUserIDPostHandlerFunc(controllers.CreateConnectionsGroupsByUserIDController)
 
-	return setupGlobalMiddleware(api.Serve(setupMiddlewares))
+	return setupGlobalMiddleware(withRoutes(api, api.Serve(setupMiddlewares)))
+}
+
+// startPictureWorkers - Start reducing queued group pictures in the background.
+// Jobs are persisted, so an instance that cannot start its workers leaves them to the others.
+func startPictureWorkers(cfg config.PictureQueue) *controllers.PictureWorkerPool {
+	if cfg.Workers == 0 {
+		return nil
+	}
+
+	ctlr, err := controllers.GetController()
+	if err != nil {
+		log.Printf("failed to start picture workers (%s)", err.Error())
+		return nil
+	}
+
+	pool := controllers.NewPictureWorkerPool(ctlr, cfg)
+	pool.Start()
+	return pool
+}
+
+// startTrashPurger - Purge the groups deleted longer than the retention period ago.
+// Purging is idempotent, every instance may run it.
+func startTrashPurger(cfg config.TrashConfig) *controllers.TrashPurger {
+	if cfg.PurgeInterval == 0 {
+		return nil
+	}
+
+	ctlr, err := controllers.GetController()
+	if err != nil {
+		log.Printf("failed to start trash purger (%s)", err.Error())
+		return nil
+	}
+
+	purger := controllers.NewTrashPurger(ctlr, cfg)
+	purger.Start()
+	return purger
+}
+
+// startEventDispatcher - Publish the domain events of the outbox to the configured sinks.
+// Events are persisted, so an instance without sinks or that cannot start dispatching leaves them to the others.
+func startEventDispatcher(cfg config.EventsConfig) *controllers.EventDispatcher {
+	if len(cfg.Sinks) == 0 {
+		return nil
+	}
+
+	ctlr, err := controllers.GetController()
+	if err != nil {
+		log.Printf("failed to start event dispatcher (%s)", err.Error())
+		return nil
+	}
+
+	sinks, err := controllers.NewEventSinks(ctlr, cfg)
+	if err != nil {
+		log.Printf("failed to open event sinks (%s)", err.Error())
+		return nil
+	}
+
+	dispatcher := controllers.NewEventDispatcher(ctlr, cfg, sinks)
+	dispatcher.Start()
+	return dispatcher
+}
+
+// startWebhookWorkers - Deliver the queued webhooks. Deliveries are persisted, so an instance without workers or
+// that cannot start them leaves them to the others.
+func startWebhookWorkers(cfg config.WebhooksConfig) *controllers.WebhookWorkerPool {
+	if cfg.Workers == 0 {
+		return nil
+	}
+
+	ctlr, err := controllers.GetController()
+	if err != nil {
+		log.Printf("failed to start webhook workers (%s)", err.Error())
+		return nil
+	}
+
+	workers := controllers.NewWebhookWorkerPool(ctlr, cfg)
+	workers.Start()
+	return workers
 }
 
 // The middleware configuration is for the handler executors. These do not apply to the swagger.json document.
 // The middleware executes after routing but before authentication, binding and validation
 func setupMiddlewares(handler http.Handler) http.Handler {
-	return handler
+	return tracing.NameOperation(metrics.InstrumentOperations(mergepatch.Middleware(handler)))
 }
 
 // The middleware configuration happens before anything, this middleware also applies to serving the swagger.json document.
 // So this is a good place to plug in a panic handling middleware, logging and metrics
 func setupGlobalMiddleware(handler http.Handler) http.Handler {
-	return handler
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", metrics.Handler())
+
+	checker := health.NewChecker(health.DefaultTimeout)
+	checker.Register("storage", storageCheck())
+	mux.Handle("/healthz", health.LivenessHandler())
+	mux.Handle("/readyz", checker.ReadinessHandler())
+	mux.Handle("/", handler)
+
+	return tracing.Middleware(requestid.Middleware(recoverPanics(mux)))
 }
@@ -0,0 +1,34 @@
+package restapi
+
+import (
+	"context"
+	"sync"
+
+	"learning/unit-testing/controllers"
+	"learning/unit-testing/database"
+	"learning/unit-testing/health"
+)
+
+// storageCheck - Readiness check pinging the configured storage.
+// The storage is created on the first probe and kept once the connection succeeds.
+func storageCheck() health.CheckFunc {
+
+	var mx sync.Mutex
+	var storage database.Storage
+
+	return func(ctx context.Context) error {
+		mx.Lock()
+		if storage == nil {
+			ctlr, err := controllers.GetController()
+			if err != nil {
+				mx.Unlock()
+				return err
+			}
+			storage = ctlr.DB
+		}
+		s := storage
+		mx.Unlock()
+
+		return s.Ping(ctx)
+	}
+}
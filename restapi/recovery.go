@@ -0,0 +1,88 @@
+package restapi
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"runtime/debug"
+
+	"learning/unit-testing/metrics"
+	"learning/unit-testing/problem"
+	"learning/unit-testing/requestid"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// responseTracker - Records whether the wrapped handler has started its response.
+type responseTracker struct {
+	http.ResponseWriter
+	started bool
+}
+
+func (w *responseTracker) WriteHeader(code int) {
+	// Informational responses leave the final status to be written.
+	if code >= http.StatusOK {
+		w.started = true
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *responseTracker) Write(b []byte) (int, error) {
+	w.started = true
+	return w.ResponseWriter.Write(b)
+}
+
+// FlushError - Flush the underlying writer, which sends the headers when not yet sent.
+func (w *responseTracker) FlushError() error {
+	w.started = true
+	return http.NewResponseController(w.ResponseWriter).Flush()
+}
+
+// Unwrap - Underlying writer, letting http.ResponseController reach its other features.
+func (w *responseTracker) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// recoverPanics - Convert a panic raised while serving a request into a logged and traced problem+json 500.
+// A panic raised once the response has started aborts the connection instead, as a problem written after
+// part of the response would corrupt it.
+func recoverPanics(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		tracker := &responseTracker{ResponseWriter: rw}
+
+		defer func() {
+			rec := recover()
+			if rec == nil {
+				return
+			}
+			// Let net/http abort the connection as it would without this middleware.
+			if rec == http.ErrAbortHandler {
+				panic(rec)
+			}
+
+			stack := string(debug.Stack())
+			id := requestid.FromContext(r.Context())
+
+			log.Printf("panic serving %s %s (request_id=%s): %v\n%s", r.Method, r.URL.Path, id, rec, stack)
+
+			span := trace.SpanFromContext(r.Context())
+			span.RecordError(fmt.Errorf("panic: %v", rec), trace.WithAttributes(attribute.String("exception.stacktrace", stack)))
+			span.SetStatus(codes.Error, "panic")
+
+			metrics.PanicsTotal.Inc()
+
+			if tracker.started {
+				panic(http.ErrAbortHandler)
+			}
+
+			details := problem.New(http.StatusInternalServerError, "The server encountered an unexpected condition.")
+			details.Instance = r.URL.Path
+			details.RequestID = id
+			problem.Write(rw, details)
+		}()
+
+		next.ServeHTTP(tracker, r)
+	})
+}
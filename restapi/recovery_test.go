@@ -0,0 +1,191 @@
+package restapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"learning/unit-testing/controllers"
+	"learning/unit-testing/database"
+	"learning/unit-testing/internal"
+	"learning/unit-testing/models"
+	"learning/unit-testing/problem"
+	"learning/unit-testing/requestid"
+	"learning/unit-testing/restapi/operations/connections"
+)
+
+// panickingStorage - Storage whose lookups panic with value. Methods not overridden panic on the nil embedded Storage.
+type panickingStorage struct {
+	database.Storage
+	value interface{}
+}
+
+func (p panickingStorage) GetUserConnectionGroupByName(userID, groupName string) (internal.UserConnectionGroupInfo, error) {
+	panic(p.value)
+}
+
+func (p panickingStorage) GetUserConnectionGroupByGroupID(userID, groupID string) (internal.UserConnectionGroupInfo, error) {
+	panic(p.value)
+}
+
+func (p panickingStorage) GetPaginatedUserConnectionGroup(params connections.UsersConnectionsGroupsByUserIDGetParams) ([]*models.Group, *models.PaginationData, error) {
+	var groups []*models.Group
+	// Out of range access, as a broken backend would do.
+	_ = groups[len(groups)]
+	return nil, nil, nil
+}
+
+type TestCaseRecoverPanic struct {
+	name    string
+	handler http.HandlerFunc
+}
+
+func TestRecoverPanics(t *testing.T) {
+
+	groupName := "Panic Group"
+
+	testCases := []TestCaseRecoverPanic{
+		{
+			name: "PanicOnCreate",
+			handler: func(rw http.ResponseWriter, r *http.Request) {
+				ctlr := controllers.Ctlr{DB: panickingStorage{value: "storage exploded"}}
+				ctlr.CreateConnectionsGroupsByUserID(connections.UsersConnectionsGroupsByUserIDPostParams{
+					HTTPRequest: r,
+					UserID:      "dc9dbe3e-60d5-4a07-8c9c-42027b555b01",
+					Body:        &models.UsersConnectionsGroupsPostRequest{GroupName: &groupName},
+				}, &models.Principal{})
+			},
+		},
+		{
+			name: "PanicWithErrorOnGet",
+			handler: func(rw http.ResponseWriter, r *http.Request) {
+				ctlr := controllers.Ctlr{DB: panickingStorage{value: http.ErrNoLocation}}
+				ctlr.GetUsersConnectionsGroupsByUserIDAndGroupID(connections.UsersConnectionsGroupsByUserIDAndGroupIDGetParams{
+					HTTPRequest: r,
+					UserID:      "dc9dbe3e-60d5-4a07-8c9c-42027b555b01",
+					GroupID:     "group_id_1",
+				}, &models.Principal{})
+			},
+		},
+		{
+			name: "OutOfRangeOnList",
+			handler: func(rw http.ResponseWriter, r *http.Request) {
+				ctlr := controllers.Ctlr{DB: panickingStorage{}}
+				ctlr.GetUsersConnectionsGroupsByUserID(connections.UsersConnectionsGroupsByUserIDGetParams{
+					HTTPRequest: r,
+					UserID:      "dc9dbe3e-60d5-4a07-8c9c-42027b555b01",
+				}, &models.Principal{})
+			},
+		},
+		{
+			name: "NilStorageOnDelete",
+			handler: func(rw http.ResponseWriter, r *http.Request) {
+				ctlr := controllers.Ctlr{DB: panickingStorage{}}
+				ctlr.DeleteUsersConnectionsGroupsByUserIDAndGroupID(connections.UsersConnectionsGroupsByUserIDAndGroupIDDeleteParams{
+					HTTPRequest: r,
+					UserID:      "dc9dbe3e-60d5-4a07-8c9c-42027b555b01",
+					GroupID:     "group_id_1",
+				}, &models.Principal{})
+			},
+		},
+	}
+
+	for _, test := range testCases {
+
+		t.Run(test.name, func(t *testing.T) {
+			handler := requestid.Middleware(recoverPanics(test.handler))
+
+			req := httptest.NewRequest(http.MethodGet, "/users/dc9dbe3e-60d5-4a07-8c9c-42027b555b01/connections/groups", nil)
+			req.Header.Set(requestid.Header, "test-request-id")
+			rec := httptest.NewRecorder()
+
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != http.StatusInternalServerError {
+				t.Fatalf("status %d != %d", rec.Code, http.StatusInternalServerError)
+			}
+			if ct := rec.Header().Get("Content-Type"); ct != problem.ContentType {
+				t.Fatalf("content type %s != %s", ct, problem.ContentType)
+			}
+
+			var details problem.Details
+			if err := json.NewDecoder(rec.Body).Decode(&details); err != nil {
+				t.Fatalf("failed to decode problem: %s", err.Error())
+			}
+			if details.Status != http.StatusInternalServerError || details.RequestID != "test-request-id" {
+				t.Fatalf("unexpected problem: %+v", details)
+			}
+			if strings.Contains(details.Detail, "storage exploded") {
+				t.Fatalf("panic value leaked to client: %+v", details)
+			}
+		})
+	}
+}
+
+func TestRecoverPanicsPassesThrough(t *testing.T) {
+
+	handler := recoverPanics(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		rw.WriteHeader(http.StatusNoContent)
+	}))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodDelete, "/", nil))
+
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("status %d != %d", rec.Code, http.StatusNoContent)
+	}
+}
+
+type TestCaseRecoverPanicAfterResponse struct {
+	name    string
+	handler http.HandlerFunc
+}
+
+func TestRecoverPanicsAfterResponseStarted(t *testing.T) {
+
+	testCases := []TestCaseRecoverPanicAfterResponse{
+		{
+			name: "AfterWriteHeader",
+			handler: func(rw http.ResponseWriter, r *http.Request) {
+				rw.WriteHeader(http.StatusOK)
+				panic("storage exploded")
+			},
+		},
+		{
+			name: "AfterPartialBody",
+			handler: func(rw http.ResponseWriter, r *http.Request) {
+				rw.Write([]byte(`{"groups": [`))
+				panic("storage exploded")
+			},
+		},
+		{
+			name: "AfterFlush",
+			handler: func(rw http.ResponseWriter, r *http.Request) {
+				rw.Header().Set("Content-Type", "text/event-stream")
+				http.NewResponseController(rw).Flush()
+				panic("storage exploded")
+			},
+		},
+	}
+
+	for _, test := range testCases {
+
+		t.Run(test.name, func(t *testing.T) {
+			handler := recoverPanics(test.handler)
+			rec := httptest.NewRecorder()
+
+			defer func() {
+				if recovered := recover(); recovered != http.ErrAbortHandler {
+					t.Fatalf("recovered %v, expected the connection to be aborted", recovered)
+				}
+				if rec.Header().Get("Content-Type") == problem.ContentType || strings.Contains(rec.Body.String(), "status") {
+					t.Fatalf("problem written after the response started: %q", rec.Body.String())
+				}
+			}()
+
+			handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+		})
+	}
+}
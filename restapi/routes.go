@@ -0,0 +1,113 @@
+package restapi
+
+import (
+	"mime"
+	"net/http"
+	"strings"
+
+	"learning/unit-testing/controllers"
+	"learning/unit-testing/jsonpatch"
+	"learning/unit-testing/metrics"
+	"learning/unit-testing/models"
+	"learning/unit-testing/problem"
+	"learning/unit-testing/tracing"
+)
+
+// principalHandler - Handler of a route served outside the go-swagger API, called with the authenticated principal.
+type principalHandler func(rw http.ResponseWriter, r *http.Request, principal *models.Principal)
+
+// Routes served outside the go-swagger API.
+const (
+	groupPath             = "/users/{userID}/connections/groups/{groupID}"
+	groupPicturePath      = groupPath + "/picture"
+	groupHistoryPath      = groupPath + "/history"
+	groupInteractionsPath = groupPath + "/interactions"
+	groupEventsPath       = "/users/{userID}/connections/groups/events"
+	groupSyncPath         = "/users/{userID}/connections/groups/sync"
+	trashPath             = "/users/{userID}/connections/trash/groups"
+	trashedGroupPath      = trashPath + "/{groupID}"
+	webhooksPath          = "/users/{userID}/connections/webhooks"
+	webhookPath           = webhooksPath + "/{subscriptionID}"
+)
+
+// withRoutes - Serve the routes go-swagger cannot describe (binary uploads and downloads, JSON Patch documents)
+// the trash of deleted groups, the group history, the webhook subscriptions, the stream of group changes and the
+// delta sync of groups before falling back to the API.
+func withRoutes(api *operations.ClientAPI, apiHandler http.Handler) http.Handler {
+
+	mux := http.NewServeMux()
+
+	instrumented := func(operation string, handler principalHandler) http.Handler {
+		return tracing.NameRoute(operation, metrics.InstrumentHandler(operation, authenticated(api, handler)))
+	}
+	route := func(method string, path string, operation string, handler principalHandler) {
+		mux.Handle(method+" "+path, instrumented(operation, handler))
+	}
+
+	route(http.MethodPut, groupPicturePath, "UsersConnectionsGroupsPictureByUserIDAndGroupIDPut", controllers.GroupPicturePutController)
+	route(http.MethodGet, groupPicturePath, "UsersConnectionsGroupsPictureByUserIDAndGroupIDGet", controllers.GroupPictureGetController)
+	route(http.MethodDelete, groupPicturePath, "UsersConnectionsGroupsPictureByUserIDAndGroupIDDelete", controllers.GroupPictureDeleteController)
+
+	route(http.MethodGet, trashPath, "UsersConnectionsTrashGroupsByUserIDGet", controllers.TrashedGroupsGetController)
+	route(http.MethodPost, trashedGroupPath+"/restore", "UsersConnectionsTrashGroupsRestoreByUserIDAndGroupIDPost", controllers.TrashedGroupRestoreController)
+	route(http.MethodDelete, trashedGroupPath, "UsersConnectionsTrashGroupsByUserIDAndGroupIDDelete", controllers.TrashedGroupPurgeController)
+
+	route(http.MethodGet, groupHistoryPath, "UsersConnectionsGroupsHistoryByUserIDAndGroupIDGet", controllers.GroupHistoryGetController)
+	route(http.MethodPost, groupHistoryPath+"/{entryID}/revert", "UsersConnectionsGroupsHistoryRevertByUserIDAndGroupIDPost", controllers.GroupHistoryRevertController)
+
+	route(http.MethodPost, groupInteractionsPath, "UsersConnectionsGroupsInteractionsByUserIDAndGroupIDPost", controllers.GroupInteractionPostController)
+
+	route(http.MethodGet, groupEventsPath, "UsersConnectionsGroupsEventsByUserIDGet", controllers.GroupChangesStreamController)
+	route(http.MethodGet, groupSyncPath, "UsersConnectionsGroupsSyncByUserIDGet", controllers.GroupSyncGetController)
+
+	route(http.MethodGet, webhooksPath, "UsersConnectionsWebhooksByUserIDGet", controllers.WebhooksGetController)
+	route(http.MethodPost, webhooksPath, "UsersConnectionsWebhooksByUserIDPost", controllers.WebhooksPostController)
+	route(http.MethodGet, webhookPath, "UsersConnectionsWebhooksByUserIDAndSubscriptionIDGet", controllers.WebhookGetController)
+	route(http.MethodDelete, webhookPath, "UsersConnectionsWebhooksByUserIDAndSubscriptionIDDelete", controllers.WebhookDeleteController)
+	route(http.MethodGet, webhookPath+"/deliveries", "UsersConnectionsWebhooksDeliveriesByUserIDAndSubscriptionIDGet", controllers.WebhookDeliveriesGetController)
+	route(http.MethodGet, webhookPath+"/dead-letters", "UsersConnectionsWebhooksDeadLettersByUserIDAndSubscriptionIDGet", controllers.WebhookDeadLettersGetController)
+	route(http.MethodPost, webhookPath+"/deliveries/{deliveryID}/redeliver", "UsersConnectionsWebhooksDeliveriesRedeliverByUserIDAndSubscriptionIDPost", controllers.WebhookRedeliverController)
+
+	// Other group PATCH bodies are merge patches handled by the API.
+	jsonPatch := instrumented("UsersConnectionsGroupsByUserIDAndGroupIDJSONPatch", controllers.GroupJSONPatchController)
+	mux.Handle(http.MethodPatch+" "+groupPath, http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType == jsonpatch.ContentType {
+			jsonPatch.ServeHTTP(rw, r)
+			return
+		}
+		apiHandler.ServeHTTP(rw, r)
+	}))
+
+	mux.Handle("/", apiHandler)
+
+	return mux
+}
+
+// authenticated - Authenticate the bearer token with the API's authenticator and check its principal is the user
+// of the route before calling next.
+func authenticated(api *operations.ClientAPI, next principalHandler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+
+		authorization := r.Header.Get("Authorization")
+		token := strings.TrimSpace(strings.TrimPrefix(authorization, "Bearer "))
+		if !strings.HasPrefix(authorization, "Bearer ") || token == "" {
+			rw.Header().Set("WWW-Authenticate", "Bearer")
+			problem.Write(rw, problem.New(http.StatusUnauthorized, "missing bearer token"))
+			return
+		}
+
+		principal, err := api.BearerAuth(token)
+		if err != nil || principal == nil {
+			rw.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+			problem.Write(rw, problem.New(http.StatusUnauthorized, "invalid bearer token"))
+			return
+		}
+
+		if err := controllers.AuthorizeUser(principal, r.PathValue("userID")); err != nil {
+			problem.Write(rw, problem.New(http.StatusForbidden, err.Error()))
+			return
+		}
+
+		next(rw, r, principal)
+	})
+}
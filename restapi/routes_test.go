@@ -0,0 +1,95 @@
+package restapi
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"learning/unit-testing/models"
+	"learning/unit-testing/restapi/operations"
+)
+
+type TestCaseAuthenticated struct {
+	name           string
+	authorization  string
+	path           string
+	expectedStatus int
+}
+
+func TestAuthenticated(t *testing.T) {
+
+	tokens := map[string]string{
+		"token_1": "dc9dbe3e-60d5-4a07-8c9c-42027b555b01",
+		"token_2": "dc9dbe3e-60d5-4a07-8c9c-42027b555b02",
+	}
+	api := &operations.ClientAPI{BearerAuth: func(token string) (*models.Principal, error) {
+		userID, ok := tokens[token]
+		if !ok {
+			return nil, errors.New("unknown token")
+		}
+		return &models.Principal{UserID: userID}, nil
+	}}
+
+	mux := http.NewServeMux()
+	for _, path := range []string{groupPicturePath, groupHistoryPath, groupEventsPath, webhooksPath} {
+		mux.Handle(http.MethodGet+" "+path, authenticated(api, func(rw http.ResponseWriter, r *http.Request, principal *models.Principal) {
+			rw.WriteHeader(http.StatusNoContent)
+		}))
+	}
+
+	testCases := []TestCaseAuthenticated{
+		{
+			name:           "OwnResources",
+			authorization:  "Bearer token_1",
+			path:           "/users/dc9dbe3e-60d5-4a07-8c9c-42027b555b01/connections/groups/group_id_1/history",
+			expectedStatus: http.StatusNoContent,
+		},
+		{
+			name:           "OtherUsersPicture",
+			authorization:  "Bearer token_2",
+			path:           "/users/dc9dbe3e-60d5-4a07-8c9c-42027b555b01/connections/groups/group_id_1/picture",
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:           "OtherUsersEvents",
+			authorization:  "Bearer token_2",
+			path:           "/users/dc9dbe3e-60d5-4a07-8c9c-42027b555b01/connections/groups/events",
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:           "OtherUsersWebhooks",
+			authorization:  "Bearer token_1",
+			path:           "/users/dc9dbe3e-60d5-4a07-8c9c-42027b555b02/connections/webhooks",
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:           "InvalidToken",
+			authorization:  "Bearer token_3",
+			path:           "/users/dc9dbe3e-60d5-4a07-8c9c-42027b555b01/connections/webhooks",
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "MissingToken",
+			path:           "/users/dc9dbe3e-60d5-4a07-8c9c-42027b555b01/connections/webhooks",
+			expectedStatus: http.StatusUnauthorized,
+		},
+	}
+
+	for _, test := range testCases {
+
+		t.Run(test.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, test.path, nil)
+			if test.authorization != "" {
+				req.Header.Set("Authorization", test.authorization)
+			}
+			rec := httptest.NewRecorder()
+
+			mux.ServeHTTP(rec, req)
+
+			if rec.Code != test.expectedStatus {
+				t.Fatalf("status %d != %d", rec.Code, test.expectedStatus)
+			}
+		})
+	}
+}
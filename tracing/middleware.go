@@ -0,0 +1,37 @@
+package tracing
+
+import (
+	"net/http"
+
+	"github.com/go-openapi/runtime/middleware"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Middleware - Start a server span for every request, continuing any incoming W3C trace context.
+func Middleware(next http.Handler) http.Handler {
+	return otelhttp.NewHandler(next, "http.server",
+		otelhttp.WithSpanNameFormatter(func(_ string, r *http.Request) string {
+			return r.Method + " " + r.URL.Path
+		}),
+	)
+}
+
+// NameRoute - Rename the server span after a route served outside the go-swagger API.
+func NameRoute(name string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		trace.SpanFromContext(r.Context()).SetName(name)
+		next.ServeHTTP(rw, r)
+	})
+}
+
+// NameOperation - Rename the server span after the matched go-swagger operation.
+// It must run after routing so that the matched route is available on the request.
+func NameOperation(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		if route := middleware.MatchedRouteFrom(r); route != nil && route.Operation != nil {
+			trace.SpanFromContext(r.Context()).SetName(route.Operation.ID)
+		}
+		next.ServeHTTP(rw, r)
+	})
+}